@@ -0,0 +1,56 @@
+package torrent
+
+import (
+	g "github.com/anacrolix/generics"
+)
+
+// Per-torrent values for tracker announces, in place of those the Client would choose.
+type AnnounceOverrides struct {
+	// The number of peers to ask for while the torrent wants peers. Nothing is asked for otherwise.
+	NumWant g.Option[int32]
+	// The port to announce, for when peers reach us on a different port than we listen on, such as
+	// through a port forward.
+	Port g.Option[uint16]
+	// Replaces ClientConfig.AnnounceKey for this torrent.
+	Key g.Option[int32]
+}
+
+// Sets the announce values that override the Client's for this torrent. They're used from the
+// next announce to each tracker.
+func (t *Torrent) SetAnnounceOverrides(ao AnnounceOverrides) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	t.announceOverrides = ao
+}
+
+func (t *Torrent) AnnounceOverrides() AnnounceOverrides {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.announceOverrides
+}
+
+func (t *Torrent) announceNumWant() int32 {
+	if !t.wantPeers() || len(t.cl.dialers) == 0 {
+		return 0
+	}
+	if t.announceOverrides.NumWant.Ok {
+		return t.announceOverrides.NumWant.Value
+	}
+	// Windozer has UDP packet limit. See:
+	// https://github.com/anacrolix/torrent/issues/764
+	return 200
+}
+
+func (t *Torrent) announcePort() uint16 {
+	if t.announceOverrides.Port.Ok {
+		return t.announceOverrides.Port.Value
+	}
+	return uint16(t.cl.incomingPeerPort())
+}
+
+func (t *Torrent) announceKey() int32 {
+	if t.announceOverrides.Key.Ok {
+		return t.announceOverrides.Key.Value
+	}
+	return t.cl.announceKey()
+}
@@ -0,0 +1,45 @@
+package torrent
+
+import (
+	"testing"
+
+	g "github.com/anacrolix/generics"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/tracker"
+)
+
+func TestAnnounceOverrides(t *testing.T) {
+	c := qt.New(t)
+	// NumWant is only sent if the Client has dialers to reach the peers.
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, _, err := cl.AddTorrentSpec(&TorrentSpec{
+		InfoHash: [20]byte{1},
+		AnnounceOverrides: AnnounceOverrides{
+			NumWant: g.Some[int32](50),
+			Port:    g.Some[uint16](1234),
+			Key:     g.Some[int32](7),
+		},
+	})
+	c.Assert(err, qt.IsNil)
+	req := func() tracker.AnnounceRequest {
+		cl.lock()
+		defer cl.unlock()
+		c.Assert(tt.wantPeers(), qt.IsTrue)
+		return tt.announceRequest(tracker.None, *tt.canonicalShortInfohash())
+	}
+	r := req()
+	c.Check(r.NumWant, qt.Equals, int32(50))
+	c.Check(r.Port, qt.Equals, uint16(1234))
+	c.Check(r.Key, qt.Equals, int32(7))
+	// Merging a spec without overrides leaves them in place.
+	c.Assert(tt.MergeSpec(&TorrentSpec{}), qt.IsNil)
+	c.Check(tt.AnnounceOverrides().Port, qt.Equals, g.Some[uint16](1234))
+	tt.SetAnnounceOverrides(AnnounceOverrides{})
+	r = req()
+	c.Check(r.NumWant, qt.Equals, int32(200))
+	c.Check(int(r.Port), qt.Equals, cl.incomingPeerPort())
+	c.Check(r.Key, qt.Equals, cl.announceKey())
+}
@@ -0,0 +1,80 @@
+package torrent
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/tracker"
+)
+
+func TestAnonymousModeExtendedHandshake(t *testing.T) {
+	c := qt.New(t)
+	for _, anonymous := range []bool{false, true} {
+		cfg := TestingConfig(t)
+		cfg.AnonymousMode = anonymous
+		cfg.PublicIp4 = net.IPv4(1, 2, 3, 4)
+		cl, err := NewClient(cfg)
+		c.Assert(err, qt.IsNil)
+		defer cl.Close()
+		pc := cl.newConnection(nil, newConnectionOpts{
+			network:    "test",
+			remoteAddr: &net.TCPAddr{IP: net.IPv4(5, 6, 7, 8), Port: 1},
+		})
+		pc.setTorrent(cl.newTorrentForTesting())
+		pc.addBuiltinLtepProtocols(true)
+		cl.lock()
+		msg := pc.extendedHandshakeMessage()
+		cl.unlock()
+		c.Check(msg.V == "", qt.Equals, anonymous)
+		c.Check(msg.YourIp == nil, qt.Equals, anonymous)
+		c.Check(msg.Port == 0, qt.Equals, anonymous)
+		c.Check(msg.Ipv4 == nil, qt.Equals, anonymous)
+		c.Check(msg.M, qt.Not(qt.HasLen), 0)
+	}
+}
+
+func TestAnonymousModeHttpUserAgent(t *testing.T) {
+	c := qt.New(t)
+	var mu sync.Mutex
+	var userAgents []string
+	requests := 0
+	s := newGreetingWebseedServer(t, func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		requests++
+		userAgents = append(userAgents, r.Header.Values("User-Agent")...)
+		mu.Unlock()
+		if r.URL.Path != "/announce" {
+			return false
+		}
+		w.Write([]byte("d8:intervali1800e5:peers0:e"))
+		return true
+	})
+	cfg := TestingConfig(t)
+	cfg.AnonymousMode = true
+	cfg.DisableTrackers = true
+	cfg.HTTPUserAgent = "identifying"
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt := downloadGreetingFromWebseed(c, cl, s.URL+"/greeting")
+	u, err := url.Parse(s.URL + "/announce")
+	c.Assert(err, qt.IsNil)
+	ts := &trackerScraper{
+		shortInfohash: *tt.canonicalShortInfohash(),
+		u:             *u,
+		t:             tt,
+	}
+	ar := ts.announce(context.Background(), tracker.Started)
+	c.Assert(ar.Err, qt.IsNil)
+	mu.Lock()
+	defer mu.Unlock()
+	// The webseed and the tracker.
+	c.Check(requests >= 2, qt.IsTrue)
+	c.Check(userAgents, qt.HasLen, 0)
+}
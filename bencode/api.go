@@ -43,16 +43,23 @@ func (e *UnmarshalInvalidArgError) Error() string {
 type UnmarshalTypeError struct {
 	BencodeTypeName     string
 	UnmarshalTargetType reflect.Type
+	// The dict keys and list indexes leading to the value, like "info.files[3].length". Empty for
+	// the top-level value.
+	Path string
 }
 
 // This could probably be a value type, but we may already have users assuming
 // that it's passed by pointer.
 func (e *UnmarshalTypeError) Error() string {
-	return fmt.Sprintf(
+	s := fmt.Sprintf(
 		"can't unmarshal a bencode %v into a %v",
 		e.BencodeTypeName,
 		e.UnmarshalTargetType,
 	)
+	if e.Path != "" {
+		s += " at " + e.Path
+	}
+	return s
 }
 
 // Unmarshaler tried to write to an unexported (therefore unwritable) field.
@@ -71,9 +78,15 @@ func (e *UnmarshalFieldError) Error() string {
 type SyntaxError struct {
 	Offset int64 // location of the error
 	What   error // error description
+	// The dict keys and list indexes leading to the value, like "info.files[3].length". Empty for
+	// the top-level value.
+	Path string
 }
 
 func (e *SyntaxError) Error() string {
+	if e.Path != "" {
+		return fmt.Sprintf("bencode: syntax error (offset: %d, path: %s): %s", e.Offset, e.Path, e.What)
+	}
 	return fmt.Sprintf("bencode: syntax error (offset: %d): %s", e.Offset, e.What)
 }
 
@@ -99,6 +112,10 @@ func (e *UnmarshalerError) Error() string {
 	return "bencode: error calling UnmarshalBencode for type " + e.Type.String() + ": " + e.Err.Error()
 }
 
+func (e *UnmarshalerError) Unwrap() error {
+	return e.Err
+}
+
 //----------------------------------------------------------------------------
 // Interfaces
 //----------------------------------------------------------------------------
@@ -29,9 +29,16 @@ type Decoder struct {
 	// Sum of bytes used to Decode values.
 	Offset int64
 	buf    bytes.Buffer
+	// Dict keys and list indexes leading to the value being decoded. See decodePath.
+	path decodePath
 }
 
 func (d *Decoder) Decode(v interface{}) (err error) {
+	defer func() {
+		// This runs after the panic recovery below has set err.
+		d.path.annotateError(err)
+		d.path = d.path[:0]
+	}()
 	defer func() {
 		if err != nil {
 			return
@@ -119,9 +126,9 @@ func (d *Decoder) throwSyntaxError(offset int64, err error) {
 
 // Assume the 'i' is already consumed. Read and validate the rest of an int into the buffer.
 func (d *Decoder) readInt() error {
-	// start := d.Offset - 1
+	start := d.Offset - 1
 	d.readUntil('e')
-	if err := d.checkBufferedInt(); err != nil {
+	if err := d.checkBufferedInt(start); err != nil {
 		return err
 	}
 	// if d.buf.Len() == 0 {
@@ -177,7 +184,7 @@ func (d *Decoder) parseInt(v reflect.Value) error {
 	return nil
 }
 
-func (d *Decoder) checkBufferedInt() error {
+func (d *Decoder) checkBufferedInt(offset int64) error {
 	b := d.buf.Bytes()
 	if len(b) <= 1 {
 		return nil
@@ -186,7 +193,10 @@ func (d *Decoder) checkBufferedInt() error {
 		b = b[1:]
 	}
 	if b[0] < '1' || b[0] > '9' {
-		return errors.New("invalid leading digit")
+		return &SyntaxError{
+			Offset: offset,
+			What:   errors.New("invalid leading digit"),
+		}
 	}
 	return nil
 }
@@ -195,7 +205,7 @@ func (d *Decoder) parseStringLength() (int, error) {
 	// We should have already consumed the first byte of the length into the Decoder buf.
 	start := d.Offset - 1
 	d.readUntil(':')
-	if err := d.checkBufferedInt(); err != nil {
+	if err := d.checkBufferedInt(start); err != nil {
 		return 0, err
 	}
 	// Really the limit should be the uint size for the platform. But we can't pass in an allocator,
@@ -400,6 +410,7 @@ func (d *Decoder) parseDict(v reflect.Value) error {
 			return fmt.Errorf("parsing bencode dict into %v: %w", v.Type(), err)
 		}
 
+		d.path.pushKey(keyStr)
 		// now we need to actually parse it
 		if df.Type == nil {
 			// Discard the value, there's nowhere to put it.
@@ -411,6 +422,7 @@ func (d *Decoder) parseDict(v reflect.Value) error {
 			if !ok {
 				return fmt.Errorf("missing value for key %q", keyStr)
 			}
+			d.path.pop()
 			continue
 		}
 		setValue := reflect.New(df.Type).Elem()
@@ -425,6 +437,7 @@ func (d *Decoder) parseDict(v reflect.Value) error {
 		if !ok {
 			return fmt.Errorf("missing value for key %q", keyStr)
 		}
+		d.path.pop()
 		df.Get(v)(setValue)
 	}
 }
@@ -456,20 +469,24 @@ func (d *Decoder) parseList(v reflect.Value) error {
 			v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
 		}
 
+		d.path.pushIndex(i)
 		if i < v.Len() {
 			ok, err := d.parseValue(v.Index(i))
 			if err != nil {
 				return err
 			}
 			if !ok {
+				d.path.pop()
 				break
 			}
 		} else {
 			_, ok := d.parseValueInterface()
 			if !ok {
+				d.path.pop()
 				break
 			}
 		}
+		d.path.pop()
 	}
 
 	if i < v.Len() {
@@ -722,10 +739,12 @@ func (d *Decoder) parseDictInterface() interface{} {
 			d.throwSyntaxError(start, fmt.Errorf("dict keys unsorted: %q <= %q", key, lastKey))
 		}
 		start = d.Offset
+		d.path.pushKey(key)
 		valuei, ok := d.parseValueInterface()
 		if !ok {
 			d.throwSyntaxError(start, fmt.Errorf("dict elem missing value [key=%v]", key))
 		}
+		d.path.pop()
 
 		lastKey = key
 		lastKeyOk = true
@@ -736,12 +755,15 @@ func (d *Decoder) parseDictInterface() interface{} {
 
 func (d *Decoder) parseListInterface() (list []interface{}) {
 	list = []interface{}{}
-	valuei, ok := d.parseValueInterface()
-	for ok {
+	for {
+		d.path.pushIndex(len(list))
+		valuei, ok := d.parseValueInterface()
+		d.path.pop()
+		if !ok {
+			return
+		}
 		list = append(list, valuei)
-		valuei, ok = d.parseValueInterface()
 	}
-	return
 }
 
 func (d *Decoder) getMaxStrLen() int64 {
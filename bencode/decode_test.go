@@ -265,3 +265,49 @@ func TestDecodeStringIntoBoolPtr(t *testing.T) {
 	check("d7:private1:Fe", false, false)
 	check("d7:private11:bunnyfoofooe", false, true)
 }
+
+type pathTestUnmarshaler struct{}
+
+func (pathTestUnmarshaler) UnmarshalBencode(b []byte) error {
+	var v struct {
+		Port int `bencode:"port"`
+	}
+	return Unmarshal(b, &v)
+}
+
+func TestDecodeErrorPath(t *testing.T) {
+	c := qt.New(t)
+	type file struct {
+		Length int64 `bencode:"length"`
+	}
+	var mi struct {
+		Info struct {
+			Files []file `bencode:"files"`
+		} `bencode:"info"`
+		Nodes []pathTestUnmarshaler `bencode:"nodes"`
+	}
+	err := Unmarshal([]byte("d4:infod5:filesld6:lengthi1eed6:length1:xeeee"), &mi)
+	var ute *UnmarshalTypeError
+	c.Assert(err, qt.ErrorAs, &ute)
+	c.Check(ute.Path, qt.Equals, "info.files[1].length")
+	c.Check(ute.Error(), qt.Equals, "can't unmarshal a bencode string into a int64 at info.files[1].length")
+	err = Unmarshal([]byte("d4:infod5:filesld6:lengthi01eeeee"), &mi)
+	var se *SyntaxError
+	c.Assert(err, qt.ErrorAs, &se)
+	c.Check(se.Path, qt.Equals, "info.files[0].length")
+	err = Unmarshal([]byte("d5:nodesld4:porti1eed4:port1:xeee"), &mi)
+	c.Assert(err, qt.ErrorAs, &ute)
+	c.Check(ute.Path, qt.Equals, "nodes[1].port")
+	var v interface{}
+	err = Unmarshal([]byte("d1:ali1ei-0eee"), &v)
+	c.Assert(err, qt.ErrorAs, &se)
+	c.Check(se.Path, qt.Equals, "a[1]")
+	// The path doesn't leak into the next value.
+	d := NewDecoder(bytes.NewReader([]byte("d1:a1:xei01e")))
+	var m map[string]int
+	c.Assert(d.Decode(&m), qt.ErrorAs, &ute)
+	c.Check(ute.Path, qt.Equals, "a")
+	var i int
+	c.Assert(d.Decode(&i), qt.ErrorAs, &se)
+	c.Check(se.Path, qt.Equals, "")
+}
@@ -101,6 +101,9 @@ func (e *Encoder) reflectMarshaler(v reflect.Value) bool {
 var bigIntType = reflect.TypeOf((*big.Int)(nil)).Elem()
 
 func (e *Encoder) reflectValue(v reflect.Value) {
+	if e.reflectStreamingString(v) {
+		return
+	}
 	if e.reflectMarshaler(v) {
 		return
 	}
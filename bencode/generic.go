@@ -0,0 +1,80 @@
+package bencode
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// Unmarshals b into a new value of type T. See Unmarshal.
+func UnmarshalTo[T any](b []byte) (ret T, err error) {
+	err = Unmarshal(b, &ret)
+	return
+}
+
+// Decodes the next value from d into a new value of type T.
+func DecodeTo[T any](d *Decoder) (ret T, err error) {
+	err = d.Decode(&ret)
+	return
+}
+
+// Calls f with each key and undecoded value of the dict in b, in the order they're encoded. Values
+// can be decoded with UnmarshalTo. Iteration stops at the first error, which is returned.
+func IterDict(b []byte, f func(key string, value []byte) error) error {
+	return iterContainer(b, 'd', "dict", func(d *Decoder) error {
+		key, err := DecodeTo[string](d)
+		if err != nil {
+			return fmt.Errorf("decoding dict key: %w", err)
+		}
+		value, err := DecodeTo[Bytes](d)
+		if err != nil {
+			return fmt.Errorf("decoding value for key %q: %w", key, err)
+		}
+		return f(key, value)
+	})
+}
+
+// Calls f with each undecoded item of the list in b. Iteration stops at the first error, which is
+// returned.
+func IterList(b []byte, f func(item []byte) error) error {
+	return iterContainer(b, 'l', "list", func(d *Decoder) error {
+		item, err := DecodeTo[Bytes](d)
+		if err != nil {
+			return err
+		}
+		return f(item)
+	})
+}
+
+func iterContainer(b []byte, open byte, typeName string, each func(*Decoder) error) error {
+	r := bytes.NewReader(b)
+	c, err := r.ReadByte()
+	if err != nil {
+		return io.ErrUnexpectedEOF
+	}
+	if c != open {
+		return &SyntaxError{
+			Offset: 0,
+			What:   fmt.Errorf("expected a %v, got %+q", typeName, c),
+		}
+	}
+	d := Decoder{r: r, Offset: 1}
+	for {
+		c, err = r.ReadByte()
+		if err != nil {
+			return io.ErrUnexpectedEOF
+		}
+		if c == 'e' {
+			break
+		}
+		r.UnreadByte()
+		err = each(&d)
+		if err != nil {
+			return err
+		}
+	}
+	if r.Len() != 0 {
+		return ErrUnusedTrailingBytes{r.Len()}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package bencode
+
+import (
+	"errors"
+	"io"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestUnmarshalTo(t *testing.T) {
+	c := qt.New(t)
+	s, err := UnmarshalTo[string]([]byte("5:hello"))
+	c.Assert(err, qt.IsNil)
+	c.Check(s, qt.Equals, "hello")
+	m, err := UnmarshalTo[map[string]int64]([]byte("d1:ai1e1:bi2ee"))
+	c.Assert(err, qt.IsNil)
+	c.Check(m, qt.DeepEquals, map[string]int64{"a": 1, "b": 2})
+	_, err = UnmarshalTo[int64]([]byte("5:hello"))
+	c.Check(err, qt.ErrorAs, new(*UnmarshalTypeError))
+}
+
+func TestIterDict(t *testing.T) {
+	c := qt.New(t)
+	var keys []string
+	var values []string
+	err := IterDict([]byte("d1:ai1e1:bl1:xe1:cd1:yi2eee"), func(key string, value []byte) error {
+		keys = append(keys, key)
+		values = append(values, string(value))
+		return nil
+	})
+	c.Assert(err, qt.IsNil)
+	c.Check(keys, qt.DeepEquals, []string{"a", "b", "c"})
+	c.Check(values, qt.DeepEquals, []string{"i1e", "l1:xe", "d1:yi2ee"})
+	stop := errors.New("stop")
+	keys = nil
+	err = IterDict([]byte("d1:ai1e1:bi2ee"), func(key string, value []byte) error {
+		keys = append(keys, key)
+		return stop
+	})
+	c.Check(err, qt.Equals, stop)
+	c.Check(keys, qt.DeepEquals, []string{"a"})
+	c.Check(IterDict([]byte("li1ee"), nil), qt.ErrorAs, new(*SyntaxError))
+	c.Check(IterDict([]byte("d1:ai1e"), func(string, []byte) error { return nil }), qt.Equals, io.ErrUnexpectedEOF)
+	c.Check(IterDict([]byte("dei1e"), nil), qt.Equals, ErrUnusedTrailingBytes{3})
+}
+
+func TestIterList(t *testing.T) {
+	c := qt.New(t)
+	var items []string
+	err := IterList([]byte("li1e3:abclee"), func(item []byte) error {
+		items = append(items, string(item))
+		return nil
+	})
+	c.Assert(err, qt.IsNil)
+	c.Check(items, qt.DeepEquals, []string{"i1e", "3:abc", "le"})
+	err = IterList([]byte("le"), func([]byte) error {
+		panic("empty list")
+	})
+	c.Check(err, qt.IsNil)
+}
@@ -0,0 +1,69 @@
+package bencode
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// The dict keys and list indexes leading to a value, like "info.files[3].length". Elements are only
+// formatted when there's an error.
+type decodePath []decodePathElem
+
+// A list index if index isn't negative, otherwise a dict key.
+type decodePathElem struct {
+	key   string
+	index int
+}
+
+func (me *decodePath) pushKey(key string) {
+	*me = append(*me, decodePathElem{key: key, index: -1})
+}
+
+func (me *decodePath) pushIndex(i int) {
+	*me = append(*me, decodePathElem{index: i})
+}
+
+func (me *decodePath) pop() {
+	*me = (*me)[:len(*me)-1]
+}
+
+func (me decodePath) String() string {
+	var sb strings.Builder
+	for i, e := range me {
+		if e.index >= 0 {
+			sb.WriteByte('[')
+			sb.WriteString(strconv.Itoa(e.index))
+			sb.WriteByte(']')
+			continue
+		}
+		if i != 0 {
+			sb.WriteByte('.')
+		}
+		sb.WriteString(e.key)
+	}
+	return sb.String()
+}
+
+// Sets the path on decoding errors in err. An error that already has a path came from decoding
+// inside an Unmarshaler, and its path is relative to the Unmarshaler's value.
+func (me decodePath) annotateError(err error) {
+	if err == nil || len(me) == 0 {
+		return
+	}
+	var se *SyntaxError
+	if errors.As(err, &se) {
+		se.Path = me.join(se.Path)
+	}
+	var ute *UnmarshalTypeError
+	if errors.As(err, &ute) {
+		ute.Path = me.join(ute.Path)
+	}
+}
+
+func (me decodePath) join(inner string) string {
+	if inner == "" || strings.HasPrefix(inner, "[") {
+		return me.String() + inner
+	}
+	return me.String() + "." + inner
+}
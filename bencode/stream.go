@@ -0,0 +1,60 @@
+package bencode
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// Any type which implements this interface is encoded as a bencode string of BencodeStringLen
+// bytes written by WriteTo, so that large strings, like a file's contents, needn't be buffered in
+// memory to be encoded. It takes precedence over Marshaler.
+type StreamingString interface {
+	// Returns the number of bytes WriteTo will write.
+	BencodeStringLen() int64
+	io.WriterTo
+}
+
+var streamingStringType = reflect.TypeOf((*StreamingString)(nil)).Elem()
+
+// A StreamingString of N bytes read from R.
+type ReaderString struct {
+	R io.Reader
+	N int64
+}
+
+var _ StreamingString = ReaderString{}
+
+func (me ReaderString) BencodeStringLen() int64 {
+	return me.N
+}
+
+func (me ReaderString) WriteTo(w io.Writer) (n int64, err error) {
+	n, err = io.CopyN(w, me.R, me.N)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return
+}
+
+// Returns true if the value implements StreamingString and was written.
+func (e *Encoder) reflectStreamingString(v reflect.Value) bool {
+	if !v.Type().Implements(streamingStringType) {
+		if v.Kind() != reflect.Ptr && v.CanAddr() && v.Addr().Type().Implements(streamingStringType) {
+			v = v.Addr()
+		} else {
+			return false
+		}
+	}
+	s := v.Interface().(StreamingString)
+	l := s.BencodeStringLen()
+	e.writeStringPrefix(l)
+	n, err := s.WriteTo(e.w)
+	if err == nil && n != l {
+		err = fmt.Errorf("wrote %v bytes, expected %v", n, l)
+	}
+	if err != nil {
+		panic(fmt.Errorf("bencode: writing streaming string of type %v: %w", v.Type(), err))
+	}
+	return true
+}
@@ -0,0 +1,31 @@
+package bencode
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestEncodeReaderString(t *testing.T) {
+	c := qt.New(t)
+	type withContents struct {
+		Contents ReaderString `bencode:"contents"`
+		Name     string       `bencode:"name"`
+	}
+	var buf bytes.Buffer
+	err := NewEncoder(&buf).Encode(withContents{
+		Contents: ReaderString{strings.NewReader("hello, world"), 5},
+		Name:     "greeting",
+	})
+	c.Assert(err, qt.IsNil)
+	c.Check(buf.String(), qt.Equals, "d8:contents5:hello4:name8:greetinge")
+}
+
+func TestEncodeReaderStringShort(t *testing.T) {
+	c := qt.New(t)
+	_, err := Marshal(ReaderString{strings.NewReader("hi"), 5})
+	c.Check(err, qt.ErrorIs, io.ErrUnexpectedEOF)
+}
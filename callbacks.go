@@ -34,6 +34,12 @@ type Callbacks struct {
 	// handshake has not yet occurred. This is a good time to alter the supported extension
 	// protocols.
 	PeerConnAdded []func(*PeerConn)
+	// Called after each piece is hashed during Torrent.VerifyData, with the progress of the run.
+	VerifyDataProgress []func(VerifyDataProgressEvent)
+	// Called when writing to storage fails. See Torrent.StorageError. The Client lock is not held.
+	StorageFailed []func(StorageFailureEvent)
+	// Called when a piece reaches ClientConfig.MaxPieceFailures, and reads needing it start failing.
+	PieceUnavailable []func(PieceUnavailableEvent)
 }
 
 type ReceivedUsefulDataEvent = PeerMessageEvent
@@ -0,0 +1,247 @@
+package torrent
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/anacrolix/log"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+	"github.com/anacrolix/torrent/types/infohash"
+)
+
+// Records the extents of chunks written to storage for pieces that haven't completed, so that after
+// a restart the Client can resume partially downloaded pieces instead of requesting them again from
+// the start. Set ClientConfig.ChunkJournal to use one. Journaled chunks are only trusted as far as
+// the piece hash: a piece whose chunks are all restored is verified before it's considered
+// complete.
+type ChunkJournal interface {
+	// Returns the journaled chunks by the torrent's canonical short infohash. Returns nothing if
+	// there's no journal.
+	Read(infohash.T) ([]Request, error)
+	// Records a chunk that has been written to storage.
+	Append(infohash.T, Request) error
+	// Replaces the torrent's journal. An empty slice removes it.
+	Rewrite(infohash.T, []Request) error
+}
+
+// Each chunk is an extent of piece index, begin and length as big-endian uint32s.
+const chunkJournalRecordLen = 12
+
+// The journal is compacted when a piece completes after this many chunks were appended since the
+// last compaction, so it doesn't grow without bound while a torrent is open.
+const chunkJournalCompactAppends = 4096
+
+type fileChunkJournal struct {
+	dir string
+
+	mu sync.Mutex
+	// Journal files held open for appending, until the torrent's journal is rewritten.
+	appending map[infohash.T]*os.File
+}
+
+// Returns a ChunkJournal that appends fixed-size records to a file per torrent in dir. A partial
+// record at the end, from a write interrupted by a crash, is ignored.
+func NewFileChunkJournal(dir string) ChunkJournal {
+	return &fileChunkJournal{dir: dir}
+}
+
+func (me *fileChunkJournal) path(ih infohash.T) string {
+	return filepath.Join(me.dir, ih.HexString()+".chunks")
+}
+
+func appendChunkJournalRecord(b []byte, r Request) []byte {
+	b = binary.BigEndian.AppendUint32(b, uint32(r.Index))
+	b = binary.BigEndian.AppendUint32(b, uint32(r.Begin))
+	return binary.BigEndian.AppendUint32(b, uint32(r.Length))
+}
+
+func (me *fileChunkJournal) Read(ih infohash.T) (ret []Request, err error) {
+	b, err := os.ReadFile(me.path(ih))
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+		return
+	}
+	for ; len(b) >= chunkJournalRecordLen; b = b[chunkJournalRecordLen:] {
+		ret = append(ret, Request{
+			Index: pp.Integer(binary.BigEndian.Uint32(b)),
+			ChunkSpec: ChunkSpec{
+				Begin:  pp.Integer(binary.BigEndian.Uint32(b[4:])),
+				Length: pp.Integer(binary.BigEndian.Uint32(b[8:])),
+			},
+		})
+	}
+	return
+}
+
+func (me *fileChunkJournal) Append(ih infohash.T, r Request) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	f, ok := me.appending[ih]
+	if !ok {
+		err := os.MkdirAll(me.dir, 0o750)
+		if err != nil {
+			return err
+		}
+		f, err = os.OpenFile(me.path(ih), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+		if err != nil {
+			return err
+		}
+		if me.appending == nil {
+			me.appending = make(map[infohash.T]*os.File)
+		}
+		me.appending[ih] = f
+	}
+	// Records are written whole with O_APPEND, so a crash leaves at most a partial last record.
+	_, err := f.Write(appendChunkJournalRecord(nil, r))
+	return err
+}
+
+func (me *fileChunkJournal) Rewrite(ih infohash.T, rs []Request) error {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	// The file is replaced, so later appends must reopen it.
+	if f, ok := me.appending[ih]; ok {
+		f.Close()
+		delete(me.appending, ih)
+	}
+	if len(rs) == 0 {
+		err := os.Remove(me.path(ih))
+		if errors.Is(err, fs.ErrNotExist) {
+			err = nil
+		}
+		return err
+	}
+	b := make([]byte, 0, len(rs)*chunkJournalRecordLen)
+	for _, r := range rs {
+		b = appendChunkJournalRecord(b, r)
+	}
+	err := os.MkdirAll(me.dir, 0o750)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(me.dir, ".chunks-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), me.path(ih))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Called outside the Client lock after a chunk is written to storage.
+func (t *Torrent) journalChunk(r Request) {
+	journal := t.cl.config.ChunkJournal
+	if journal == nil {
+		return
+	}
+	err := journal.Append(*t.canonicalShortInfohash(), r)
+	if err != nil {
+		t.logger.WithDefaultLevel(log.Warning).Printf("error journaling chunk %v: %v", r, err)
+	}
+	t.chunkJournalAppends.Add(1)
+}
+
+// Returns the journaled chunks by piece. Extents that don't match a chunk at the current chunk size
+// are dropped.
+func (t *Torrent) readChunkJournal() (ret map[pieceIndex][]chunkIndexType) {
+	journal := t.cl.config.ChunkJournal
+	if journal == nil {
+		return
+	}
+	rs, err := journal.Read(*t.canonicalShortInfohash())
+	if err != nil {
+		t.logger.WithDefaultLevel(log.Warning).Printf("error reading chunk journal: %v", err)
+		return
+	}
+	ret = make(map[pieceIndex][]chunkIndexType)
+	for _, r := range rs {
+		i := pieceIndex(r.Index)
+		if i >= t.numPieces() || r.Begin%t.chunkSize != 0 || r.Begin >= t.pieceLength(i) {
+			continue
+		}
+		ci := r.Begin / t.chunkSize
+		if r.ChunkSpec != chunkIndexSpec(ci, t.pieceLength(i), t.chunkSize) {
+			continue
+		}
+		ret[i] = append(ret[i], chunkIndexType(ci))
+	}
+	return
+}
+
+// Marks a piece's journaled chunks dirty, and queues the piece for hashing if that's all of them.
+// Returns false if there was nothing to restore, in which case the piece should get its usual
+// initial check. A piece with journaled chunks isn't checked otherwise, as it can't be complete, and
+// failing the check would discard the chunks.
+func (t *Torrent) restoreJournaledChunks(i pieceIndex, chunks []chunkIndexType) bool {
+	if len(chunks) == 0 {
+		return false
+	}
+	p := t.piece(i)
+	if p.storageCompletionOk && t.pieceComplete(i) {
+		return false
+	}
+	for _, ci := range chunks {
+		p.unpendChunkIndex(ci)
+	}
+	if t.pieceAllDirty(i) {
+		t.queuePieceCheck(i)
+	}
+	return true
+}
+
+// Compacts the journal if enough chunks have been journaled since it was last compacted. Called
+// when a piece completes, as its chunks are then no longer needed.
+func (t *Torrent) maybeCompactChunkJournal() {
+	if t.chunkJournalAppends.Load() >= chunkJournalCompactAppends {
+		t.compactChunkJournal()
+	}
+}
+
+// Rewrites the journal to the dirty chunks of incomplete pieces, dropping those of pieces that
+// completed or failed their hash check. The journal is written without the Client lock, and the
+// returned channel is closed when that's done. Nil if there's nothing to do. The Client lock must
+// be held.
+func (t *Torrent) compactChunkJournal() (done <-chan struct{}) {
+	journal := t.cl.config.ChunkJournal
+	if journal == nil || !t.haveInfo() {
+		return nil
+	}
+	t.chunkJournalAppends.Store(0)
+	ih := *t.canonicalShortInfohash()
+	compacted := make(chan struct{})
+	go func() {
+		defer close(compacted)
+		// Compactions are serialized, so the latest snapshot is written last.
+		t.chunkJournalCompactMu.Lock()
+		defer t.chunkJournalCompactMu.Unlock()
+		var rs []Request
+		t.cl.rLock()
+		t.dirtyChunks.Iterate(func(x RequestIndex) bool {
+			r := t.requestIndexToRequest(x)
+			if !t.pieceComplete(pieceIndex(r.Index)) {
+				rs = append(rs, r)
+			}
+			return true
+		})
+		t.cl.rUnlock()
+		err := journal.Rewrite(ih, rs)
+		if err != nil {
+			t.logger.WithDefaultLevel(log.Warning).Printf("error compacting chunk journal: %v", err)
+		}
+	}()
+	return compacted
+}
@@ -0,0 +1,96 @@
+package torrent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/types/infohash"
+)
+
+func TestFileChunkJournal(t *testing.T) {
+	c := qt.New(t)
+	dir := t.TempDir()
+	journal := NewFileChunkJournal(dir)
+	ih := infohash.HashBytes([]byte("hello"))
+	rs, err := journal.Read(ih)
+	c.Assert(err, qt.IsNil)
+	c.Check(rs, qt.HasLen, 0)
+	a := newRequest(1, 0, 2)
+	b := newRequest(1, 4, 1)
+	c.Assert(journal.Append(ih, a), qt.IsNil)
+	c.Assert(journal.Append(ih, b), qt.IsNil)
+	// Simulate a record torn by a crash.
+	f, err := os.OpenFile(filepath.Join(dir, ih.HexString()+".chunks"), os.O_WRONLY|os.O_APPEND, 0)
+	c.Assert(err, qt.IsNil)
+	f.Write([]byte{0, 0, 0})
+	f.Close()
+	rs, err = journal.Read(ih)
+	c.Assert(err, qt.IsNil)
+	c.Check(rs, qt.DeepEquals, []Request{a, b})
+	c.Assert(journal.Rewrite(ih, []Request{b}), qt.IsNil)
+	rs, err = journal.Read(ih)
+	c.Assert(err, qt.IsNil)
+	c.Check(rs, qt.DeepEquals, []Request{b})
+	c.Assert(journal.Rewrite(ih, nil), qt.IsNil)
+	rs, err = journal.Read(ih)
+	c.Assert(err, qt.IsNil)
+	c.Check(rs, qt.HasLen, 0)
+}
+
+func TestJournaledChunksRestored(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.ChunkJournal = NewFileChunkJournal(t.TempDir())
+	spec, err := TorrentSpecFromMetaInfoErr(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	// Pieces are 5 bytes, so piece 1 has chunks at 0, 2 and 4.
+	spec.ChunkSize = 2
+	ih := spec.InfoHash
+	restored := []Request{
+		newRequest(1, 0, 2),
+		newRequest(1, 4, 1),
+	}
+	for _, r := range append([]Request{
+		// Not aligned to a chunk.
+		newRequest(1, 1, 2),
+		// The wrong length for the last chunk.
+		newRequest(1, 4, 2),
+		// There's no such piece.
+		newRequest(7, 0, 2),
+	}, restored...) {
+		c.Assert(cfg.ChunkJournal.Append(ih, r), qt.IsNil)
+	}
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	tt, _, err := cl.AddTorrentSpec(spec)
+	c.Assert(err, qt.IsNil)
+	cl.lock()
+	c.Check(tt.piece(1).numDirtyChunks(), qt.Equals, chunkIndexType(2))
+	c.Check(tt.pieceQueuedForHash(1), qt.IsFalse)
+	cl.unlock()
+	// Compaction while the torrent is open drops chunks that aren't dirty.
+	c.Assert(cfg.ChunkJournal.Append(ih, newRequest(0, 0, 2)), qt.IsNil)
+	tt.chunkJournalAppends.Store(chunkJournalCompactAppends)
+	cl.lock()
+	compacted := tt.compactChunkJournal()
+	c.Check(tt.chunkJournalAppends.Load(), qt.Equals, int64(0))
+	cl.unlock()
+	<-compacted
+	rs, err := cfg.ChunkJournal.Read(ih)
+	c.Assert(err, qt.IsNil)
+	c.Check(rs, qt.DeepEquals, restored)
+	// Appends after compaction go to the new journal.
+	c.Assert(cfg.ChunkJournal.Append(ih, newRequest(0, 0, 2)), qt.IsNil)
+	rs, err = cfg.ChunkJournal.Read(ih)
+	c.Assert(err, qt.IsNil)
+	c.Check(rs, qt.HasLen, len(restored)+1)
+	cl.Close()
+	// Closing compacts the journal to the chunks that are still dirty.
+	rs, err = cfg.ChunkJournal.Read(ih)
+	c.Assert(err, qt.IsNil)
+	c.Check(rs, qt.DeepEquals, restored)
+}
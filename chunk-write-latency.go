@@ -0,0 +1,52 @@
+package torrent
+
+import (
+	"sync"
+	"time"
+)
+
+// The average is ignored if there haven't been writes for this long, such as when a download has
+// finished, and only hashing remains.
+const chunkWriteLatencyStaleAfter = 5 * time.Second
+
+// Tracks a moving average of how long chunk writes to storage take. It rises when writes saturate
+// the disk.
+type chunkWriteLatency struct {
+	mu       sync.Mutex
+	average  time.Duration
+	lastTime time.Time
+}
+
+// Each write moves the average 1/weight of the way towards its latency. See
+// ClientConfig.ChunkWriteLatencyWeight.
+func (me *chunkWriteLatency) add(d time.Duration, weight int) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.lastTime.IsZero() {
+		me.average = d
+	} else {
+		me.average += (d - me.average) / time.Duration(maxInt(1, weight))
+	}
+	me.lastTime = time.Now()
+}
+
+// Returns the average write latency, or zero if there haven't been any writes recently.
+func (me *chunkWriteLatency) current() time.Duration {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if time.Since(me.lastTime) > chunkWriteLatencyStaleAfter {
+		return 0
+	}
+	return me.average
+}
+
+// Returns how many pieces the torrent may hash at once. Fewer are allowed while chunk writes are
+// slow.
+func (t *Torrent) maxPieceHashers() int {
+	cfg := t.cl.config
+	n := cfg.PieceHashersPerTorrent
+	if cfg.SlowChunkWriteLatency > 0 && t.cl.chunkWriteLatency.current() >= cfg.SlowChunkWriteLatency {
+		n = minInt(n, maxInt(1, cfg.PieceHashersWhileWritesSlow))
+	}
+	return n
+}
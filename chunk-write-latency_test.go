@@ -0,0 +1,46 @@
+package torrent
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestMaxPieceHashersWhileWritesSlow(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.PieceHashersPerTorrent = 4
+	cfg.SlowChunkWriteLatency = 50 * time.Millisecond
+	cfg.PieceHashersWhileWritesSlow = 2
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt := cl.newTorrentForTesting()
+	c.Check(tt.maxPieceHashers(), qt.Equals, 4)
+	cl.chunkWriteLatency.add(time.Millisecond, cfg.ChunkWriteLatencyWeight)
+	c.Check(tt.maxPieceHashers(), qt.Equals, 4)
+	for range 20 {
+		cl.chunkWriteLatency.add(time.Second, cfg.ChunkWriteLatencyWeight)
+	}
+	c.Check(tt.maxPieceHashers(), qt.Equals, 2)
+	cfg.PieceHashersWhileWritesSlow = 0
+	c.Check(tt.maxPieceHashers(), qt.Equals, 1)
+	// A stale average doesn't hold back hashing once writes stop.
+	cl.chunkWriteLatency.lastTime = time.Now().Add(-time.Minute)
+	c.Check(tt.maxPieceHashers(), qt.Equals, 4)
+}
+
+func TestChunkWriteLatencyWeight(t *testing.T) {
+	c := qt.New(t)
+	c.Check(NewDefaultClientConfig().ChunkWriteLatencyWeight, qt.Equals, 8)
+	var l chunkWriteLatency
+	l.add(time.Millisecond, 8)
+	l.add(9*time.Millisecond, 8)
+	c.Check(l.current(), qt.Equals, 2*time.Millisecond)
+	l.add(10*time.Millisecond, 2)
+	c.Check(l.current(), qt.Equals, 6*time.Millisecond)
+	// Without smoothing, the latest write is the average.
+	l.add(time.Millisecond, 0)
+	c.Check(l.current(), qt.Equals, time.Millisecond)
+}
@@ -0,0 +1,221 @@
+package torrent
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"golang.org/x/exp/maps"
+)
+
+// A structured snapshot of the state written by Client.WriteStatus. It's intended for dashboards
+// and for comparing Client state in tests.
+type ClientState struct {
+	ListenPort    int
+	ListenPorts   ListenPorts
+	PeerId        string
+	ExtensionBits string
+	AnnounceKey   int32
+	NumBannedIps  int
+	DhtServers    []DhtServerState
+	Stats         ClientStats
+	// Sorted by canonical short infohash.
+	Torrents []TorrentState
+}
+
+type DhtServerState struct {
+	Network string
+	Addr    string
+	Id      string
+	Stats   interface{}
+}
+
+type TorrentState struct {
+	InfoHash   string `json:",omitempty"`
+	InfoHashV2 string `json:",omitempty"`
+	Name       string
+	HaveInfo   bool
+	// The following are only meaningful if HaveInfo is true.
+	Length          int64
+	BytesMissing    int64
+	NumPieces       int
+	PiecesCompleted int
+	PieceStateRuns  string
+	MetadataLength  int
+	DhtAnnounces    int
+	Trackers        []TrackerState
+	Stats           TorrentStats
+	Webseeds        []PeerState
+	PeerConns       []PeerState
+	// The storage error that paused data download. See Torrent.StorageError.
+	StorageError string `json:",omitempty"`
+}
+
+type TrackerState struct {
+	Url string
+	// Time until the next announce is due. Zero if it can occur any time.
+	NextAnnounce      time.Duration
+	LastAnnounce      time.Time
+	LastAnnounceErr   string `json:",omitempty"`
+	LastAnnouncePeers int
+	// A non-fatal warning message from the tracker in the last announce.
+	LastAnnounceWarning string `json:",omitempty"`
+	ConsecutiveFailures int    `json:",omitempty"`
+	// Set after too many consecutive failures. See Torrent.DisabledTrackers.
+	Disabled bool `json:",omitempty"`
+}
+
+// Transport is "utp", "tcp" or another network name for peer connections, and "webseed" for
+// webseeds. Encryption is "rc4" for MSE encrypted connections, "header" if only the handshake was
+// obfuscated, and "none" otherwise.
+type PeerState struct {
+	Addr            string
+	PeerId          string `json:",omitempty"`
+	Source          PeerSource
+	Transport       string
+	Outgoing        bool
+	Encryption      string `json:",omitempty"`
+	Flags           string
+	Closed          bool
+	PiecesCompleted string
+	DownloadRate    float64
+	Rates           TransferRates
+	Stats           ConnStats
+	StatusLines     []string
+	// See ClientConfig.PeerConnMessageTraceLength.
+	MessageTrace []MessageTraceEntry `json:",omitempty"`
+}
+
+// Returns a structured snapshot of the Client's state, as shown by WriteStatus.
+func (cl *Client) State() (ret ClientState) {
+	cl.rLock()
+	defer cl.rUnlock()
+	return cl.stateLocked()
+}
+
+// Returns Client.State encoded as JSON.
+func (cl *Client) StateJSON() ([]byte, error) {
+	state := cl.State()
+	return json.Marshal(&state)
+}
+
+func (cl *Client) stateLocked() (ret ClientState) {
+	ret.ListenPort = cl.LocalPort()
+	ret.ListenPorts = cl.listenPorts()
+	ret.PeerId = fmt.Sprintf("%+q", cl.PeerID())
+	ret.ExtensionBits = fmt.Sprint(cl.config.Extensions)
+	ret.AnnounceKey = cl.announceKey()
+	ret.NumBannedIps = len(cl.badPeerIPs)
+	cl.eachDhtServer(func(s DhtServer) {
+		ret.DhtServers = append(ret.DhtServers, DhtServerState{
+			Network: s.Addr().Network(),
+			Addr:    s.Addr().String(),
+			Id:      fmt.Sprintf("%x", s.ID()),
+			Stats:   s.Stats(),
+		})
+	})
+	ret.Stats = cl.statsLocked()
+	torrentsSlice := cl.torrentsAsSlice()
+	sort.Slice(torrentsSlice, func(l, r int) bool {
+		return torrentsSlice[l].canonicalShortInfohash().AsString() < torrentsSlice[r].canonicalShortInfohash().AsString()
+	})
+	for _, t := range torrentsSlice {
+		ret.Torrents = append(ret.Torrents, t.stateLocked())
+	}
+	return
+}
+
+func (t *Torrent) stateLocked() (ret TorrentState) {
+	if t.infoHash.Ok {
+		ret.InfoHash = t.infoHash.Value.HexString()
+	}
+	if t.infoHashV2.Ok {
+		ret.InfoHashV2 = t.infoHashV2.Value.HexString()
+	}
+	ret.Name = t.name()
+	ret.MetadataLength = t.metadataSize()
+	ret.HaveInfo = t.haveInfo()
+	if ret.HaveInfo {
+		ret.Length = t.length()
+		ret.BytesMissing = t.bytesMissingLocked()
+		ret.NumPieces = t.numPieces()
+		ret.PiecesCompleted = t.numPiecesCompleted()
+		ret.PieceStateRuns = t.pieceStateRuns().String()
+	}
+	ret.DhtAnnounces = t.numDHTAnnounces
+	if t.storageErr != nil {
+		ret.StorageError = t.storageErr.Error()
+	}
+	for _, ta := range t.trackerAnnouncers {
+		ret.Trackers = append(ret.Trackers, t.trackerState(ta))
+	}
+	sort.Slice(ret.Trackers, func(i, j int) bool {
+		return ret.Trackers[i].Url < ret.Trackers[j].Url
+	})
+	ret.Stats = t.statsLocked()
+	for _, ws := range t.webSeeds {
+		ret.Webseeds = append(ret.Webseeds, ws.state())
+	}
+	sort.Slice(ret.Webseeds, func(i, j int) bool {
+		return ret.Webseeds[i].Addr < ret.Webseeds[j].Addr
+	})
+	peerConns := maps.Keys(t.conns)
+	sort.Slice(peerConns, func(i, j int) bool {
+		return peerConns[i].RemoteAddr.String() < peerConns[j].RemoteAddr.String()
+	})
+	for _, pc := range peerConns {
+		ret.PeerConns = append(ret.PeerConns, pc.state())
+	}
+	return
+}
+
+func (t *Torrent) trackerState(ta torrentTrackerAnnouncer) (ret TrackerState) {
+	ret.Url = t.cl.redactTracker(ta.URL().String())
+	ts, ok := ta.(*trackerScraper)
+	if !ok {
+		return
+	}
+	ar := ts.lastAnnounce
+	if na := ar.Completed.Add(ar.Interval).Sub(ts.t.cl.clock().Now()); na > 0 {
+		ret.NextAnnounce = na
+	}
+	ret.LastAnnounce = ar.Completed
+	if ar.Err != nil {
+		ret.LastAnnounceErr = t.cl.redactTracker(ar.Err.Error())
+	}
+	ret.LastAnnouncePeers = ar.NumPeers
+	ret.LastAnnounceWarning = ar.Warning
+	ret.ConsecutiveFailures = ts.consecutiveFailures
+	ret.Disabled = ts.disabled
+	return
+}
+
+func (cn *Peer) state() (ret PeerState) {
+	if cn.RemoteAddr != nil {
+		ret.Addr = cn.RemoteAddr.String()
+	}
+	ret.Source = cn.Discovery
+	ret.Outgoing = cn.outgoing
+	if _, ok := cn.peerImpl.(*webseedPeer); ok {
+		ret.Transport = "webseed"
+		ret.Outgoing = true
+	}
+	ret.Flags = cn.statusFlags()
+	ret.Closed = cn.closed.IsSet()
+	ret.PiecesCompleted = cn.completedString()
+	ret.DownloadRate = cn.downloadRate()
+	ret.Rates = cn.rates.rates(cn.now())
+	ret.Stats = cn._stats.Copy()
+	ret.StatusLines = cn.peerImplStatusLines()
+	return
+}
+
+func (cn *PeerConn) state() (ret PeerState) {
+	ret = cn.Peer.state()
+	ret.PeerId = fmt.Sprintf("%+q", cn.PeerID)
+	ret.Transport = cn.transport()
+	ret.Encryption = cn.encryption()
+	ret.MessageTrace = cn.MessageTrace()
+	return
+}
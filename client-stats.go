@@ -26,6 +26,10 @@ type ClientStats struct {
 	// to hole-punch connect requests. The total may not match the sum of attempts for all Torrents
 	// if a Torrent is dropped while there are outstanding dials.
 	ActiveHalfOpenAttempts int
+	// Incoming connections that haven't completed handshakes. See
+	// ClientConfig.MaxHalfAcceptedConns.
+	HalfAcceptedConns int
+	Handshakes        HandshakeStats
 
 	NumPeersUndialableWithoutHolepunch int
 	// Number of unique peer addresses that were dialed after receiving a holepunch connect message,
@@ -36,11 +40,20 @@ type ClientStats struct {
 	NumPeersDialableOnlyAfterHolepunch              int
 	NumPeersDialedSuccessfullyAfterHolepunchConnect int
 	NumPeersProbablyOnlyConnectedDueToHolepunch     int
+
+	// Rolling transfer rates over all connections.
+	Rates TransferRates
+
+	UploadReadCache UploadReadCacheStats
 }
 
 func (cl *Client) statsLocked() (stats ClientStats) {
 	stats.ConnStats = cl.connStats.Copy()
+	stats.Rates = cl.rates.rates(cl.clock().Now())
+	stats.UploadReadCache = cl.uploadReadCache.stats()
 	stats.ActiveHalfOpenAttempts = cl.numHalfOpen
+	stats.HalfAcceptedConns = cl.numHalfAccepted
+	stats.Handshakes = cl.handshakeStats()
 
 	stats.NumPeersUndialableWithoutHolepunch = len(cl.undialableWithoutHolepunch)
 	stats.NumPeersUndialableWithoutHolepunchDialedAfterHolepunchConnect = len(cl.undialableWithoutHolepunchDialedAfterHolepunchConnect)
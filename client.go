@@ -14,6 +14,8 @@ import (
 	"net"
 	"net/http"
 	"net/netip"
+	"os"
+	"slices"
 	"sort"
 	"strconv"
 	"time"
@@ -45,9 +47,11 @@ import (
 	pp "github.com/anacrolix/torrent/peer_protocol"
 	request_strategy "github.com/anacrolix/torrent/request-strategy"
 	"github.com/anacrolix/torrent/storage"
+	"github.com/anacrolix/torrent/storage/disabled"
 	"github.com/anacrolix/torrent/tracker"
 	"github.com/anacrolix/torrent/types/infohash"
 	infohash_v2 "github.com/anacrolix/torrent/types/infohash-v2"
+	"github.com/anacrolix/torrent/udpmux"
 	"github.com/anacrolix/torrent/webtorrent"
 )
 
@@ -57,6 +61,7 @@ type Client struct {
 	// An aggregate of stats over all connections. First in struct to ensure 64-bit alignment of
 	// fields. See #262.
 	connStats ConnStats
+	rates     transferRateMeters
 
 	_mu    lockWithDeferreds
 	event  sync.Cond
@@ -64,6 +69,16 @@ type Client struct {
 
 	config *ClientConfig
 	logger log.Logger
+	// Per-transport enable flags and stats.
+	transports transports
+	// Prompts torrents to open new connections once ClientConfig.DialRateLimiter allows a dial.
+	dialRateLimitTimer *time.Timer
+	// Shared by tracker announces. Has its own lock.
+	trackerClients trackerClients
+	// Shared by all torrents, as they're usually on the same disks. Has its own lock.
+	chunkWriteLatency chunkWriteLatency
+	// See ClientConfig.RandSource. Has its own lock.
+	rand lockedRand
 
 	peerID         PeerID
 	defaultStorage *storage.Client
@@ -78,16 +93,38 @@ type Client struct {
 	// through legitimate channels.
 	dopplegangerAddrs map[string]struct{}
 	badPeerIPs        map[netip.Addr]struct{}
+	// Our external IPs as reported by peers and trackers.
+	externalIpVotes externalIpVotes
+	dhtPortPings    chan dhtPortPing
+	uploadSlots     uploadSlots
+	// Metadata bytes allocated by torrents without info, for ClientConfig.MaxMetadataBytesInFlight.
+	metadataBytesInFlight int
+	// Torrents waiting for MaxMetadataBytesInFlight to allow their metadata allocation.
+	deferredMetadataTorrents map[*Torrent]struct{}
+	// When each DHT node may next be sent sample_infohashes, by address, from the intervals they
+	// returned.
+	dhtSampleNotBefore map[string]time.Time
 	// All Torrents once.
 	torrents map[*Torrent]struct{}
 	// All Torrents by their short infohashes (v1 if valid, and truncated v2 if valid). Unless the
 	// info has been obtained, there's no knowing if an infohash belongs to v1 or v2.
 	torrentsByShortHash map[InfoHash]*Torrent
+	// Keys of torrentsByShortHash by mse.SecretKeyReq2Hash.
+	shortHashesBySkeyHash map[[20]byte]InfoHash
+	// Whether header obfuscation was used in the last successful outgoing handshake, by peer
+	// address. It's tried first next time.
+	headerObfuscationByAddr map[string]bool
 
 	pieceRequestOrder map[interface{}]*request_strategy.PieceRequestOrder
 
 	acceptLimiter map[ipStr]int
 	numHalfOpen   int
+	// Incoming conns that haven't completed handshakes.
+	numHalfAccepted int
+	handshakes      handshakeCounters
+	// Local addresses of connections dialed by SelfTest. They're closed without handshaking, and
+	// aren't held against the loopback address when accepted.
+	selfTestAddrs map[string]struct{}
 
 	websocketTrackers websocketTrackers
 
@@ -97,6 +134,7 @@ type Client struct {
 	clientHolepunchAddrSets
 
 	defaultLocalLtepProtocolMap LocalLtepProtocolMap
+	uploadReadCache             uploadReadCache
 }
 
 type ipStr string
@@ -148,6 +186,7 @@ func (cl *Client) WriteStatus(_w io.Writer) {
 	w := bufio.NewWriter(_w)
 	defer w.Flush()
 	fmt.Fprintf(w, "Listen port: %d\n", cl.LocalPort())
+	fmt.Fprintf(w, "Listen ports: %+v\n", cl.listenPorts())
 	fmt.Fprintf(w, "Peer ID: %+q\n", cl.PeerID())
 	fmt.Fprintf(w, "Extension bits: %v\n", cl.config.Extensions)
 	fmt.Fprintf(w, "Announce key: %x\n", cl.announceKey())
@@ -156,6 +195,13 @@ func (cl *Client) WriteStatus(_w io.Writer) {
 		fmt.Fprintf(w, "%s DHT server at %s:\n", s.Addr().Network(), s.Addr().String())
 		writeDhtServerStatus(w, s)
 	})
+	transportStats := cl.transportStatsLocked()
+	for _, name := range sortedTransportNames(transportStats) {
+		fmt.Fprintf(w, "Transport %v: %+v\n", name, transportStats[name])
+	}
+	if slots := cl.uploadSlots.slots; slots != 0 {
+		fmt.Fprintf(w, "Upload slots: %d of %d in use\n", cl.uploadSlots.unchoked, slots)
+	}
 	dumpStats(w, cl.statsLocked())
 	torrentsSlice := cl.torrentsAsSlice()
 	fmt.Fprintf(w, "# Torrents: %d\n", len(torrentsSlice))
@@ -197,13 +243,43 @@ func (cl *Client) initLogger() {
 	cl.logger = logger.WithValues(cl)
 }
 
+// The User-Agent for HTTP requests, such as to trackers and webseeds. It's empty in anonymous mode,
+// where httpRequestDirector also removes the header, including the tracker client's default.
+func (cl *Client) httpUserAgent() string {
+	if cl.config.AnonymousMode {
+		return ""
+	}
+	return cl.config.HTTPUserAgent
+}
+
+// Returns the HttpRequestDirector to apply to tracker and webseed requests, scrubbing the
+// User-Agent first in anonymous mode.
+func (cl *Client) httpRequestDirector() func(*http.Request) error {
+	director := cl.config.HttpRequestDirector
+	if !cl.config.AnonymousMode {
+		return director
+	}
+	return func(req *http.Request) error {
+		// An empty User-Agent prevents the net/http default being sent.
+		req.Header.Set("User-Agent", "")
+		if director != nil {
+			return director(req)
+		}
+		return nil
+	}
+}
+
 func (cl *Client) announceKey() int32 {
+	if cl.config.AnnounceKey.Ok {
+		return cl.config.AnnounceKey.Value
+	}
 	return int32(binary.BigEndian.Uint32(cl.peerID[16:20]))
 }
 
 // Initializes a bare minimum Client. *Client and *ClientConfig must not be nil.
 func (cl *Client) init(cfg *ClientConfig) {
 	cl.config = cfg
+	cl.rand.init(cfg.RandSource)
 	g.MakeMap(&cl.dopplegangerAddrs)
 	g.MakeMap(&cl.torrentsByShortHash)
 	g.MakeMap(&cl.torrents)
@@ -211,19 +287,36 @@ func (cl *Client) init(cfg *ClientConfig) {
 	cl.activeAnnounceLimiter.SlotsPerKey = 2
 	cl.event.L = cl.locker()
 	cl.ipBlockList = cfg.IPBlocklist
+	if cfg.HTTPClient != nil {
+		cl.httpClient = cfg.HTTPClient
+	} else {
+		cl.initHttpClient()
+	}
+	cl.defaultLocalLtepProtocolMap = makeBuiltinLtepProtocols(!cfg.DisablePEX)
+	uploadReadCacheCapacity := cfg.UploadReadCacheCapacity
+	if uploadReadCacheCapacity == 0 && cfg.ServeOnly {
+		uploadReadCacheCapacity = defaultServeOnlyUploadReadCacheCapacity
+	}
+	cl.uploadReadCache.init(uploadReadCacheCapacity)
+	cl.dhtPortPings = make(chan dhtPortPing, dhtPortPingQueueLen)
+}
+
+func (cl *Client) initHttpClient() {
+	cfg := cl.config
 	cl.httpClient = &http.Client{
 		Transport: cfg.WebTransport,
 	}
 	if cl.httpClient.Transport == nil {
+		maxConnsPerHost := cfg.WebseedMaxConnsPerHost
+		if maxConnsPerHost <= 0 {
+			maxConnsPerHost = defaultWebseedMaxConnsPerHost
+		}
 		cl.httpClient.Transport = &http.Transport{
-			Proxy:       cfg.HTTPProxy,
-			DialContext: cfg.HTTPDialContext,
-			// I think this value was observed from some webseeds. It seems reasonable to extend it
-			// to other uses of HTTP from the client.
-			MaxConnsPerHost: 10,
+			Proxy:           cfg.HTTPProxy,
+			DialContext:     cfg.HTTPDialContext,
+			MaxConnsPerHost: maxConnsPerHost,
 		}
 	}
-	cl.defaultLocalLtepProtocolMap = makeBuiltinLtepProtocols(!cfg.DisablePEX)
 }
 
 func NewClient(cfg *ClientConfig) (cl *Client, err error) {
@@ -234,6 +327,7 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 	cl = &Client{}
 	cl.init(cfg)
 	go cl.acceptLimitClearer()
+	go cl.dhtPortPinger()
 	cl.initLogger()
 	defer func() {
 		if err != nil {
@@ -242,6 +336,22 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 		}
 	}()
 
+	if cfg.LockDataDir {
+		var lockFile *os.File
+		lockFile, err = lockDir(cfg.DataDir)
+		if err != nil {
+			return
+		}
+		cl.onClose = append(cl.onClose, func() {
+			lockFile.Close()
+		})
+	}
+
+	cl.trackerClients.logger = cl.logger
+	cl.trackerClients.redact = cl.redactTracker
+	cl.onClose = append(cl.onClose, cl.trackerClients.close)
+	cl.initUploadSlots()
+
 	storageImpl := cfg.DefaultStorage
 	if storageImpl == nil {
 		// We'd use mmap by default but HFS+ doesn't support sparse files.
@@ -256,9 +366,16 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 	cl.defaultStorage = storage.NewClient(storageImpl)
 
 	if cfg.PeerID != "" {
-		missinggo.CopyExact(&cl.peerID, cfg.PeerID)
+		if len(cfg.PeerID) != len(cl.peerID) {
+			err = fmt.Errorf("peer ID has length %v, expected %v", len(cfg.PeerID), len(cl.peerID))
+			return
+		}
+		copy(cl.peerID[:], cfg.PeerID)
 	} else {
-		o := copy(cl.peerID[:], cfg.Bep20)
+		var o int
+		if !cfg.AnonymousMode {
+			o = copy(cl.peerID[:], cfg.Bep20)
+		}
 		_, err = rand.Read(cl.peerID[o:])
 		if err != nil {
 			panic("error generating peer id")
@@ -266,12 +383,38 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 	}
 
 	builtinListenNetworks := cl.listenNetworks()
+	listenPort := cl.config.ListenPort
+	packetConns := cfg.PacketConns
+	noUdp := false
+	if len(packetConns) != 0 {
+		listenPort = addrPortOrZero(packetConns[0].LocalAddr())
+	} else if cfg.Socks5UdpProxy != nil {
+		var pc net.PacketConn
+		pc, err = cl.socks5UdpAssociate()
+		if err == nil {
+			packetConns = []net.PacketConn{pc}
+		} else {
+			cl.logger.Levelf(log.Warning, "disabling uTP and DHT: %v", err)
+			noUdp = true
+			err = nil
+		}
+	}
+	if len(packetConns) != 0 || noUdp {
+		builtinListenNetworks = slices.DeleteFunc(builtinListenNetworks, func(n network) bool {
+			return n.Udp
+		})
+	}
 	sockets, err := listenAll(
 		builtinListenNetworks,
 		cl.config.ListenHost,
-		cl.config.ListenPort,
+		listenPort,
 		cl.firewallCallback,
 		cl.logger,
+		socketOpts{
+			tcpSimultaneousOpen: cl.config.TcpSimultaneousOpen,
+			tos:                 cl.config.PeerSocketTos,
+			mark:                cl.config.PeerSocketMark,
+		},
 	)
 	if err != nil {
 		return
@@ -280,6 +423,26 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 		err = fmt.Errorf("no sockets created for networks %v", builtinListenNetworks)
 		return
 	}
+	// PacketConns for the DHT to use instead of the UDP sockets, when they're multiplexed.
+	var dhtPacketConns []net.PacketConn
+	for _, pc := range packetConns {
+		var s socket
+		if cfg.MuxPacketConns {
+			mux := udpmux.New(pc)
+			cl.onClose = append(cl.onClose, func() { mux.Close() })
+			dhtPacketConns = append(dhtPacketConns, mux.Route(udpmux.IsKrpc))
+			pc = mux.Route(udpmux.IsUtp)
+		}
+		s, err = utpSocketFromPacketConn(pc, cl.firewallCallback, cl.logger)
+		if err != nil {
+			err = fmt.Errorf("creating utp socket on %v: %w", pc.LocalAddr(), err)
+			for _, s := range sockets {
+				s.Close()
+			}
+			return
+		}
+		sockets = append(sockets, s)
+	}
 
 	// Check for panics.
 	cl.LocalPort()
@@ -298,16 +461,21 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 
 	go cl.forwardPort()
 	if !cfg.NoDHT {
-		for _, s := range sockets {
-			if pc, ok := s.(net.PacketConn); ok {
-				ds, err := cl.NewAnacrolixDhtServer(pc)
-				if err != nil {
-					panic(err)
+		if len(dhtPacketConns) == 0 {
+			for _, s := range sockets {
+				if pc, ok := s.(net.PacketConn); ok {
+					dhtPacketConns = append(dhtPacketConns, pc)
 				}
-				cl.dhtServers = append(cl.dhtServers, AnacrolixDhtServerWrapper{ds})
-				cl.onClose = append(cl.onClose, func() { ds.Close() })
 			}
 		}
+		for _, pc := range dhtPacketConns {
+			ds, err := cl.NewAnacrolixDhtServer(pc)
+			if err != nil {
+				panic(err)
+			}
+			cl.dhtServers = append(cl.dhtServers, AnacrolixDhtServerWrapper{ds})
+			cl.onClose = append(cl.onClose, func() { ds.Close() })
+		}
 	}
 
 	cl.websocketTrackers = websocketTrackers{
@@ -330,6 +498,7 @@ func NewClient(cfg *ClientConfig) (cl *Client, err error) {
 		WebsocketTrackerHttpHeader: cl.config.WebsocketTrackerHttpHeader,
 		ICEServers:                 cl.config.ICEServers,
 		DialContext:                cl.config.TrackerDialContext,
+		Redact:                     cl.redactTracker,
 		OnConn: func(dc datachannel.ReadWriteCloser, dcc webtorrent.DataChannelContext) {
 			cl.lock()
 			defer cl.unlock()
@@ -421,21 +590,41 @@ func (cl *Client) NewAnacrolixDhtServer(conn net.PacketConn) (s *dht.Server, err
 		IPBlocklist:    cl.ipBlockList,
 		Conn:           conn,
 		OnAnnouncePeer: cl.onDHTAnnouncePeer,
+		PeerStore:      newDhtPeerStore(cl.clock()),
 		PublicIP: func() net.IP {
 			if connIsIpv6(conn) && cl.config.PublicIp6 != nil {
 				return cl.config.PublicIp6
 			}
 			return cl.config.PublicIp4
 		}(),
-		StartingNodes: cl.config.DhtStartingNodes(conn.LocalAddr().Network()),
+		StartingNodes: cl.dhtStartingNodes(conn.LocalAddr().Network()),
 		OnQuery:       cl.config.DHTOnQuery,
 		Logger:        logger,
 	}
 	if f := cl.config.ConfigureAnacrolixDhtServer; f != nil {
 		f(&cfg)
 	}
+	var sampler *dhtSampleInfohashesResponder
+	if ps, ok := cfg.PeerStore.(*dhtPeerStore); ok && !cl.config.DisableDhtSampleInfohashes {
+		sampler = &dhtSampleInfohashesResponder{
+			clock:     cl.clock(),
+			peerStore: ps,
+			limiter:   cl.config.DhtSampleInfohashesRateLimiter,
+			conn:      cfg.Conn,
+		}
+		onQuery := cfg.OnQuery
+		cfg.OnQuery = func(query *krpc.Msg, source net.Addr) bool {
+			if onQuery != nil && !onQuery(query, source) {
+				return false
+			}
+			return sampler.onQuery(query, source)
+		}
+	}
 	s, err = dht.NewServer(&cfg)
 	if err == nil {
+		if sampler != nil {
+			sampler.server.Store(s)
+		}
 		go s.TableMaintainer()
 	}
 	return
@@ -452,6 +641,8 @@ func (cl *Client) eachDhtServer(f func(DhtServer)) {
 }
 
 // Stops the client. All connections to peers are closed and all activity will come to a halt.
+// Blocks until the background work of each Torrent has stopped, so as for Torrent.Drop, it mustn't
+// be called from callbacks or hooks run by the Client.
 func (cl *Client) Close() (errs []error) {
 	var closeGroup sync.WaitGroup // For concurrent cleanup to complete before returning
 	cl.lock()
@@ -484,7 +675,8 @@ func (cl *Client) ipIsBlocked(ip net.IP) bool {
 }
 
 func (cl *Client) wantConns() bool {
-	if cl.config.AlwaysWantConns {
+	// Torrents for incoming connections might be added by OnUnknownInfoHash.
+	if cl.config.AlwaysWantConns || cl.config.OnUnknownInfoHash != nil {
 		return true
 	}
 	for t := range cl.torrents {
@@ -518,14 +710,41 @@ func (cl *Client) rejectAccepted(conn net.Conn) error {
 			return errors.New("bad source addr")
 		}
 	}
+	if l := cl.config.AcceptRateLimiter; l != nil && !cl.config.DisableAcceptRateLimiting && !l.Allow() {
+		return errors.New("accept rate limited")
+	}
 	return nil
 }
 
+// Counts an incoming conn against ClientConfig.MaxHalfAcceptedConns until it completes handshakes.
+func (cl *Client) startHalfAccepted() error {
+	cl.lock()
+	defer cl.unlock()
+	if limit := cl.config.MaxHalfAcceptedConns; limit > 0 && cl.numHalfAccepted >= limit {
+		return errors.New("too many half-accepted conns")
+	}
+	cl.numHalfAccepted++
+	return nil
+}
+
+// Applies ClientConfig.AcceptPeerConn.
+func (cl *Client) acceptPeerConnPolicy(remote net.Addr, ih *InfoHash) bool {
+	f := cl.config.AcceptPeerConn
+	return f == nil || f(remote, ih)
+}
+
 func (cl *Client) acceptConnections(l Listener) {
+	transport := cl.transports.get(networkTransport(l.Addr().Network()))
 	for {
 		conn, err := l.Accept()
 		torrent.Add("client listener accepts", 1)
 		if err == nil {
+			transport.accepted.Add(1)
+			if transport.disabled.Load() {
+				torrent.Add("accepted conns closed for disabled transport", 1)
+				conn.Close()
+				continue
+			}
 			holepunchAddr, holepunchErr := addrPortFromPeerRemoteAddr(conn.RemoteAddr())
 			if holepunchErr == nil {
 				cl.lock()
@@ -560,6 +779,12 @@ func (cl *Client) acceptConnections(l Listener) {
 			continue
 		}
 		go func() {
+			if reject == nil && !cl.acceptPeerConnPolicy(conn.RemoteAddr(), nil) {
+				reject = errors.New("rejected by AcceptPeerConn")
+			}
+			if reject == nil {
+				reject = cl.startHalfAccepted()
+			}
 			if reject != nil {
 				torrent.Add("rejected accepted connections", 1)
 				cl.logger.LazyLog(log.Debug, func() log.Msg {
@@ -649,7 +874,13 @@ func (cl *Client) dopplegangerAddr(addr string) bool {
 
 // Returns a connection over UTP or TCP, whichever is first to connect.
 func (cl *Client) dialFirst(ctx context.Context, addr string) (res DialResult) {
-	return DialFirst(ctx, addr, cl.dialers)
+	var dialers []Dialer
+	for _, d := range cl.dialers {
+		if cl.dialerEnabled(d) {
+			dialers = append(dialers, d)
+		}
+	}
+	return DialFirst(ctx, addr, dialers)
 }
 
 // Returns a connection over UTP or TCP, whichever is first to connect.
@@ -724,11 +955,20 @@ func (cl *Client) initiateProtocolHandshakes(
 	if err != nil {
 		panic(err)
 	}
+	// The handshakes are bounded by the deadline, so cancellation brings it forward.
+	stopCancelDeadline := context.AfterFunc(ctx, func() {
+		nc.SetDeadline(time.Now())
+	})
+	defer stopCancelDeadline()
+	cl.handshakes.outgoingInProgress.Add(1)
 	err = cl.initiateHandshakes(c, t)
+	cl.handshakes.outgoingInProgress.Add(-1)
+	cl.handshakes.countResult(err)
 	return
 }
 
 func doProtocolHandshakeOnDialResult(
+	ctx context.Context,
 	t *Torrent,
 	obfuscatedHeader bool,
 	addr PeerRemoteAddr,
@@ -740,7 +980,7 @@ func doProtocolHandshakeOnDialResult(
 	nc := dr.Conn
 	addrIpPort, _ := tryIpPortFromNetAddr(addr)
 	c, err = cl.initiateProtocolHandshakes(
-		context.Background(), nc, t, obfuscatedHeader,
+		ctx, nc, t, obfuscatedHeader,
 		newConnectionOpts{
 			outgoing:   true,
 			remoteAddr: addr,
@@ -755,41 +995,73 @@ func doProtocolHandshakeOnDialResult(
 	return c, err
 }
 
+// PEX peers that don't advertise uTP support aren't dialed over uTP, unless no other enabled
+// transport can reach them.
+func (cl *Client) skipUtpDial(p PeerInfo) bool {
+	if p.Source != PeerSourcePex || p.Get(pp.PexSupportsUtp) {
+		return false
+	}
+	for _, d := range cl.dialers {
+		if cl.dialerEnabled(d) && networkTransport(d.DialerNetwork()) != "utp" {
+			return true
+		}
+	}
+	return false
+}
+
 // Returns nil connection and nil error if no connection could be established for valid reasons.
 func (cl *Client) dialAndCompleteHandshake(opts outgoingConnOpts) (c *PeerConn, err error) {
-	// It would be better if dial rate limiting could be tested when considering to open connections
-	// instead. Doing it here means if the limit is low, and the half-open limit is high, we could
-	// end up with lots of outgoing connection attempts pending that were initiated on stale data.
-	{
-		dialReservation := cl.config.DialRateLimiter.Reserve()
-		if !opts.receivedHolepunchConnect {
-			if !dialReservation.OK() {
-				err = errors.New("can't make dial limit reservation")
-				return
-			}
-			time.Sleep(dialReservation.Delay())
-		}
+	// Regular dials have already been allowed by Client.allowDial. Responses to holepunch connects
+	// can't wait, but still take from the limit so other dials make way.
+	if opts.receivedHolepunchConnect {
+		cl.config.DialRateLimiter.Reserve()
 	}
 	torrent.Add("establish outgoing connection", 1)
 	addr := opts.peerInfo.Addr
 	dialPool := dialPool{
-		resCh: make(chan DialResult),
-		addr:  addr.String(),
+		resCh:    make(chan DialResult),
+		addr:     addr.String(),
+		onResult: cl.countTransportDialResult,
 	}
 	defer dialPool.startDrainer()
 	dialTimeout := opts.t.getDialTimeoutUnlocked()
+	// Dials and handshakes end when the Torrent closes, as closing waits for them.
+	closedCtx, cancelClosedCtx := opts.t.closedContext(context.Background())
+	defer cancelClosedCtx()
 	{
-		ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+		ctx, cancel := context.WithTimeout(closedCtx, dialTimeout)
 		defer cancel()
+		skipUtp := cl.skipUtpDial(opts.peerInfo)
 		for _, d := range cl.dialers {
+			if !cl.dialerEnabled(d) {
+				continue
+			}
+			if skipUtp && networkTransport(d.DialerNetwork()) == "utp" {
+				continue
+			}
+			if opts.receivedHolepunchConnect {
+				d = holepunchDialer(d)
+			}
+			cl.transports.get(networkTransport(d.DialerNetwork())).dialsStarted.Add(1)
 			dialPool.add(ctx, d)
 		}
 	}
 	holepunchAddr, holepunchAddrErr := addrPortFromPeerRemoteAddr(addr)
 	headerObfuscationPolicy := opts.HeaderObfuscationPolicy
 	obfuscatedHeaderFirst := headerObfuscationPolicy.Preferred
+	if !headerObfuscationPolicy.RequirePreferred {
+		if remembered, ok := cl.rememberedHeaderObfuscation(addr.String()); ok {
+			obfuscatedHeaderFirst = remembered
+		} else if opts.peerInfo.Get(pp.PexPrefersEncryption) {
+			obfuscatedHeaderFirst = true
+		}
+	}
 	firstDialResult := dialPool.getFirst()
 	if firstDialResult.Conn == nil {
+		if closedCtx.Err() != nil {
+			err = ErrTorrentClosed
+			return
+		}
 		// No dialers worked. Try to initiate a holepunching rendezvous.
 		if holepunchAddrErr == nil {
 			cl.lock()
@@ -814,6 +1086,7 @@ func (cl *Client) dialAndCompleteHandshake(opts outgoingConnOpts) (c *PeerConn,
 		cl.unlock()
 	}
 	c, err = doProtocolHandshakeOnDialResult(
+		closedCtx,
 		opts.t,
 		obfuscatedHeaderFirst,
 		addr,
@@ -821,6 +1094,7 @@ func (cl *Client) dialAndCompleteHandshake(opts outgoingConnOpts) (c *PeerConn,
 	)
 	if err == nil {
 		torrent.Add("initiated conn with preferred header obfuscation", 1)
+		cl.rememberHeaderObfuscation(addr.String(), obfuscatedHeaderFirst)
 		return
 	}
 	c.logger.Levelf(
@@ -835,8 +1109,9 @@ func (cl *Client) dialAndCompleteHandshake(opts outgoingConnOpts) (c *PeerConn,
 	}
 	// Reuse the dialer that returned already but failed to handshake.
 	{
-		ctx, cancel := context.WithTimeout(context.Background(), dialTimeout)
+		ctx, cancel := context.WithTimeout(closedCtx, dialTimeout)
 		defer cancel()
+		cl.transports.get(networkTransport(firstDialResult.Dialer.DialerNetwork())).dialsStarted.Add(1)
 		dialPool.add(ctx, firstDialResult.Dialer)
 	}
 	secondDialResult := dialPool.getFirst()
@@ -844,6 +1119,7 @@ func (cl *Client) dialAndCompleteHandshake(opts outgoingConnOpts) (c *PeerConn,
 		return
 	}
 	c, err = doProtocolHandshakeOnDialResult(
+		closedCtx,
 		opts.t,
 		!obfuscatedHeaderFirst,
 		addr,
@@ -851,6 +1127,7 @@ func (cl *Client) dialAndCompleteHandshake(opts outgoingConnOpts) (c *PeerConn,
 	)
 	if err == nil {
 		torrent.Add("initiated conn with fallback header obfuscation", 1)
+		cl.rememberHeaderObfuscation(addr.String(), !obfuscatedHeaderFirst)
 		return
 	}
 	c.logger.Levelf(
@@ -888,6 +1165,7 @@ func (cl *Client) outgoingConnection(
 	defer cl.unlock()
 	// Don't release lock between here and addPeerConn, unless it's for failure.
 	cl.noLongerHalfOpen(opts.t, opts.peerInfo.Addr.String(), attemptKey)
+	opts.t.recordPeerDial(opts.peerInfo.Addr, err == nil)
 	if err != nil {
 		if cl.config.Debug {
 			cl.logger.Levelf(
@@ -901,6 +1179,7 @@ func (cl *Client) outgoingConnection(
 	}
 	defer c.close()
 	c.Discovery = opts.peerInfo.Source
+	c.DiscoveryFlags = opts.peerInfo.PexPeerFlags
 	c.trusted = opts.peerInfo.Trusted
 	opts.t.runHandshookConnLoggingErr(c)
 }
@@ -924,7 +1203,7 @@ func (cl *Client) initiateHandshakes(c *PeerConn, t *Torrent) (err error) {
 		)
 		c.setRW(rw)
 		if err != nil {
-			return fmt.Errorf("header obfuscation handshake: %w", err)
+			return handshakeEncryptionError{fmt.Errorf("header obfuscation handshake: %w", err)}
 		}
 	}
 	ih, err := cl.connBtHandshake(c, t.canonicalShortInfohash())
@@ -938,49 +1217,19 @@ func (cl *Client) initiateHandshakes(c *PeerConn, t *Torrent) (err error) {
 		c.v2 = true
 		return nil
 	}
-	err = errors.New("bittorrent protocol handshake: peer infohash didn't match")
+	err = errHandshakeWrongInfohash
 	return
 }
 
-// Calls f with any secret keys. Note that it takes the Client lock, and so must be used from code
-// that won't also try to take the lock. This saves us copying all the infohashes everytime.
-func (cl *Client) forSkeys(f func([]byte) bool) {
-	cl.rLock()
-	defer cl.rUnlock()
-	if false { // Emulate the bug from #114
-		var firstIh InfoHash
-		for ih := range cl.torrentsByShortHash {
-			firstIh = ih
-			break
-		}
-		for range cl.torrentsByShortHash {
-			if !f(firstIh[:]) {
-				break
-			}
-		}
-		return
-	}
-	for ih := range cl.torrentsByShortHash {
-		if !f(ih[:]) {
-			break
-		}
-	}
-}
-
-func (cl *Client) handshakeReceiverSecretKeys() mse.SecretKeyIter {
-	if ret := cl.config.Callbacks.ReceiveEncryptedHandshakeSkeys; ret != nil {
-		return ret
-	}
-	return cl.forSkeys
-}
-
 // Do encryption and bittorrent handshakes as receiver.
-func (cl *Client) receiveHandshakes(c *PeerConn) (t *Torrent, err error) {
+func (cl *Client) receiveHandshakes(c *PeerConn) (t *Torrent, ih InfoHash, err error) {
 	defer perf.ScopeTimerErr(&err)()
 	var rw io.ReadWriter
+	skeys, skeyLookup := cl.handshakeReceiverSecretKeys()
 	rw, c.headerEncrypted, c.cryptoMethod, err = handleEncryption(
 		c.rw(),
-		cl.handshakeReceiverSecretKeys(),
+		skeys,
+		skeyLookup,
 		cl.config.HeaderObfuscationPolicy,
 		cl.config.CryptoSelector,
 	)
@@ -997,23 +1246,40 @@ func (cl *Client) receiveHandshakes(c *PeerConn) (t *Torrent, err error) {
 	if err != nil {
 		if err == mse.ErrNoSecretKeyMatch {
 			err = nil
+		} else {
+			err = handshakeEncryptionError{err}
 		}
 		return
 	}
 	if cl.config.HeaderObfuscationPolicy.RequirePreferred && c.headerEncrypted != cl.config.HeaderObfuscationPolicy.Preferred {
-		err = errors.New("connection does not have required header obfuscation")
+		err = handshakeEncryptionError{errors.New("connection does not have required header obfuscation")}
 		return
 	}
-	ih, err := cl.connBtHandshake(c, nil)
+	ih, err = cl.connBtHandshake(c, nil)
 	if err != nil {
-		return nil, fmt.Errorf("during bt handshake: %w", err)
+		return nil, ih, fmt.Errorf("during bt handshake: %w", err)
 	}
 	cl.lock()
 	t = cl.torrentsByShortHash[ih]
 	cl.unlock()
+	if t == nil {
+		t = cl.onUnknownInfoHash(ih)
+	}
 	return
 }
 
+// Gives ClientConfig.OnUnknownInfoHash the chance to add a Torrent for an incoming handshake.
+func (cl *Client) onUnknownInfoHash(ih InfoHash) *Torrent {
+	f := cl.config.OnUnknownInfoHash
+	if f == nil || f(cl, ih) == nil {
+		return nil
+	}
+	cl.lock()
+	defer cl.unlock()
+	// Use the Torrent the Client has for the infohash, in case the callback returned another.
+	return cl.torrentsByShortHash[ih]
+}
+
 var successfulPeerWireProtocolHandshakePeerReservedBytes expvar.Map
 
 func init() {
@@ -1032,7 +1298,7 @@ func (cl *Client) connBtHandshake(c *PeerConn, ih *metainfo.Hash) (ret metainfo.
 	ret = res.Hash
 	c.PeerExtensionBytes = res.PeerExtensionBits
 	c.PeerID = res.PeerID
-	c.completedHandshake = time.Now()
+	c.completedHandshake = cl.clock().Now()
 	if cb := cl.config.Callbacks.CompletedHandshake; cb != nil {
 		cb(c, res.Hash)
 	}
@@ -1044,7 +1310,19 @@ func (cl *Client) runReceivedConn(c *PeerConn) {
 	if err != nil {
 		panic(err)
 	}
-	t, err := cl.receiveHandshakes(c)
+	t, ih, err := cl.receiveHandshakes(c)
+	cl.lock()
+	cl.numHalfAccepted--
+	selfTest := cl.takeSelfTestAddr(c.RemoteAddr)
+	cl.unlock()
+	if selfTest {
+		return
+	}
+	if err == nil && t == nil {
+		cl.handshakes.countResult(errHandshakeUnknownInfohash)
+	} else {
+		cl.handshakes.countResult(err)
+	}
 	if err != nil {
 		cl.logger.LazyLog(log.Debug, func() log.Msg {
 			return log.Fmsg(
@@ -1070,6 +1348,10 @@ func (cl *Client) runReceivedConn(c *PeerConn) {
 		return
 	}
 	torrent.Add("received handshake for loaded torrent", 1)
+	if !cl.acceptPeerConnPolicy(c.conn.RemoteAddr(), &ih) {
+		torrent.Add("handshook conns rejected by AcceptPeerConn", 1)
+		return
+	}
 	c.conn.SetWriteDeadline(time.Time{})
 	cl.lock()
 	defer cl.unlock()
@@ -1078,6 +1360,10 @@ func (cl *Client) runReceivedConn(c *PeerConn) {
 
 // Client lock must be held before entering this.
 func (t *Torrent) runHandshookConn(pc *PeerConn) error {
+	if !t.addBackgroundWork() {
+		return ErrTorrentClosed
+	}
+	defer t.backgroundWork.Done()
 	pc.setTorrent(t)
 	cl := t.cl
 	for i, b := range cl.config.MinPeerExtensions {
@@ -1128,7 +1414,7 @@ func (p *Peer) initUpdateRequestsTimer() {
 		}
 	}
 	if enableUpdateRequestsTimer {
-		p.updateRequestsTimer = time.AfterFunc(math.MaxInt64, p.updateRequestsTimerFunc)
+		p.updateRequestsTimer = p.t.cl.clock().AfterFunc(math.MaxInt64, p.updateRequestsTimerFunc)
 	}
 }
 
@@ -1144,7 +1430,7 @@ func (c *Peer) updateRequestsTimerFunc() {
 		// If there are no outstanding requests, then a request update should have already run.
 		return
 	}
-	if d := time.Since(c.lastRequestUpdate); d < updateRequestsTimerDuration {
+	if d := c.now().Sub(c.lastRequestUpdate); d < updateRequestsTimerDuration {
 		// These should be benign, Timer.Stop doesn't guarantee that its function won't run if it's
 		// already been fired.
 		torrent.Add("spurious timer requests updates", 1)
@@ -1153,34 +1439,55 @@ func (c *Peer) updateRequestsTimerFunc() {
 	c.updateRequests(peerUpdateRequestsTimerReason)
 }
 
-// Maximum pending requests we allow peers to send us. If peer requests are buffered on read, this
-// instructs the amount of memory that might be used to cache pending writes. Assuming 512KiB
-// (1<<19) cached for sending, for 16KiB (1<<14) chunks.
+// Default maximum pending requests we allow peers to send us. If peer requests are buffered on
+// read, this instructs the amount of memory that might be used to cache pending writes. Assuming
+// 512KiB (1<<19) cached for sending, for 16KiB (1<<14) chunks.
 const localClientReqq = 1024
 
+// The reqq we advertise to peers, and enforce on the requests they send us.
+func (cl *Client) localReqq() int {
+	if cl.config.PeerRequestQueueLength > 0 {
+		return cl.config.PeerRequestQueueLength
+	}
+	return localClientReqq
+}
+
+// The extended handshake to send, without identifying information in anonymous mode.
+func (pc *PeerConn) extendedHandshakeMessage() pp.ExtendedHandshakeMessage {
+	t := pc.t
+	cl := t.cl
+	msg := pp.ExtendedHandshakeMessage{
+		V:            cl.config.ExtendedHandshakeClientVersion,
+		Reqq:         cl.localReqq(),
+		YourIp:       pp.CompactIp(pc.remoteIp()),
+		Encryption:   cl.config.HeaderObfuscationPolicy.Preferred || !cl.config.HeaderObfuscationPolicy.RequirePreferred,
+		Port:         cl.incomingPeerPort(),
+		MetadataSize: t.metadataSize(),
+		UploadOnly:   t.partialSeed(),
+		// TODO: We can figure these out specific to the socket used.
+		Ipv4: pp.CompactIp(cl.publicIp4().To4()),
+		Ipv6: cl.publicIp6().To16(),
+	}
+	if cl.config.AnonymousMode {
+		msg.V = ""
+		msg.YourIp = nil
+		msg.Port = 0
+		msg.Ipv4 = nil
+		msg.Ipv6 = nil
+	}
+	msg.M = pc.LocalLtepProtocolMap.toSupportedExtensionDict()
+	return msg
+}
+
 // See the order given in Transmission's tr_peerMsgsNew.
 func (pc *PeerConn) sendInitialMessages() {
 	t := pc.t
 	cl := t.cl
 	if pc.PeerExtensionBytes.SupportsExtended() && cl.config.Extensions.SupportsExtended() {
 		pc.write(pp.Message{
-			Type:       pp.Extended,
-			ExtendedID: pp.HandshakeExtendedID,
-			ExtendedPayload: func() []byte {
-				msg := pp.ExtendedHandshakeMessage{
-					V:            cl.config.ExtendedHandshakeClientVersion,
-					Reqq:         localClientReqq,
-					YourIp:       pp.CompactIp(pc.remoteIp()),
-					Encryption:   cl.config.HeaderObfuscationPolicy.Preferred || !cl.config.HeaderObfuscationPolicy.RequirePreferred,
-					Port:         cl.incomingPeerPort(),
-					MetadataSize: t.metadataSize(),
-					// TODO: We can figure these out specific to the socket used.
-					Ipv4: pp.CompactIp(cl.config.PublicIp4.To4()),
-					Ipv6: cl.config.PublicIp6.To16(),
-				}
-				msg.M = pc.LocalLtepProtocolMap.toSupportedExtensionDict()
-				return bencode.MustMarshal(msg)
-			}(),
+			Type:            pp.Extended,
+			ExtendedID:      pp.HandshakeExtendedID,
+			ExtendedPayload: bencode.MustMarshal(pc.extendedHandshakeMessage()),
 		})
 	}
 	func() {
@@ -1237,7 +1544,7 @@ func (cl *Client) gotMetadataExtensionMsg(payload []byte, t *Torrent, c *PeerCon
 			return fmt.Errorf("data has bad offset in payload: %d", begin)
 		}
 		t.saveMetadataPiece(piece, payload[begin:])
-		c.lastUsefulChunkReceived = time.Now()
+		c.lastUsefulChunkReceived = c.now()
 		err = t.maybeCompleteMetadata()
 		if err != nil {
 			// Log this at the Torrent-level, as we don't partition metadata by Peer yet, so we
@@ -1336,6 +1643,7 @@ func (cl *Client) newTorrentOpt(opts AddTorrentOpts) (t *Torrent) {
 		webSeeds:     make(map[string]*Peer),
 		gotMetainfoC: make(chan struct{}),
 	}
+	t.peers.getScore = t.reservePeerScore
 	var salt [8]byte
 	rand.Read(salt[:])
 	t.smartBanCache.Hash = func(b []byte) uint64 {
@@ -1346,12 +1654,14 @@ func (cl *Client) newTorrentOpt(opts AddTorrentOpts) (t *Torrent) {
 	}
 	t.smartBanCache.Init()
 	t.networkingEnabled.Set()
+	t.dataDownloadDisallowed.SetBool(cl.config.ServeOnly)
 	t.logger = cl.logger.WithDefaultLevel(log.Debug)
 	t.sourcesLogger = t.logger.WithNames("sources")
 	if opts.ChunkSize == 0 {
 		opts.ChunkSize = defaultChunkSize
 	}
 	t.setChunkSize(opts.ChunkSize)
+	t.loadPersistedStats()
 	return
 }
 
@@ -1385,13 +1695,14 @@ func (cl *Client) AddTorrentInfoHashWithStorage(
 	t = cl.newTorrent(infoHash, specStorage)
 	cl.eachDhtServer(func(s DhtServer) {
 		if cl.config.PeriodicallyAnnounceTorrentsToDht {
-			go t.dhtAnnouncer(s)
+			t.goBackground(func() { t.dhtAnnouncer(s) })
 		}
 	})
-	cl.torrentsByShortHash[infoHash] = t
+	cl.setTorrentShortHash(infoHash, t)
 	cl.torrents[t] = struct{}{}
 	cl.clearAcceptLimits()
 	t.updateWantPeersEvent()
+	t.startInfoLookup()
 	// Tickle Client.waitAccept, new torrent may want conns.
 	cl.event.Broadcast()
 	return
@@ -1400,6 +1711,18 @@ func (cl *Client) AddTorrentInfoHashWithStorage(
 // Adds a torrent by InfoHash with a custom Storage implementation. If the torrent already exists
 // then this Storage is ignored and the existing torrent returned with `new` set to `false`.
 func (cl *Client) AddTorrentOpt(opts AddTorrentOpts) (t *Torrent, new bool) {
+	t, new, _ = cl.addTorrentOpt(opts, false)
+	if new {
+		cl.lock()
+		t.startInfoLookup()
+		cl.unlock()
+	}
+	return
+}
+
+// Adds a torrent as for AddTorrentOpt, returning ErrTooManyTorrents instead if it's new and limit
+// is set and ClientConfig.MaxTorrents has been reached.
+func (cl *Client) addTorrentOpt(opts AddTorrentOpts, limit bool) (t *Torrent, new bool, err error) {
 	infoHash := opts.InfoHash
 	cl.lock()
 	defer cl.unlock()
@@ -1413,15 +1736,21 @@ func (cl *Client) AddTorrentOpt(opts AddTorrentOpts) (t *Torrent, new bool) {
 			return
 		}
 	}
+	if limit {
+		err = cl.torrentLimitErr()
+		if err != nil {
+			return
+		}
+	}
 	new = true
 
 	t = cl.newTorrentOpt(opts)
 	cl.eachDhtServer(func(s DhtServer) {
 		if cl.config.PeriodicallyAnnounceTorrentsToDht {
-			go t.dhtAnnouncer(s)
+			t.goBackground(func() { t.dhtAnnouncer(s) })
 		}
 	})
-	cl.torrentsByShortHash[infoHash] = t
+	cl.setTorrentShortHash(infoHash, t)
 	cl.torrents[t] = struct{}{}
 	t.setInfoBytesLocked(opts.InfoBytes)
 	cl.clearAcceptLimits()
@@ -1439,15 +1768,18 @@ type AddTorrentOpts struct {
 	InfoBytes  []byte
 }
 
-// Add or merge a torrent spec. Returns new if the torrent wasn't already in the client. See also
-// Torrent.MergeSpec.
+// Add or merge a torrent spec. Returns new if the torrent wasn't already in the client. Returns
+// ErrTooManyTorrents if ClientConfig.MaxTorrents would be exceeded. See also Torrent.MergeSpec.
 func (cl *Client) AddTorrentSpec(spec *TorrentSpec) (t *Torrent, new bool, err error) {
-	t, new = cl.AddTorrentOpt(AddTorrentOpts{
+	t, new, err = cl.addTorrentOpt(AddTorrentOpts{
 		InfoHash:   spec.InfoHash,
 		InfoHashV2: spec.InfoHashV2,
 		Storage:    spec.Storage,
 		ChunkSize:  spec.ChunkSize,
-	})
+	}, true)
+	if err != nil {
+		return
+	}
 	modSpec := *spec
 	if new {
 		// ChunkSize was already applied by adding a new Torrent, and MergeSpec disallows changing
@@ -1457,29 +1789,52 @@ func (cl *Client) AddTorrentSpec(spec *TorrentSpec) (t *Torrent, new bool, err e
 	err = t.MergeSpec(&modSpec)
 	if err != nil && new {
 		t.Drop()
+		return
+	}
+	if new {
+		// After merging, so info bytes in the spec aren't looked up.
+		cl.lock()
+		t.startInfoLookup()
+		cl.unlock()
 	}
 	return
 }
 
 // The trackers will be merged with the existing ones. If the Info isn't yet known, it will be set.
-// spec.DisallowDataDownload/Upload will be read and applied
+// spec.DisallowDataDownload/Upload will be read and applied, as are any spec.AnnounceOverrides.
 // The display name is replaced if the new spec provides one. Note that any `Storage` is ignored.
 func (t *Torrent) MergeSpec(spec *TorrentSpec) error {
 	if spec.DisplayName != "" {
 		t.SetDisplayName(spec.DisplayName)
 	}
+	cl := t.cl
+	if spec.SeedMode {
+		cl.lock()
+		t.seedMode = true
+		cl.unlock()
+	}
+	if spec.Encoding != "" {
+		cl.lock()
+		t.infoEncoding = spec.Encoding
+		cl.unlock()
+	}
 	if spec.InfoBytes != nil {
 		err := t.SetInfoBytes(spec.InfoBytes)
 		if err != nil {
 			return err
 		}
 	}
-	cl := t.cl
 	cl.AddDhtNodes(spec.DhtNodes)
 	t.UseSources(spec.Sources)
 	cl.lock()
 	defer cl.unlock()
 	t.initialPieceCheckDisabled = spec.DisableInitialPieceCheck
+	if spec.SelectOnly != nil {
+		t.selectOnlyFiles = spec.SelectOnly
+		if t.haveInfo() {
+			t.applySelectOnlyFiles()
+		}
+	}
 	for _, url := range spec.Webseeds {
 		t.addWebSeed(url)
 	}
@@ -1493,46 +1848,67 @@ func (t *Torrent) MergeSpec(spec *TorrentSpec) error {
 	if spec.ChunkSize != 0 {
 		panic("chunk size cannot be changed for existing Torrent")
 	}
+	if spec.AnnounceOverrides != (AnnounceOverrides{}) {
+		t.announceOverrides = spec.AnnounceOverrides
+	}
 	t.addTrackers(spec.Trackers)
 	t.maybeNewConns()
-	t.dataDownloadDisallowed.SetBool(spec.DisallowDataDownload)
+	t.dataDownloadDisallowed.SetBool(spec.DisallowDataDownload || cl.config.ServeOnly)
 	t.dataUploadDisallowed = spec.DisallowDataUpload
 	return t.AddPieceLayers(spec.PieceLayers)
 }
 
 func (cl *Client) dropTorrent(t *Torrent, wg *sync.WaitGroup) (err error) {
 	t.eachShortInfohash(func(short [20]byte) {
-		delete(cl.torrentsByShortHash, short)
+		cl.deleteTorrentShortHash(short)
 	})
 	err = t.close(wg)
 	delete(cl.torrents, t)
+	delete(cl.deferredMetadataTorrents, t)
+	if t.metadataInFlight != 0 {
+		t.setMetadataInFlight(0)
+		cl.retryDeferredMetadataAllocs()
+	}
 	return
 }
 
-func (cl *Client) allTorrentsCompleted() bool {
+// Returns a torrent that isn't complete, or nil if they all are.
+func (cl *Client) incompleteTorrent() *Torrent {
 	for t := range cl.torrents {
-		if !t.haveInfo() {
-			return false
-		}
-		if !t.haveAllPieces() {
-			return false
+		if !t.Complete.Bool() {
+			return t
 		}
 	}
-	return true
+	return nil
 }
 
 // Returns true when all torrents are completely downloaded and false if the
-// client is stopped before that.
+// client is stopped before that. See Torrent.Wait to wait for individual
+// torrents.
 func (cl *Client) WaitAll() bool {
-	cl.lock()
-	defer cl.unlock()
-	for !cl.allTorrentsCompleted() {
-		if cl.closed.IsSet() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-cl.closed.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	for {
+		cl.rLock()
+		t := cl.incompleteTorrent()
+		closed := cl.closed.IsSet()
+		cl.rUnlock()
+		if t == nil {
+			return true
+		}
+		if closed {
 			return false
 		}
-		cl.event.Wait()
+		// Returns early if t is dropped, which removes it from consideration.
+		t.Wait(ctx)
 	}
-	return true
 }
 
 // Returns handles to all the torrents loaded in the Client.
@@ -1558,6 +1934,41 @@ func (cl *Client) AddMagnet(uri string) (T *Torrent, err error) {
 	return
 }
 
+// Resolves the metainfo for a magnet link from the swarm, using peers from the DHT, trackers and the
+// link itself, without downloading or uploading any piece data. If the torrent wasn't already in
+// the Client, it's dropped again before returning, which ends its networking.
+func (cl *Client) GetMetainfo(ctx context.Context, magnet string) (*metainfo.MetaInfo, error) {
+	spec, err := TorrentSpecFromMagnetUri(magnet)
+	if err != nil {
+		return nil, err
+	}
+	// Only used if the torrent is new.
+	spec.Storage = disabled.Client{}
+	t, new, err := cl.AddTorrentSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	if new {
+		t.DisallowDataDownload()
+		t.DisallowDataUpload()
+		defer t.Drop()
+	}
+	select {
+	case <-t.GotInfo():
+	case <-ctx.Done():
+		return nil, context.Cause(ctx)
+	case <-t.Closed():
+		// Another caller might have dropped it after the info arrived.
+		select {
+		case <-t.GotInfo():
+		default:
+			return nil, ErrTorrentClosed
+		}
+	}
+	mi := t.Metainfo()
+	return &mi, nil
+}
+
 func (cl *Client) AddTorrent(mi *metainfo.MetaInfo) (T *Torrent, err error) {
 	ts, err := TorrentSpecFromMetaInfoErr(mi)
 	if err != nil {
@@ -1593,7 +2004,7 @@ func (cl *Client) AddDhtNodes(nodes []string) {
 				Port: hmp.Port,
 			},
 		}
-		cl.eachDhtServer(func(s DhtServer) {
+		cl.eachDhtServerForIp(ip, func(s DhtServer) {
 			s.AddNode(ni)
 		})
 	}
@@ -1641,11 +2052,15 @@ func (cl *Client) newConnection(nc net.Conn, opts newConnectionOpts) (c *PeerCon
 			localPublicAddr: opts.localPublicAddr,
 			Network:         opts.network,
 			callbacks:       &cl.config.Callbacks,
+			clock:           cl.clock(),
 		},
 		connString: opts.connString,
 		conn:       nc,
 	}
 	c.peerRequestDataAllocLimiter.Max = cl.config.MaxAllocPeerRequestDataPerConn
+	if n := cl.config.PeerConnMessageTraceLength; n > 0 {
+		c.messageTrace = newMessageTrace(n)
+	}
 	c.initRequestState()
 	// TODO: Need to be much more explicit about this, including allowing non-IP bannable addresses.
 	if opts.remoteAddr != nil {
@@ -1674,6 +2089,11 @@ func (cl *Client) newConnection(nc net.Conn, opts newConnectionOpts) (c *PeerCon
 }
 
 func (cl *Client) onDHTAnnouncePeer(ih metainfo.Hash, ip net.IP, port int, portOk bool) {
+	// The server sets the port from implied_port if requested. Without either there's no address
+	// to connect to.
+	if !portOk || port == 0 {
+		return
+	}
 	cl.lock()
 	defer cl.unlock()
 	t := cl.torrentsByShortHash[ih]
@@ -1713,16 +2133,15 @@ func (cl *Client) findListener(f func(Listener) bool) (ret Listener) {
 }
 
 func (cl *Client) publicIp(peer net.IP) net.IP {
-	// TODO: Use BEP 10 to determine how peers are seeing us.
 	if peer.To4() != nil {
 		return firstNotNil(
-			cl.config.PublicIp4,
+			cl.publicIp4(),
 			cl.findListenerIp(func(ip net.IP) bool { return ip.To4() != nil }),
 		)
 	}
 
 	return firstNotNil(
-		cl.config.PublicIp6,
+		cl.publicIp6(),
 		cl.findListenerIp(func(ip net.IP) bool { return ip.To4() == nil }),
 	)
 }
@@ -1755,11 +2174,52 @@ func (cl *Client) ListenAddrs() (ret []net.Addr) {
 	return
 }
 
+// The ports the Client is reachable on, by protocol. Each is zero if there's no such listener. If
+// listeners for different address families use different ports, the first is given.
+type ListenPorts struct {
+	Tcp int
+	Utp int
+	Dht int
+}
+
+// Returns the ports in use for incoming peer connections and the DHT. LocalPort only gives the
+// first listener's port, which may not be the one wanted if TCP and uTP are bound separately.
+func (cl *Client) ListenPorts() ListenPorts {
+	cl.rLock()
+	defer cl.rUnlock()
+	return cl.listenPorts()
+}
+
+func (cl *Client) listenPorts() (ret ListenPorts) {
+	setIfZero := func(port *int, addr net.Addr) {
+		if *port == 0 {
+			*port = addrPortOrZero(addr)
+		}
+	}
+	for _, l := range cl.listeners {
+		n := parseNetworkString(l.Addr().Network())
+		switch {
+		case n.Tcp:
+			setIfZero(&ret.Tcp, l.Addr())
+		case n.Udp:
+			setIfZero(&ret.Utp, l.Addr())
+		}
+	}
+	for _, s := range cl.dhtServers {
+		setIfZero(&ret.Dht, s.Addr())
+	}
+	return
+}
+
+// Returns our external IPs, from ClientConfig.PublicIp4 and PublicIp6 if set, and otherwise as
+// reported by peers and trackers by majority vote.
 func (cl *Client) PublicIPs() (ips []net.IP) {
-	if ip := cl.config.PublicIp4; ip != nil {
+	cl.rLock()
+	defer cl.rUnlock()
+	if ip := cl.publicIp4(); ip != nil {
 		ips = append(ips, ip)
 	}
-	if ip := cl.config.PublicIp6; ip != nil {
+	if ip := cl.publicIp6(); ip != nil {
 		ips = append(ips, ip)
 	}
 	return
@@ -1786,6 +2246,8 @@ func maskIpForAcceptLimiting(ip net.IP) net.IP {
 
 func (cl *Client) clearAcceptLimits() {
 	cl.acceptLimiter = nil
+	// Any left are for connections that were rejected before handshaking.
+	cl.selfTestAddrs = nil
 }
 
 func (cl *Client) acceptLimitClearer() {
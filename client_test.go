@@ -1,20 +1,28 @@
 package torrent
 
 import (
+	"context"
 	"encoding/binary"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
 	"net"
+	"net/http"
 	"net/netip"
+	"net/url"
 	"os"
 	"path/filepath"
 	"reflect"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"testing/iotest"
 	"time"
 
 	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/krpc"
 	"github.com/anacrolix/log"
 	"github.com/anacrolix/missinggo/v2"
 	"github.com/anacrolix/missinggo/v2/filecache"
@@ -22,12 +30,15 @@ import (
 	qt "github.com/frankban/quicktest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/time/rate"
 
 	"github.com/anacrolix/torrent/bencode"
 	"github.com/anacrolix/torrent/internal/testutil"
 	"github.com/anacrolix/torrent/iplist"
 	"github.com/anacrolix/torrent/metainfo"
+	pp "github.com/anacrolix/torrent/peer_protocol"
 	"github.com/anacrolix/torrent/storage"
+	"github.com/anacrolix/torrent/tracker"
 )
 
 func TestClientDefault(t *testing.T) {
@@ -475,8 +486,14 @@ func TestAddMetainfoWithNodes(t *testing.T) {
 	// Nodes are not added or exposed in Torrent's metainfo. We just randomly
 	// check if the announce-list is here instead. TODO: Add nodes.
 	assert.Len(t, tt.metainfo.AnnounceList, 5)
-	// There are 6 nodes in the torrent file.
-	for sum() != int64(6*len(cl.dhtServers)) {
+	// There are 6 IPv4 nodes in the torrent file, and they're only given to IPv4 servers.
+	numIpv4Servers := 0
+	cl.eachDhtServer(func(s DhtServer) {
+		if !dhtServerIsIpv6(s) {
+			numIpv4Servers++
+		}
+	})
+	for sum() != int64(6*numIpv4Servers) {
 		time.Sleep(time.Millisecond)
 	}
 }
@@ -914,3 +931,332 @@ func TestClientConfigSetHandlerNotIgnored(t *testing.T) {
 	h := cl.logger.Handlers[0].(log.StreamHandler)
 	c.Check(h.W, qt.Equals, io.Discard)
 }
+
+func TestClientStateJSON(t *testing.T) {
+	c := qt.New(t)
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	state := cl.State()
+	c.Assert(state.Torrents, qt.HasLen, 1)
+	c.Check(state.Torrents[0].InfoHash, qt.Equals, tt.InfoHash().HexString())
+	c.Check(state.Torrents[0].HaveInfo, qt.IsTrue)
+	c.Check(state.Torrents[0].Length, qt.Equals, tt.Length())
+	b, err := cl.StateJSON()
+	c.Assert(err, qt.IsNil)
+	var decoded map[string]interface{}
+	c.Assert(json.Unmarshal(b, &decoded), qt.IsNil)
+	c.Check(decoded["PeerId"], qt.Equals, state.PeerId)
+	c.Check(decoded["Torrents"], qt.HasLen, 1)
+}
+
+func TestClientIdentityConfig(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.Bep20 = "-XX0100-"
+	cfg.AnnounceKey.Set(42)
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	peerId := cl.PeerID()
+	c.Check(string(peerId[:8]), qt.Equals, "-XX0100-")
+	c.Check(cl.announceKey(), qt.Equals, int32(42))
+}
+
+func TestLockDataDir(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.LockDataDir = true
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	_, err = NewClient(cfg)
+	var locked *ErrAlreadyLocked
+	c.Assert(errors.As(err, &locked), qt.IsTrue, qt.Commentf("%v", err))
+	c.Check(locked.Pid, qt.Equals, os.Getpid())
+	cl.Close()
+	cl, err = NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	cl.Close()
+}
+
+func TestPerTorrentStorage(t *testing.T) {
+	c := qt.New(t)
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	spec, err := TorrentSpecFromMetaInfoErr(mi)
+	c.Assert(err, qt.IsNil)
+	fileStorage := storage.NewFile(dir)
+	defer fileStorage.Close()
+	spec.Storage = fileStorage
+	withData, _, err := cl.AddTorrentSpec(spec)
+	c.Assert(err, qt.IsNil)
+	// A different piece length gives a different infohash for the same data.
+	withoutData, err := cl.AddTorrent(testutil.Greeting.Metainfo(6))
+	c.Assert(err, qt.IsNil)
+	withData.VerifyData()
+	withoutData.VerifyData()
+	c.Check(withData.BytesMissing(), qt.Equals, int64(0))
+	c.Check(withoutData.BytesMissing(), qt.Equals, withoutData.Length())
+}
+
+type testDhtServer struct {
+	DhtServer
+	addr  net.Addr
+	nodes []krpc.NodeInfo
+	pings chan *net.UDPAddr
+}
+
+func (me *testDhtServer) Ping(addr *net.UDPAddr) {
+	me.pings <- addr
+}
+
+func (me *testDhtServer) Addr() net.Addr {
+	return me.addr
+}
+
+func (me *testDhtServer) AddNode(ni krpc.NodeInfo) error {
+	me.nodes = append(me.nodes, ni)
+	return nil
+}
+
+func TestAddDhtNodesMatchesAddressFamily(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	s4 := &testDhtServer{addr: &net.UDPAddr{IP: net.IPv4zero}}
+	s6 := &testDhtServer{addr: &net.UDPAddr{IP: net.IPv6zero}}
+	cl.AddDhtServer(s4)
+	cl.AddDhtServer(s6)
+	cl.AddDhtNodes([]string{"1.2.3.4:6881", "[2001:db8::1]:6881"})
+	c.Assert(s4.nodes, qt.HasLen, 1)
+	c.Check(s4.nodes[0].Addr.IP.String(), qt.Equals, "1.2.3.4")
+	c.Assert(s6.nodes, qt.HasLen, 1)
+	c.Check(s6.nodes[0].Addr.IP.String(), qt.Equals, "2001:db8::1")
+}
+
+func TestDhtBootstrapNodes(t *testing.T) {
+	c := qt.New(t)
+	addrs, err := dhtBootstrapNodesGetter([]string{"127.0.0.1:6881", "no port", "[::1]:6882"})()
+	c.Assert(err, qt.IsNil)
+	c.Assert(addrs, qt.HasLen, 2)
+	c.Check(addrs[0].String(), qt.Equals, "127.0.0.1:6881")
+	c.Check(addrs[1].String(), qt.Equals, "[::1]:6882")
+	_, err = dhtBootstrapNodesGetter([]string{"no port"})()
+	c.Check(err, qt.IsNotNil)
+}
+
+func TestHeaderObfuscationPolicyForPeer(t *testing.T) {
+	c := qt.New(t)
+	requires := PeerInfo{RequiresEncryption: true}
+	policy, ok := HeaderObfuscationPolicy{}.forPeer(requires)
+	c.Check(ok, qt.IsTrue)
+	c.Check(policy, qt.Equals, HeaderObfuscationPolicy{RequirePreferred: true, Preferred: true})
+	policy, ok = HeaderObfuscationPolicy{}.forPeer(PeerInfo{})
+	c.Check(ok, qt.IsTrue)
+	c.Check(policy, qt.Equals, HeaderObfuscationPolicy{})
+	_, ok = HeaderObfuscationPolicy{RequirePreferred: true}.forPeer(requires)
+	c.Check(ok, qt.IsFalse)
+}
+
+func TestClientConfigPeerIdWrongLength(t *testing.T) {
+	cfg := TestingConfig(t)
+	cfg.PeerID = "too short"
+	_, err := NewClient(cfg)
+	qt.Assert(t, err, qt.IsNotNil)
+}
+
+func TestListenPorts(t *testing.T) {
+	c := qt.New(t)
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	ports := cl.ListenPorts()
+	c.Check(ports.Tcp, qt.Not(qt.Equals), 0)
+	// The listeners are created on a common port.
+	c.Check(ports.Utp, qt.Equals, ports.Tcp)
+	// The DHT is disabled for testing.
+	c.Check(ports.Dht, qt.Equals, 0)
+}
+
+func TestDhtPortPingQueued(t *testing.T) {
+	c := qt.New(t)
+	// The queue is serviced by a goroutine that NewClient starts.
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	s := &testDhtServer{addr: &net.UDPAddr{IP: net.IPv4zero}, pings: make(chan *net.UDPAddr, 1)}
+	cl.AddDhtServer(s)
+	cl.lock()
+	cl.queueDhtPortPing(net.UDPAddr{IP: net.IPv4(1, 2, 3, 4), Port: 6881})
+	// There's no server for IPv6 to queue a ping for.
+	cl.queueDhtPortPing(net.UDPAddr{IP: net.ParseIP("2001:db8::1"), Port: 6881})
+	cl.unlock()
+	c.Check((<-s.pings).String(), qt.Equals, "1.2.3.4:6881")
+	c.Check(s.pings, qt.HasLen, 0)
+}
+
+func TestServeOnlyClient(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.ServeOnly = true
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	c.Check(cl.uploadReadCache.capacity, qt.Equals, int64(defaultServeOnlyUploadReadCacheCapacity))
+	spec := TorrentSpecFromMetaInfo(testutil.GreetingMetaInfo())
+	spec.Webseeds = []string{"http://localhost/greeting"}
+	tt, _, err := cl.AddTorrentSpec(spec)
+	c.Assert(err, qt.IsNil)
+	tt.AllowDataDownload()
+	cl.lock()
+	defer cl.unlock()
+	c.Check(tt.dataDownloadDisallowed.Bool(), qt.IsTrue)
+	c.Check(tt.webSeeds, qt.HasLen, 0)
+	c.Check(tt.seeding(), qt.IsTrue)
+}
+
+func TestAcceptPeerConnPolicy(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.MinPeerExtensions.SetBit(pp.ExtensionBitFast, false)
+	var (
+		mu         sync.Mutex
+		infoHashes []*InfoHash
+	)
+	cfg.AcceptPeerConn = func(remote net.Addr, infoHash *InfoHash) bool {
+		mu.Lock()
+		defer mu.Unlock()
+		infoHashes = append(infoHashes, infoHash)
+		// Accept connections, then reject them once the torrent is known.
+		return infoHash == nil
+	}
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	ih := testutil.GreetingMetaInfo().HashInfoBytes()
+	cl.AddTorrentInfoHash(ih)
+	nc, err := net.Dial("tcp", fmt.Sprintf(":%d", cl.LocalPort()))
+	c.Assert(err, qt.IsNil)
+	defer nc.Close()
+	_, err = pp.Handshake(nc, &ih, [20]byte{}, PeerExtensionBits{})
+	c.Assert(err, qt.IsNil)
+	nc.SetReadDeadline(time.Now().Add(10 * time.Second))
+	// The connection is closed without any messages.
+	_, err = nc.Read(make([]byte, 1))
+	c.Check(err, qt.IsNotNil)
+	c.Check(errors.Is(err, os.ErrDeadlineExceeded), qt.IsFalse)
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(infoHashes, qt.HasLen, 2)
+	c.Check(infoHashes[0], qt.IsNil)
+	c.Check(*infoHashes[1], qt.Equals, ih)
+}
+
+func TestMaxHalfAcceptedConns(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.MaxHalfAcceptedConns = 1
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	cl.AddTorrentInfoHash(testutil.GreetingMetaInfo().HashInfoBytes())
+	dial := func() net.Conn {
+		nc, err := net.Dial("tcp", fmt.Sprintf(":%d", cl.LocalPort()))
+		c.Assert(err, qt.IsNil)
+		return nc
+	}
+	// Never sends a handshake.
+	first := dial()
+	defer first.Close()
+	for cl.Stats().HalfAcceptedConns != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	second := dial()
+	defer second.Close()
+	second.SetReadDeadline(time.Now().Add(10 * time.Second))
+	_, err = second.Read(make([]byte, 1))
+	c.Check(err, qt.IsNotNil)
+	c.Check(errors.Is(err, os.ErrDeadlineExceeded), qt.IsFalse)
+	first.Close()
+	for cl.Stats().HalfAcceptedConns != 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDisableAcceptRateLimitingAppliesToAcceptRateLimiter(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.AlwaysWantConns = true
+	// Never allows a connection.
+	cfg.AcceptRateLimiter = rate.NewLimiter(0, 0)
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	nc, _ := net.Pipe()
+	defer nc.Close()
+	c.Check(cl.rejectAccepted(nc), qt.IsNil)
+	cl.config.DisableAcceptRateLimiting = false
+	c.Check(cl.rejectAccepted(nc), qt.ErrorMatches, "accept rate limited")
+}
+
+type countingRoundTripper struct {
+	requests atomic.Int32
+}
+
+func (me *countingRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	me.requests.Add(1)
+	return http.DefaultTransport.RoundTrip(r)
+}
+
+func TestHTTPClientAndHeader(t *testing.T) {
+	c := qt.New(t)
+	var (
+		mu      sync.Mutex
+		headers = make(map[string][]string)
+	)
+	s := newGreetingWebseedServer(t, func(w http.ResponseWriter, r *http.Request) bool {
+		mu.Lock()
+		headers[r.URL.Path] = append(headers[r.URL.Path], r.Header.Get("Authorization"))
+		mu.Unlock()
+		if r.URL.Path != "/announce" {
+			return false
+		}
+		w.Write([]byte("d8:intervali1800e5:peers0:e"))
+		return true
+	})
+	transport := &countingRoundTripper{}
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = true
+	cfg.HTTPClient = &http.Client{Transport: transport}
+	cfg.HTTPHeader = http.Header{"Authorization": {"Bearer secret"}}
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt := downloadGreetingFromWebseed(c, cl, s.URL+"/greeting")
+	u, err := url.Parse(s.URL + "/announce")
+	c.Assert(err, qt.IsNil)
+	ts := &trackerScraper{
+		shortInfohash: *tt.canonicalShortInfohash(),
+		u:             *u,
+		t:             tt,
+	}
+	ar := ts.announce(context.Background(), tracker.Started)
+	c.Assert(ar.Err, qt.IsNil)
+	mu.Lock()
+	defer mu.Unlock()
+	c.Assert(headers["/greeting"], qt.Not(qt.HasLen), 0)
+	c.Assert(headers["/announce"], qt.HasLen, 1)
+	for path, values := range headers {
+		for _, v := range values {
+			c.Check(v, qt.Equals, "Bearer secret", qt.Commentf("%v", path))
+		}
+	}
+	// Every request went through the custom client.
+	c.Check(int(transport.requests.Load()), qt.Equals, len(headers["/greeting"])+len(headers["/announce"]))
+}
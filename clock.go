@@ -0,0 +1,98 @@
+package torrent
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// The Client's source of time for scheduling, such as request updates, connection pruning, tracker
+// announces, PEX, webseed backoff and transfer rates. Set ClientConfig.Clock to a simulated clock
+// to test request strategies and choking deterministically. Network deadlines and rate limiters
+// always use real time.
+type Clock interface {
+	Now() time.Time
+	// Like time.AfterFunc.
+	AfterFunc(d time.Duration, f func()) ClockTimer
+	// Like time.After.
+	After(d time.Duration) <-chan time.Time
+}
+
+// A timer created by Clock.AfterFunc. *time.Timer implements it.
+type ClockTimer interface {
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	return time.AfterFunc(d, f)
+}
+
+func (realClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+func (cl *Client) clock() Clock {
+	if c := cl.config.Clock; c != nil {
+		return c
+	}
+	return realClock{}
+}
+
+func (cn *Peer) now() time.Time {
+	if cn.clock == nil {
+		// Peers constructed directly in tests.
+		return time.Now()
+	}
+	return cn.clock.Now()
+}
+
+// A rand.Rand that's safe for concurrent use. See ClientConfig.RandSource.
+type lockedRand struct {
+	mu sync.Mutex
+	r  *rand.Rand
+}
+
+func (me *lockedRand) init(src rand.Source) {
+	if src == nil {
+		src = rand.NewSource(time.Now().UnixNano())
+	}
+	me.r = rand.New(src)
+}
+
+func (me *lockedRand) lock() {
+	me.mu.Lock()
+	if me.r == nil {
+		me.init(nil)
+	}
+}
+
+func (me *lockedRand) Float64() float64 {
+	me.lock()
+	defer me.mu.Unlock()
+	return me.r.Float64()
+}
+
+func (me *lockedRand) Int63n(n int64) int64 {
+	me.lock()
+	defer me.mu.Unlock()
+	return me.r.Int63n(n)
+}
+
+func (me *lockedRand) Perm(n int) []int {
+	me.lock()
+	defer me.mu.Unlock()
+	return me.r.Perm(n)
+}
+
+func (me *lockedRand) Shuffle(n int, swap func(i, j int)) {
+	me.lock()
+	defer me.mu.Unlock()
+	me.r.Shuffle(n, swap)
+}
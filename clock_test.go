@@ -0,0 +1,75 @@
+package torrent
+
+import (
+	"bytes"
+	"io"
+	"math/rand"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (me *fakeClock) Now() time.Time {
+	return me.now
+}
+
+func (me *fakeClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	// Never fires, as the tests advance time by hand.
+	return time.AfterFunc(time.Duration(1<<63-1), f)
+}
+
+func (me *fakeClock) After(d time.Duration) <-chan time.Time {
+	return nil
+}
+
+func TestPeerUsesClientClock(t *testing.T) {
+	c := qt.New(t)
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	cfg := TestingConfig(t)
+	cfg.Clock = clock
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	pc := cl.newConnection(nil, newConnectionOpts{network: "test"})
+	pc.setTorrent(cl.newTorrentForTesting())
+	pc.initMessageWriter()
+	pc.setInterested(true)
+	clock.now = clock.now.Add(10 * time.Second)
+	c.Check(pc.cumInterest(), qt.Equals, 10*time.Second)
+}
+
+func TestRandSourceDeterminesPieceRequestOrder(t *testing.T) {
+	c := qt.New(t)
+	info := metainfo.Info{
+		Name:        "a",
+		Length:      64 << 10,
+		PieceLength: 1 << 10,
+	}
+	c.Assert(info.GeneratePieces(func(metainfo.FileInfo) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(make([]byte, info.Length))), nil
+	}), qt.IsNil)
+	mi := &metainfo.MetaInfo{InfoBytes: bencode.MustMarshal(info)}
+	var orders [2][]int
+	for i := range orders {
+		cfg := TestingConfig(t)
+		cfg.RandSource = rand.NewSource(42)
+		cl, err := NewClient(cfg)
+		c.Assert(err, qt.IsNil)
+		defer cl.Close()
+		tt, err := cl.AddTorrent(mi)
+		c.Assert(err, qt.IsNil)
+		cl.lock()
+		orders[i] = tt.pieceRequestOrder
+		cl.unlock()
+	}
+	c.Check(orders[0], qt.HasLen, 64)
+	c.Check(orders[0], qt.DeepEquals, orders[1])
+}
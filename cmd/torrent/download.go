@@ -122,7 +122,11 @@ func addTorrents(
 				}
 				return t, nil
 			} else if strings.HasPrefix(arg, "infohash:") {
-				t, _ := client.AddTorrentInfoHash(metainfo.NewHashFromHex(strings.TrimPrefix(arg, "infohash:")))
+				ih, err := metainfo.ParseHash(strings.TrimPrefix(arg, "infohash:"))
+				if err != nil {
+					return nil, fmt.Errorf("parsing infohash: %w", err)
+				}
+				t, _ := client.AddTorrentInfoHash(ih)
 				return t, nil
 			} else {
 				metaInfo, err := metainfo.LoadFromFile(arg)
@@ -358,9 +362,7 @@ func downloadErr(flags downloadFlags) error {
 
 	// Write status on the root path on the default HTTP muxer. This will be bound to localhost
 	// somewhere if GOPPROF is set, thanks to the envpprof import.
-	http.HandleFunc("/", func(w http.ResponseWriter, req *http.Request) {
-		client.WriteStatus(w)
-	})
+	http.Handle("/", torrent.StatusHandler(client))
 	var wg sync.WaitGroup
 	fatalErr := make(chan error, 1)
 	err = addTorrents(ctx, client, flags, &wg,
@@ -28,9 +28,7 @@ func serve() (cmd bargle.Command) {
 			return fmt.Errorf("new torrent client: %w", err)
 		}
 		defer cl.Close()
-		http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-			cl.WriteStatus(w)
-		})
+		http.Handle("/", torrent.StatusHandler(cl))
 		for _, filePath := range filePaths {
 			totalLength, err := totalLength(filePath)
 			if err != nil {
@@ -0,0 +1,10 @@
+package torrent
+
+// Sets the download completed event once all the wanted pieces are complete, if any of them were
+// downloaded. A torrent whose data was already complete when it was added doesn't complete this
+// way, so trackers aren't told it was downloaded.
+func (t *Torrent) updateDownloadCompleted() {
+	if t.piecesDownloaded && t.haveInfo() && !t.needData() {
+		t.downloadCompleted.Set()
+	}
+}
@@ -0,0 +1,82 @@
+package torrent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func TestDownloadCompletedRequiresDownloading(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	cl.lock()
+	defer cl.unlock()
+	// Nothing is wanted, but nothing was downloaded either.
+	tt.updateDownloadCompleted()
+	c.Check(tt.downloadCompleted.IsSet(), qt.IsFalse)
+	tt.piecesDownloaded = true
+	tt.updateDownloadCompleted()
+	c.Check(tt.downloadCompleted.IsSet(), qt.IsTrue)
+}
+
+func TestTrackerCompletedEventSentOnce(t *testing.T) {
+	c := qt.New(t)
+	events := make(chan string, 10)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events <- r.URL.Query().Get("event")
+		w.Write([]byte("d8:intervali1800e5:peers0:e"))
+	}))
+	defer s.Close()
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = true
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	u, err := url.Parse(s.URL + "/announce")
+	c.Assert(err, qt.IsNil)
+	ts := &trackerScraper{
+		shortInfohash: *tt.canonicalShortInfohash(),
+		u:             *u,
+		t:             tt,
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ts.Run()
+	}()
+	// Waits for the result of an announce after the one that completed at prev.
+	announced := func(prev time.Time) time.Time {
+		for {
+			cl.lock()
+			completed := ts.lastAnnounce.Completed
+			cl.unlock()
+			if !completed.Equal(prev) {
+				return completed
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	c.Check(<-events, qt.Equals, "started")
+	started := announced(time.Time{})
+	cl.lock()
+	tt.downloadCompleted.Set()
+	cl.unlock()
+	c.Check(<-events, qt.Equals, "completed")
+	// Dropping the torrent would cancel the completed announce if it were still running.
+	announced(started)
+	tt.Drop()
+	<-done
+	c.Check(<-events, qt.Equals, "stopped")
+	c.Check(events, qt.HasLen, 0)
+	c.Check(ts.completedSent, qt.IsTrue)
+}
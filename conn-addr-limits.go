@@ -0,0 +1,55 @@
+package torrent
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+)
+
+// Returns the subnet that ClientConfig.MaxConnsPerSubnet applies to: the /24 for IPv4, and the /64
+// for IPv6.
+func connLimitSubnet(ip net.IP) (netip.Prefix, bool) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return netip.Prefix{}, false
+	}
+	addr = addr.Unmap()
+	bits := 64
+	if addr.Is4() {
+		bits = 24
+	}
+	prefix, err := addr.Prefix(bits)
+	return prefix, err == nil
+}
+
+// Returns an error if adding the conn would exceed ClientConfig.MaxConnsPerIp or
+// MaxConnsPerSubnet for the Torrent.
+func (t *Torrent) connAddrLimitErr(c *PeerConn) error {
+	perIp := t.cl.config.MaxConnsPerIp
+	perSubnet := t.cl.config.MaxConnsPerSubnet
+	if (perIp <= 0 && perSubnet <= 0) || c.trusted {
+		return nil
+	}
+	ip := c.remoteIp()
+	subnet, ok := connLimitSubnet(ip)
+	if !ok {
+		return nil
+	}
+	var sameIp, sameSubnet int
+	for c0 := range t.conns {
+		ip0 := c0.remoteIp()
+		if ip0.Equal(ip) {
+			sameIp++
+		}
+		if subnet0, ok := connLimitSubnet(ip0); ok && subnet0 == subnet {
+			sameSubnet++
+		}
+	}
+	if perIp > 0 && sameIp >= perIp {
+		return fmt.Errorf("already have %v conns from %v", sameIp, ip)
+	}
+	if perSubnet > 0 && sameSubnet >= perSubnet {
+		return fmt.Errorf("already have %v conns from %v", sameSubnet, subnet)
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package torrent
+
+import (
+	"net"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestConnAddrLimits(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	cl.config.MaxConnsPerIp = 2
+	cl.config.MaxConnsPerSubnet = 3
+	tt := cl.newTorrentForTesting()
+	add := func(ip string, port int, trusted bool) error {
+		pc := &PeerConn{Peer: Peer{
+			RemoteAddr: &net.TCPAddr{IP: net.ParseIP(ip), Port: port},
+			trusted:    trusted,
+		}}
+		err := tt.connAddrLimitErr(pc)
+		if err == nil {
+			tt.conns[pc] = struct{}{}
+		}
+		return err
+	}
+	c.Check(add("1.2.3.4", 1, false), qt.IsNil)
+	c.Check(add("1.2.3.4", 2, false), qt.IsNil)
+	c.Check(add("1.2.3.4", 3, false), qt.IsNotNil)
+	c.Check(add("1.2.3.4", 3, true), qt.IsNil)
+	// The /24 now has 3 conns.
+	c.Check(add("1.2.3.5", 1, false), qt.IsNotNil)
+	c.Check(add("1.2.4.5", 1, false), qt.IsNil)
+	c.Check(add("2001:db8::1", 1, false), qt.IsNil)
+	c.Check(add("2001:db8::2", 1, false), qt.IsNil)
+	c.Check(add("2001:db8::3", 1, false), qt.IsNil)
+	c.Check(add("2001:db8::4", 1, false), qt.IsNotNil)
+	c.Check(add("2001:db8:0:1::1", 1, false), qt.IsNil)
+}
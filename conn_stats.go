@@ -33,6 +33,13 @@ type ConnStats struct {
 
 	MetadataChunksRead Count
 
+	// Chunk data received that was wasted: chunks we already had, chunks for pieces we didn't want,
+	// and data written to pieces that then failed verification. Failed verification is only
+	// attributed when peers supplied all the piece's data. See BytesReadWasted.
+	BytesReadWastedDuplicate  Count
+	BytesReadWastedUnwanted   Count
+	BytesReadWastedFailedHash Count
+
 	// Number of pieces data was written to, that subsequently passed verification.
 	PiecesDirtiedGood Count
 	// Number of pieces data was written to, that subsequently failed verification. Note that a
@@ -48,6 +55,13 @@ func (me *ConnStats) Copy() (ret ConnStats) {
 	return
 }
 
+// The total of the BytesReadWasted fields.
+func (me *ConnStats) BytesReadWasted() int64 {
+	return me.BytesReadWastedDuplicate.Int64() +
+		me.BytesReadWastedUnwanted.Int64() +
+		me.BytesReadWastedFailedHash.Int64()
+}
+
 type Count struct {
 	n int64
 }
@@ -8,6 +8,8 @@ import "github.com/anacrolix/sync"
 type lockWithDeferreds struct {
 	internal      sync.RWMutex
 	unlockActions []func()
+	// Run after the lock is released, for callers that may need to take the lock themselves.
+	afterUnlockActions []func()
 }
 
 func (me *lockWithDeferreds) Lock() {
@@ -20,7 +22,12 @@ func (me *lockWithDeferreds) Unlock() {
 		unlockActions[i]()
 	}
 	me.unlockActions = unlockActions[:0]
+	afterUnlockActions := me.afterUnlockActions
+	me.afterUnlockActions = nil
 	me.internal.Unlock()
+	for _, action := range afterUnlockActions {
+		action()
+	}
 }
 
 func (me *lockWithDeferreds) RLock() {
@@ -34,3 +41,7 @@ func (me *lockWithDeferreds) RUnlock() {
 func (me *lockWithDeferreds) Defer(action func()) {
 	me.unlockActions = append(me.unlockActions, action)
 }
+
+func (me *lockWithDeferreds) DeferAfterUnlock(action func()) {
+	me.afterUnlockActions = append(me.afterUnlockActions, action)
+}
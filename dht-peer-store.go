@@ -0,0 +1,152 @@
+package torrent
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/dht/v2/krpc"
+	peer_store "github.com/anacrolix/dht/v2/peer-store"
+)
+
+const (
+	// Per BEP 5, announced peers are dropped if they don't announce again within this time.
+	dhtPeerStoreTtl = 30 * time.Minute
+	// Bounds the memory peers announcing to us can consume.
+	dhtPeerStoreMaxInfohashes       = 10000
+	dhtPeerStoreMaxPeersPerInfohash = 1000
+	// Keeps the values in get_peers responses within a UDP datagram. Each value is a bencoded
+	// compact address, see dhtPeerValueLen.
+	dhtPeerStoreMaxGetPeersBytes = 800
+	// Limits how often every stored infohash is scanned for expired peers. Without it, each
+	// announce for a new infohash to a full store would walk the whole store.
+	dhtPeerStorePruneAllInterval = time.Minute
+)
+
+// Stores peers that announce to our DHT servers, so they can be returned in get_peers responses.
+// The server determines the port, including for implied_port announces, where the UDP source port
+// is used.
+type dhtPeerStore struct {
+	clock Clock
+	mu    sync.Mutex
+	peers map[peer_store.InfoHash]map[string]dhtStoredPeer
+	// The earliest a full prune can run again.
+	nextPruneAll time.Time
+}
+
+type dhtStoredPeer struct {
+	addr    krpc.NodeAddr
+	expires time.Time
+}
+
+var _ peer_store.Interface = (*dhtPeerStore)(nil)
+
+func newDhtPeerStore(clock Clock) *dhtPeerStore {
+	return &dhtPeerStore{
+		clock: clock,
+		peers: make(map[peer_store.InfoHash]map[string]dhtStoredPeer),
+	}
+}
+
+func (me *dhtPeerStore) AddPeer(ih peer_store.InfoHash, addr krpc.NodeAddr) {
+	if addr.Port == 0 {
+		return
+	}
+	now := me.clock.Now()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	peers, ok := me.peers[ih]
+	if !ok {
+		if len(me.peers) >= dhtPeerStoreMaxInfohashes {
+			me.maybePruneAll(now)
+			if len(me.peers) >= dhtPeerStoreMaxInfohashes {
+				return
+			}
+		}
+		peers = make(map[string]dhtStoredPeer)
+		me.peers[ih] = peers
+	}
+	key := addr.String()
+	if _, ok := peers[key]; !ok && len(peers) >= dhtPeerStoreMaxPeersPerInfohash {
+		me.prune(ih, now)
+		if len(peers) >= dhtPeerStoreMaxPeersPerInfohash {
+			return
+		}
+		// Pruning removes the infohash if all its peers expired.
+		if len(peers) == 0 {
+			me.peers[ih] = peers
+		}
+	}
+	peers[key] = dhtStoredPeer{
+		addr:    addr,
+		expires: now.Add(dhtPeerStoreTtl),
+	}
+}
+
+func (me *dhtPeerStore) GetPeers(ih peer_store.InfoHash) (ret []krpc.NodeAddr) {
+	now := me.clock.Now()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.prune(ih, now)
+	// Map iteration order varies, so repeated queries see different peers.
+	n := 0
+	for _, p := range me.peers[ih] {
+		l := dhtPeerValueLen(p.addr)
+		if n+l > dhtPeerStoreMaxGetPeersBytes {
+			// A shorter IPv4 address may still fit.
+			continue
+		}
+		n += l
+		ret = append(ret, p.addr)
+	}
+	return
+}
+
+// The bencoded length of a peer in get_peers values, such as "6:" followed by an IPv4 address and
+// port.
+func dhtPeerValueLen(addr krpc.NodeAddr) int {
+	if addr.IP.To4() != nil {
+		return 2 + net.IPv4len + 2
+	}
+	return 3 + net.IPv6len + 2
+}
+
+// Returns up to n of the stored infohashes, varying between calls, and the number stored in total.
+// Infohashes whose peers expired since the last full prune may be included.
+func (me *dhtPeerStore) sampleInfohashes(n int) (ret []peer_store.InfoHash, num int) {
+	now := me.clock.Now()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.maybePruneAll(now)
+	for ih := range me.peers {
+		if len(ret) >= n {
+			break
+		}
+		ret = append(ret, ih)
+	}
+	return ret, len(me.peers)
+}
+
+// Removes expired peers for the infohash, and the infohash itself if none remain.
+func (me *dhtPeerStore) prune(ih peer_store.InfoHash, now time.Time) {
+	peers := me.peers[ih]
+	for key, p := range peers {
+		if !now.Before(p.expires) {
+			delete(peers, key)
+		}
+	}
+	if len(peers) == 0 {
+		delete(me.peers, ih)
+	}
+}
+
+// Prunes every infohash, unless that was done within dhtPeerStorePruneAllInterval.
+func (me *dhtPeerStore) maybePruneAll(now time.Time) {
+	if now.Before(me.nextPruneAll) {
+		return
+	}
+	me.nextPruneAll = now.Add(dhtPeerStorePruneAllInterval)
+	for ih := range me.peers {
+		me.prune(ih, now)
+	}
+}
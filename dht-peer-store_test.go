@@ -0,0 +1,97 @@
+package torrent
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/dht/v2/krpc"
+	peer_store "github.com/anacrolix/dht/v2/peer-store"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDhtPeerStoreExpiry(t *testing.T) {
+	c := qt.New(t)
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	ps := newDhtPeerStore(clock)
+	var ih peer_store.InfoHash
+	a := krpc.NodeAddr{IP: net.IPv4(1, 2, 3, 4), Port: 6881}
+	b := krpc.NodeAddr{IP: net.IPv4(5, 6, 7, 8), Port: 6882}
+	ps.AddPeer(ih, a)
+	ps.AddPeer(ih, krpc.NodeAddr{IP: net.IPv4(9, 9, 9, 9)})
+	clock.now = clock.now.Add(dhtPeerStoreTtl / 2)
+	ps.AddPeer(ih, b)
+	c.Check(ps.GetPeers(ih), qt.HasLen, 2)
+	// Announcing again refreshes the expiry.
+	ps.AddPeer(ih, a)
+	clock.now = clock.now.Add(dhtPeerStoreTtl - time.Second)
+	c.Check(ps.GetPeers(ih), qt.HasLen, 2)
+	clock.now = clock.now.Add(time.Second)
+	c.Check(ps.GetPeers(ih), qt.HasLen, 0)
+	c.Check(ps.peers, qt.HasLen, 0)
+}
+
+func TestDhtPeerStoreLimits(t *testing.T) {
+	c := qt.New(t)
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	ps := newDhtPeerStore(clock)
+	var ih peer_store.InfoHash
+	for i := range dhtPeerStoreMaxPeersPerInfohash + 1 {
+		ps.AddPeer(ih, krpc.NodeAddr{IP: net.IPv4(10, 0, byte(i>>8), byte(i)), Port: 1})
+	}
+	c.Check(ps.peers[ih], qt.HasLen, dhtPeerStoreMaxPeersPerInfohash)
+	c.Check(ps.GetPeers(ih), qt.HasLen, 100)
+	// IPv6 addresses take more room in the response.
+	var ih6 peer_store.InfoHash
+	ih6[0] = 1
+	for i := range 100 {
+		ip := make(net.IP, net.IPv6len)
+		ip[0], ip[15] = 0x20, byte(i)
+		ps.AddPeer(ih6, krpc.NodeAddr{IP: ip, Port: 1})
+	}
+	c.Check(ps.GetPeers(ih6), qt.HasLen, dhtPeerStoreMaxGetPeersBytes/21)
+}
+
+func TestDhtPeerStoreAddToFullyExpiredInfohash(t *testing.T) {
+	c := qt.New(t)
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	ps := newDhtPeerStore(clock)
+	var ih peer_store.InfoHash
+	for i := range dhtPeerStoreMaxPeersPerInfohash {
+		ps.AddPeer(ih, krpc.NodeAddr{IP: net.IPv4(10, 0, byte(i>>8), byte(i)), Port: 1})
+	}
+	clock.now = clock.now.Add(dhtPeerStoreTtl)
+	a := krpc.NodeAddr{IP: net.IPv4(1, 2, 3, 4), Port: 6881}
+	ps.AddPeer(ih, a)
+	c.Check(ps.GetPeers(ih), qt.DeepEquals, []krpc.NodeAddr{a})
+}
+
+func TestDhtPeerStoreFullPruneRateLimited(t *testing.T) {
+	c := qt.New(t)
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	ps := newDhtPeerStore(clock)
+	addr := krpc.NodeAddr{IP: net.IPv4(1, 2, 3, 4), Port: 6881}
+	ih := func(i int) (ret peer_store.InfoHash) {
+		ret[0], ret[1] = byte(i>>8), byte(i)
+		return
+	}
+	ps.AddPeer(ih(0), addr)
+	clock.now = clock.now.Add(time.Second)
+	for i := 1; i < dhtPeerStoreMaxInfohashes; i++ {
+		ps.AddPeer(ih(i), addr)
+	}
+	c.Assert(ps.peers, qt.HasLen, dhtPeerStoreMaxInfohashes)
+	clock.now = clock.now.Add(dhtPeerStoreTtl - time.Second)
+	// The first infohash has expired, and the full prune makes room.
+	ps.AddPeer(ih(dhtPeerStoreMaxInfohashes), addr)
+	c.Check(ps.peers, qt.HasLen, dhtPeerStoreMaxInfohashes)
+	c.Check(ps.peers[ih(0)], qt.HasLen, 0)
+	// Everything else expires, but the store isn't scanned again until the interval passes.
+	clock.now = clock.now.Add(time.Second)
+	ps.AddPeer(ih(dhtPeerStoreMaxInfohashes+1), addr)
+	c.Check(ps.peers, qt.HasLen, dhtPeerStoreMaxInfohashes)
+	c.Check(ps.peers[ih(dhtPeerStoreMaxInfohashes+1)], qt.HasLen, 0)
+	clock.now = clock.now.Add(dhtPeerStorePruneAllInterval)
+	ps.AddPeer(ih(dhtPeerStoreMaxInfohashes+1), addr)
+	c.Check(ps.peers, qt.HasLen, 2)
+}
@@ -0,0 +1,50 @@
+package torrent
+
+import (
+	"net"
+	"time"
+)
+
+// Peers tell us their DHT port with PORT messages. We ping those nodes, and the DHT servers add
+// them to their routing tables if they respond. The pings are queued and rate limited, so peers
+// can't cause unbounded goroutines or DHT traffic.
+const dhtPortPingQueueLen = 64
+
+type dhtPortPing struct {
+	s    DhtServer
+	addr net.UDPAddr
+}
+
+// Queues pings of the node at addr on each DHT server for its address family. Pings are dropped if
+// the queue is full.
+func (cl *Client) queueDhtPortPing(addr net.UDPAddr) {
+	cl.eachDhtServerForIp(addr.IP, func(s DhtServer) {
+		select {
+		case cl.dhtPortPings <- dhtPortPing{s, addr}:
+		default:
+			torrent.Add("dht port pings dropped", 1)
+		}
+	})
+}
+
+func (cl *Client) dhtPortPinger() {
+	for {
+		var p dhtPortPing
+		select {
+		case <-cl.closed.Done():
+			return
+		case p = <-cl.dhtPortPings:
+		}
+		if l := cl.config.DhtPortPingRateLimiter; l != nil {
+			r := l.Reserve()
+			select {
+			case <-cl.closed.Done():
+				r.Cancel()
+				return
+			case <-time.After(r.Delay()):
+			}
+		}
+		// Pings wait for a response, so they're not done in series.
+		go p.s.Ping(&p.addr)
+	}
+}
@@ -0,0 +1,195 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/int160"
+	"github.com/anacrolix/dht/v2/krpc"
+	peer_store "github.com/anacrolix/dht/v2/peer-store"
+	g "github.com/anacrolix/generics"
+	"golang.org/x/time/rate"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+const (
+	// Samples are regenerated at most this often, and indexers are told not to ask again sooner.
+	// Announced peers don't outlive dhtPeerStoreTtl, so there's no point waiting longer.
+	dhtSampleInfohashesInterval = dhtPeerStoreTtl
+	// Keeps responses within a UDP datagram.
+	dhtMaxInfohashSamples = 20
+	// The number of closest nodes returned, as for get_peers.
+	dhtSampleInfohashesNodes = 8
+)
+
+// Answers BEP 51 sample_infohashes queries, which the anacrolix/dht Server doesn't handle itself,
+// from the infohashes peers have announced to the server.
+type dhtSampleInfohashesResponder struct {
+	clock     Clock
+	peerStore *dhtPeerStore
+	limiter   *rate.Limiter
+	conn      net.PacketConn
+	// Set once the Server is created. Queries arriving before then get the Server's default
+	// response.
+	server atomic.Pointer[dht.Server]
+
+	mu      sync.Mutex
+	samples []byte
+	num     int
+	expires time.Time
+}
+
+// A sample_infohashes response. krpc.Return isn't used, as its krpc.CompactInfohashes samples
+// can't be bencoded by this version of anacrolix/dht.
+type dhtSampleInfohashesMsg struct {
+	T  string                    `bencode:"t"`
+	Y  string                    `bencode:"y"`
+	R  dhtSampleInfohashesReturn `bencode:"r"`
+	IP krpc.NodeAddr             `bencode:"ip,omitempty"`
+}
+
+type dhtSampleInfohashesReturn struct {
+	ID       krpc.ID                  `bencode:"id"`
+	Nodes    krpc.CompactIPv4NodeInfo `bencode:"nodes,omitempty"`
+	Nodes6   krpc.CompactIPv6NodeInfo `bencode:"nodes6,omitempty"`
+	Interval int64                    `bencode:"interval"`
+	Num      int64                    `bencode:"num"`
+	// The concatenated infohashes. Always included, even when empty, so indexers can tell we
+	// support the query.
+	Samples []byte `bencode:"samples"`
+}
+
+// For use as a dht.ServerConfig.OnQuery. Returns false for queries it handles, so the Server
+// doesn't also respond.
+func (me *dhtSampleInfohashesResponder) onQuery(query *krpc.Msg, source net.Addr) (propagate bool) {
+	if query.Q != "sample_infohashes" || query.A == nil {
+		return true
+	}
+	s := me.server.Load()
+	if s == nil {
+		return true
+	}
+	if me.limiter != nil && !me.limiter.Allow() {
+		// Dropped, as an overloaded node would.
+		return false
+	}
+	// The Server lock is held while this is called, and replying needs the routing table.
+	go me.reply(s, query.T, query.A.Target, dht.NewAddr(source))
+	return false
+}
+
+func (me *dhtSampleInfohashesResponder) reply(s *dht.Server, t string, target krpc.ID, source dht.Addr) {
+	samples, num := me.sample()
+	r := dhtSampleInfohashesReturn{
+		ID:       s.ID(),
+		Interval: int64(dhtSampleInfohashesInterval / time.Second),
+		Num:      int64(num),
+		Samples:  samples,
+	}
+	nodes := closestDhtNodes(s.Nodes(), target, source.IP().To4() == nil)
+	if source.IP().To4() == nil {
+		r.Nodes6 = nodes
+	} else {
+		r.Nodes = nodes
+	}
+	b, err := bencode.Marshal(dhtSampleInfohashesMsg{
+		T:  t,
+		Y:  "r",
+		R:  r,
+		IP: source.KRPC(),
+	})
+	if err != nil {
+		panic(err)
+	}
+	me.conn.WriteTo(b, source.Raw())
+}
+
+// Returns the current sample of stored infohashes, concatenated, regenerating it if it has expired.
+func (me *dhtSampleInfohashesResponder) sample() ([]byte, int) {
+	now := me.clock.Now()
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if now.Before(me.expires) {
+		return me.samples, me.num
+	}
+	ihs, num := me.peerStore.sampleInfohashes(dhtMaxInfohashSamples)
+	me.samples = make([]byte, 0, len(ihs)*len(peer_store.InfoHash{}))
+	for _, ih := range ihs {
+		me.samples = append(me.samples, ih[:]...)
+	}
+	me.num = num
+	me.expires = now.Add(dhtSampleInfohashesInterval)
+	return me.samples, me.num
+}
+
+// Returns the nodes closest to target, of the same address family as the requester.
+func closestDhtNodes(nodes []krpc.NodeInfo, target krpc.ID, ipv6 bool) (ret []krpc.NodeInfo) {
+	for _, n := range nodes {
+		if (n.Addr.IP.To4() == nil) == ipv6 {
+			ret = append(ret, n)
+		}
+	}
+	t := int160.FromByteArray(target)
+	sort.Slice(ret, func(i, j int) bool {
+		return int160.FromByteArray(ret[i].ID).Distance(t).Cmp(int160.FromByteArray(ret[j].ID).Distance(t)) < 0
+	})
+	if len(ret) > dhtSampleInfohashesNodes {
+		ret = ret[:dhtSampleInfohashesNodes]
+	}
+	return
+}
+
+// Returned by Client.SampleDhtInfohashes when the node's last requested interval hasn't passed.
+var ErrDhtSampleInfohashesTooSoon = errors.New("sample_infohashes interval hasn't passed for node")
+
+// Asks the DHT node at addr for a sample of the infohashes it stores (BEP 51), using a DHT server
+// for the address family of addr. Nodes aren't asked again before the interval they return. Crawlers
+// can continue with the returned Nodes to discover more of the DHT.
+func (cl *Client) SampleDhtInfohashes(ctx context.Context, addr *net.UDPAddr, target [20]byte) (
+	ret DhtInfohashSample, err error,
+) {
+	key := addr.String()
+	cl.lock()
+	now := cl.clock().Now()
+	if now.Before(cl.dhtSampleNotBefore[key]) {
+		cl.unlock()
+		err = ErrDhtSampleInfohashesTooSoon
+		return
+	}
+	var sampler DhtInfohashSampler
+	cl.eachDhtServerForIp(addr.IP, func(s DhtServer) {
+		if ds, ok := s.(DhtInfohashSampler); ok && sampler == nil {
+			sampler = ds
+		}
+	})
+	cl.unlock()
+	if sampler == nil {
+		err = errors.New("no DHT servers support sample_infohashes for the address")
+		return
+	}
+	ret, err = sampler.SampleInfohashes(ctx, addr, target)
+	if err != nil {
+		return
+	}
+	cl.lock()
+	defer cl.unlock()
+	now = cl.clock().Now()
+	// Forget nodes that may be asked again, so crawling doesn't grow this without bound.
+	for k, t := range cl.dhtSampleNotBefore {
+		if !now.Before(t) {
+			delete(cl.dhtSampleNotBefore, k)
+		}
+	}
+	if ret.Interval > 0 {
+		g.MakeMapIfNil(&cl.dhtSampleNotBefore)
+		cl.dhtSampleNotBefore[key] = now.Add(ret.Interval)
+	}
+	return
+}
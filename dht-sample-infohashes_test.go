@@ -0,0 +1,98 @@
+package torrent
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	"github.com/anacrolix/dht/v2/krpc"
+	peer_store "github.com/anacrolix/dht/v2/peer-store"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func newDhtSampleTestingClient(c *qt.C, disableSampling bool) *Client {
+	cfg := TestingConfig(c)
+	cfg.NoDHT = false
+	cfg.DhtStartingNodes = func(string) dht.StartingNodesGetter {
+		return func() ([]dht.Addr, error) { return nil, nil }
+	}
+	cfg.DisableDhtSampleInfohashes = disableSampling
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(func() { cl.Close() })
+	return cl
+}
+
+// Returns the address of the Client's IPv4 DHT server.
+func dhtServerUdp4Addr(c *qt.C, cl *Client) *net.UDPAddr {
+	for _, s := range cl.DhtServers() {
+		if !dhtServerIsIpv6(s) {
+			return s.Addr().(*net.UDPAddr)
+		}
+	}
+	c.Fatal("no IPv4 DHT server")
+	return nil
+}
+
+func TestSampleDhtInfohashes(t *testing.T) {
+	c := qt.New(t)
+	indexed := newDhtSampleTestingClient(c, false)
+	ih := peer_store.InfoHash{1, 2, 3}
+	for _, s := range indexed.DhtServers() {
+		s.(PeerStorer).PeerStore().AddPeer(ih, krpc.NodeAddr{IP: net.IPv4(1, 2, 3, 4), Port: 6881})
+	}
+	crawler := newDhtSampleTestingClient(c, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addr := dhtServerUdp4Addr(c, indexed)
+	sample, err := crawler.SampleDhtInfohashes(ctx, addr, [20]byte{})
+	c.Assert(err, qt.IsNil)
+	c.Check(sample.Samples, qt.DeepEquals, [][20]byte{ih})
+	c.Check(sample.Num, qt.Equals, 1)
+	c.Check(sample.Interval, qt.Equals, dhtSampleInfohashesInterval)
+	// The node's interval is respected.
+	_, err = crawler.SampleDhtInfohashes(ctx, addr, [20]byte{})
+	c.Check(err, qt.Equals, ErrDhtSampleInfohashesTooSoon)
+}
+
+func TestSampleDhtInfohashesDisabled(t *testing.T) {
+	c := qt.New(t)
+	optedOut := newDhtSampleTestingClient(c, true)
+	crawler := newDhtSampleTestingClient(c, false)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	_, err := crawler.SampleDhtInfohashes(ctx, dhtServerUdp4Addr(c, optedOut), [20]byte{})
+	c.Check(err, qt.IsNotNil)
+}
+
+func TestClosestDhtNodes(t *testing.T) {
+	c := qt.New(t)
+	var nodes []krpc.NodeInfo
+	for i := range 20 {
+		nodes = append(nodes, krpc.NodeInfo{
+			ID:   krpc.ID{byte(i)},
+			Addr: krpc.NodeAddr{IP: net.IPv4(10, 0, 0, byte(i)), Port: 1},
+		})
+	}
+	nodes = append(nodes, krpc.NodeInfo{ID: krpc.ID{5}, Addr: krpc.NodeAddr{IP: net.ParseIP("::1"), Port: 1}})
+	closest := closestDhtNodes(nodes, krpc.ID{4}, false)
+	c.Assert(closest, qt.HasLen, dhtSampleInfohashesNodes)
+	c.Check(closest[0].ID, qt.Equals, krpc.ID{4})
+	c.Check(closest[1].ID, qt.Equals, krpc.ID{5})
+	c.Check(closestDhtNodes(nodes, krpc.ID{4}, true), qt.HasLen, 1)
+}
+
+func TestDhtSampleInfohashesReturnAlwaysHasSamples(t *testing.T) {
+	c := qt.New(t)
+	b, err := bencode.Marshal(dhtSampleInfohashesReturn{})
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Contains, "7:samples0:")
+	var r krpc.Return
+	c.Assert(bencode.Unmarshal(b, &r), qt.IsNil)
+	c.Assert(r.Samples, qt.IsNotNil)
+	c.Check(*r.Samples, qt.HasLen, 0)
+}
@@ -1,8 +1,13 @@
 package torrent
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net"
+	"strconv"
+	"time"
 
 	"github.com/anacrolix/dht/v2"
 	"github.com/anacrolix/dht/v2/krpc"
@@ -22,11 +27,107 @@ type DhtServer interface {
 	WriteStatus(io.Writer)
 }
 
+func (cl *Client) dhtStartingNodes(network string) dht.StartingNodesGetter {
+	if len(cl.config.DhtBootstrapNodes) != 0 {
+		return dhtBootstrapNodesGetter(cl.config.DhtBootstrapNodes)
+	}
+	return cl.config.DhtStartingNodes(network)
+}
+
+// Resolves the "host:port" bootstrap nodes each time it's called. An error is only returned if
+// none of them resolve.
+func dhtBootstrapNodesGetter(hostPorts []string) dht.StartingNodesGetter {
+	return func() (addrs []dht.Addr, err error) {
+		var errs []error
+		for _, hostPort := range hostPorts {
+			resolved, resolveErr := resolveDhtBootstrapNode(hostPort)
+			if resolveErr != nil {
+				errs = append(errs, resolveErr)
+				continue
+			}
+			addrs = append(addrs, resolved...)
+		}
+		if len(addrs) == 0 {
+			err = errors.Join(errs...)
+		}
+		return
+	}
+}
+
+func resolveDhtBootstrapNode(hostPort string) (addrs []dht.Addr, err error) {
+	host, portStr, err := net.SplitHostPort(hostPort)
+	if err != nil {
+		return
+	}
+	port, err := strconv.ParseUint(portStr, 10, 16)
+	if err != nil {
+		err = fmt.Errorf("parsing port in %q: %w", hostPort, err)
+		return
+	}
+	ips, err := net.DefaultResolver.LookupIP(context.Background(), "ip", host)
+	if err != nil {
+		return
+	}
+	for _, ip := range ips {
+		addrs = append(addrs, dht.NewAddr(&net.UDPAddr{IP: ip, Port: int(port)}))
+	}
+	return
+}
+
+// Whether the DHT server's routing table holds IPv6 nodes. BEP 32 keeps separate routing tables
+// for each address family, and we run a server on each UDP socket.
+func dhtServerIsIpv6(s DhtServer) bool {
+	ip := addrIpOrNil(s.Addr())
+	return ip.To4() == nil && ip.To16() != nil
+}
+
+// Calls f with the DHT servers that can reach the given IP.
+func (cl *Client) eachDhtServerForIp(ip net.IP, f func(DhtServer)) {
+	isIpv6 := ip.To4() == nil
+	cl.eachDhtServer(func(s DhtServer) {
+		if dhtServerIsIpv6(s) == isIpv6 {
+			f(s)
+		}
+	})
+}
+
 // Optional interface for DhtServer's that can expose their peer store (if any).
 type PeerStorer interface {
 	PeerStore() peer_store.Interface
 }
 
+// Optional interface for DhtServers that support BEP 33 scrapes.
+type DhtScraper interface {
+	// Returns approximate counts of seeders and leechers for the infohash, estimated from the
+	// bloom filters returned by nodes close to it.
+	Scrape(ctx context.Context, infoHash [20]byte) (DhtScrapeResult, error)
+}
+
+type DhtScrapeResult struct {
+	Seeders  int
+	Leechers int
+}
+
+// Optional interface for DhtServers that can ask other nodes for samples of the infohashes they
+// store (BEP 51), for indexing the DHT.
+type DhtInfohashSampler interface {
+	// Sends a sample_infohashes query for target to the node at addr.
+	SampleInfohashes(ctx context.Context, addr net.Addr, target [20]byte) (DhtInfohashSample, error)
+}
+
+type DhtInfohashSample struct {
+	Samples [][20]byte
+	// The number of infohashes the node stores in total.
+	Num int
+	// The node shouldn't be asked again until this has passed.
+	Interval time.Duration
+	// Nodes close to the target, for continuing a traversal.
+	Nodes []krpc.NodeInfo
+}
+
+// Returned by DhtInfohashSampler.SampleInfohashes when the node responds without samples.
+var ErrDhtSampleInfohashesUnsupported = errors.New("node doesn't support sample_infohashes")
+
 type DhtAnnounce interface {
 	Close()
 	Peers() <-chan dht.PeersValues
@@ -59,4 +160,72 @@ func (me AnacrolixDhtServerWrapper) Ping(addr *net.UDPAddr) {
 	})
 }
 
-var _ DhtServer = AnacrolixDhtServerWrapper{}
+func (me AnacrolixDhtServerWrapper) SampleInfohashes(
+	ctx context.Context, addr net.Addr, target [20]byte,
+) (ret DhtInfohashSample, err error) {
+	// The Server's send rate limiting applies.
+	res := me.Server.Query(ctx, dht.NewAddr(addr), "sample_infohashes", dht.QueryInput{
+		MsgArgs: krpc.MsgArgs{Target: target},
+	})
+	err = res.ToError()
+	if err != nil {
+		return
+	}
+	r := res.Reply.R
+	if r == nil || r.Samples == nil {
+		err = ErrDhtSampleInfohashesUnsupported
+		return
+	}
+	ret.Samples = *r.Samples
+	if r.Num != nil {
+		ret.Num = int(*r.Num)
+	}
+	if r.Interval != nil {
+		ret.Interval = time.Duration(*r.Interval) * time.Second
+	}
+	r.ForAllNodes(func(ni krpc.NodeInfo) {
+		ret.Nodes = append(ret.Nodes, ni)
+	})
+	return
+}
+
+func (me AnacrolixDhtServerWrapper) Scrape(ctx context.Context, infoHash [20]byte) (ret DhtScrapeResult, err error) {
+	// This does a get_peers traversal with the scrape flag, and doesn't announce us.
+	a, err := me.Server.AnnounceTraversal(infoHash, dht.Scrape())
+	if err != nil {
+		return
+	}
+	defer a.Close()
+	var seeds, peers krpc.ScrapeBloomFilter
+	for {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case pv, ok := <-a.Peers:
+			if !ok {
+				ret.Seeders = int(seeds.EstimateCount())
+				ret.Leechers = int(peers.EstimateCount())
+				return
+			}
+			mergeScrapeBloomFilter(&seeds, pv.BFsd)
+			mergeScrapeBloomFilter(&peers, pv.BFpe)
+		}
+	}
+}
+
+// BEP 33 filters from different nodes are combined by OR-ing them together.
+func mergeScrapeBloomFilter(dst, src *krpc.ScrapeBloomFilter) {
+	if src == nil {
+		return
+	}
+	for i := range dst {
+		dst[i] |= src[i]
+	}
+}
+
+var (
+	_ DhtServer          = AnacrolixDhtServerWrapper{}
+	_ DhtScraper         = AnacrolixDhtServerWrapper{}
+	_ DhtInfohashSampler = AnacrolixDhtServerWrapper{}
+)
@@ -8,6 +8,8 @@ type dialPool struct {
 	resCh chan DialResult
 	addr  string
 	left  int
+	// Called with the result of each dial, from the dialing goroutine.
+	onResult func(DialResult)
 }
 
 func (me *dialPool) getFirst() (res DialResult) {
@@ -21,10 +23,14 @@ func (me *dialPool) getFirst() (res DialResult) {
 func (me *dialPool) add(ctx context.Context, dialer Dialer) {
 	me.left++
 	go func() {
-		me.resCh <- DialResult{
+		res := DialResult{
 			dialFromSocket(ctx, dialer, me.addr),
 			dialer,
 		}
+		if me.onResult != nil {
+			me.onResult(res)
+		}
+		me.resCh <- res
 	}()
 }
 
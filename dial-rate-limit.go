@@ -0,0 +1,40 @@
+package torrent
+
+import (
+	"time"
+)
+
+// Takes a token from ClientConfig.DialRateLimiter to start a dial. If there isn't one yet, the
+// Client's torrents are prompted to open new connections once there is, so that a burst of new
+// peers is dialed gradually rather than all at once. The limiter uses real time.
+func (cl *Client) allowDial() bool {
+	now := time.Now()
+	r := cl.config.DialRateLimiter.ReserveN(now, 1)
+	if !r.OK() {
+		// There will never be a token.
+		return false
+	}
+	delay := r.DelayFrom(now)
+	if delay == 0 {
+		return true
+	}
+	r.CancelAt(now)
+	torrent.Add("dials deferred by rate limit", 1)
+	if cl.dialRateLimitTimer == nil {
+		cl.dialRateLimitTimer = time.AfterFunc(delay, cl.openNewConnsAfterDialRateLimit)
+	} else {
+		cl.dialRateLimitTimer.Reset(delay)
+	}
+	return false
+}
+
+func (cl *Client) openNewConnsAfterDialRateLimit() {
+	cl.lock()
+	defer cl.unlock()
+	if cl.closed.IsSet() {
+		return
+	}
+	for t := range cl.torrents {
+		t.openNewConns()
+	}
+}
@@ -0,0 +1,73 @@
+package torrent
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"golang.org/x/time/rate"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func TestOpenNewConnsWaitsForDialRateLimit(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	// Dials to closed loopback ports are refused immediately over TCP.
+	cfg.DisableUTP = true
+	cfg.DialRateLimiter = rate.NewLimiter(rate.Every(time.Hour), 2)
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	// Outgoing connections are only wanted when there's data to get, and pieces aren't pending
+	// until they've been checked.
+	tt.VerifyData()
+	tt.DownloadAll()
+	cl.lock()
+	defer cl.unlock()
+	for i := 1; i <= 5; i++ {
+		tt.peers.Add(PeerInfo{
+			Addr:   ipPortAddr{IP: net.IPv4(127, 0, 0, 1), Port: i},
+			Source: PeerSourceDirect,
+		})
+	}
+	c.Check(tt.openNewConns(), qt.Equals, 2)
+	// The peers beyond the burst are kept until the limiter allows more dials.
+	c.Check(tt.peers.Len(), qt.Equals, 3)
+	c.Check(cl.dialRateLimitTimer, qt.IsNotNil)
+}
+
+func TestOpenNewConnsSkipsUndialablePeersBeforeTakingDialToken(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.DisableUTP = true
+	cfg.DialRateLimiter = rate.NewLimiter(rate.Every(time.Hour), 2)
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	// Outgoing connections are only wanted when there's data to get, and pieces aren't pending
+	// until they've been checked.
+	tt.VerifyData()
+	tt.DownloadAll()
+	cl.lock()
+	defer cl.unlock()
+	for i := 1; i <= 5; i++ {
+		p := PeerInfo{
+			Addr:   ipPortAddr{IP: net.IPv4(127, 0, 0, 1), Port: i},
+			Source: PeerSourceDirect,
+		}
+		if i > 2 {
+			// Ourselves, so initiateConn would discard it.
+			p.Id = cl.peerID
+		}
+		tt.peers.Add(p)
+	}
+	c.Check(tt.openNewConns(), qt.Equals, 2)
+	c.Check(tt.peers.Len(), qt.Equals, 0)
+	c.Check(cl.dialRateLimitTimer, qt.IsNil)
+}
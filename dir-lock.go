@@ -0,0 +1,76 @@
+package torrent
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// The name of the file used to lock a directory against use by other Client instances.
+const dirLockFileName = ".torrent.lock"
+
+// Returned by NewClient when a directory it would use is locked by another Client, possibly in
+// another process.
+type ErrAlreadyLocked struct {
+	Path string
+	// The process ID recorded by the owner of the lock. Zero if it couldn't be determined.
+	Pid int
+}
+
+func (me *ErrAlreadyLocked) Error() string {
+	if me.Pid == 0 {
+		return fmt.Sprintf("%q is locked by another client", me.Path)
+	}
+	return fmt.Sprintf("%q is locked by another client (pid %v)", me.Path, me.Pid)
+}
+
+// Takes an advisory lock on dir, creating it if necessary. The lock is released by closing the
+// returned file, or when the process exits.
+func lockDir(dir string) (f *os.File, err error) {
+	if dir == "" {
+		// The default storage uses the working directory in this case.
+		dir = "."
+	}
+	err = os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return
+	}
+	path := filepath.Join(dir, dirLockFileName)
+	f, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o640)
+	if err != nil {
+		return
+	}
+	locked, err := tryLockFile(f)
+	if err == nil && !locked {
+		err = &ErrAlreadyLocked{
+			Path: dir,
+			Pid:  readLockPid(f),
+		}
+	}
+	if err == nil {
+		err = writeLockPid(f)
+	}
+	if err != nil {
+		f.Close()
+		f = nil
+	}
+	return
+}
+
+func readLockPid(f *os.File) int {
+	var b [32]byte
+	n, _ := f.ReadAt(b[:], 0)
+	pid, _ := strconv.Atoi(string(bytes.TrimSpace(b[:n])))
+	return pid
+}
+
+func writeLockPid(f *os.File) error {
+	err := f.Truncate(0)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	return err
+}
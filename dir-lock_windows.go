@@ -0,0 +1,24 @@
+package torrent
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// Byte range locks on Windows are mandatory, so we lock a region past the recorded PID to keep it
+// readable by other instances.
+const windowsDirLockOffset = 1 << 20
+
+func tryLockFile(f *os.File) (bool, error) {
+	ol := windows.Overlapped{Offset: windowsDirLockOffset}
+	err := windows.LockFileEx(
+		windows.Handle(f.Fd()),
+		windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY,
+		0, 1, 0, &ol)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return false, nil
+	}
+	return err == nil, err
+}
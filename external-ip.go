@@ -0,0 +1,125 @@
+package torrent
+
+import (
+	"net"
+	"net/netip"
+)
+
+// The most voters whose reports of our external IP are kept. Beyond this, arbitrary voters are
+// forgotten to make room.
+const maxExternalIpVoters = 200
+
+// Infers our external IPs from what other hosts report seeing, such as "yourip" in extended
+// handshakes, and "external ip" in tracker responses. Each voter gets one vote, which is replaced if
+// it reports again, and the address with the most votes wins for each family. The winners are kept
+// up to date as votes change, as they're used to prioritize peers.
+type externalIpVotes struct {
+	byVoter map[string]netip.Addr
+	counts  map[netip.Addr]int
+	// The winners for IPv4 and IPv6, indexed by externalIpFamily.
+	winners [2]net.IP
+}
+
+func externalIpFamily(ipv6 bool) int {
+	if ipv6 {
+		return 1
+	}
+	return 0
+}
+
+func (me *externalIpVotes) vote(voter string, ip net.IP) {
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok {
+		return
+	}
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return
+	}
+	if me.byVoter == nil {
+		me.byVoter = make(map[string]netip.Addr)
+		me.counts = make(map[netip.Addr]int)
+	}
+	if prev, ok := me.byVoter[voter]; ok {
+		if prev == addr {
+			return
+		}
+		me.removeVote(prev)
+	} else if len(me.byVoter) >= maxExternalIpVoters {
+		for k, prev := range me.byVoter {
+			delete(me.byVoter, k)
+			me.removeVote(prev)
+			break
+		}
+	}
+	me.byVoter[voter] = addr
+	me.counts[addr]++
+	me.updateWinners()
+}
+
+func (me *externalIpVotes) removeVote(addr netip.Addr) {
+	me.counts[addr]--
+	if me.counts[addr] <= 0 {
+		delete(me.counts, addr)
+	}
+}
+
+// Picks the address with the most votes for each family. Ties go to the lesser address so the
+// result is stable.
+func (me *externalIpVotes) updateWinners() {
+	var best [2]netip.Addr
+	var bestCount [2]int
+	for addr, count := range me.counts {
+		i := externalIpFamily(addr.Is6())
+		if count > bestCount[i] || count == bestCount[i] && addr.Less(best[i]) {
+			best[i] = addr
+			bestCount[i] = count
+		}
+	}
+	for i := range me.winners {
+		me.winners[i] = nil
+		if bestCount[i] != 0 {
+			me.winners[i] = best[i].AsSlice()
+		}
+	}
+}
+
+// Returns the address with the most votes for the family, or nil if there are none. The result
+// must not be modified.
+func (me *externalIpVotes) winner(ipv6 bool) net.IP {
+	return me.winners[externalIpFamily(ipv6)]
+}
+
+// Records a report of our external IP from the given voter, such as a peer or tracker.
+func (cl *Client) voteExternalIp(voter string, ip net.IP) {
+	cl.externalIpVotes.vote(voter, ip)
+}
+
+// Our IPv4 address as others see it: the configured PublicIp4, otherwise the voted address.
+func (cl *Client) publicIp4() net.IP {
+	return firstNotNil(cl.config.PublicIp4, cl.externalIpVotes.winner(false))
+}
+
+// Our IPv6 address as others see it: the configured PublicIp6, otherwise the voted address.
+func (cl *Client) publicIp6() net.IP {
+	return firstNotNil(cl.config.PublicIp6, cl.externalIpVotes.winner(true))
+}
+
+// Returns our external IP as reported by peers in the "yourip" of extended handshakes and by
+// trackers, by majority vote, unless ClientConfig.PublicIp4 or PublicIp6 is set. IPv4 is preferred.
+// Returns nil if there's no consensus yet.
+func (cl *Client) PublicIP() net.IP {
+	cl.rLock()
+	defer cl.rUnlock()
+	return firstNotNil(cl.publicIp4(), cl.publicIp6())
+}
+
+// The IPs to send in tracker announces. See ClientTrackerConfig.AnnounceVotedExternalIp.
+func (cl *Client) announceIps() (ip4, ip6 net.IP) {
+	if !cl.config.AnnounceVotedExternalIp {
+		return cl.config.PublicIp4, cl.config.PublicIp6
+	}
+	cl.rLock()
+	defer cl.rUnlock()
+	return cl.publicIp4(), cl.publicIp6()
+}
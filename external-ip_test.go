@@ -0,0 +1,104 @@
+package torrent
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestExternalIpVotes(t *testing.T) {
+	c := qt.New(t)
+	var votes externalIpVotes
+	c.Check(votes.winner(false), qt.IsNil)
+	votes.vote("a", net.ParseIP("1.2.3.4"))
+	votes.vote("b", net.ParseIP("5.6.7.8"))
+	votes.vote("c", net.ParseIP("5.6.7.8"))
+	// Private and loopback addresses aren't useful to others.
+	votes.vote("d", net.ParseIP("192.168.1.1"))
+	votes.vote("e", net.ParseIP("127.0.0.1"))
+	votes.vote("f", net.ParseIP("2001:db8::1"))
+	c.Check(votes.winner(false).String(), qt.Equals, "5.6.7.8")
+	c.Check(votes.winner(true).String(), qt.Equals, "2001:db8::1")
+	// A voter changing its mind replaces its earlier vote.
+	votes.vote("b", net.ParseIP("1.2.3.4"))
+	c.Check(votes.winner(false).String(), qt.Equals, "1.2.3.4")
+}
+
+func TestPublicIPsPrefersConfig(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.PublicIp4 = net.ParseIP("9.9.9.9")
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	cl.lock()
+	cl.voteExternalIp("a", net.ParseIP("1.2.3.4"))
+	cl.voteExternalIp("b", net.ParseIP("2001:db8::1"))
+	cl.unlock()
+	ips := cl.PublicIPs()
+	c.Assert(ips, qt.HasLen, 2)
+	c.Check(ips[0].String(), qt.Equals, "9.9.9.9")
+	c.Check(ips[1].String(), qt.Equals, "2001:db8::1")
+}
+
+func TestPublicIPFromVotes(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	c.Check(cl.PublicIP(), qt.IsNil)
+	cl.lock()
+	cl.voteExternalIp("b", net.ParseIP("2001:db8::1"))
+	cl.unlock()
+	c.Check(cl.PublicIP().String(), qt.Equals, "2001:db8::1")
+	cl.lock()
+	cl.voteExternalIp("a", net.ParseIP("1.2.3.4"))
+	cl.unlock()
+	c.Check(cl.PublicIP().String(), qt.Equals, "1.2.3.4")
+	// Voted IPs are only announced if configured.
+	ip4, ip6 := cl.announceIps()
+	c.Check(ip4, qt.IsNil)
+	c.Check(ip6, qt.IsNil)
+	cl.config.AnnounceVotedExternalIp = true
+	ip4, ip6 = cl.announceIps()
+	c.Check(ip4.String(), qt.Equals, "1.2.3.4")
+	c.Check(ip6.String(), qt.Equals, "2001:db8::1")
+}
+
+func TestExternalIpVotesEvictionKeepsCounts(t *testing.T) {
+	c := qt.New(t)
+	var votes externalIpVotes
+	checkCounts := func() {
+		counts := make(map[netip.Addr]int)
+		for _, addr := range votes.byVoter {
+			counts[addr]++
+		}
+		c.Check(votes.counts, qt.DeepEquals, counts)
+	}
+	for i := range maxExternalIpVoters {
+		votes.vote(fmt.Sprintf("%v", i), net.ParseIP("1.2.3.4"))
+	}
+	checkCounts()
+	// Each new voter evicts an arbitrary earlier one.
+	for i := range maxExternalIpVoters {
+		votes.vote(fmt.Sprintf("new%v", i), net.ParseIP("5.6.7.8"))
+	}
+	c.Check(votes.byVoter, qt.HasLen, maxExternalIpVoters)
+	checkCounts()
+	// Repeating or changing a vote keeps the counts consistent.
+	votes.vote("new0", net.ParseIP("5.6.7.8"))
+	votes.vote("new1", net.ParseIP("1.2.3.4"))
+	checkCounts()
+}
+
+func BenchmarkExternalIpVotesWinner(b *testing.B) {
+	var votes externalIpVotes
+	for i := range maxExternalIpVoters {
+		votes.vote(fmt.Sprintf("%v", i), net.IPv4(1, 2, 3, byte(i%7)))
+	}
+	b.ReportAllocs()
+	for range b.N {
+		votes.winner(false)
+	}
+}
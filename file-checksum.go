@@ -0,0 +1,146 @@
+package torrent
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/anacrolix/log"
+)
+
+// Per-File state for verifying whole-file checksums.
+type fileChecksumState struct {
+	// A piece of the file was downloaded and passed its hash since the file was last verified.
+	wanted  bool
+	running bool
+	err     error
+}
+
+// Reads torrent data from storage for whole-file verification. See Torrent.readAt. Storage is
+// read-locked for each read rather than the whole file, so closing the Torrent and its storage
+// isn't held up, and reads stop once the Torrent is closed.
+type torrentReaderAt struct {
+	t *Torrent
+}
+
+// Bounds how long storage is read-locked for each read.
+const fileChecksumReadSize = 1 << 20
+
+func (me torrentReaderAt) ReadAt(b []byte, off int64) (n int, err error) {
+	for len(b) != 0 {
+		chunk := b[:minInt(len(b), fileChecksumReadSize)]
+		var n1 int
+		me.t.storageLock.RLock()
+		if me.t.closed.IsSet() {
+			err = ErrTorrentClosed
+		} else {
+			n1, err = me.t.readAt(chunk, off)
+		}
+		me.t.storageLock.RUnlock()
+		n += n1
+		off += int64(n1)
+		b = b[n1:]
+		if err != nil || n1 < len(chunk) {
+			return
+		}
+	}
+	return
+}
+
+// Whether the file has a checksum to verify on completion, from the metainfo or
+// ClientConfig.VerifyFile.
+func (f *File) hasChecksum() bool {
+	return f.fi.Md5sum != "" || f.t.cl.config.VerifyFile != nil
+}
+
+// Checks the file's data in storage against the md5sum from the metainfo, if there is one, and
+// then ClientConfig.VerifyFile. The file should be complete.
+func (f *File) verifyChecksums() error {
+	newReader := func() io.Reader {
+		return io.NewSectionReader(torrentReaderAt{f.t}, f.offset, f.length)
+	}
+	if want := f.fi.Md5sum; want != "" {
+		h := md5.New()
+		if _, err := io.Copy(h, newReader()); err != nil {
+			return fmt.Errorf("reading file data: %w", err)
+		}
+		if got := hex.EncodeToString(h.Sum(nil)); !strings.EqualFold(got, want) {
+			return fmt.Errorf("md5sum mismatch: got %v, expected %v", got, want)
+		}
+	}
+	if hook := f.t.cl.config.VerifyFile; hook != nil {
+		if err := hook(f, newReader()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The error from the last whole-file checksum verification, which runs when a file is completed by
+// downloading if it has an md5sum in the metainfo or ClientConfig.VerifyFile is set. Nil if
+// verification passed or hasn't run.
+func (f *File) ChecksumErr() error {
+	f.t.cl.rLock()
+	defer f.t.cl.rUnlock()
+	return f.checksum.err
+}
+
+func (f *File) completeLocked() bool {
+	begin, end := f.BeginPieceIndex(), f.EndPieceIndex()
+	if begin == end {
+		return true
+	}
+	completed := &f.t._completedPieces
+	n := completed.Rank(uint32(end - 1))
+	if begin > 0 {
+		n -= completed.Rank(uint32(begin - 1))
+	}
+	return n == uint64(end-begin)
+}
+
+// Called when a piece that was downloaded passes its hash.
+func (t *Torrent) wantFileChecksums(piece pieceIndex) {
+	for _, f := range t.piece(piece).files {
+		if f.hasChecksum() {
+			f.checksum.wanted = true
+		}
+	}
+}
+
+// Starts verifying the files of a newly completed piece if they're now complete and need it.
+func (t *Torrent) maybeVerifyFileChecksums(piece pieceIndex) {
+	for _, f := range t.piece(piece).files {
+		if !f.checksum.wanted || f.checksum.running || f.length == 0 || !f.completeLocked() {
+			continue
+		}
+		f.checksum.wanted = false
+		f.checksum.running = true
+		t.goBackground(func() { t.fileChecksummer(f) })
+	}
+}
+
+func (t *Torrent) fileChecksummer(f *File) {
+	if t.closed.IsSet() {
+		return
+	}
+	err := f.verifyChecksums()
+	t.cl.lock()
+	defer t.cl.unlock()
+	f.checksum.running = false
+	f.checksum.err = err
+	if err == nil {
+		t.logger.Levelf(log.Debug, "file %q passed checksum verification", f.DisplayPath())
+		return
+	}
+	if t.closed.IsSet() {
+		return
+	}
+	t.logger.Levelf(log.Warning, "file %q failed checksum verification: %v", f.DisplayPath(), err)
+	// Storage may have lost or corrupted data since the pieces were hashed. Anything that fails
+	// will be downloaded again, and the file verified again when it completes.
+	for i := f.BeginPieceIndex(); i < f.EndPieceIndex(); i++ {
+		t.queuePieceCheck(i)
+	}
+}
@@ -0,0 +1,56 @@
+package torrent
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func TestFileChecksums(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	cfg := TestingConfig(t)
+	cfg.DataDir = dir
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	tt.VerifyData()
+	f := tt.Files()[0]
+	sum := md5.Sum([]byte(testutil.GreetingFileContents))
+	f.fi.Md5sum = hex.EncodeToString(sum[:])
+	c.Check(f.verifyChecksums(), qt.IsNil)
+	f.fi.Md5sum = hex.EncodeToString(make([]byte, md5.Size))
+	c.Check(f.verifyChecksums(), qt.ErrorMatches, "md5sum mismatch: .*")
+	f.fi.Md5sum = ""
+	hookErr := errors.New("not in manifest")
+	verified := make(chan string, 1)
+	cfg.VerifyFile = func(f *File, r io.Reader) error {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		verified <- string(b)
+		return hookErr
+	}
+	c.Check(f.verifyChecksums(), qt.Equals, hookErr)
+	c.Check(<-verified, qt.Equals, testutil.GreetingFileContents)
+	// Completing a downloaded piece runs verification in the background.
+	cl.lock()
+	tt.wantFileChecksums(0)
+	tt.maybeVerifyFileChecksums(0)
+	cl.unlock()
+	c.Check(<-verified, qt.Equals, testutil.GreetingFileContents)
+	// Reading for verification stops once the torrent is closed.
+	tt.Drop()
+	c.Check(f.verifyChecksums(), qt.ErrorIs, ErrTorrentClosed)
+}
@@ -20,6 +20,7 @@ type File struct {
 	displayPath string
 	prio        piecePriority
 	piecesRoot  g.Option[[sha256.Size]byte]
+	checksum    fileChecksumState
 }
 
 func (f *File) String() string {
@@ -170,6 +171,11 @@ func byteRegionExclusivePieces(off, size, pieceSize int64) (begin, end int) {
 	return
 }
 
+// Forces the pieces containing data in the file to be re-hashed. See Torrent.VerifyPieces.
+func (f *File) VerifyData() {
+	f.t.VerifyPieces(f.BeginPieceIndex(), f.EndPieceIndex())
+}
+
 // Deprecated: Use File.SetPriority.
 func (f *File) Cancel() {
 	f.SetPriority(PiecePriorityNone)
@@ -0,0 +1,57 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestGetMetainfoFromPeer(t *testing.T) {
+	c := qt.New(t)
+	// The seeder only accepts connections if it has data to share.
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	cfg := TestingConfig(t)
+	cfg.DataDir = dir
+	cfg.Seed = true
+	seeder, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer seeder.Close()
+	st, err := seeder.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	st.VerifyData()
+
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	magnet := fmt.Sprintf("magnet:?xt=urn:btih:%s", mi.HashInfoBytes().HexString())
+	for _, addr := range seeder.ListenAddrs() {
+		magnet += "&x.pe=" + addr.String()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	got, err := cl.GetMetainfo(ctx, magnet)
+	c.Assert(err, qt.IsNil)
+	c.Check(got.HashInfoBytes(), qt.Equals, mi.HashInfoBytes())
+	// The torrent was only added to fetch the info.
+	c.Check(cl.Torrents(), qt.HasLen, 0)
+}
+
+func TestGetMetainfoContextDone(t *testing.T) {
+	c := qt.New(t)
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = cl.GetMetainfo(ctx, "magnet:?xt=urn:btih:"+metainfo.Hash{1}.HexString())
+	c.Check(err, qt.Equals, context.DeadlineExceeded)
+	c.Check(cl.Torrents(), qt.HasLen, 0)
+}
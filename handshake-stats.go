@@ -0,0 +1,80 @@
+package torrent
+
+import (
+	"errors"
+	"net"
+)
+
+// Counts of BitTorrent protocol handshakes, including any header obfuscation, by outcome. These are
+// the first thing to check when a swarm won't connect.
+type HandshakeStats struct {
+	// Handshakes underway on outgoing conns. Outgoing dials that haven't connected yet are in
+	// ClientStats.ActiveHalfOpenAttempts, and incoming conns that haven't completed handshakes are
+	// in ClientStats.HalfAcceptedConns.
+	OutgoingInProgress int64
+	Completed          int64
+	// The peer stopped responding before handshakes completed.
+	Timeout int64
+	// Incoming handshakes for torrents we don't have.
+	UnknownInfohash int64
+	// Outgoing handshakes where the peer responded with a different infohash.
+	WrongInfohash int64
+	// Header obfuscation failed, or didn't match our HeaderObfuscationPolicy.
+	Encryption int64
+	Other      int64
+}
+
+var (
+	errHandshakeWrongInfohash   = errors.New("bittorrent protocol handshake: peer infohash didn't match")
+	errHandshakeUnknownInfohash = errors.New("received handshake for unloaded torrent")
+)
+
+// Wraps errors from header obfuscation in handshakes.
+type handshakeEncryptionError struct {
+	error
+}
+
+func (me handshakeEncryptionError) Unwrap() error {
+	return me.error
+}
+
+type handshakeCounters struct {
+	outgoingInProgress Count
+	completed          Count
+	timeout            Count
+	unknownInfohash    Count
+	wrongInfohash      Count
+	encryption         Count
+	other              Count
+}
+
+func (me *handshakeCounters) countResult(err error) {
+	var netErr net.Error
+	switch {
+	case err == nil:
+		me.completed.Add(1)
+	case errors.As(err, &netErr) && netErr.Timeout():
+		me.timeout.Add(1)
+	case errors.Is(err, errHandshakeUnknownInfohash):
+		me.unknownInfohash.Add(1)
+	case errors.Is(err, errHandshakeWrongInfohash):
+		me.wrongInfohash.Add(1)
+	case errors.As(err, &handshakeEncryptionError{}):
+		me.encryption.Add(1)
+	default:
+		me.other.Add(1)
+	}
+}
+
+func (cl *Client) handshakeStats() HandshakeStats {
+	me := &cl.handshakes
+	return HandshakeStats{
+		OutgoingInProgress: me.outgoingInProgress.Int64(),
+		Completed:          me.completed.Int64(),
+		Timeout:            me.timeout.Int64(),
+		UnknownInfohash:    me.unknownInfohash.Int64(),
+		WrongInfohash:      me.wrongInfohash.Int64(),
+		Encryption:         me.encryption.Int64(),
+		Other:              me.other.Int64(),
+	}
+}
@@ -0,0 +1,52 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+func TestHandshakeCountersClassifyErrors(t *testing.T) {
+	c := qt.New(t)
+	var hc handshakeCounters
+	hc.countResult(nil)
+	hc.countResult(fmt.Errorf("bittorrent protocol handshake: %w", os.ErrDeadlineExceeded))
+	hc.countResult(handshakeEncryptionError{&net.OpError{Op: "read", Err: os.ErrDeadlineExceeded}})
+	hc.countResult(errHandshakeWrongInfohash)
+	hc.countResult(errHandshakeUnknownInfohash)
+	hc.countResult(handshakeEncryptionError{errors.New("no supported crypto methods")})
+	hc.countResult(errors.New("EOF"))
+	cl := &Client{handshakes: hc}
+	c.Check(cl.handshakeStats(), qt.Equals, HandshakeStats{
+		Completed:       1,
+		Timeout:         2,
+		UnknownInfohash: 1,
+		WrongInfohash:   1,
+		Encryption:      1,
+		Other:           1,
+	})
+}
+
+func TestHandshakeStatsUnknownInfohash(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.AlwaysWantConns = true
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	nc, err := net.Dial("tcp", fmt.Sprintf(":%d", cl.LocalPort()))
+	c.Assert(err, qt.IsNil)
+	defer nc.Close()
+	ih := InfoHash{1}
+	go pp.Handshake(nc, &ih, [20]byte{}, PeerExtensionBits{})
+	for cl.Stats().Handshakes.UnknownInfohash != 1 {
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -31,6 +31,8 @@ func (r deadlineReader) Read(b []byte) (int, error) {
 func handleEncryption(
 	rw io.ReadWriter,
 	skeys mse.SecretKeyIter,
+	// Used instead of skeys if non-nil.
+	skeyLookup mse.SecretKeyLookup,
 	policy HeaderObfuscationPolicy,
 	selector mse.CryptoSelector,
 ) (
@@ -65,7 +67,11 @@ func handleEncryption(
 		}
 	}
 	headerEncrypted = true
-	ret, cryptoMethod, err = mse.ReceiveHandshake(rw, skeys, selector)
+	if skeyLookup != nil {
+		ret, cryptoMethod, err = mse.ReceiveHandshakeLookup(rw, skeyLookup, selector)
+	} else {
+		ret, cryptoMethod, err = mse.ReceiveHandshake(rw, skeys, selector)
+	}
 	return
 }
 
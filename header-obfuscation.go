@@ -0,0 +1,38 @@
+package torrent
+
+// The number of peer addresses for which we remember whether header obfuscation worked.
+const maxRememberedHeaderObfuscation = 1 << 14
+
+// Returns the header obfuscation policy for dialing the peer, applying
+// ClientConfig.HeaderObfuscationPolicyBySource. Returns false if we can't connect to it at all.
+func (cl *Client) dialHeaderObfuscationPolicy(pi PeerInfo) (HeaderObfuscationPolicy, bool) {
+	policy := cl.config.HeaderObfuscationPolicy
+	if bySource, ok := cl.config.HeaderObfuscationPolicyBySource[pi.Source]; ok {
+		policy = bySource
+	}
+	return policy.forPeer(pi)
+}
+
+// Returns whether header obfuscation was used the last time a handshake with the address succeeded.
+func (cl *Client) rememberedHeaderObfuscation(addr string) (obfuscated, ok bool) {
+	cl.rLock()
+	defer cl.rUnlock()
+	obfuscated, ok = cl.headerObfuscationByAddr[addr]
+	return
+}
+
+func (cl *Client) rememberHeaderObfuscation(addr string, obfuscated bool) {
+	cl.lock()
+	defer cl.unlock()
+	if _, ok := cl.headerObfuscationByAddr[addr]; !ok && len(cl.headerObfuscationByAddr) >= maxRememberedHeaderObfuscation {
+		// Forget an arbitrary address to make room.
+		for k := range cl.headerObfuscationByAddr {
+			delete(cl.headerObfuscationByAddr, k)
+			break
+		}
+	}
+	if cl.headerObfuscationByAddr == nil {
+		cl.headerObfuscationByAddr = make(map[string]bool)
+	}
+	cl.headerObfuscationByAddr[addr] = obfuscated
+}
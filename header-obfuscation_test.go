@@ -0,0 +1,42 @@
+package torrent
+
+import (
+	"fmt"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDialHeaderObfuscationPolicyBySource(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	cl.config.HeaderObfuscationPolicy = HeaderObfuscationPolicy{Preferred: true}
+	noFallback := HeaderObfuscationPolicy{RequirePreferred: true, Preferred: false}
+	cl.config.HeaderObfuscationPolicyBySource = map[PeerSource]HeaderObfuscationPolicy{
+		PeerSourceTracker: noFallback,
+	}
+	policy, ok := cl.dialHeaderObfuscationPolicy(PeerInfo{Source: PeerSourceTracker})
+	c.Assert(ok, qt.IsTrue)
+	c.Check(policy, qt.Equals, noFallback)
+	policy, ok = cl.dialHeaderObfuscationPolicy(PeerInfo{Source: PeerSourcePex})
+	c.Assert(ok, qt.IsTrue)
+	c.Check(policy, qt.Equals, cl.config.HeaderObfuscationPolicy)
+	// The source policy forbids the encryption the peer requires.
+	_, ok = cl.dialHeaderObfuscationPolicy(PeerInfo{Source: PeerSourceTracker, RequiresEncryption: true})
+	c.Check(ok, qt.IsFalse)
+}
+
+func TestRememberHeaderObfuscation(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	_, ok := cl.rememberedHeaderObfuscation("1.2.3.4:5")
+	c.Check(ok, qt.IsFalse)
+	cl.rememberHeaderObfuscation("1.2.3.4:5", false)
+	obfuscated, ok := cl.rememberedHeaderObfuscation("1.2.3.4:5")
+	c.Check(ok, qt.IsTrue)
+	c.Check(obfuscated, qt.IsFalse)
+	for i := 0; i < maxRememberedHeaderObfuscation+10; i++ {
+		cl.rememberHeaderObfuscation(fmt.Sprintf("10.0.0.1:%d", i), true)
+	}
+	c.Check(cl.headerObfuscationByAddr, qt.HasLen, maxRememberedHeaderObfuscation)
+}
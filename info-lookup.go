@@ -0,0 +1,74 @@
+package torrent
+
+import (
+	"context"
+	"time"
+
+	"github.com/anacrolix/log"
+)
+
+// How long metadata requests to peers wait for ClientConfig.LookupInfoBytes.
+const infoLookupTimeout = 10 * time.Second
+
+// Looks up the info with ClientConfig.LookupInfoBytes, if it's set, for a new Torrent that doesn't
+// have it. Metadata isn't requested from peers until the lookup ends or times out. The Client lock
+// must be held.
+func (t *Torrent) startInfoLookup() {
+	lookup := t.cl.config.LookupInfoBytes
+	if lookup == nil || t.haveInfo() {
+		return
+	}
+	t.infoLookupPending = true
+	ctx, cancel := context.WithTimeout(context.Background(), infoLookupTimeout)
+	ih := t.InfoHash()
+	returned := make(chan struct{})
+	// The callback might ignore ctx, so it isn't tracked as background work that Drop and Close
+	// wait for. Its result is still used if it arrives late.
+	go func() {
+		defer close(returned)
+		b, err := lookup(ctx, ih)
+		t.cl.lock()
+		defer t.cl.unlock()
+		t.gotLookedUpInfo(b, err)
+	}()
+	t.goBackground(func() {
+		defer cancel()
+		select {
+		case <-returned:
+		case <-ctx.Done():
+		case <-t.closed.Done():
+		}
+		t.cl.lock()
+		defer t.cl.unlock()
+		t.endInfoLookup()
+	})
+}
+
+func (t *Torrent) gotLookedUpInfo(b []byte, err error) {
+	if t.closed.IsSet() {
+		return
+	}
+	if err != nil {
+		t.logger.Levelf(log.Debug, "looking up info: %v", err)
+	} else if b != nil && !t.haveInfo() {
+		err = t.setInfoBytesLocked(b)
+		if err != nil {
+			t.logger.Levelf(log.Warning, "setting looked up info: %v", err)
+		}
+	}
+	t.endInfoLookup()
+}
+
+// Stops waiting on the lookup, and falls back to the swarm if it didn't provide the info.
+func (t *Torrent) endInfoLookup() {
+	if !t.infoLookupPending {
+		return
+	}
+	t.infoLookupPending = false
+	if t.closed.IsSet() || t.haveInfo() {
+		return
+	}
+	for c := range t.conns {
+		c.requestPendingMetadata()
+	}
+}
@@ -0,0 +1,87 @@
+package torrent
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestLookupInfoBytes(t *testing.T) {
+	c := qt.New(t)
+	mi := testutil.GreetingMetaInfo()
+	var lookedUp []metainfo.Hash
+	cfg := TestingConfig(t)
+	cfg.LookupInfoBytes = func(ctx context.Context, ih metainfo.Hash) ([]byte, error) {
+		lookedUp = append(lookedUp, ih)
+		if ih != mi.HashInfoBytes() {
+			return nil, nil
+		}
+		return mi.InfoBytes, nil
+	}
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+
+	tt, err := cl.AddMagnet("magnet:?xt=urn:btih:" + mi.HashInfoBytes().HexString())
+	c.Assert(err, qt.IsNil)
+	select {
+	case <-tt.GotInfo():
+	case <-time.After(10 * time.Second):
+		c.Fatal("info wasn't looked up")
+	}
+	c.Check(tt.Info().BestName(), qt.Equals, testutil.GreetingFileName)
+
+	// Unknown infohashes fall back to the swarm.
+	other, _ := cl.AddTorrentInfoHash(metainfo.Hash{1})
+	for {
+		cl.lock()
+		pending := other.infoLookupPending
+		cl.unlock()
+		if !pending {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Check(other.Info(), qt.IsNil)
+
+	// Torrents added with their info aren't looked up.
+	tt.Drop()
+	_, err = cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	cl.lock()
+	c.Check(lookedUp, qt.DeepEquals, []metainfo.Hash{mi.HashInfoBytes(), {1}})
+	cl.unlock()
+}
+
+func TestLookupInfoBytesIgnoringContextDoesntBlockDrop(t *testing.T) {
+	c := qt.New(t)
+	release := make(chan struct{})
+	defer close(release)
+	cfg := TestingConfig(t)
+	cfg.LookupInfoBytes = func(context.Context, metainfo.Hash) ([]byte, error) {
+		<-release
+		return nil, nil
+	}
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, _ := cl.AddTorrentInfoHash(metainfo.Hash{1})
+	dropped := make(chan struct{})
+	go func() {
+		tt.Drop()
+		close(dropped)
+	}()
+	select {
+	case <-dropped:
+	case <-time.After(5 * time.Second):
+		c.Fatal("drop waited on the lookup")
+	}
+	cl.lock()
+	c.Check(tt.infoLookupPending, qt.IsFalse)
+	cl.unlock()
+}
@@ -0,0 +1,53 @@
+package torrent
+
+// The pieces wanted when a Torrent is used for live content, where data becomes available linearly
+// and anything behind the playhead is no longer of use.
+type liveWindow struct {
+	playhead pieceIndex
+	size     int
+}
+
+func (me liveWindow) contains(piece pieceIndex) bool {
+	return piece >= me.playhead && piece < me.playhead+me.size
+}
+
+func (me liveWindow) piecePriority(piece pieceIndex) piecePriority {
+	switch {
+	case piece == me.playhead:
+		return PiecePriorityNow
+	case me.contains(piece):
+		return PiecePriorityReadahead
+	default:
+		return PiecePriorityNone
+	}
+}
+
+// Switches piece selection to suit live content. Only pieces in [playhead, playhead+size) are
+// requested, strictly in order. Pieces before the playhead are never requested, even if they're
+// incomplete, and outstanding requests for them are dropped. File and reader priorities are
+// ignored. Call it again as the playhead advances.
+func (t *Torrent) SetLiveWindow(playhead pieceIndex, size int) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	t.liveWindow.Set(liveWindow{playhead, size})
+	t.updateLiveWindowPiecePriorities()
+}
+
+// Reverts to normal piece selection after SetLiveWindow.
+func (t *Torrent) ClearLiveWindow() {
+	t.cl.lock()
+	defer t.cl.unlock()
+	if !t.liveWindow.Ok {
+		return
+	}
+	t.liveWindow.SetNone()
+	t.updateLiveWindowPiecePriorities()
+}
+
+func (t *Torrent) updateLiveWindowPiecePriorities() {
+	if !t.haveInfo() {
+		// Applied when the info is set.
+		return
+	}
+	t.updateAllPiecePriorities("live window changed")
+}
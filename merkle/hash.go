@@ -7,10 +7,15 @@ import (
 )
 
 func NewHash() *Hash {
-	h := &Hash{
-		nextBlock: sha256.New(),
+	return NewHashFromBlockHash(sha256.New())
+}
+
+// Returns a Hash that uses blockHash, which must compute SHA-256, to hash each block. This allows
+// an optimized SHA-256 implementation to be used.
+func NewHashFromBlockHash(blockHash hash.Hash) *Hash {
+	return &Hash{
+		nextBlock: blockHash,
 	}
-	return h
 }
 
 type Hash struct {
@@ -0,0 +1,121 @@
+package torrent
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+// A message read from or written to a peer. See ClientConfig.PeerConnMessageTraceLength.
+type MessageTraceEntry struct {
+	Time     time.Time
+	Outgoing bool
+	// A short description of the message. Payloads are summarized by their length.
+	Message string
+}
+
+func (me MessageTraceEntry) String() string {
+	dir := "<"
+	if me.Outgoing {
+		dir = ">"
+	}
+	return fmt.Sprintf("%s %s %s", me.Time.Format("15:04:05.000"), dir, me.Message)
+}
+
+// Retains the most recent messages in each direction. It's safe for concurrent use.
+type messageTrace struct {
+	mu sync.Mutex
+	// Indexed by whether the messages are outgoing.
+	rings [2]messageTraceRing
+}
+
+type messageTraceRing struct {
+	entries []MessageTraceEntry
+	// Where the next entry goes once entries is at capacity.
+	next int
+}
+
+func (me *messageTraceRing) add(e MessageTraceEntry) {
+	if len(me.entries) < cap(me.entries) {
+		me.entries = append(me.entries, e)
+		return
+	}
+	me.entries[me.next] = e
+	me.next = (me.next + 1) % len(me.entries)
+}
+
+// Appends the entries oldest first.
+func (me *messageTraceRing) appendTo(ret []MessageTraceEntry) []MessageTraceEntry {
+	ret = append(ret, me.entries[me.next:]...)
+	return append(ret, me.entries[:me.next]...)
+}
+
+func newMessageTrace(length int) *messageTrace {
+	var ret messageTrace
+	for i := range ret.rings {
+		ret.rings[i].entries = make([]MessageTraceEntry, 0, length)
+	}
+	return &ret
+}
+
+func (me *messageTrace) add(outgoing bool, msg *pp.Message) {
+	e := MessageTraceEntry{
+		Time:     time.Now(),
+		Outgoing: outgoing,
+		Message:  messageTraceSummary(msg),
+	}
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	i := 0
+	if outgoing {
+		i = 1
+	}
+	me.rings[i].add(e)
+}
+
+// Returns the retained messages from both directions in the order they occurred.
+func (me *messageTrace) entries() (ret []MessageTraceEntry) {
+	me.mu.Lock()
+	for i := range me.rings {
+		ret = me.rings[i].appendTo(ret)
+	}
+	me.mu.Unlock()
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Time.Before(ret[j].Time)
+	})
+	return
+}
+
+func messageTraceSummary(msg *pp.Message) string {
+	if msg.Keepalive {
+		return "keepalive"
+	}
+	switch msg.Type {
+	case pp.Have, pp.Suggest, pp.AllowedFast:
+		return fmt.Sprintf("%v %v", msg.Type, msg.Index)
+	case pp.Request, pp.Cancel, pp.Reject:
+		return fmt.Sprintf("%v %v %v %v", msg.Type, msg.Index, msg.Begin, msg.Length)
+	case pp.Piece:
+		return fmt.Sprintf("%v %v %v [%v bytes]", msg.Type, msg.Index, msg.Begin, len(msg.Piece))
+	case pp.Bitfield:
+		return fmt.Sprintf("%v [%v bits]", msg.Type, len(msg.Bitfield))
+	case pp.Port:
+		return fmt.Sprintf("%v %v", msg.Type, msg.Port)
+	case pp.Extended:
+		return fmt.Sprintf("%v %v [%v bytes]", msg.Type, msg.ExtendedID, len(msg.ExtendedPayload))
+	default:
+		return msg.Type.String()
+	}
+}
+
+// Returns the messages recorded for the connection, if ClientConfig.PeerConnMessageTraceLength is
+// set.
+func (cn *PeerConn) MessageTrace() []MessageTraceEntry {
+	if cn.messageTrace == nil {
+		return nil
+	}
+	return cn.messageTrace.entries()
+}
@@ -0,0 +1,23 @@
+package torrent
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+func TestMessageTraceKeepsLatestEachWay(t *testing.T) {
+	c := qt.New(t)
+	mt := newMessageTrace(2)
+	for i := 0; i < 3; i++ {
+		mt.add(false, &pp.Message{Type: pp.Have, Index: pp.Integer(i)})
+	}
+	mt.add(true, &pp.Message{Type: pp.Request, Index: 1, Begin: 2, Length: 3})
+	var msgs []string
+	for _, e := range mt.entries() {
+		msgs = append(msgs, e.Message)
+	}
+	c.Check(msgs, qt.DeepEquals, []string{"Have 1", "Have 2", "Request 1 2 3"})
+}
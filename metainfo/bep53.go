@@ -0,0 +1,62 @@
+package metainfo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// The most file indices a "so" parameter can select. The values come from untrusted magnet links, and
+// ranges are expanded, so this bounds the allocation. It's more files than torrents have in practice.
+const MaxSelectOnlyIndices = 1 << 18
+
+// Parses a BEP 53 "so" (select only) magnet link parameter value, like "0,2,4,6-8", into the file
+// indices it contains, in the order given. Ranges are inclusive.
+func ParseSelectOnly(s string) (indices []int, err error) {
+	for _, part := range strings.Split(s, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		var begin, end int
+		begin, err = strconv.Atoi(first)
+		if err != nil {
+			err = fmt.Errorf("parsing file index %q: %w", first, err)
+			return
+		}
+		end = begin
+		if isRange {
+			end, err = strconv.Atoi(last)
+			if err != nil {
+				err = fmt.Errorf("parsing file index %q: %w", last, err)
+				return
+			}
+		}
+		if begin < 0 || end < begin {
+			err = fmt.Errorf("invalid file index range %q", part)
+			return
+		}
+		if end-begin >= MaxSelectOnlyIndices-len(indices) {
+			err = fmt.Errorf("more than %v file indices selected", MaxSelectOnlyIndices)
+			return
+		}
+		for i := begin; i <= end; i++ {
+			indices = append(indices, i)
+		}
+	}
+	return
+}
+
+// Returns the file indices from any BEP 53 "so" parameters in the magnet link.
+func (m *MagnetV2) SelectOnly() (indices []int, err error) {
+	for _, so := range m.Params["so"] {
+		var more []int
+		more, err = ParseSelectOnly(so)
+		if err != nil {
+			return
+		}
+		if len(indices)+len(more) > MaxSelectOnlyIndices {
+			err = fmt.Errorf("more than %v file indices selected", MaxSelectOnlyIndices)
+			return
+		}
+		indices = append(indices, more...)
+	}
+	return
+}
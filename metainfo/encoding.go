@@ -0,0 +1,57 @@
+package metainfo
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// Sets Info.NameDecoded and FileInfo.PathDecoded from the name and paths, where they aren't valid
+// UTF-8 and there's no UTF-8 variant, by decoding them from the given encoding. This is intended
+// for the metainfo "encoding" field, which is outside the info dict. Encodings are looked up by
+// their WHATWG Encoding Standard labels, like "gbk", "shift_jis" and "windows-1252". UTF-8 is a
+// no-op.
+func (info *Info) DecodeNames(encoding string) error {
+	if encoding == "" {
+		return nil
+	}
+	enc, err := htmlindex.Get(encoding)
+	if err != nil {
+		return fmt.Errorf("looking up encoding %q: %w", encoding, err)
+	}
+	if name, _ := htmlindex.Name(enc); name == "utf-8" {
+		return nil
+	}
+	dec := enc.NewDecoder()
+	if info.NameUtf8 == "" && !utf8.ValidString(info.Name) {
+		info.NameDecoded, err = dec.String(info.Name)
+		if err != nil {
+			return fmt.Errorf("decoding name: %w", err)
+		}
+	}
+	for i := range info.Files {
+		fi := &info.Files[i]
+		if len(fi.PathUtf8) != 0 || allValidUtf8(fi.Path) {
+			continue
+		}
+		fi.PathDecoded = make([]string, 0, len(fi.Path))
+		for _, comp := range fi.Path {
+			comp, err = dec.String(comp)
+			if err != nil {
+				return fmt.Errorf("decoding path %q: %w", fi.Path, err)
+			}
+			fi.PathDecoded = append(fi.PathDecoded, comp)
+		}
+	}
+	return nil
+}
+
+func allValidUtf8(ss []string) bool {
+	for _, s := range ss {
+		if !utf8.ValidString(s) {
+			return false
+		}
+	}
+	return true
+}
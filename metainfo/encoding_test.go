@@ -0,0 +1,55 @@
+package metainfo
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+// "中文" and "文件" in GBK.
+const (
+	gbkChinese = "\xd6\xd0\xce\xc4"
+	gbkFile    = "\xce\xc4\xbc\xfe"
+)
+
+func TestDecodeNames(t *testing.T) {
+	c := qt.New(t)
+	info := Info{
+		Name: gbkChinese,
+		Files: []FileInfo{
+			{Path: []string{gbkFile}},
+			{Path: []string{"plain"}},
+			{Path: []string{gbkFile}, PathUtf8: []string{"utf8"}},
+		},
+	}
+	c.Assert(info.DecodeNames("GBK"), qt.IsNil)
+	c.Check(info.BestName(), qt.Equals, "中文")
+	c.Check(info.Files[0].BestPath(), qt.DeepEquals, []string{"文件"})
+	c.Check(info.Files[1].PathDecoded, qt.IsNil)
+	c.Check(info.Files[2].BestPath(), qt.DeepEquals, []string{"utf8"})
+	// The decoded names aren't part of the info dict.
+	b, err := bencode.Marshal(info)
+	c.Assert(err, qt.IsNil)
+	var roundTripped Info
+	c.Assert(bencode.Unmarshal(b, &roundTripped), qt.IsNil)
+	c.Check(roundTripped.NameDecoded, qt.Equals, "")
+	c.Check(info.DecodeNames("x-unknown"), qt.IsNotNil)
+}
+
+func TestUnmarshalInfoUsesEncoding(t *testing.T) {
+	c := qt.New(t)
+	mi := MetaInfo{
+		InfoBytes: bencode.MustMarshal(Info{Name: gbkChinese}),
+		Encoding:  "gbk",
+	}
+	info, err := mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.BestName(), qt.Equals, "中文")
+	c.Check(info.Name, qt.Equals, gbkChinese)
+	mi.Encoding = "UTF-8"
+	info, err = mi.UnmarshalInfo()
+	c.Assert(err, qt.IsNil)
+	c.Check(info.BestName(), qt.Equals, gbkChinese)
+}
@@ -15,6 +15,10 @@ type FileInfo struct {
 	// Unofficial extension by BiglyBT? https://github.com/BiglySoftware/BiglyBT/issues/1274. Might
 	// be a safer bet when available: https://github.com/anacrolix/torrent/pull/915.
 	PathUtf8 []string `bencode:"path.utf-8,omitempty"`
+	// Path converted to UTF-8 from the metainfo encoding field. See Info.DecodeNames.
+	PathDecoded []string `bencode:"-"`
+	// Optional hex MD5 of the file's contents. BEP3.
+	Md5sum string `bencode:"md5sum,omitempty"`
 
 	ExtendedFileAttrs
 
@@ -36,5 +40,8 @@ func (fi *FileInfo) BestPath() []string {
 	if len(fi.PathUtf8) != 0 {
 		return fi.PathUtf8
 	}
+	if len(fi.PathDecoded) != 0 {
+		return fi.PathDecoded
+	}
 	return fi.Path
 }
@@ -13,4 +13,5 @@ type Hash = infohash.T
 var (
 	NewHashFromHex = infohash.FromHexString
 	HashBytes      = infohash.HashBytes
+	ParseHash      = infohash.Parse
 )
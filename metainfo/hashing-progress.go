@@ -0,0 +1,58 @@
+package metainfo
+
+import (
+	"crypto/sha1"
+	"io"
+	"time"
+)
+
+// Progress of hashing piece data, such as when building an Info or rechecking a torrent.
+type HashingProgress struct {
+	PiecesHashed int
+	NumPieces    int
+	BytesHashed  int64
+	TotalBytes   int64
+	// The average rate since hashing began.
+	BytesPerSecond float64
+}
+
+// Tracks HashingProgress against the time hashing started.
+type HashingProgressMeter struct {
+	HashingProgress
+	Started time.Time
+}
+
+// Records a hashed piece of the given length and updates the rate.
+func (me *HashingProgressMeter) PieceHashed(length int64) {
+	me.PiecesHashed++
+	me.BytesHashed += length
+	if elapsed := time.Since(me.Started); elapsed > 0 {
+		me.BytesPerSecond = float64(me.BytesHashed) / elapsed.Seconds()
+	}
+}
+
+// Like GeneratePieces, but records each hashed piece in meter and then calls progress with it. Either
+// may be nil, and progress is only called with a meter.
+func GeneratePiecesWithProgress(
+	r io.Reader, pieceLength int64, b []byte, meter *HashingProgressMeter, progress func(HashingProgress),
+) ([]byte, error) {
+	for {
+		h := sha1.New()
+		written, err := io.CopyN(h, r, pieceLength)
+		if written > 0 {
+			b = h.Sum(b)
+			if meter != nil {
+				meter.PieceHashed(written)
+				if progress != nil {
+					progress(meter.HashingProgress)
+				}
+			}
+		}
+		if err == io.EOF {
+			return b, nil
+		}
+		if err != nil {
+			return b, err
+		}
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/anacrolix/missinggo/v2/slices"
 )
@@ -18,6 +19,8 @@ type Info struct {
 	Name        string `bencode:"name"`         // BEP3
 	NameUtf8    string `bencode:"name.utf-8,omitempty"`
 	Length      int64  `bencode:"length,omitempty"` // BEP3, mutually exclusive with Files
+	// Optional hex MD5 of a single file's contents. BEP3.
+	Md5sum string `bencode:"md5sum,omitempty"`
 	ExtendedFileAttrs
 	Private *bool `bencode:"private,omitempty"` // BEP27
 	// TODO: Document this field.
@@ -27,6 +30,9 @@ type Info struct {
 	// BEP 52 (BitTorrent v2)
 	MetaVersion int64    `bencode:"meta version,omitempty"`
 	FileTree    FileTree `bencode:"file tree,omitempty"`
+
+	// Name converted to UTF-8 from the metainfo encoding field. See DecodeNames.
+	NameDecoded string `bencode:"-"`
 }
 
 // The Info.Name field is "advisory". For multi-file torrents it's usually a suggested directory
@@ -41,6 +47,11 @@ const NoName = "-"
 
 // This is a helper that sets Files and Pieces from a root path and its children.
 func (info *Info) BuildFromFilePath(root string) (err error) {
+	return info.BuildFromFilePathWithProgress(root, nil)
+}
+
+// Like BuildFromFilePath, but calls progress after each piece is hashed, if it's not nil.
+func (info *Info) BuildFromFilePathWithProgress(root string, progress func(HashingProgress)) (err error) {
 	info.Name = func() string {
 		b := filepath.Base(root)
 		switch b {
@@ -82,9 +93,9 @@ func (info *Info) BuildFromFilePath(root string) (err error) {
 	if info.PieceLength == 0 {
 		info.PieceLength = ChoosePieceLength(info.TotalLength())
 	}
-	err = info.GeneratePieces(func(fi FileInfo) (io.ReadCloser, error) {
+	err = info.GeneratePiecesWithProgress(func(fi FileInfo) (io.ReadCloser, error) {
 		return os.Open(filepath.Join(root, strings.Join(fi.BestPath(), string(filepath.Separator))))
-	})
+	}, progress)
 	if err != nil {
 		err = fmt.Errorf("error generating pieces: %s", err)
 	}
@@ -111,6 +122,14 @@ func (info *Info) writeFiles(w io.Writer, open func(fi FileInfo) (io.ReadCloser,
 // Sets Pieces (the block of piece hashes in the Info) by using the passed
 // function to get at the torrent data.
 func (info *Info) GeneratePieces(open func(fi FileInfo) (io.ReadCloser, error)) (err error) {
+	return info.GeneratePiecesWithProgress(open, nil)
+}
+
+// Like GeneratePieces, but calls progress after each piece is hashed, if it's not nil.
+func (info *Info) GeneratePiecesWithProgress(
+	open func(fi FileInfo) (io.ReadCloser, error),
+	progress func(HashingProgress),
+) (err error) {
 	if info.PieceLength == 0 {
 		return errors.New("piece length must be non-zero")
 	}
@@ -120,7 +139,15 @@ func (info *Info) GeneratePieces(open func(fi FileInfo) (io.ReadCloser, error))
 		pw.CloseWithError(err)
 	}()
 	defer pr.Close()
-	info.Pieces, err = GeneratePieces(pr, info.PieceLength, nil)
+	totalLength := info.TotalLength()
+	meter := HashingProgressMeter{
+		HashingProgress: HashingProgress{
+			NumPieces:  int((totalLength + info.PieceLength - 1) / info.PieceLength),
+			TotalBytes: totalLength,
+		},
+		Started: time.Now(),
+	}
+	info.Pieces, err = GeneratePiecesWithProgress(pr, info.PieceLength, nil, &meter, progress)
 	return
 }
 
@@ -165,7 +192,8 @@ func (info *Info) UpvertedFiles() (files []FileInfo) {
 			Length: info.Length,
 			// Callers should determine that Info.Name is the basename, and
 			// thus a regular file.
-			Path: nil,
+			Path:   nil,
+			Md5sum: info.Md5sum,
 		}}
 	}
 	var offset int64
@@ -185,6 +213,9 @@ func (info *Info) BestName() string {
 	if info.NameUtf8 != "" {
 		return info.NameUtf8
 	}
+	if info.NameDecoded != "" {
+		return info.NameDecoded
+	}
 	return info.Name
 }
 
@@ -1,6 +1,8 @@
 package metainfo
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -14,3 +16,21 @@ func TestMarshalInfo(t *testing.T) {
 	assert.NoError(t, err)
 	assert.EqualValues(t, "d4:name0:12:piece lengthi0e6:pieces0:e", string(b))
 }
+
+func TestBuildFromFilePathWithProgress(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "a"), []byte("hello, world\n"), 0o600))
+	info := Info{PieceLength: 5}
+	var progress []HashingProgress
+	err := info.BuildFromFilePathWithProgress(dir, func(p HashingProgress) {
+		progress = append(progress, p)
+	})
+	assert.NoError(t, err)
+	assert.Len(t, progress, 3)
+	last := progress[len(progress)-1]
+	assert.EqualValues(t, 3, last.PiecesHashed)
+	assert.EqualValues(t, 3, last.NumPieces)
+	assert.EqualValues(t, 13, last.BytesHashed)
+	assert.EqualValues(t, 13, last.TotalBytes)
+	assert.Len(t, info.Pieces, 60)
+}
@@ -1,6 +1,7 @@
 package metainfo
 
 import (
+	"fmt"
 	"testing"
 
 	qt "github.com/frankban/quicktest"
@@ -36,3 +37,22 @@ func TestParseMagnetV2(t *testing.T) {
 	c.Check(m.InfoHash.HexString(), qt.Equals, "631a31dd0a46257d5078c0dee4e66e26f73e42ac")
 	c.Check(m.Params["xt"], qt.HasLen, 1)
 }
+
+func TestMagnetV2SelectOnly(t *testing.T) {
+	c := qt.New(t)
+	m, err := ParseMagnetV2Uri("magnet:?xt=urn:btih:631a31dd0a46257d5078c0dee4e66e26f73e42ac&so=0,2,4,6-8")
+	c.Assert(err, qt.IsNil)
+	so, err := m.SelectOnly()
+	c.Assert(err, qt.IsNil)
+	c.Check(so, qt.DeepEquals, []int{0, 2, 4, 6, 7, 8})
+	_, err = ParseSelectOnly("3-1")
+	c.Check(err, qt.IsNotNil)
+	_, err = ParseSelectOnly("1,,2")
+	c.Check(err, qt.IsNotNil)
+	// Huge ranges from untrusted links aren't expanded.
+	_, err = ParseSelectOnly("0-2000000000")
+	c.Check(err, qt.IsNotNil)
+	so, err = ParseSelectOnly(fmt.Sprintf("0-%v", MaxSelectOnlyIndices-1))
+	c.Assert(err, qt.IsNil)
+	c.Check(so, qt.HasLen, MaxSelectOnlyIndices)
+}
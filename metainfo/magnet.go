@@ -1,8 +1,6 @@
 package metainfo
 
 import (
-	"encoding/base32"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"net/url"
@@ -96,26 +94,9 @@ func ParseMagnetUri(uri string) (m Magnet, err error) {
 }
 
 func parseEncodedV1Infohash(encoded string) (ih infohash.T, err error) {
-	decode := func() func(dst, src []byte) (int, error) {
-		switch len(encoded) {
-		case 40:
-			return hex.Decode
-		case 32:
-			return base32.StdEncoding.Decode
-		}
-		return nil
-	}()
-	if decode == nil {
-		err = fmt.Errorf("unhandled xt parameter encoding (encoded length %d)", len(encoded))
-		return
-	}
-	n, err := decode(ih[:], []byte(encoded))
+	ih, err = infohash.Parse(encoded)
 	if err != nil {
 		err = fmt.Errorf("error decoding xt: %w", err)
-		return
-	}
-	if n != 20 {
-		panic(n)
 	}
 	return
 }
@@ -52,8 +52,15 @@ func LoadFromFile(filename string) (*MetaInfo, error) {
 	return Load(&buf)
 }
 
+// Names that aren't UTF-8 are decoded using the encoding field if it's known. See
+// Info.DecodeNames.
 func (mi MetaInfo) UnmarshalInfo() (info Info, err error) {
 	err = bencode.Unmarshal(mi.InfoBytes, &info)
+	if err != nil {
+		return
+	}
+	// Unknown encodings aren't an error: the names are still usable as is.
+	info.DecodeNames(mi.Encoding)
 	return
 }
 
@@ -13,26 +13,27 @@ type Node string
 var _ bencode.Unmarshaler = (*Node)(nil)
 
 func (n *Node) UnmarshalBencode(b []byte) (err error) {
-	var iface interface{}
-	err = bencode.Unmarshal(b, &iface)
+	if len(b) == 0 || b[0] != 'l' {
+		s, err := bencode.UnmarshalTo[string](b)
+		*n = Node(s)
+		return err
+	}
+	// A BEP 5 host and port pair.
+	l, err := bencode.UnmarshalTo[[]bencode.Bytes](b)
 	if err != nil {
 		return
 	}
-	switch v := iface.(type) {
-	case string:
-		*n = Node(v)
-	case []interface{}:
-		func() {
-			defer func() {
-				r := recover()
-				if r != nil {
-					err = r.(error)
-				}
-			}()
-			*n = Node(net.JoinHostPort(v[0].(string), strconv.FormatInt(v[1].(int64), 10)))
-		}()
-	default:
-		err = fmt.Errorf("unsupported type: %T", iface)
+	if len(l) != 2 {
+		return fmt.Errorf("expected host and port, got %v items", len(l))
+	}
+	host, err := bencode.UnmarshalTo[string](l[0])
+	if err != nil {
+		return fmt.Errorf("decoding host: %w", err)
+	}
+	port, err := bencode.UnmarshalTo[int64](l[1])
+	if err != nil {
+		return fmt.Errorf("decoding port: %w", err)
 	}
+	*n = Node(net.JoinHostPort(host, strconv.FormatInt(port, 10)))
 	return
 }
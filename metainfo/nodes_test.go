@@ -72,3 +72,10 @@ func TestMetainfoEmptyInfoBytes(t *testing.T) {
 	var mi MetaInfo
 	require.NoError(t, bencode.Unmarshal(buf.Bytes(), &mi))
 }
+
+func TestNodeUnmarshalErrors(t *testing.T) {
+	for _, b := range []string{"i1e", "l9:127.0.0.1e", "l9:127.0.0.15:16881e", "li1ei1ee"} {
+		var n Node
+		assert.Error(t, bencode.Unmarshal([]byte(b), &n), b)
+	}
+}
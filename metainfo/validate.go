@@ -0,0 +1,295 @@
+package metainfo
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+)
+
+type FindingSeverity int
+
+const (
+	// The torrent is usable, but some clients might handle it poorly.
+	FindingWarning FindingSeverity = iota
+	// The torrent can't be used as is.
+	FindingError
+)
+
+func (me FindingSeverity) String() string {
+	switch me {
+	case FindingWarning:
+		return "warning"
+	case FindingError:
+		return "error"
+	default:
+		return fmt.Sprintf("FindingSeverity(%d)", int(me))
+	}
+}
+
+// A problem with a MetaInfo found by Validate.
+type Finding struct {
+	Severity FindingSeverity
+	// The bencode key path of the field concerned, like "info.files[3].path" or
+	// "announce-list[0][1]".
+	Field string
+	Msg   string
+}
+
+func (me Finding) String() string {
+	return fmt.Sprintf("%v: %v: %v", me.Severity, me.Field, me.Msg)
+}
+
+type Findings []Finding
+
+// Returns the first finding with FindingError severity as an error, or nil if there isn't one.
+func (me Findings) Err() error {
+	for _, f := range me {
+		if f.Severity == FindingError {
+			return fmt.Errorf("invalid metainfo: %v: %v", f.Field, f.Msg)
+		}
+	}
+	return nil
+}
+
+// Path components longer than this are rejected by most filesystems.
+const maxPathComponentLen = 255
+
+// Full paths longer than this are rejected on some platforms, in particular older Windows APIs.
+const maxPathLen = 4096
+
+const minV2PieceLength = 16 << 10
+
+// Sanity checks a MetaInfo before it's added to a Client or served to others. Findings are in the
+// order the fields appear in the metainfo. An empty result means nothing of concern was found.
+func Validate(mi *MetaInfo) (ret Findings) {
+	v := validator{mi: mi}
+	v.announce()
+	v.urlList()
+	v.info()
+	return v.findings
+}
+
+type validator struct {
+	mi       *MetaInfo
+	findings Findings
+}
+
+func (v *validator) add(severity FindingSeverity, field string, format string, args ...any) {
+	v.findings = append(v.findings, Finding{
+		Severity: severity,
+		Field:    field,
+		Msg:      fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) announce() {
+	if v.mi.Announce != "" {
+		v.trackerUrl("announce", v.mi.Announce)
+	}
+	for i, tier := range v.mi.AnnounceList {
+		if len(tier) == 0 {
+			v.add(FindingWarning, fmt.Sprintf("announce-list[%d]", i), "empty tier")
+		}
+		for j, u := range tier {
+			v.trackerUrl(fmt.Sprintf("announce-list[%d][%d]", i, j), u)
+		}
+	}
+}
+
+func (v *validator) trackerUrl(field, s string) {
+	u, err := url.Parse(s)
+	if err != nil {
+		v.add(FindingError, field, "parsing tracker URL: %v", err)
+		return
+	}
+	switch u.Scheme {
+	case "http", "https", "udp", "ws", "wss":
+	default:
+		v.add(FindingWarning, field, "unsupported tracker URL scheme %q", u.Scheme)
+		return
+	}
+	if u.Host == "" {
+		v.add(FindingError, field, "tracker URL %q has no host", s)
+	}
+}
+
+func (v *validator) urlList() {
+	for i, s := range v.mi.UrlList {
+		field := fmt.Sprintf("url-list[%d]", i)
+		u, err := url.Parse(s)
+		if err != nil {
+			v.add(FindingError, field, "parsing webseed URL: %v", err)
+			continue
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			v.add(FindingWarning, field, "unsupported webseed URL scheme %q", u.Scheme)
+		}
+	}
+}
+
+func (v *validator) info() {
+	if len(v.mi.InfoBytes) == 0 {
+		v.add(FindingError, "info", "missing")
+		return
+	}
+	info, err := v.mi.UnmarshalInfo()
+	if err != nil {
+		v.add(FindingError, "info", "decoding: %v", err)
+		return
+	}
+	v.name(&info)
+	v.pieceLength(&info)
+	if info.HasV1() {
+		v.v1Files(&info)
+		v.pieces(&info)
+	}
+	if info.HasV2() {
+		v.fileTree(&info)
+	}
+}
+
+func (v *validator) name(info *Info) {
+	if info.Name == "" && info.NameUtf8 == "" {
+		v.add(FindingWarning, "info.name", "missing")
+		return
+	}
+	v.utf8("info.name", []string{info.Name}, []string{info.NameUtf8}, []string{info.NameDecoded})
+	if info.NameUtf8 != "" && !utf8.ValidString(info.NameUtf8) {
+		v.add(FindingError, "info.name.utf-8", "not valid UTF-8")
+	}
+	if strings.ContainsAny(info.BestName(), "/\\") || info.BestName() == ".." {
+		v.add(FindingWarning, "info.name", "%q isn't a single path component", info.BestName())
+	}
+}
+
+// Checks that a name or path is valid UTF-8, or has a UTF-8 alternative, such as one decoded using
+// the encoding field.
+func (v *validator) utf8(field string, comps []string, alternatives ...[]string) {
+	for _, alt := range alternatives {
+		if len(alt) != 0 && alt[0] != "" {
+			return
+		}
+	}
+	for _, c := range comps {
+		if utf8.ValidString(c) {
+			continue
+		}
+		if v.mi.Encoding != "" && !strings.EqualFold(v.mi.Encoding, "UTF-8") {
+			v.add(FindingWarning, field, "not valid UTF-8, and couldn't be decoded from the declared encoding %q", v.mi.Encoding)
+		} else {
+			v.add(FindingWarning, field, "not valid UTF-8, and has no UTF-8 alternative")
+		}
+		return
+	}
+}
+
+func (v *validator) pieceLength(info *Info) {
+	const field = "info.piece length"
+	switch {
+	case info.PieceLength < 0:
+		v.add(FindingError, field, "negative")
+	case info.PieceLength == 0:
+		if info.TotalLength() != 0 {
+			v.add(FindingError, field, "missing")
+		}
+	case info.PieceLength&(info.PieceLength-1) != 0:
+		if info.HasV2() {
+			v.add(FindingError, field, "%v isn't a power of two", info.PieceLength)
+		} else {
+			v.add(FindingWarning, field, "%v isn't a power of two", info.PieceLength)
+		}
+	case info.HasV2() && info.PieceLength < minV2PieceLength:
+		v.add(FindingError, field, "%v is less than the v2 minimum of %v", info.PieceLength, minV2PieceLength)
+	}
+}
+
+func (v *validator) pieces(info *Info) {
+	const field = "info.pieces"
+	if len(info.Pieces)%20 != 0 {
+		v.add(FindingError, field, "length %v isn't a multiple of 20", len(info.Pieces))
+		return
+	}
+	if info.PieceLength <= 0 {
+		return
+	}
+	var total int64
+	for _, fi := range info.Files {
+		total += fi.Length
+	}
+	if len(info.Files) == 0 {
+		total = info.Length
+	}
+	expected := (total + info.PieceLength - 1) / info.PieceLength
+	if int64(len(info.Pieces)/20) != expected {
+		v.add(FindingError, field, "has %v hashes, but the files need %v", len(info.Pieces)/20, expected)
+	}
+}
+
+func (v *validator) v1Files(info *Info) {
+	if info.Length != 0 && len(info.Files) != 0 {
+		v.add(FindingError, "info.length", "present with info.files")
+	}
+	if info.Length < 0 {
+		v.add(FindingError, "info.length", "negative")
+	}
+	for i, fi := range info.Files {
+		field := fmt.Sprintf("info.files[%d]", i)
+		if fi.Length < 0 {
+			v.add(FindingError, field+".length", "negative")
+		}
+		if len(fi.Path) == 0 && len(fi.PathUtf8) == 0 {
+			v.add(FindingError, field+".path", "missing")
+			continue
+		}
+		v.path(field+".path", fi.BestPath())
+		v.utf8(field+".path", fi.Path, fi.PathUtf8, fi.PathDecoded)
+	}
+}
+
+func (v *validator) fileTree(info *Info) {
+	piecesRootsOk := true
+	info.FileTree.Walk(nil, func(path []string, ft *FileTree) {
+		if ft.IsDir() || path == nil {
+			return
+		}
+		field := "info.file tree." + strings.Join(path, ".")
+		v.path(field, path)
+		if ft.File.Length < 0 {
+			v.add(FindingError, field, "negative length")
+		}
+		if ft.File.Length != 0 && len(ft.File.PiecesRoot) != 32 {
+			v.add(FindingError, field, "pieces root has length %v, expected 32", len(ft.File.PiecesRoot))
+			piecesRootsOk = false
+		}
+	})
+	if !piecesRootsOk || info.PieceLength <= 0 {
+		return
+	}
+	err := ValidatePieceLayers(v.mi.PieceLayers, &info.FileTree, info.PieceLength)
+	if err != nil {
+		v.add(FindingError, "piece layers", "%v", err)
+	}
+}
+
+// Checks file path components would be safe and portable to create under the torrent's directory.
+func (v *validator) path(field string, comps []string) {
+	total := 0
+	for _, c := range comps {
+		total += len(c) + 1
+		switch {
+		case c == "" || c == "." || c == "..":
+			v.add(FindingError, field, "unsafe path component %q", c)
+		case strings.ContainsAny(c, "/\\\x00"):
+			v.add(FindingError, field, "path component %q contains a separator", c)
+		case len(c) > maxPathComponentLen:
+			v.add(FindingWarning, field, "path component is %v bytes, longer than %v", len(c), maxPathComponentLen)
+		default:
+			continue
+		}
+		return
+	}
+	if total > maxPathLen {
+		v.add(FindingWarning, field, "path is %v bytes, longer than %v", total, maxPathLen)
+	}
+}
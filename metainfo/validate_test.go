@@ -0,0 +1,62 @@
+package metainfo
+
+import (
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+func TestValidateGood(t *testing.T) {
+	c := qt.New(t)
+	mi, err := LoadFromFile("testdata/continuum.torrent")
+	c.Assert(err, qt.IsNil)
+	findings := Validate(mi)
+	c.Check(findings, qt.HasLen, 0)
+	c.Check(findings.Err(), qt.IsNil)
+}
+
+func TestValidateFindings(t *testing.T) {
+	c := qt.New(t)
+	info := Info{
+		PieceLength: 3 << 10,
+		Pieces:      make([]byte, 40),
+		Name:        "caf\xe9",
+		Files: []FileInfo{
+			{Length: 1 << 10, Path: []string{"..", "passwd"}},
+			{Length: 1 << 10, Path: []string{strings.Repeat("a", 300)}},
+		},
+	}
+	mi := MetaInfo{
+		InfoBytes: bencode.MustMarshal(info),
+		Announce:  "udp://tracker.example:1337/announce",
+		AnnounceList: AnnounceList{
+			{"http:///announce", "magnet:?xt=urn:btih:abc"},
+		},
+		Encoding: "x-unknown",
+	}
+	findings := Validate(&mi)
+	fields := make(map[string]FindingSeverity)
+	for _, f := range findings {
+		fields[f.Field] = f.Severity
+	}
+	c.Check(fields, qt.DeepEquals, map[string]FindingSeverity{
+		"announce-list[0][0]": FindingError,
+		"announce-list[0][1]": FindingWarning,
+		"info.name":           FindingWarning,
+		"info.piece length":   FindingWarning,
+		"info.pieces":         FindingError,
+		"info.files[0].path":  FindingError,
+		"info.files[1].path":  FindingWarning,
+	}, qt.Commentf("%v", findings))
+	c.Check(findings.Err(), qt.ErrorMatches, `invalid metainfo: announce-list\[0\]\[0\]: .*`)
+}
+
+func TestValidateMissingInfo(t *testing.T) {
+	c := qt.New(t)
+	findings := Validate(&MetaInfo{Announce: "http://tracker.example/announce"})
+	c.Assert(findings, qt.HasLen, 1)
+	c.Check(findings[0], qt.Equals, Finding{FindingError, "info", "missing"})
+}
@@ -23,6 +23,7 @@ type (
 const (
 	PiecePriorityNormal    = types.PiecePriorityNormal
 	PiecePriorityNone      = types.PiecePriorityNone
+	PiecePriorityLow       = types.PiecePriorityLow
 	PiecePriorityNow       = types.PiecePriorityNow
 	PiecePriorityReadahead = types.PiecePriorityReadahead
 	PiecePriorityNext      = types.PiecePriorityNext
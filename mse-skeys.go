@@ -0,0 +1,57 @@
+package torrent
+
+import (
+	g "github.com/anacrolix/generics"
+
+	"github.com/anacrolix/torrent/mse"
+)
+
+// The secret keys for incoming header obfuscated handshakes are the short infohashes of our
+// torrents. They're indexed by mse.SecretKeyReq2Hash, so that each handshake is a map lookup rather
+// than hashing every infohash, which scales poorly with many torrents.
+
+func (cl *Client) setTorrentShortHash(short InfoHash, t *Torrent) {
+	cl.torrentsByShortHash[short] = t
+	g.MakeMapIfNil(&cl.shortHashesBySkeyHash)
+	cl.shortHashesBySkeyHash[mse.SecretKeyReq2Hash(short[:])] = short
+}
+
+func (cl *Client) deleteTorrentShortHash(short InfoHash) {
+	delete(cl.torrentsByShortHash, short)
+	delete(cl.shortHashesBySkeyHash, mse.SecretKeyReq2Hash(short[:]))
+}
+
+// Implements mse.SecretKeyLookup. Note that it takes the Client lock.
+func (cl *Client) lookupSkey(req2Hash [20]byte) (skey []byte, ok bool) {
+	cl.rLock()
+	defer cl.rUnlock()
+	short, ok := cl.shortHashesBySkeyHash[req2Hash]
+	if !ok || cl.torrentsByShortHash[short].encryptedIncomingDisallowed {
+		return nil, false
+	}
+	return short[:], true
+}
+
+// Returns the secret keys to accept for incoming header obfuscated handshakes. Only one is
+// returned.
+func (cl *Client) handshakeReceiverSecretKeys() (mse.SecretKeyIter, mse.SecretKeyLookup) {
+	if ret := cl.config.Callbacks.ReceiveEncryptedHandshakeSkeys; ret != nil {
+		return ret, nil
+	}
+	return nil, cl.lookupSkey
+}
+
+// Refuses incoming connections for the torrent that use header obfuscation, by not accepting its
+// infohash as a secret key. This doesn't apply if Callbacks.ReceiveEncryptedHandshakeSkeys is set.
+func (t *Torrent) DisallowEncryptedIncoming() {
+	t.cl.lock()
+	defer t.cl.unlock()
+	t.encryptedIncomingDisallowed = true
+}
+
+// Accepts incoming connections for the torrent that use header obfuscation. This is the default.
+func (t *Torrent) AllowEncryptedIncoming() {
+	t.cl.lock()
+	defer t.cl.unlock()
+	t.encryptedIncomingDisallowed = false
+}
@@ -0,0 +1,32 @@
+package torrent
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/mse"
+)
+
+func TestLookupSkey(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	ih := InfoHash{1}
+	tt, _ := cl.AddTorrentInfoHash(ih)
+	req2Hash := mse.SecretKeyReq2Hash(ih[:])
+	skey, ok := cl.lookupSkey(req2Hash)
+	c.Assert(ok, qt.IsTrue)
+	c.Check(skey, qt.DeepEquals, ih[:])
+	_, ok = cl.lookupSkey(mse.SecretKeyReq2Hash([]byte("nope")))
+	c.Check(ok, qt.IsFalse)
+	tt.DisallowEncryptedIncoming()
+	_, ok = cl.lookupSkey(req2Hash)
+	c.Check(ok, qt.IsFalse)
+	tt.AllowEncryptedIncoming()
+	_, ok = cl.lookupSkey(req2Hash)
+	c.Check(ok, qt.IsTrue)
+	tt.Drop()
+	_, ok = cl.lookupSkey(req2Hash)
+	c.Check(ok, qt.IsFalse)
+	c.Check(cl.shortHashesBySkeyHash, qt.HasLen, 0)
+}
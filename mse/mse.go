@@ -203,6 +203,8 @@ type handshake struct {
 	chooseMethod CryptoSelector
 	// Sent to the receiver.
 	cryptoProvides CryptoMethod
+	// Used instead of skeys if set.
+	skeyLookup SecretKeyLookup
 
 	writeMu    sync.Mutex
 	writes     [][]byte
@@ -413,21 +415,8 @@ func (h *handshake) initerSteps() (ret io.ReadWriter, selected CryptoMethod, err
 
 var ErrNoSecretKeyMatch = errors.New("no skey matched")
 
-func (h *handshake) receiverSteps() (ret io.ReadWriter, chosen CryptoMethod, err error) {
-	// There is up to 512 bytes of padding, then the 20 byte hash.
-	err = readUntil(io.LimitReader(h.conn, 532), hash(req1, h.s[:]))
-	if err != nil {
-		if err == io.EOF {
-			err = errors.New("failed to synchronize on S hash")
-		}
-		return
-	}
-	var b [20]byte
-	_, err = io.ReadFull(h.conn, b[:])
-	if err != nil {
-		return
-	}
-	expectedHash := hash(req3, h.s[:])
+// The initiator sends HASH('req2', SKEY) xor HASH('req3', S). Returns the skey that matches it.
+func (h *handshake) iterSkeys(b [20]byte, expectedHash []byte) (ret []byte, err error) {
 	eachHash := sha1.New()
 	var sum, xored [sha1.Size]byte
 	err = ErrNoSecretKeyMatch
@@ -438,12 +427,46 @@ func (h *handshake) receiverSteps() (ret io.ReadWriter, chosen CryptoMethod, err
 		eachHash.Sum(sum[:0])
 		xorInPlace(xored[:], sum[:], expectedHash)
 		if bytes.Equal(xored[:], b[:]) {
-			h.skey = skey
+			ret = skey
 			err = nil
 			return false
 		}
 		return true
 	})
+	return
+}
+
+// Like iterSkeys, but recovers HASH('req2', SKEY) to look the skey up directly.
+func (h *handshake) lookupSkey(b [20]byte, expectedHash []byte) (ret []byte, err error) {
+	var req2Hash [sha1.Size]byte
+	xorInPlace(req2Hash[:], b[:], expectedHash)
+	ret, ok := h.skeyLookup(req2Hash)
+	if !ok {
+		err = ErrNoSecretKeyMatch
+	}
+	return
+}
+
+func (h *handshake) receiverSteps() (ret io.ReadWriter, chosen CryptoMethod, err error) {
+	// There is up to 512 bytes of padding, then the 20 byte hash.
+	err = readUntil(io.LimitReader(h.conn, 532), hash(req1, h.s[:]))
+	if err != nil {
+		if err == io.EOF {
+			err = errors.New("failed to synchronize on S hash")
+		}
+		return
+	}
+	var b [20]byte
+	_, err = io.ReadFull(h.conn, b[:])
+	if err != nil {
+		return
+	}
+	expectedHash := hash(req3, h.s[:])
+	if h.skeyLookup != nil {
+		h.skey, err = h.lookupSkey(b, expectedHash)
+	} else {
+		h.skey, err = h.iterSkeys(b, expectedHash)
+	}
 	if err != nil {
 		return
 	}
@@ -571,6 +594,27 @@ func ReceiveHandshakeEx(rw io.ReadWriter, skeys SecretKeyIter, selectCrypto Cryp
 // returns false or exhausted.
 type SecretKeyIter func(callback func(skey []byte) (more bool))
 
+// Returns the secret key with the given SecretKeyReq2Hash. Receivers with many secret keys can index
+// them by that hash, rather than hashing every key for each handshake as with SecretKeyIter.
+type SecretKeyLookup func(req2Hash [20]byte) (skey []byte, ok bool)
+
+// Returns HASH('req2', SKEY), which the initiator obfuscates the secret key with.
+func SecretKeyReq2Hash(skey []byte) (ret [20]byte) {
+	copy(ret[:], hash(req2, skey))
+	return
+}
+
+// Like ReceiveHandshake, but finds the secret key with a SecretKeyLookup.
+func ReceiveHandshakeLookup(rw io.ReadWriter, skeys SecretKeyLookup, selectCrypto CryptoSelector) (io.ReadWriter, CryptoMethod, error) {
+	h := handshake{
+		conn:         rw,
+		initer:       false,
+		skeyLookup:   skeys,
+		chooseMethod: selectCrypto,
+	}
+	return h.Do()
+}
+
 func DefaultCryptoSelector(provided CryptoMethod) CryptoMethod {
 	// We prefer plaintext for performance reasons.
 	if provided&CryptoMethodPlaintext != 0 {
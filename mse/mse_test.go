@@ -276,3 +276,57 @@ func BenchmarkSkeysReceive(b *testing.B) {
 		}
 	}
 }
+
+func mapLookup(skeys [][]byte) SecretKeyLookup {
+	m := make(map[[20]byte][]byte, len(skeys))
+	for _, skey := range skeys {
+		m[SecretKeyReq2Hash(skey)] = skey
+	}
+	return func(req2Hash [20]byte) (skey []byte, ok bool) {
+		skey, ok = m[req2Hash]
+		return
+	}
+}
+
+func TestReceiveHandshakeLookup(t *testing.T) {
+	for _, initSkey := range []string{"yep", "nope"} {
+		initiator, receiver := net.Pipe()
+		go func() {
+			InitiateHandshake(initiator, []byte(initSkey), nil, AllSupportedCrypto)
+			initiator.Close()
+		}()
+		_, _, err := ReceiveHandshakeLookup(
+			receiver, mapLookup([][]byte{[]byte("maybe"), []byte("yep")}), DefaultCryptoSelector)
+		if initSkey == "yep" {
+			assert.NoError(t, err)
+		} else {
+			assert.ErrorIs(t, err, ErrNoSecretKeyMatch)
+		}
+		receiver.Close()
+	}
+}
+
+func BenchmarkSkeysReceiveLookup(b *testing.B) {
+	var skeys [][]byte
+	for i := 0; i < 100000; i += 1 {
+		skeys = append(skeys, make([]byte, 20))
+	}
+	fillRand(b, skeys...)
+	initSkey := skeys[len(skeys)/2]
+	lookup := mapLookup(skeys)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i += 1 {
+		initiator, receiver := net.Pipe()
+		go func() {
+			_, _, err := InitiateHandshake(initiator, initSkey, nil, AllSupportedCrypto)
+			if err != nil {
+				panic(err)
+			}
+		}()
+		_, _, err := ReceiveHandshakeLookup(receiver, lookup, DefaultCryptoSelector)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
@@ -1,11 +1,13 @@
 package torrent
 
 import (
+	"context"
 	"net"
 	"testing"
 
 	"github.com/anacrolix/log"
 	"github.com/anacrolix/missinggo/v2"
+	qt "github.com/frankban/quicktest"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
@@ -85,3 +87,22 @@ func TestListenLocalhostNetwork(t *testing.T) {
 		listenClosure(net.Listen, "tcp4", "localhost:0"),
 	)
 }
+
+func TestTcpSimultaneousOpenDialsFromListenPort(t *testing.T) {
+	c := qt.New(t)
+	remote, err := net.Listen("tcp4", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	defer remote.Close()
+	s, err := listenTcp("tcp4", "127.0.0.1:0", socketOpts{tcpSimultaneousOpen: true})
+	c.Assert(err, qt.IsNil)
+	defer s.Close()
+	nc, err := holepunchDialer(s).Dial(context.Background(), remote.Addr().String())
+	c.Assert(err, qt.IsNil)
+	defer nc.Close()
+	c.Check(nc.LocalAddr().String(), qt.Equals, s.Addr().String())
+	// Without simultaneous open, holepunch dials use the usual dialer.
+	s2, err := listenTcp("tcp4", "127.0.0.1:0", socketOpts{})
+	c.Assert(err, qt.IsNil)
+	defer s2.Close()
+	c.Check(holepunchDialer(s2), qt.Equals, Dialer(s2))
+}
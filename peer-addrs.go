@@ -0,0 +1,60 @@
+package torrent
+
+import (
+	"net"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+// Describes peers added by address with Torrent.AddPeerAddrs and Torrent.AddPeerNetAddrs.
+type AddPeerOpts struct {
+	// Defaults to PeerSourceDirect.
+	Source PeerSource
+	// The peers are thought to be seeds. They aren't dialed once we have all the pieces.
+	Seed bool
+	// The peers won't accept unencrypted connections.
+	RequiresEncryption bool
+	// Whether we can ignore poor or bad behaviour from the peers.
+	Trusted bool
+}
+
+func (opts AddPeerOpts) peerInfo(addr PeerRemoteAddr) (ret PeerInfo) {
+	ret.Addr = addr
+	ret.Source = opts.Source
+	if ret.Source == "" {
+		ret.Source = PeerSourceDirect
+	}
+	if opts.Seed {
+		ret.PexPeerFlags |= pp.PexSeedUploadOnly
+	}
+	if opts.RequiresEncryption {
+		ret.SupportsEncryption = true
+		ret.RequiresEncryption = true
+	}
+	ret.Trusted = opts.Trusted
+	return
+}
+
+// Adds peers by "host:port" address, such as from an external peer source. Returns the number of
+// peers added to the reserve.
+func (t *Torrent) AddPeerAddrs(addrs []string, opts AddPeerOpts) int {
+	peers := make([]PeerInfo, 0, len(addrs))
+	for _, addr := range addrs {
+		peers = append(peers, opts.peerInfo(StringAddr(addr)))
+	}
+	return t.AddPeers(peers)
+}
+
+// Adds peers by net.Addr, such as a *net.TCPAddr. See AddPeerAddrs.
+func (t *Torrent) AddPeerNetAddrs(addrs []net.Addr, opts AddPeerOpts) int {
+	peers := make([]PeerInfo, 0, len(addrs))
+	for _, addr := range addrs {
+		peers = append(peers, opts.peerInfo(addr))
+	}
+	return t.AddPeers(peers)
+}
+
+// We don't dial peers thought to be seeds when we're one too, as neither has anything to offer.
+func (t *Torrent) skipDialingSeeds() bool {
+	return t.haveAllPieces()
+}
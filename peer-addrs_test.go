@@ -0,0 +1,45 @@
+package torrent
+
+import (
+	"net"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+func TestAddPeerAddrs(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	// No dialers, so added peers stay in reserve.
+	cfg.DisableTCP = true
+	cfg.DisableUTP = true
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt := cl.newTorrentForTesting()
+	c.Check(tt.AddPeerAddrs([]string{"1.2.3.4:5", "1.2.3.4:6"}, AddPeerOpts{
+		Seed:               true,
+		RequiresEncryption: true,
+	}), qt.Equals, 2)
+	c.Check(tt.AddPeerNetAddrs([]net.Addr{
+		&net.TCPAddr{IP: net.IPv4(5, 6, 7, 8), Port: 9},
+	}, AddPeerOpts{Source: PeerSourceTracker}), qt.Equals, 1)
+	peers := make(map[string]PeerInfo)
+	cl.lock()
+	tt.peers.Each(func(p PeerInfo) {
+		peers[p.Addr.String()] = p
+	})
+	cl.unlock()
+	c.Assert(peers, qt.HasLen, 3)
+	p := peers["1.2.3.4:6"]
+	c.Check(p.Source, qt.Equals, PeerSource(PeerSourceDirect))
+	c.Check(p.Get(pp.PexSeedUploadOnly), qt.IsTrue)
+	c.Check(p.RequiresEncryption, qt.IsTrue)
+	c.Check(p.SupportsEncryption, qt.IsTrue)
+	p = peers["5.6.7.8:9"]
+	c.Check(p.Source, qt.Equals, PeerSource(PeerSourceTracker))
+	c.Check(p.Get(pp.PexSeedUploadOnly), qt.IsFalse)
+	c.Check(p.RequiresEncryption, qt.IsFalse)
+}
@@ -0,0 +1,110 @@
+package torrent
+
+import (
+	"expvar"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// Limits how many distinct client implementations get their own entry, since peers choose
+	// their own names.
+	maxPeerClientImplementations = 256
+	maxPeerClientNameLen         = 64
+)
+
+// Connection-level stats aggregated by the remote client implementation, as reported in the
+// extended handshake, or the BEP 20 peer ID if that's absent. Helps to spot interop problems with
+// specific implementations.
+var (
+	peerClientImplementations = expvar.NewMap("peerClientImplementations")
+
+	peerClientImplementationsMu    sync.Mutex
+	peerClientImplementationsCount int
+)
+
+// Returns the expvar entry to aggregate stats for a client implementation into.
+func peerClientImplementationVar(name string) *expvar.Map {
+	peerClientImplementationsMu.Lock()
+	defer peerClientImplementationsMu.Unlock()
+	if v, ok := peerClientImplementations.Get(name).(*expvar.Map); ok {
+		return v
+	}
+	if peerClientImplementationsCount >= maxPeerClientImplementations {
+		name = "other"
+		if v, ok := peerClientImplementations.Get(name).(*expvar.Map); ok {
+			return v
+		}
+	}
+	v := new(expvar.Map).Init()
+	peerClientImplementations.Set(name, v)
+	peerClientImplementationsCount++
+	return v
+}
+
+// Reduces an extended handshake "v" value to the implementation name, dropping versions so that
+// releases of the same client are aggregated together. Falls back to the client code in BEP 20
+// style peer IDs.
+func peerClientImplementation(v string, id PeerID) string {
+	var fields []string
+	for _, f := range strings.Fields(v) {
+		if looksLikeVersion(f) {
+			break
+		}
+		if i := strings.LastIndexByte(f, '/'); i > 0 && looksLikeVersion(f[i+1:]) {
+			fields = append(fields, f[:i])
+			break
+		}
+		fields = append(fields, f)
+	}
+	name := sanitizeExpvarKey(strings.Join(fields, " "))
+	if name != "" {
+		return name
+	}
+	if id[0] == '-' && id[7] == '-' {
+		if code := sanitizeExpvarKey(string(id[1:3])); len(code) == 2 {
+			return "peer id " + code
+		}
+	}
+	return "unknown"
+}
+
+func looksLikeVersion(s string) bool {
+	s = strings.TrimPrefix(s, "v")
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
+
+// expvar.Var.String must produce valid JSON, and keys are formatted with %q.
+func sanitizeExpvarKey(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || !unicode.IsPrint(r) {
+			return -1
+		}
+		return r
+	}, s)
+	if utf8.RuneCountInString(s) > maxPeerClientNameLen {
+		s = string([]rune(s)[:maxPeerClientNameLen])
+	}
+	return s
+}
+
+// Adds the connection's stats to the aggregate for the remote client implementation. Connections
+// that didn't complete the BitTorrent handshake aren't counted.
+func (cn *PeerConn) addPeerClientImplementationStats() {
+	if cn.PeerID == (PeerID{}) {
+		return
+	}
+	v, _ := cn.PeerClientName.Load().(string)
+	m := peerClientImplementationVar(peerClientImplementation(v, cn.PeerID))
+	m.Add("connections", 1)
+	stats := reflect.ValueOf(&cn._stats).Elem()
+	for i := 0; i < stats.NumField(); i++ {
+		n := stats.Field(i).Addr().Interface().(*Count).Int64()
+		if n != 0 {
+			m.Add(stats.Type().Field(i).Name, n)
+		}
+	}
+}
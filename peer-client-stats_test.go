@@ -0,0 +1,58 @@
+package torrent
+
+import (
+	"expvar"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestPeerClientImplementation(t *testing.T) {
+	c := qt.New(t)
+	var azureusId PeerID
+	copy(azureusId[:], "-qB4650-abcdefghijkl")
+	for _, tc := range []struct {
+		v        string
+		id       PeerID
+		expected string
+	}{
+		{"qBittorrent/4.6.0", PeerID{}, "qBittorrent"},
+		{"Transmission 4.0.5", PeerID{}, "Transmission"},
+		{"µTorrent 3.5.5", PeerID{}, "µTorrent"},
+		{"libTorrent (Rakshasa) 0.13.8", PeerID{}, "libTorrent (Rakshasa)"},
+		{"github.com/anacrolix/confluence v1.2.3 (anacrolix/torrent v1.55.0)", PeerID{}, "github.com/anacrolix/confluence"},
+		{"ut_payme\xeet", PeerID{}, "ut_paymet"},
+		{"", azureusId, "peer id qB"},
+		{"", PeerID{}, "unknown"},
+		{"\x00\x01", PeerID{}, "unknown"},
+	} {
+		c.Check(peerClientImplementation(tc.v, tc.id), qt.Equals, tc.expected, qt.Commentf("%q", tc.v))
+	}
+}
+
+func TestPeerClientImplementationStatsOnClose(t *testing.T) {
+	c := qt.New(t)
+	// The expvars are global, so they may have been added to by earlier runs of the test.
+	get := func(key string) int64 {
+		m, _ := peerClientImplementations.Get("TestPeerClientImplementationStatsOnClose").(*expvar.Map)
+		if m == nil {
+			return 0
+		}
+		v, _ := m.Get(key).(*expvar.Int)
+		if v == nil {
+			return 0
+		}
+		return v.Value()
+	}
+	conns, bytesRead := get("connections"), get("BytesReadData")
+	cl := newTestingClient(t)
+	pc := cl.newConnection(nil, newConnectionOpts{network: "test"})
+	copy(pc.PeerID[:], "-TR4050-abcdefghijkl")
+	pc.PeerClientName.Store("TestPeerClientImplementationStatsOnClose/1.0")
+	pc._stats.BytesReadData.Add(3)
+	pc.onClose()
+	c.Check(get("connections")-conns, qt.Equals, int64(1))
+	c.Check(get("BytesReadData")-bytesRead, qt.Equals, int64(3))
+	// Zero stats aren't added.
+	c.Check(get("BytesWrittenData"), qt.Equals, int64(0))
+}
@@ -32,6 +32,16 @@ func (pc *PeerConn) initMessageWriter() {
 			return pc.useful()
 		},
 		writeBuffer: new(bytes.Buffer),
+		onWriteStall: func(timeout time.Duration) {
+			pc.locker().Lock()
+			defer pc.locker().Unlock()
+			if pc.closed.IsSet() {
+				return
+			}
+			torrent.Add("conns closed for stalled writes", 1)
+			pc.logger.Levelf(log.Debug, "closing connection: no write progress for %v", timeout)
+			pc.close()
+		},
 	}
 }
 
@@ -44,7 +54,7 @@ func (pc *PeerConn) messageWriterRunner() {
 	defer pc.locker().Unlock()
 	defer pc.close()
 	defer pc.locker().Lock()
-	pc.messageWriter.run(pc.t.cl.config.KeepAliveTimeout)
+	pc.messageWriter.run(pc.t.cl.config.KeepAliveTimeout, pc.t.cl.config.PeerWriteStallTimeout)
 }
 
 type peerConnMsgWriter struct {
@@ -54,20 +64,33 @@ type peerConnMsgWriter struct {
 	logger          log.Logger
 	w               io.Writer
 	keepAlive       func() bool
+	// Called from a timer if a write makes no progress within the stall timeout. It should close
+	// the connection, which unblocks the write.
+	onWriteStall func(timeout time.Duration)
 
 	mu        sync.Mutex
 	writeCond chansync.BroadcastCond
 	// Pointer so we can swap with the "front buffer".
 	writeBuffer *bytes.Buffer
+	// Bytes taken from writeBuffer that haven't been written yet.
+	writing int
 }
 
 // Routine that writes to the peer. Some of what to write is buffered by
 // activity elsewhere in the Client, and some is determined locally when the
 // connection is writable.
-func (cn *peerConnMsgWriter) run(keepAliveTimeout time.Duration) {
+func (cn *peerConnMsgWriter) run(keepAliveTimeout, writeStallTimeout time.Duration) {
 	lastWrite := time.Now()
 	keepAliveTimer := time.NewTimer(keepAliveTimeout)
 	frontBuf := new(bytes.Buffer)
+	// Network writes block when the peer isn't reading what we send, which would otherwise hold
+	// on to the connection and its buffers indefinitely.
+	var stallTimer *time.Timer
+	if writeStallTimeout > 0 {
+		stallTimer = time.AfterFunc(writeStallTimeout, func() { cn.onWriteStall(writeStallTimeout) })
+		stallTimer.Stop()
+		defer stallTimer.Stop()
+	}
 	for {
 		if cn.closed.IsSet() {
 			return
@@ -91,6 +114,7 @@ func (cn *peerConnMsgWriter) run(keepAliveTimeout time.Duration) {
 		}
 		// Flip the buffers.
 		frontBuf, cn.writeBuffer = cn.writeBuffer, frontBuf
+		cn.writing = frontBuf.Len()
 		cn.mu.Unlock()
 		if frontBuf.Len() == 0 {
 			panic("expected non-empty front buffer")
@@ -99,14 +123,23 @@ func (cn *peerConnMsgWriter) run(keepAliveTimeout time.Duration) {
 		for frontBuf.Len() != 0 {
 			// Limit write size for WebRTC. See https://github.com/pion/datachannel/issues/59.
 			next := frontBuf.Next(1<<16 - 1)
+			if stallTimer != nil {
+				stallTimer.Reset(writeStallTimeout)
+			}
 			var n int
 			n, err = cn.w.Write(next)
+			if stallTimer != nil {
+				stallTimer.Stop()
+			}
 			if err == nil && n != len(next) {
 				panic("expected full write")
 			}
 			if err != nil {
 				break
 			}
+			cn.mu.Lock()
+			cn.writing = frontBuf.Len()
+			cn.mu.Unlock()
 		}
 		if err != nil {
 			cn.logger.WithDefaultLevel(log.Debug).Printf("error writing: %v", err)
@@ -125,6 +158,17 @@ func (cn *peerConnMsgWriter) write(msg pp.Message) bool {
 	return !cn.writeBufferFull()
 }
 
+// Bytes waiting to be written to the peer, including those in a write that hasn't completed.
+func (cn *peerConnMsgWriter) queuedBytes() int {
+	cn.mu.Lock()
+	defer cn.mu.Unlock()
+	if cn.writeBuffer == nil {
+		// Not initialized yet.
+		return 0
+	}
+	return cn.writeBuffer.Len() + cn.writing
+}
+
 func (cn *peerConnMsgWriter) writeBufferFull() bool {
 	return cn.writeBuffer.Len() >= writeBufferHighWaterLen
 }
@@ -0,0 +1,89 @@
+package torrent
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/chansync"
+	"github.com/anacrolix/log"
+	qt "github.com/frankban/quicktest"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+func TestMessageWriterStalledWrite(t *testing.T) {
+	c := qt.New(t)
+	// Nothing reads from the pipe, so writes block as they would for a peer that stops reading.
+	r, w := io.Pipe()
+	var closed chansync.SetOnce
+	stalled := make(chan time.Duration, 1)
+	mw := peerConnMsgWriter{
+		fillWriteBuffer: func() {},
+		closed:          &closed,
+		logger:          log.Default,
+		w:               w,
+		keepAlive:       func() bool { return false },
+		writeBuffer:     new(bytes.Buffer),
+		onWriteStall: func(timeout time.Duration) {
+			stalled <- timeout
+			closed.Set()
+			r.Close()
+		},
+	}
+	msg := pp.Message{Type: pp.Have, Index: 1}
+	mw.write(msg)
+	msgLen := len(msg.MustMarshalBinary())
+	c.Check(mw.queuedBytes(), qt.Equals, msgLen)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mw.run(time.Hour, 10*time.Millisecond)
+	}()
+	select {
+	case timeout := <-stalled:
+		c.Check(timeout, qt.Equals, 10*time.Millisecond)
+	case <-time.After(10 * time.Second):
+		c.Fatal("write stall not detected")
+	}
+	<-done
+	// The data taken for the failed write is still counted.
+	c.Check(mw.queuedBytes(), qt.Equals, msgLen)
+}
+
+func TestMessageWriterQueuedBytesDrain(t *testing.T) {
+	c := qt.New(t)
+	var closed chansync.SetOnce
+	var out bytes.Buffer
+	written := make(chan struct{}, 1)
+	mw := peerConnMsgWriter{
+		fillWriteBuffer: func() {},
+		closed:          &closed,
+		logger:          log.Default,
+		w: writerFunc(func(b []byte) (int, error) {
+			n, err := out.Write(b)
+			written <- struct{}{}
+			return n, err
+		}),
+		keepAlive:   func() bool { return false },
+		writeBuffer: new(bytes.Buffer),
+	}
+	mw.write(pp.Message{Type: pp.Interested})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		mw.run(time.Hour, time.Hour)
+	}()
+	<-written
+	closed.Set()
+	<-done
+	c.Check(out.Len(), qt.Equals, 5)
+	c.Check(mw.queuedBytes(), qt.Equals, 0)
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) {
+	return f(b)
+}
@@ -0,0 +1,66 @@
+package torrent
+
+import (
+	g "github.com/anacrolix/generics"
+)
+
+// Orders reserve peers after trust and before BEP 40 priority. Higher scoring peers are dialed
+// first, and the lowest are discarded when there are more than ClientConfig.TorrentPeersHighWater.
+type peerScore = int32
+
+// Outcomes of past dials to a peer address.
+type peerDialHistory struct {
+	successes int
+	failures  int
+}
+
+const (
+	peerScoreConnectedBefore = 4
+	// Failures beyond this don't lower the score further, so a peer that has worked before isn't
+	// written off by a bad patch.
+	maxScoredPeerDialFailures = 8
+)
+
+// Peers from sources that are specific to the torrent, and harder to forge in bulk, are preferred.
+func peerSourceScore(source PeerSource) peerScore {
+	switch source {
+	case PeerSourceDirect:
+		return 3
+	case PeerSourceTracker:
+		return 2
+	case PeerSourcePex, PeerSourceUtHolepunch:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func (t *Torrent) reservePeerScore(p PeerInfo) (ret peerScore) {
+	ret = peerSourceScore(p.Source)
+	h := t.peerDialHistory[p.Addr.String()]
+	if h.successes != 0 {
+		ret += peerScoreConnectedBefore
+	}
+	ret -= peerScore(min(h.failures, maxScoredPeerDialFailures))
+	return
+}
+
+// Records the outcome of dialing a peer, for scoring it if it's added again. The history is
+// bounded, by discarding arbitrary addresses.
+func (t *Torrent) recordPeerDial(addr PeerRemoteAddr, ok bool) {
+	key := addr.String()
+	h, known := t.peerDialHistory[key]
+	if !known && len(t.peerDialHistory) >= 2*t.cl.config.TorrentPeersHighWater {
+		for k := range t.peerDialHistory {
+			delete(t.peerDialHistory, k)
+			break
+		}
+	}
+	if ok {
+		h.successes++
+	} else {
+		h.failures++
+	}
+	g.MakeMapIfNil(&t.peerDialHistory)
+	t.peerDialHistory[key] = h
+}
@@ -0,0 +1,41 @@
+package torrent
+
+import (
+	"net"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestReservePeerScoring(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	// No dialers, so added peers stay in reserve.
+	cfg.DisableTCP = true
+	cfg.DisableUTP = true
+	cfg.TorrentPeersHighWater = 2
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt := cl.newTorrentForTesting()
+	addr := func(port int) PeerRemoteAddr {
+		return ipPortAddr{net.IPv4(1, 2, 3, 4), port}
+	}
+	cl.lock()
+	defer cl.unlock()
+	for range 3 {
+		tt.recordPeerDial(addr(3), false)
+	}
+	tt.addPeer(PeerInfo{Addr: addr(1), Source: PeerSourceDhtGetPeers})
+	tt.addPeer(PeerInfo{Addr: addr(2), Source: PeerSourceTracker})
+	// Scores below the others after its failures, and is discarded at the high water mark.
+	tt.addPeer(PeerInfo{Addr: addr(3), Source: PeerSourceTracker})
+	c.Assert(tt.peers.Len(), qt.Equals, 2)
+	tt.recordPeerDial(addr(1), true)
+	// Replaces the existing entry with a score that reflects the successful dial.
+	c.Check(tt.addPeer(PeerInfo{Addr: addr(1), Source: PeerSourcePex}), qt.IsTrue)
+	c.Assert(tt.peers.Len(), qt.Equals, 2)
+	c.Check(tt.peers.PopMax().Addr.String(), qt.Equals, addr(1).String())
+	c.Check(tt.peers.PopMax().Addr.String(), qt.Equals, addr(2).String())
+	c.Check(tt.peers.Len(), qt.Equals, 0)
+}
@@ -0,0 +1,67 @@
+package torrent
+
+import (
+	g "github.com/anacrolix/generics"
+	"github.com/google/btree"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+// Counts established and half-open connections by the source the peer was discovered from.
+func (t *Torrent) connsBySource() map[PeerSource]int {
+	ret := make(map[PeerSource]int)
+	for pc := range t.conns {
+		ret[pc.Discovery]++
+	}
+	for _, attempts := range t.halfOpen {
+		for _, pi := range attempts {
+			ret[pi.Source]++
+		}
+	}
+	return ret
+}
+
+// Returns the number of established and half-open connections to peers from each source.
+func (t *Torrent) ConnsBySource() map[PeerSource]int {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.connsBySource()
+}
+
+func (t *Torrent) peerSourceAtLimit(source PeerSource, bySource map[PeerSource]int) bool {
+	limit := t.cl.config.PeerSourceConnLimits[source]
+	return limit > 0 && bySource[source] >= limit
+}
+
+// Removes and returns the next peer to dial. Peers thought to be seeds are skipped if we're one.
+// Trusted peers go first. Otherwise the highest priority
+// peer is taken from the source with the fewest connections, skipping sources at their limit, so
+// that one source can't crowd out the others.
+func (t *Torrent) popPeerToDial(bySource map[PeerSource]int) (_ PeerInfo, ok bool) {
+	var best g.Option[prioritizedPeersItem]
+	skipSeeds := t.skipDialingSeeds()
+	t.peers.om.Descend(func(i btree.Item) bool {
+		item := i.(prioritizedPeersItem)
+		if skipSeeds && item.p.Get(pp.PexSeedUploadOnly) {
+			return true
+		}
+		if item.p.Trusted {
+			best.Set(item)
+			return false
+		}
+		source := item.p.Source
+		if t.peerSourceAtLimit(source, bySource) {
+			return true
+		}
+		if !best.Ok || bySource[source] < bySource[best.Value.p.Source] {
+			best.Set(item)
+		}
+		// Nothing can beat a source without connections.
+		return bySource[best.Value.p.Source] != 0
+	})
+	if !best.Ok {
+		return
+	}
+	t.peers.Delete(best.Value)
+	return best.Value.p, true
+}
@@ -0,0 +1,50 @@
+package torrent
+
+import (
+	"net"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func TestPopPeerToDialBalancesSources(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.PeerSourceConnLimits = map[PeerSource]int{PeerSourceDhtGetPeers: 1}
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	cl.lock()
+	defer cl.unlock()
+	for i := 1; i <= 3; i++ {
+		for j, source := range []PeerSource{PeerSourcePex, PeerSourceTracker, PeerSourceDhtGetPeers} {
+			tt.peers.Add(PeerInfo{
+				Addr:   ipPortAddr{IP: net.IPv4(10, 0, byte(j), byte(i)), Port: 6881},
+				Source: source,
+			})
+		}
+	}
+	bySource := map[PeerSource]int{PeerSourcePex: 2}
+	var popped []PeerSource
+	for {
+		p, ok := tt.popPeerToDial(bySource)
+		if !ok {
+			break
+		}
+		bySource[p.Source]++
+		popped = append(popped, p.Source)
+	}
+	c.Check(bySource, qt.DeepEquals, map[PeerSource]int{
+		PeerSourcePex:         5,
+		PeerSourceTracker:     3,
+		PeerSourceDhtGetPeers: 1,
+	})
+	// The tracker and DHT have no connections, so they're dialed before more PEX peers.
+	c.Check(popped[:2], qt.Not(qt.Contains), PeerSource(PeerSourcePex))
+	// The remaining DHT peers are kept for when a slot frees up.
+	c.Check(tt.peers.Len(), qt.Equals, 2)
+}
@@ -28,6 +28,7 @@ type (
 	Peer struct {
 		// First to ensure 64-bit alignment for atomics. See #262.
 		_stats ConnStats
+		rates  transferRateMeters
 
 		t *Torrent
 
@@ -45,11 +46,17 @@ type (
 		headerEncrypted bool
 		cryptoMethod    mse.CryptoMethod
 		Discovery       PeerSource
-		trusted         bool
-		closed          chansync.SetOnce
+		// Connectivity flags learned before connecting, such as from the ut_pex message the peer
+		// was discovered in.
+		DiscoveryFlags pp.PexPeerFlags
+		trusted        bool
+		closed         chansync.SetOnce
 		// Set true after we've added our ConnStats generated during handshake to
 		// other ConnStat instances as determined when the *Torrent became known.
 		reconciledHandshakeStats bool
+		// The Client's Clock. It's needed before the Torrent is known, such as for rates during the
+		// handshake.
+		clock Clock
 
 		lastMessageReceived     time.Time
 		completedHandshake      time.Time
@@ -59,7 +66,7 @@ type (
 		// Stuff controlled by the local peer.
 		needRequestUpdate    string
 		requestState         request_strategy.PeerRequestState
-		updateRequestsTimer  *time.Timer
+		updateRequestsTimer  ClockTimer
 		lastRequestUpdate    time.Time
 		peakRequests         maxRequests
 		lastBecameInterested time.Time
@@ -138,11 +145,11 @@ func (p *Peer) initRequestState() {
 func (cn *Peer) updateExpectingChunks() {
 	if cn.expectingChunks() {
 		if cn.lastStartedExpectingToReceiveChunks.IsZero() {
-			cn.lastStartedExpectingToReceiveChunks = time.Now()
+			cn.lastStartedExpectingToReceiveChunks = cn.now()
 		}
 	} else {
 		if !cn.lastStartedExpectingToReceiveChunks.IsZero() {
-			cn.cumulativeExpectedToReceiveChunks += time.Since(cn.lastStartedExpectingToReceiveChunks)
+			cn.cumulativeExpectedToReceiveChunks += cn.now().Sub(cn.lastStartedExpectingToReceiveChunks)
 			cn.lastStartedExpectingToReceiveChunks = time.Time{}
 		}
 	}
@@ -177,7 +184,7 @@ func (cn *Peer) remoteChokingPiece(piece pieceIndex) bool {
 func (cn *Peer) cumInterest() time.Duration {
 	ret := cn.priorInterest
 	if cn.requestState.Interested {
-		ret += time.Since(cn.lastBecameInterested)
+		ret += cn.now().Sub(cn.lastBecameInterested)
 	}
 	return ret
 }
@@ -207,11 +214,11 @@ func (cn *Peer) completedString() string {
 	return fmt.Sprintf("%d/%d", have, cn.bestPeerNumPieces())
 }
 
-func eventAgeString(t time.Time) string {
+func eventAgeString(now, t time.Time) string {
 	if t.IsZero() {
 		return "never"
 	}
-	return fmt.Sprintf("%.2fs ago", time.Since(t).Seconds())
+	return fmt.Sprintf("%.2fs ago", now.Sub(t).Seconds())
 }
 
 // Inspired by https://github.com/transmission/transmission/wiki/Peer-Status-Text.
@@ -286,9 +293,9 @@ func (cn *Peer) writeStatus(w io.Writer) {
 	}
 	fmt.Fprintf(w, "bep40-prio: %v\n", prioStr)
 	fmt.Fprintf(w, "last msg: %s, connected: %s, last helpful: %s, itime: %s, etime: %s\n",
-		eventAgeString(cn.lastMessageReceived),
-		eventAgeString(cn.completedHandshake),
-		eventAgeString(cn.lastHelpful()),
+		eventAgeString(cn.now(), cn.lastMessageReceived),
+		eventAgeString(cn.now(), cn.completedHandshake),
+		eventAgeString(cn.now(), cn.lastHelpful()),
 		cn.cumInterest(),
 		cn.totalExpectingTime(),
 	)
@@ -304,10 +311,20 @@ func (cn *Peer) writeStatus(w io.Writer) {
 		cn.nominalMaxRequests(),
 		cn.PeerMaxRequests,
 		len(cn.peerRequests),
-		localClientReqq,
+		cn.t.cl.localReqq(),
 		cn.statusFlags(),
 		cn.downloadRate()/(1<<10),
 	)
+	if cn.DiscoveryFlags != 0 {
+		fmt.Fprintf(w, "discovery flags: %v\n", pexPeerFlagsString(cn.DiscoveryFlags))
+	}
+	if cn._stats.BytesReadWasted() != 0 {
+		fmt.Fprintf(w, "wasted bytes: %v duplicate, %v unwanted, %v failed hash\n",
+			&cn._stats.BytesReadWastedDuplicate,
+			&cn._stats.BytesReadWastedUnwanted,
+			&cn._stats.BytesReadWastedFailedHash,
+		)
+	}
 	fmt.Fprintf(w, "requested pieces:")
 	cn.iterContiguousPieceRequests(func(piece pieceIndex, count int) {
 		fmt.Fprintf(w, " %v(%v)", piece, count)
@@ -328,6 +345,11 @@ func (p *Peer) close() {
 	p.peerImpl.onClose()
 	if p.t != nil {
 		p.t.decPeerPieceAvailability(p)
+		// We won't get acknowledgements now, and anything in flight won't be received.
+		p.requestState.Cancelled.Iterate(func(r RequestIndex) bool {
+			p.t.decCancelledRequest(r)
+			return true
+		})
 	}
 	for _, f := range p.callbacks.PeerClosed {
 		f(p)
@@ -373,7 +395,7 @@ func (cn *Peer) nominalMaxRequests() maxRequests {
 func (cn *Peer) totalExpectingTime() (ret time.Duration) {
 	ret = cn.cumulativeExpectedToReceiveChunks
 	if !cn.lastStartedExpectingToReceiveChunks.IsZero() {
-		ret += time.Since(cn.lastStartedExpectingToReceiveChunks)
+		ret += cn.now().Sub(cn.lastStartedExpectingToReceiveChunks)
 	}
 	return
 }
@@ -384,9 +406,9 @@ func (cn *Peer) setInterested(interested bool) bool {
 	}
 	cn.requestState.Interested = interested
 	if interested {
-		cn.lastBecameInterested = time.Now()
+		cn.lastBecameInterested = cn.now()
 	} else if !cn.lastBecameInterested.IsZero() {
-		cn.priorInterest += time.Since(cn.lastBecameInterested)
+		cn.priorInterest += cn.now().Sub(cn.lastBecameInterested)
 	}
 	cn.updateExpectingChunks()
 	// log.Printf("%p: setting interest: %v", cn, interested)
@@ -448,7 +470,8 @@ func (cn *Peer) request(r RequestIndex) (more bool, err error) {
 	if cn.requestState.Requests.Contains(r) {
 		return true, nil
 	}
-	if maxRequests(cn.requestState.Requests.GetCardinality()) >= cn.nominalMaxRequests() {
+	// Cancelled requests count against the peer's reqq until they're rejected or satisfied.
+	if maxRequests(cn.requestState.Requests.GetCardinality()+cn.requestState.Cancelled.GetCardinality()) >= cn.nominalMaxRequests() {
 		return true, errors.New("too many outstanding requests")
 	}
 	cn.requestState.Requests.Add(r)
@@ -458,7 +481,7 @@ func (cn *Peer) request(r RequestIndex) (more bool, err error) {
 	cn.validReceiveChunks[r]++
 	cn.t.requestState[r] = requestState{
 		peer: cn,
-		when: time.Now(),
+		when: cn.now(),
 	}
 	cn.updateExpectingChunks()
 	ppReq := cn.t.requestIndexToRequest(r)
@@ -477,6 +500,7 @@ func (me *Peer) cancel(r RequestIndex) {
 		if !me.requestState.Cancelled.CheckedAdd(r) {
 			panic("request already cancelled")
 		}
+		me.t.cancelledRequests[r]++
 	}
 	me.decPeakRequests()
 	if me.isLowOnRequests() {
@@ -536,6 +560,23 @@ func (cn *Peer) allStats(f func(*ConnStats)) {
 
 func (cn *Peer) readBytes(n int64) {
 	cn.allStats(add(n, func(cs *ConnStats) *Count { return &cs.BytesRead }))
+	now := cn.now()
+	cn.allRates(func(rm *transferRateMeters) { rm.download.add(n, now) })
+}
+
+// All transfer rate meters that include this connection. Like allStats, the Torrent and Client
+// meters only count traffic after the handshake has been reconciled.
+func (cn *Peer) allRates(f func(*transferRateMeters)) {
+	f(&cn.rates)
+	if cn.reconciledHandshakeStats {
+		f(&cn.t.rates)
+		f(&cn.t.cl.rates)
+	}
+}
+
+// Rolling download and upload rates for this connection.
+func (cn *Peer) TransferRates() TransferRates {
+	return cn.rates.rates(cn.now())
 }
 
 func (c *Peer) lastHelpful() (ret time.Time) {
@@ -570,7 +611,7 @@ func runSafeExtraneous(f func()) {
 func (c *Peer) remoteRejectedRequest(r RequestIndex) bool {
 	if c.deleteRequest(r) {
 		c.decPeakRequests()
-	} else if !c.requestState.Cancelled.CheckedRemove(r) {
+	} else if !c.removeCancelled(r) {
 		return false
 	}
 	if c.isLowOnRequests() {
@@ -641,7 +682,7 @@ func (c *Peer) receiveChunk(msg *pp.Message) error {
 			}
 		}
 		// Request has been satisfied.
-		if c.deleteRequest(req) || c.requestState.Cancelled.CheckedRemove(req) {
+		if c.deleteRequest(req) || c.removeCancelled(req) {
 			intended = true
 			if !c.peerChoking {
 				c._chunksReceivedWhileExpecting++
@@ -661,21 +702,29 @@ func (c *Peer) receiveChunk(msg *pp.Message) error {
 		// panic(fmt.Sprintf("%+v", ppReq))
 		chunksReceived.Add("redundant", 1)
 		c.allStats(add(1, func(cs *ConnStats) *Count { return &cs.ChunksReadWasted }))
+		c.allStats(add(int64(len(msg.Piece)), func(cs *ConnStats) *Count { return &cs.BytesReadWastedDuplicate }))
 		return nil
 	}
 
 	piece := &t.pieces[ppReq.Index]
-
-	c.allStats(add(1, func(cs *ConnStats) *Count { return &cs.ChunksReadUseful }))
-	c.allStats(add(int64(len(msg.Piece)), func(cs *ConnStats) *Count { return &cs.BytesReadUsefulData }))
 	if intended {
 		c.piecesReceivedSinceLastRequestUpdate++
-		c.allStats(add(int64(len(msg.Piece)), func(cs *ConnStats) *Count { return &cs.BytesReadUsefulIntendedData }))
 	}
-	for _, f := range c.t.cl.config.Callbacks.ReceivedUsefulData {
-		f(ReceivedUsefulDataEvent{c, msg})
+	if !t.wantPieceIndex(pieceIndex(ppReq.Index)) {
+		// We'll still store it, but it wasn't needed, so it's counted as wasted and not useful.
+		c.allStats(add(1, func(cs *ConnStats) *Count { return &cs.ChunksReadWasted }))
+		c.allStats(add(int64(len(msg.Piece)), func(cs *ConnStats) *Count { return &cs.BytesReadWastedUnwanted }))
+	} else {
+		c.allStats(add(1, func(cs *ConnStats) *Count { return &cs.ChunksReadUseful }))
+		c.allStats(add(int64(len(msg.Piece)), func(cs *ConnStats) *Count { return &cs.BytesReadUsefulData }))
+		if intended {
+			c.allStats(add(int64(len(msg.Piece)), func(cs *ConnStats) *Count { return &cs.BytesReadUsefulIntendedData }))
+		}
+		for _, f := range c.t.cl.config.Callbacks.ReceivedUsefulData {
+			f(ReceivedUsefulDataEvent{c, msg})
+		}
+		c.lastUsefulChunkReceived = c.now()
 	}
-	c.lastUsefulChunkReceived = time.Now()
 
 	// Need to record that it hasn't been written yet, before we attempt to do
 	// anything with it.
@@ -704,7 +753,13 @@ func (c *Peer) receiveChunk(msg *pp.Message) error {
 		// because we want to handle errors synchronously and I haven't thought of a nice way to
 		// defer any concurrency to the storage and have that notify the client of errors. TODO: Do
 		// that instead.
-		return t.writeChunk(int(msg.Index), int64(msg.Begin), msg.Piece)
+		started := time.Now()
+		err := t.writeChunk(int(msg.Index), int64(msg.Begin), msg.Piece)
+		cl.chunkWriteLatency.add(time.Since(started), cl.config.ChunkWriteLatencyWeight)
+		if err == nil {
+			t.journalChunk(ppReq)
+		}
+		return err
 	}()
 
 	piece.decrementPendingWrites()
@@ -716,11 +771,12 @@ func (c *Peer) receiveChunk(msg *pp.Message) error {
 		// request update runs while we're writing the chunk that just failed. Then we never do a
 		// fresh update after pending the failed request.
 		c.updateRequests("Peer.receiveChunk error writing chunk")
-		t.onWriteChunkErr(err)
+		piece.lastErr = fmt.Sprintf("writing chunk: %v", err)
+		t.onWriteChunkErr(pieceIndex(ppReq.Index), err)
 		return nil
 	}
 
-	c.onDirtiedPiece(pieceIndex(ppReq.Index))
+	c.onDirtiedPiece(pieceIndex(ppReq.Index), int64(len(msg.Piece)))
 
 	// We need to ensure the piece is only queued once, so only the last chunk writer gets this job.
 	if t.pieceAllDirty(pieceIndex(ppReq.Index)) && piece.pendingWrites == 0 {
@@ -738,16 +794,16 @@ func (c *Peer) receiveChunk(msg *pp.Message) error {
 	return nil
 }
 
-func (c *Peer) onDirtiedPiece(piece pieceIndex) {
+func (c *Peer) onDirtiedPiece(piece pieceIndex, n int64) {
 	if c.peerTouchedPieces == nil {
 		c.peerTouchedPieces = make(map[pieceIndex]struct{})
 	}
 	c.peerTouchedPieces[piece] = struct{}{}
 	ds := &c.t.pieces[piece].dirtiers
 	if *ds == nil {
-		*ds = make(map[*Peer]struct{})
+		*ds = make(map[*Peer]int64)
 	}
-	(*ds)[c] = struct{}{}
+	(*ds)[c] += n
 }
 
 func (cn *Peer) netGoodPiecesDirtied() int64 {
@@ -786,6 +842,15 @@ func (c *Peer) deleteRequest(r RequestIndex) bool {
 	return true
 }
 
+// Returns true if a request that was awaiting cancel acknowledgement is removed.
+func (c *Peer) removeCancelled(r RequestIndex) bool {
+	if !c.requestState.Cancelled.CheckedRemove(r) {
+		return false
+	}
+	c.t.decCancelledRequest(r)
+	return true
+}
+
 func (c *Peer) deleteAllRequests(reason string) {
 	if c.requestState.Requests.IsEmpty() {
 		return
@@ -865,6 +930,11 @@ func (cn *Peer) stats() *ConnStats {
 	return &cn._stats
 }
 
+// Returns a snapshot of the connection's stats, such as to find peers sending a lot of wasted data.
+func (cn *Peer) Stats() ConnStats {
+	return cn._stats.Copy()
+}
+
 func (p *Peer) TryAsPeerConn() (*PeerConn, bool) {
 	pc, ok := p.peerImpl.(*PeerConn)
 	return pc, ok
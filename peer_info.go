@@ -13,6 +13,8 @@ type PeerInfo struct {
 	Source PeerSource
 	// Peer is known to support encryption.
 	SupportsEncryption bool
+	// Peer won't accept unencrypted connections, per a tracker's crypto_flags.
+	RequiresEncryption bool
 	peer_protocol.PexPeerFlags
 	// Whether we can ignore poor or bad behaviour from the peer.
 	Trusted bool
@@ -23,6 +25,7 @@ func (me PeerInfo) equal(other PeerInfo) bool {
 		me.Addr.String() == other.Addr.String() &&
 		me.Source == other.Source &&
 		me.SupportsEncryption == other.SupportsEncryption &&
+		me.RequiresEncryption == other.RequiresEncryption &&
 		me.PexPeerFlags == other.PexPeerFlags &&
 		me.Trusted == other.Trusted
 }
@@ -25,8 +25,10 @@ func (me *peerInfos) AppendFromPex(nas []krpc.NodeAddr, fs []peer_protocol.PexPe
 func (ret peerInfos) AppendFromTracker(ps []tracker.Peer) peerInfos {
 	for _, p := range ps {
 		_p := PeerInfo{
-			Addr:   ipPortAddr{p.IP, p.Port},
-			Source: PeerSourceTracker,
+			Addr:               ipPortAddr{p.IP, p.Port},
+			Source:             PeerSourceTracker,
+			SupportsEncryption: p.RequiresEncryption,
+			RequiresEncryption: p.RequiresEncryption,
 		}
 		copy(_p.Id[:], p.ID)
 		ret = append(ret, _p)
@@ -21,6 +21,8 @@ type (
 		YourIp CompactIp `bencode:"yourip,omitempty"`
 		Ipv4   CompactIp `bencode:"ipv4,omitempty"`
 		Ipv6   net.IP    `bencode:"ipv6,omitempty"`
+		// BEP 21. Set by partial seeds, which won't download anything further.
+		UploadOnly bool `bencode:"upload_only,omitempty"`
 	}
 
 	ExtensionName   string
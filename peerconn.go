@@ -7,7 +7,6 @@ import (
 	"errors"
 	"fmt"
 	"io"
-	"math/rand"
 	"net"
 	"net/netip"
 	"strconv"
@@ -43,6 +42,10 @@ type PeerConn struct {
 	// A string that should identify the PeerConn's net.Conn endpoints. The net.Conn could
 	// be wrapping WebRTC, uTP, or TCP etc. Used in writing the conn status for peers.
 	connString string
+	// Set if ClientConfig.PeerConnMessageTraceLength is non-zero.
+	messageTrace *messageTrace
+	// The DHT port last given in a PORT message that we queued a ping for.
+	dhtPortPinged Option[int]
 
 	// See BEP 3 etc.
 	PeerID             PeerID
@@ -69,6 +72,7 @@ type PeerConn struct {
 	PeerExtensionIDs map[pp.ExtensionName]pp.ExtensionNumber
 	PeerClientName   atomic.Value
 	uploadTimer      *time.Timer
+	uploadSlot       peerUploadSlot
 	pex              pexConnState
 
 	// The pieces the peer has claimed to have.
@@ -120,14 +124,50 @@ func (cn *PeerConn) pexStatus() string {
 	}
 }
 
-func (cn *PeerConn) peerImplStatusLines() []string {
-	return []string{
+func (cn *PeerConn) peerImplStatusLines() (ret []string) {
+	ret = []string{
 		cn.connString,
 		fmt.Sprintf("peer id: %+q", cn.PeerID),
 		fmt.Sprintf("extensions: %v", cn.PeerExtensionBytes),
 		fmt.Sprintf("ltep extensions: %v", cn.PeerExtensionIDs),
 		fmt.Sprintf("pex: %s", cn.pexStatus()),
+		fmt.Sprintf(
+			"transport: %s, %s, encryption: %s, source: %q",
+			cn.transport(), cn.direction(), cn.encryption(), cn.Discovery),
+		fmt.Sprintf("write queue: %v bytes", cn.WriteQueueBytes()),
 	}
+	for _, e := range cn.MessageTrace() {
+		ret = append(ret, "trace: "+e.String())
+	}
+	return
+}
+
+// Bytes of messages queued to be written to the peer, such as piece data we're uploading.
+func (cn *PeerConn) WriteQueueBytes() int {
+	return cn.messageWriter.queuedBytes()
+}
+
+// Returns "utp" or "tcp" for the builtin networks, and the network name otherwise.
+func (cn *PeerConn) transport() string {
+	return networkTransport(cn.Network)
+}
+
+func (cn *PeerConn) direction() string {
+	if cn.outgoing {
+		return "outgoing"
+	}
+	return "incoming"
+}
+
+// Returns "rc4" if the stream is MSE encrypted, "header" if only the handshake was obfuscated, and
+// "none" otherwise.
+func (cn *PeerConn) encryption() string {
+	if cn.cryptoMethod == mse.CryptoMethodRC4 {
+		return "rc4"
+	} else if cn.headerEncrypted {
+		return "header"
+	}
+	return "none"
 }
 
 // Returns true if the connection is over IPv6.
@@ -207,10 +247,21 @@ func (cn *PeerConn) onClose() {
 	if cn.pex.IsEnabled() {
 		cn.pex.Close()
 	}
+	if cn.t != nil {
+		cn.t.cl.onUploadSlotConnClosed(cn)
+	}
+	if !cn.choking && cn.t != nil {
+		cn.choking = true
+		cn.t.cl.onUploadSlotFreed()
+	}
+	if cn.uploadTimer != nil {
+		cn.uploadTimer.Stop()
+	}
 	cn.tickleWriter()
 	if cn.conn != nil {
 		go cn.conn.Close()
 	}
+	cn.addPeerClientImplementationStats()
 	if cb := cn.callbacks.PeerConnClosed; cb != nil {
 		cb(cn)
 	}
@@ -223,6 +274,9 @@ func (cn *PeerConn) write(msg pp.Message) bool {
 	// We don't need to track bytes here because the connection's Writer has that behaviour injected
 	// (although there's some delay between us buffering the message, and the connection writer
 	// flushing it out.).
+	if cn.messageTrace != nil {
+		cn.messageTrace.add(true, &msg)
+	}
 	notFull := cn.messageWriter.write(msg)
 	// Last I checked only Piece messages affect stats, and we don't write those.
 	cn.wroteMsg(&msg)
@@ -255,10 +309,11 @@ func (cn *PeerConn) onPeerSentCancel(r Request) {
 		torrent.Add("unexpected cancels received", 1)
 		return
 	}
+	torrent.Add("peer requests cancelled", 1)
 	if cn.fastEnabled() {
 		cn.reject(r)
 	} else {
-		delete(cn.peerRequests, r)
+		cn.deletePeerRequest(r)
 	}
 }
 
@@ -267,15 +322,36 @@ func (cn *PeerConn) choke(msg messageWriter) (more bool) {
 		return true
 	}
 	cn.choking = true
+	cn.t.cl.onUploadSlotFreed()
 	more = msg(pp.Message{
 		Type: pp.Choke,
 	})
-	if !cn.fastEnabled() {
-		cn.deleteAllPeerRequests()
+	if cn.fastEnabled() {
+		// With the fast extension, choking doesn't implicitly discard requests, so the peer expects
+		// a reject for each one we won't serve.
+		for r := range cn.peerRequests {
+			torrent.Add("peer requests rejected on choke", 1)
+			msg(r.ToMsg(pp.Reject))
+		}
 	}
+	// Any reads still pending are abandoned when they complete.
+	cn.deleteAllPeerRequests()
 	return
 }
 
+// Removes a queued peer request, and releases any data allocated for it.
+func (cn *PeerConn) deletePeerRequest(r Request) {
+	if state, ok := cn.peerRequests[r]; ok {
+		state.allocReservation.Drop()
+		delete(cn.peerRequests, r)
+	}
+}
+
+// Whether a peer request hasn't been rejected, cancelled or dropped since it was queued.
+func (cn *PeerConn) peerRequestQueued(r Request, state *peerRequestState) bool {
+	return cn.peerRequests[r] == state
+}
+
 func (cn *PeerConn) deleteAllPeerRequests() {
 	for _, state := range cn.peerRequests {
 		state.allocReservation.Drop()
@@ -288,6 +364,8 @@ func (cn *PeerConn) unchoke(msg func(pp.Message) bool) bool {
 		return true
 	}
 	cn.choking = false
+	cn.uploadSlot.unchokedAt = cn.now()
+	cn.t.cl.uploadSlots.unchoked++
 	return msg(pp.Message{
 		Type: pp.Unchoke,
 	})
@@ -508,7 +586,7 @@ func (cn *PeerConn) peerSentHaveNone() error {
 }
 
 func (c *PeerConn) requestPendingMetadata() {
-	if c.t.haveInfo() {
+	if c.t.haveInfo() || c.t.infoLookupPending {
 		return
 	}
 	if c.PeerExtensionIDs[pp.ExtensionNameMetadata] == 0 {
@@ -522,7 +600,7 @@ func (c *PeerConn) requestPendingMetadata() {
 			pending = append(pending, index)
 		}
 	}
-	rand.Shuffle(len(pending), func(i, j int) { pending[i], pending[j] = pending[j], pending[i] })
+	c.t.cl.rand.Shuffle(len(pending), func(i, j int) { pending[i], pending[j] = pending[j], pending[i] })
 	for _, i := range pending {
 		c.requestMetadataPiece(i)
 	}
@@ -543,6 +621,8 @@ func (cn *PeerConn) wroteMsg(msg *pp.Message) {
 
 func (cn *PeerConn) wroteBytes(n int64) {
 	cn.allStats(add(n, func(cs *ConnStats) *Count { return &cs.BytesWritten }))
+	now := cn.now()
+	cn.allRates(func(rm *transferRateMeters) { rm.upload.add(n, now) })
 }
 
 func (c *PeerConn) fastEnabled() bool {
@@ -555,10 +635,7 @@ func (c *PeerConn) reject(r Request) {
 	}
 	c.write(r.ToMsg(pp.Reject))
 	// It is possible to reject a request before it is added to peer requests due to being invalid.
-	if state, ok := c.peerRequests[r]; ok {
-		state.allocReservation.Drop()
-		delete(c.peerRequests, r)
-	}
+	c.deletePeerRequest(r)
 }
 
 func (c *PeerConn) maximumPeerRequestChunkLength() (_ Option[int]) {
@@ -588,7 +665,7 @@ func (c *PeerConn) onReadRequest(r Request, startFetch bool) error {
 		return nil
 	}
 	// TODO: What if they've already requested this?
-	if len(c.peerRequests) >= localClientReqq {
+	if len(c.peerRequests) >= c.t.cl.localReqq() {
 		torrent.Add("requests received while queue full", 1)
 		if c.fastEnabled() {
 			c.reject(r)
@@ -618,7 +695,7 @@ func (c *PeerConn) onReadRequest(r Request, startFetch bool) error {
 		return errors.New("chunk overflows piece")
 	}
 	if c.peerRequests == nil {
-		c.peerRequests = make(map[Request]*peerRequestState, localClientReqq)
+		c.peerRequests = make(map[Request]*peerRequestState)
 	}
 	value := &peerRequestState{
 		allocReservation: c.peerRequestDataAllocLimiter.Reserve(int64(r.Length)),
@@ -626,7 +703,7 @@ func (c *PeerConn) onReadRequest(r Request, startFetch bool) error {
 	c.peerRequests[r] = value
 	if startFetch {
 		// TODO: Limit peer request data read concurrency.
-		go c.peerRequestDataReader(r, value)
+		c.t.goBackground(func() { c.peerRequestDataReader(r, value) })
 	}
 	return nil
 }
@@ -641,9 +718,21 @@ func (c *PeerConn) peerRequestDataReader(r Request, prs *peerRequestState) {
 		c.logger.WithDefaultLevel(log.Debug).Levelf(log.ErrorLevel(err), "waiting for alloc limit reservation: %v", err)
 		return
 	}
+	// Don't go to storage for requests that were cancelled, or dropped by choking, while we waited.
+	c.locker().RLock()
+	queued := c.peerRequestQueued(r, prs)
+	c.locker().RUnlock()
+	if !queued {
+		torrent.Add("peer requests abandoned before read", 1)
+		return
+	}
 	b, err := c.readPeerRequestData(r)
 	c.locker().Lock()
 	defer c.locker().Unlock()
+	if !c.peerRequestQueued(r, prs) {
+		torrent.Add("peer requests abandoned after read", 1)
+		return
+	}
 	if err != nil {
 		c.peerRequestDataReadFailed(err, r)
 	} else {
@@ -672,6 +761,10 @@ func (c *PeerConn) peerRequestDataReadFailed(err error, r Request) {
 		return
 	}
 	i := pieceIndex(r.Index)
+	if c.t.seedMode && c.t.piece(i).numVerifies == 0 {
+		// The piece was assumed complete, so find out if it really is.
+		c.t.queuePieceCheck(i)
+	}
 	if c.t.pieceComplete(i) {
 		// There used to be more code here that just duplicated the following break. Piece
 		// completions are currently cached, so I'm not sure how helpful this update is, except to
@@ -699,8 +792,14 @@ func (c *PeerConn) peerRequestDataReadFailed(err error, r Request) {
 }
 
 func (c *PeerConn) readPeerRequestData(r Request) ([]byte, error) {
-	b := make([]byte, r.Length)
+	cache := &c.t.cl.uploadReadCache
 	p := c.t.info.Piece(int(r.Index))
+	// Pieces too large for the cache are read a request at a time, rather than reading the whole
+	// piece for each request only for it to be discarded.
+	if cache.fits(p.Length()) {
+		return c.readPeerRequestDataCached(cache, r)
+	}
+	b := make([]byte, r.Length)
 	n, err := c.t.readAt(b, p.Offset()+int64(r.Begin))
 	if n == len(b) {
 		if err == io.EOF {
@@ -714,6 +813,31 @@ func (c *PeerConn) readPeerRequestData(r Request) ([]byte, error) {
 	return b, err
 }
 
+// Reads the whole piece containing the request into the cache, so subsequent requests for the
+// piece's chunks don't touch storage.
+func (c *PeerConn) readPeerRequestDataCached(cache *uploadReadCache, r Request) ([]byte, error) {
+	key := uploadReadCacheKey{c.t, pieceIndex(r.Index)}
+	pieceData, ok := cache.get(key)
+	if !ok {
+		p := c.t.info.Piece(int(r.Index))
+		pieceData = make([]byte, p.Length())
+		n, err := c.t.readAt(pieceData, p.Offset())
+		if n != len(pieceData) {
+			if err == nil {
+				panic("expected error")
+			}
+			return nil, err
+		}
+		cache.put(key, pieceData)
+	}
+	end := int(r.Begin + r.Length)
+	if end > len(pieceData) {
+		return nil, fmt.Errorf("request %v extends beyond piece length %v", r, len(pieceData))
+	}
+	// Copy out, as the cached data is shared with other readers.
+	return append([]byte(nil), pieceData[r.Begin:end]...), nil
+}
+
 func (c *PeerConn) logProtocolBehaviour(level log.Level, format string, arg ...interface{}) {
 	c.logger.WithContextText(fmt.Sprintf(
 		"peer id %q, ext v %q", c.PeerID, c.PeerClientName.Load(),
@@ -748,6 +872,9 @@ func (c *PeerConn) mainReadLoop() (err error) {
 				err = fmt.Errorf("decoding message: %w", err)
 			}
 		}()
+		if c.messageTrace != nil && err == nil {
+			c.messageTrace.add(false, &msg)
+		}
 		// Do this before checking closed.
 		if cb := c.callbacks.ReadMessage; cb != nil && err == nil {
 			cb(c, &msg)
@@ -759,7 +886,7 @@ func (c *PeerConn) mainReadLoop() (err error) {
 			err = log.WithLevel(log.Info, err)
 			return err
 		}
-		c.lastMessageReceived = time.Now()
+		c.lastMessageReceived = c.now()
 		if msg.Keepalive {
 			receivedKeepalives.Add(1)
 			continue
@@ -857,9 +984,11 @@ func (c *PeerConn) mainReadLoop() (err error) {
 			if msg.Port != 0 {
 				pingAddr.Port = int(msg.Port)
 			}
-			cl.eachDhtServer(func(s DhtServer) {
-				go s.Ping(&pingAddr)
-			})
+			if c.dhtPortPinged.Ok && c.dhtPortPinged.Value == pingAddr.Port {
+				break
+			}
+			c.dhtPortPinged.Set(pingAddr.Port)
+			cl.queueDhtPortPing(pingAddr)
 		case pp.Suggest:
 			torrent.Add("suggests received", 1)
 			log.Fmsg("peer suggested piece %d", msg.Index).AddValues(c, msg.Index).LogLevel(log.Debug, c.t.logger)
@@ -927,7 +1056,7 @@ func (c *PeerConn) onReadExtendedMsg(id pp.ExtensionNumber, payload []byte) (err
 		if cb := c.callbacks.ReadExtendedHandshake; cb != nil {
 			cb(c, &d)
 		}
-		if d.Reqq != 0 {
+		if d.Reqq > 0 {
 			c.PeerMaxRequests = d.Reqq
 		}
 		c.PeerClientName.Store(d.V)
@@ -936,6 +1065,9 @@ func (c *PeerConn) onReadExtendedMsg(id pp.ExtensionNumber, payload []byte) (err
 		}
 		c.PeerListenPort = d.Port
 		c.PeerPrefersEncryption = d.Encryption
+		if len(d.YourIp) != 0 {
+			cl.voteExternalIp("peer "+c.remoteIp().String(), net.IP(d.YourIp))
+		}
 		for name, id := range d.M {
 			if _, ok := c.PeerExtensionIDs[name]; !ok {
 				peersSupportingExtension.Add(
@@ -1019,7 +1151,7 @@ func (c *PeerConn) uploadAllowed() bool {
 		return false
 	}
 	if c.t.seeding() {
-		return true
+		return c.haveUploadSlot()
 	}
 	if !c.peerHasWantedPieces() {
 		return false
@@ -1028,7 +1160,7 @@ func (c *PeerConn) uploadAllowed() bool {
 	if c._stats.BytesWrittenData.Int64() >= c._stats.BytesReadData.Int64()+100<<10 {
 		return false
 	}
-	return true
+	return c.haveUploadSlot()
 }
 
 func (c *PeerConn) setRetryUploadTimer(delay time.Duration) {
@@ -1091,7 +1223,7 @@ func (c *PeerConn) tickleWriter() {
 }
 
 func (c *PeerConn) sendChunk(r Request, msg func(pp.Message) bool, state *peerRequestState) (more bool) {
-	c.lastChunkSent = time.Now()
+	c.lastChunkSent = c.now()
 	state.allocReservation.Release()
 	return msg(pp.Message{
 		Type:  pp.Piece,
@@ -1303,17 +1435,28 @@ file:
 }
 
 func (pc *PeerConn) onReadHashes(msg *pp.Message) (err error) {
+	if !pc.t.haveInfo() {
+		return errors.New("received hashes before info")
+	}
 	file := pc.t.getFileByPiecesRoot(msg.PiecesRoot)
+	if file == nil {
+		return fmt.Errorf("received hashes for unknown pieces root %x", msg.PiecesRoot)
+	}
+	if msg.ProofLayers != 0 {
+		// We don't request proof layers, so this isn't a response to one of our requests.
+		return fmt.Errorf("received hashes with %v proof layers", msg.ProofLayers)
+	}
+	if int(msg.Index)+len(msg.Hashes) > file.numPieces() {
+		return fmt.Errorf(
+			"received %v hashes at index %v for file with %v pieces",
+			len(msg.Hashes), msg.Index, file.numPieces())
+	}
 	filePieceHashes := pc.receivedHashPieces[msg.PiecesRoot]
 	if filePieceHashes == nil {
 		filePieceHashes = make([][32]byte, file.numPieces())
 		generics.MakeMapIfNil(&pc.receivedHashPieces)
 		pc.receivedHashPieces[msg.PiecesRoot] = filePieceHashes
 	}
-	if msg.ProofLayers != 0 {
-		// This isn't handled yet.
-		panic(msg.ProofLayers)
-	}
 	copy(filePieceHashes[msg.Index:], msg.Hashes)
 	root := merkle.RootWithPadHash(
 		filePieceHashes,
@@ -16,7 +16,9 @@ import (
 	"github.com/stretchr/testify/require"
 	"golang.org/x/time/rate"
 
+	"github.com/anacrolix/torrent/internal/testutil"
 	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/mse"
 	pp "github.com/anacrolix/torrent/peer_protocol"
 	"github.com/anacrolix/torrent/storage"
 )
@@ -158,6 +160,8 @@ func BenchmarkConnectionMainReadLoop(b *testing.B) {
 			// The chunk must be written to storage everytime, to ensure the
 			// writeSem is unlocked.
 			t.pendAllChunkSpecs(0)
+			// Chunks for pieces that aren't wanted aren't counted as useful.
+			t._pendingPieces.Add(0)
 			g.MakeMapIfNil(&cn.validReceiveChunks)
 			eachRequestIndex(func(ri RequestIndex) {
 				cn.validReceiveChunks[ri] = 1
@@ -216,6 +220,22 @@ func TestConnPexPeerFlags(t *testing.T) {
 	}
 }
 
+func TestConnTransportAndEncryption(t *testing.T) {
+	testcases := []struct {
+		conn       *PeerConn
+		transport  string
+		encryption string
+	}{
+		{&PeerConn{Peer: Peer{Network: "tcp4"}}, "tcp", "none"},
+		{&PeerConn{Peer: Peer{Network: "udp6", cryptoMethod: mse.CryptoMethodRC4}}, "utp", "rc4"},
+		{&PeerConn{Peer: Peer{Network: "webrtc", headerEncrypted: true}}, "webrtc", "header"},
+	}
+	for i, tc := range testcases {
+		require.EqualValues(t, tc.transport, tc.conn.transport(), i)
+		require.EqualValues(t, tc.encryption, tc.conn.encryption(), i)
+	}
+}
+
 func TestConnPexEvent(t *testing.T) {
 	c := qt.New(t)
 	var (
@@ -391,6 +411,72 @@ func TestReceiveLargeRequest(t *testing.T) {
 	c.Check(pc.messageWriter.writeBuffer.Len(), qt.Equals, 17)
 }
 
+func TestPeerRequestsBeyondLocalReqqRejected(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.PeerRequestQueueLength = 2
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	pc := cl.newConnection(nil, newConnectionOpts{network: "test"})
+	tor := cl.newTorrentForTesting()
+	tor.info = &metainfo.Info{PieceLength: 1 << 20}
+	pc.setTorrent(tor)
+	tor._completedPieces.Add(0)
+	pc.PeerExtensionBytes.SetBit(pp.ExtensionBitFast, true)
+	pc.choking = false
+	pc.initMessageWriter()
+	for i := range 3 {
+		c.Check(pc.onReadRequest(newRequest(0, pp.Integer(i*defaultChunkSize), defaultChunkSize), false), qt.IsNil)
+	}
+	c.Check(pc.peerRequests, qt.HasLen, 2)
+	// Only the reject for the third request was written.
+	c.Check(pc.messageWriter.writeBuffer.Len(), qt.Equals, 17)
+}
+
+func TestChokeRejectsPeerRequests(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	pc := cl.newConnection(nil, newConnectionOpts{network: "test"})
+	tor := cl.newTorrentForTesting()
+	tor.info = &metainfo.Info{PieceLength: 1 << 20}
+	pc.setTorrent(tor)
+	tor._completedPieces.Add(0)
+	pc.PeerExtensionBytes.SetBit(pp.ExtensionBitFast, true)
+	pc.choking = false
+	pc.initMessageWriter()
+	req := newRequest(0, 0, defaultChunkSize)
+	c.Assert(pc.onReadRequest(req, false), qt.IsNil)
+	state := pc.peerRequests[req]
+	c.Assert(state, qt.IsNotNil)
+	pc.choke(pc.write)
+	c.Check(pc.peerRequests, qt.HasLen, 0)
+	// A choke followed by a reject.
+	c.Check(pc.messageWriter.writeBuffer.Len(), qt.Equals, 5+17)
+	// The read for the dropped request finishes without going to storage, which the test torrent
+	// doesn't have.
+	pc.peerRequestDataReader(req, state)
+	c.Check(state.data, qt.IsNil)
+}
+
+func TestPeerSentCancelNonFast(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	pc := cl.newConnection(nil, newConnectionOpts{network: "test"})
+	tor := cl.newTorrentForTesting()
+	tor.info = &metainfo.Info{PieceLength: 1 << 20}
+	pc.setTorrent(tor)
+	tor._completedPieces.Add(0)
+	pc.choking = false
+	pc.initMessageWriter()
+	req := newRequest(0, 0, defaultChunkSize)
+	c.Assert(pc.onReadRequest(req, false), qt.IsNil)
+	pc.onPeerSentCancel(req)
+	c.Check(pc.peerRequests, qt.HasLen, 0)
+	// Without the fast extension, cancels aren't acknowledged.
+	c.Check(pc.messageWriter.writeBuffer.Len(), qt.Equals, 0)
+}
+
 func TestChunkOverflowsPiece(t *testing.T) {
 	c := qt.New(t)
 	check := func(begin, length, limit pp.Integer, expected bool) {
@@ -402,3 +488,53 @@ func TestChunkOverflowsPiece(t *testing.T) {
 	check(2, pp.IntegerMax, pp.IntegerMax, true)
 	check(2, pp.IntegerMax-2, pp.IntegerMax, false)
 }
+
+// The IDs advertised in the extended handshake must be the ones incoming messages are dispatched
+// on, even after the builtin protocols are rearranged.
+func TestLocalLtepProtocolMapIdsAgree(t *testing.T) {
+	c := qt.New(t)
+	m := LocalLtepProtocolMap{
+		Index:      []pp.ExtensionName{pp.ExtensionNameMetadata, pp.ExtensionNamePex},
+		NumBuiltin: 2,
+	}
+	m.AddUserProtocol(pp.ExtensionNameMetadata)
+	m.AddUserProtocol("my_ext")
+	for name, id := range m.toSupportedExtensionDict() {
+		lookedUp, builtin, err := m.LookupId(id)
+		c.Assert(err, qt.IsNil)
+		c.Check(lookedUp, qt.Equals, name)
+		c.Check(builtin, qt.Equals, name == pp.ExtensionNamePex)
+	}
+}
+
+func TestCancelledRequestsCountedAcrossPeers(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt := cl.newTorrentForTesting()
+	tt.cancelledRequests = make(map[RequestIndex]int)
+	var pcs [2]PeerConn
+	for i := range pcs {
+		pcs[i].t = tt
+		pcs[i].initRequestState()
+		pcs[i].requestState.Cancelled.Add(3)
+		tt.cancelledRequests[3]++
+	}
+	c.Check(pcs[0].removeCancelled(3), qt.IsTrue)
+	c.Check(pcs[0].removeCancelled(3), qt.IsFalse)
+	c.Check(tt.cancelledRequests, qt.DeepEquals, map[RequestIndex]int{3: 1})
+	c.Check(pcs[1].removeCancelled(3), qt.IsTrue)
+	c.Check(tt.cancelledRequests, qt.HasLen, 0)
+}
+
+func TestReadHashesMalformed(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt := cl.newTorrent(testutil.GreetingMetaInfo().HashInfoBytes(), badStorage{})
+	pc := PeerConn{Peer: Peer{t: tt}}
+	pc.initRequestState()
+	msg := pp.Message{Type: pp.Hashes, Hashes: make([][32]byte, 2)}
+	c.Check(pc.onReadHashes(&msg), qt.IsNotNil)
+	c.Assert(tt.setInfoBytesLocked(testutil.GreetingMetaInfo().InfoBytes), qt.IsNil)
+	// The greeting torrent is v1 only, so no pieces root matches.
+	c.Check(pc.onReadHashes(&msg), qt.IsNotNil)
+}
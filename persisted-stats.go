@@ -0,0 +1,156 @@
+package torrent
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/types/infohash"
+)
+
+// Transfer totals for a torrent that are kept across sessions by a TorrentStatsStore, so that share
+// ratios survive restarts.
+type PersistedTorrentStats struct {
+	// Piece data received from and sent to peers, as in ConnStats.
+	BytesReadData    int64
+	BytesWrittenData int64
+	// When the torrent was first seen to be complete. Zero if it hasn't been.
+	Completed time.Time
+}
+
+// Loads and saves PersistedTorrentStats by the torrent's canonical short infohash. Set
+// ClientConfig.TorrentStatsStore to use one.
+type TorrentStatsStore interface {
+	// Returns the zero value if nothing was stored.
+	Get(infohash.T) (PersistedTorrentStats, error)
+	Set(infohash.T, PersistedTorrentStats) error
+}
+
+type fileTorrentStatsStore struct {
+	dir string
+}
+
+// Returns a TorrentStatsStore that keeps a JSON file per torrent in dir.
+func NewFileTorrentStatsStore(dir string) TorrentStatsStore {
+	return fileTorrentStatsStore{dir}
+}
+
+func (me fileTorrentStatsStore) path(ih infohash.T) string {
+	return filepath.Join(me.dir, ih.HexString()+".stats.json")
+}
+
+func (me fileTorrentStatsStore) Get(ih infohash.T) (ret PersistedTorrentStats, err error) {
+	b, err := os.ReadFile(me.path(ih))
+	if errors.Is(err, fs.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(b, &ret)
+	return
+}
+
+func (me fileTorrentStatsStore) Set(ih infohash.T, stats PersistedTorrentStats) error {
+	b, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(me.dir, 0o750)
+	if err != nil {
+		return err
+	}
+	// Write to a temporary file and rename it, so an interrupted write doesn't lose the totals.
+	f, err := os.CreateTemp(me.dir, ".stats-*")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(b)
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), me.path(ih))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Loads the persisted stats without the Client lock, so a slow store doesn't stall the Client. The
+// Client lock must be held.
+func (t *Torrent) loadPersistedStats() {
+	store := t.cl.config.TorrentStatsStore
+	if store == nil {
+		return
+	}
+	loaded := make(chan struct{})
+	t.persistedStatsLoaded = loaded
+	ih := *t.canonicalShortInfohash()
+	go func() {
+		defer close(loaded)
+		stats, err := store.Get(ih)
+		t.cl.lock()
+		defer t.cl.unlock()
+		if err != nil {
+			t.logger.WithDefaultLevel(log.Warning).Printf(
+				"error loading persisted stats, they won't be saved: %v", err)
+			t.persistedStatsLoadFailed = true
+			return
+		}
+		t.persistedStats.BytesReadData += stats.BytesReadData
+		t.persistedStats.BytesWrittenData += stats.BytesWrittenData
+		// The torrent may have completed while loading, but it was complete earlier.
+		if !stats.Completed.IsZero() {
+			t.persistedStats.Completed = stats.Completed
+		}
+	}()
+}
+
+// Returns the persisted totals with this session's transfers added.
+func (t *Torrent) allTimeStats() (ret PersistedTorrentStats) {
+	ret = t.persistedStats
+	ret.BytesReadData += t.stats.BytesReadData.Int64()
+	ret.BytesWrittenData += t.stats.BytesWrittenData.Int64()
+	return
+}
+
+// Saves the stats in a goroutine, without the Client lock, once they've been loaded. Nothing is
+// saved if loading failed. Returns the goroutine's completion, for waiting on when closing. The
+// Client lock must be held.
+func (t *Torrent) savePersistedStats() (done <-chan struct{}) {
+	store := t.cl.config.TorrentStatsStore
+	if store == nil {
+		return nil
+	}
+	loaded := t.persistedStatsLoaded
+	ih := *t.canonicalShortInfohash()
+	saved := make(chan struct{})
+	go func() {
+		defer close(saved)
+		<-loaded
+		// Saves are serialized, so the latest snapshot is stored last.
+		t.persistedStatsSaveMu.Lock()
+		defer t.persistedStatsSaveMu.Unlock()
+		t.cl.rLock()
+		stats := t.allTimeStats()
+		failed := t.persistedStatsLoadFailed
+		t.cl.rUnlock()
+		if failed {
+			return
+		}
+		err := store.Set(ih, stats)
+		if err != nil {
+			t.logger.WithDefaultLevel(log.Warning).Printf("error saving persisted stats: %v", err)
+		}
+	}()
+	return saved
+}
@@ -0,0 +1,74 @@
+package torrent
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/types/infohash"
+)
+
+func TestFileTorrentStatsStore(t *testing.T) {
+	c := qt.New(t)
+	store := NewFileTorrentStatsStore(t.TempDir())
+	ih := infohash.HashBytes([]byte("hello"))
+	stats, err := store.Get(ih)
+	c.Assert(err, qt.IsNil)
+	c.Check(stats, qt.Equals, PersistedTorrentStats{})
+	stats = PersistedTorrentStats{
+		BytesReadData:    1,
+		BytesWrittenData: 2,
+		Completed:        time.Unix(1700000000, 0).UTC(),
+	}
+	c.Assert(store.Set(ih, stats), qt.IsNil)
+	loaded, err := store.Get(ih)
+	c.Assert(err, qt.IsNil)
+	c.Check(loaded, qt.DeepEquals, stats)
+}
+
+func TestTorrentStatsPersistAcrossClients(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.TorrentStatsStore = NewFileTorrentStatsStore(t.TempDir())
+	ih := infohash.HashBytes([]byte("hello"))
+	c.Assert(cfg.TorrentStatsStore.Set(ih, PersistedTorrentStats{BytesWrittenData: 42}), qt.IsNil)
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	tt, _ := cl.AddTorrentInfoHash(ih)
+	<-tt.persistedStatsLoaded
+	tt.stats.BytesWrittenData.Add(8)
+	c.Check(tt.Stats().AllTime.BytesWrittenData, qt.Equals, int64(50))
+	cl.Close()
+	stats, err := cfg.TorrentStatsStore.Get(ih)
+	c.Assert(err, qt.IsNil)
+	c.Check(stats.BytesWrittenData, qt.Equals, int64(50))
+}
+
+type failingTorrentStatsStore struct {
+	sets int
+}
+
+func (me *failingTorrentStatsStore) Get(infohash.T) (PersistedTorrentStats, error) {
+	return PersistedTorrentStats{}, errors.New("unavailable")
+}
+
+func (me *failingTorrentStatsStore) Set(infohash.T, PersistedTorrentStats) error {
+	me.sets++
+	return nil
+}
+
+func TestTorrentStatsNotSavedAfterLoadFails(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	store := &failingTorrentStatsStore{}
+	cfg.TorrentStatsStore = store
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	tt, _ := cl.AddTorrentInfoHash(infohash.HashBytes([]byte("hello")))
+	<-tt.persistedStatsLoaded
+	tt.stats.BytesWrittenData.Add(8)
+	cl.Close()
+	c.Check(store.sets, qt.Equals, 0)
+}
@@ -1,8 +1,10 @@
 package torrent
 
 import (
+	"fmt"
 	"net"
 	"net/netip"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,6 +25,31 @@ const (
 	pexMaxDelta  = 50 // upper bound on added+added6 and dropped+dropped6 in a single PEX message
 )
 
+// Names the flags that are set. PexPeerFlags doesn't have a String method since it's embedded in
+// PeerInfo.
+func pexPeerFlagsString(f pp.PexPeerFlags) string {
+	var names []string
+	for _, n := range []struct {
+		f    pp.PexPeerFlags
+		name string
+	}{
+		{pp.PexPrefersEncryption, "encryption"},
+		{pp.PexSeedUploadOnly, "seed"},
+		{pp.PexSupportsUtp, "utp"},
+		{pp.PexHolepunchSupport, "holepunch"},
+		{pp.PexOutgoingConn, "outgoing"},
+	} {
+		if f.Get(n.f) {
+			names = append(names, n.name)
+			f &^= n.f
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("%#02x", byte(f)))
+	}
+	return strings.Join(names, ",")
+}
+
 // represents a single connection (t=pexAdd) or disconnection (t=pexDrop) event
 type pexEvent struct {
 	t    pexEventType
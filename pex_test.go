@@ -325,3 +325,37 @@ func BenchmarkPexInitial50(b *testing.B)  { benchmarkPexInitialN(b, 50) }
 func BenchmarkPexInitial100(b *testing.B) { benchmarkPexInitialN(b, 100) }
 func BenchmarkPexInitial200(b *testing.B) { benchmarkPexInitialN(b, 200) }
 func BenchmarkPexInitial400(b *testing.B) { benchmarkPexInitialN(b, 400) }
+
+func TestPexAddedFlagsKeptOnPeerInfo(t *testing.T) {
+	var peers peerInfos
+	peers.AppendFromPex(
+		[]krpc.NodeAddr{{IP: net.IPv4(1, 2, 3, 4), Port: 1}, {IP: net.IPv4(1, 2, 3, 5), Port: 2}},
+		[]pp.PexPeerFlags{pp.PexPrefersEncryption | pp.PexSeedUploadOnly | pp.PexSupportsUtp},
+	)
+	require.Len(t, peers, 2)
+	assert.True(t, peers[0].SupportsEncryption)
+	assert.True(t, peers[0].Get(pp.PexSeedUploadOnly))
+	assert.True(t, peers[0].Get(pp.PexSupportsUtp))
+	assert.Equal(t, "encryption,seed,utp", pexPeerFlagsString(peers[0].PexPeerFlags))
+	// Missing flags are treated as none set.
+	assert.EqualValues(t, 0, peers[1].PexPeerFlags)
+	assert.False(t, peers[1].SupportsEncryption)
+	assert.Equal(t, "holepunch,0x40", pexPeerFlagsString(pp.PexHolepunchSupport|0x40))
+}
+
+func TestPexPeerSkipsUtpUnlessAdvertised(t *testing.T) {
+	cl, err := NewClient(TestingConfig(t))
+	require.NoError(t, err)
+	defer cl.Close()
+	var p PeerInfo
+	p.FromPex(krpc.NodeAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1}, 0)
+	assert.True(t, cl.skipUtpDial(p))
+	p.PexPeerFlags = pp.PexSupportsUtp
+	assert.False(t, cl.skipUtpDial(p))
+	// Peers from other sources don't advertise transports.
+	assert.False(t, cl.skipUtpDial(PeerInfo{Addr: p.Addr, Source: PeerSourceTracker}))
+	// uTP is still used if it's the only way to reach the peer.
+	p.PexPeerFlags = 0
+	cl.SetTransportEnabled("tcp", false)
+	assert.False(t, cl.skipUtpDial(p))
+}
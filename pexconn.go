@@ -21,7 +21,7 @@ type pexConnState struct {
 	enabled bool
 	xid     pp.ExtensionNumber
 	last    *pexEvent
-	timer   *time.Timer
+	timer   ClockTimer
 	gate    chan struct{}
 	readyfn func()
 	torrent *Torrent
@@ -50,7 +50,7 @@ func (s *pexConnState) Init(c *PeerConn) {
 	s.dbg = c.logger.WithDefaultLevel(log.Debug)
 	s.readyfn = c.tickleWriter
 	s.gate = make(chan struct{}, 1)
-	s.timer = time.AfterFunc(0, func() {
+	s.timer = c.t.cl.clock().AfterFunc(0, func() {
 		s.gate <- struct{}{}
 		s.readyfn() // wake up the writer
 	})
@@ -133,17 +133,18 @@ func (s *pexConnState) Recv(payload []byte) error {
 	torrent.Add("pex added6 peers received", int64(len(rx.Added6)))
 
 	// "Clients must batch updates to send no more than 1 PEX message per minute."
-	timeSinceLastRecv := time.Since(s.lastRecv)
+	now := s.torrent.cl.clock().Now()
+	timeSinceLastRecv := now.Sub(s.lastRecv)
 	if timeSinceLastRecv < 45*time.Second {
 		return fmt.Errorf("last received only %v ago", timeSinceLastRecv)
 	}
-	s.lastRecv = time.Now()
+	s.lastRecv = now
 	s.updateRemoteLiveConns(rx)
 
 	var peers peerInfos
 	peers.AppendFromPex(rx.Added6, rx.Added6Flags)
 	peers.AppendFromPex(rx.Added, rx.AddedFlags)
-	if time.Now().Before(s.torrent.pex.rest) {
+	if now.Before(s.torrent.pex.rest) {
 		s.dbg.Printf("in cooldown period, incoming PEX discarded")
 		return nil
 	}
@@ -151,7 +152,7 @@ func (s *pexConnState) Recv(payload []byte) error {
 	s.dbg.Printf("got %v peers over pex, added %v", len(peers), added)
 
 	if len(peers) > 0 {
-		s.torrent.pex.rest = time.Now().Add(pexInterval)
+		s.torrent.pex.rest = now.Add(pexInterval)
 	}
 
 	// one day we may also want to:
@@ -0,0 +1,32 @@
+package torrent
+
+// Describes how available the torrent's pieces are from connected peers, to judge whether it can
+// be completed from the current swarm.
+type PieceAvailabilityStats struct {
+	// The number of complete copies of the torrent across connected peers, as the least available
+	// piece's availability, plus the fraction of pieces that are more available than that. A value
+	// under 1 means some pieces can't currently be obtained.
+	DistributedCopies float64
+	// The number of pieces by availability: Histogram[n] is how many pieces n peers have.
+	Histogram []int
+}
+
+func (t *Torrent) pieceAvailabilityStats() (ret PieceAvailabilityStats) {
+	if !t.haveInfo() || t.numPieces() == 0 {
+		return
+	}
+	minAvail := -1
+	for i := range t.pieces {
+		avail := t.pieces[i].availability()
+		for len(ret.Histogram) <= avail {
+			ret.Histogram = append(ret.Histogram, 0)
+		}
+		ret.Histogram[avail]++
+		if minAvail == -1 || avail < minAvail {
+			minAvail = avail
+		}
+	}
+	moreAvailable := t.numPieces() - ret.Histogram[minAvail]
+	ret.DistributedCopies = float64(minAvail) + float64(moreAvailable)/float64(t.numPieces())
+	return
+}
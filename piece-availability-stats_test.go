@@ -0,0 +1,31 @@
+package torrent
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func TestPieceAvailabilityStats(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt := cl.newTorrentForTesting()
+	c.Check(tt.Stats().Availability, qt.DeepEquals, PieceAvailabilityStats{})
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	cl.lock()
+	defer cl.unlock()
+	c.Check(tt.pieceAvailabilityStats(), qt.DeepEquals, PieceAvailabilityStats{
+		Histogram: []int{3},
+	})
+	for i, avail := range []int{2, 1, 1} {
+		tt.pieces[i].relativeAvailability = avail
+	}
+	c.Check(tt.pieceAvailabilityStats().Histogram, qt.DeepEquals, []int{0, 2, 1})
+	c.Check(tt.pieceAvailabilityStats().DistributedCopies, qt.Equals, 1+1.0/3)
+	for i := range tt.pieces {
+		tt.pieces[i].relativeAvailability = 0
+	}
+}
@@ -0,0 +1,37 @@
+package torrent
+
+import (
+	"crypto/sha256"
+	"hash"
+)
+
+// Creates the hashes used to verify pieces. Set ClientConfig.PieceHashImpl to use optimized SHA
+// implementations, or to offload hashing elsewhere, such as to worker processes. Piece data is
+// written to the returned hashes from the piece hasher goroutines, so implementations must allow
+// concurrent use of distinct hashes. Storage that implements storage.SelfHashing for v1 pieces
+// bypasses this.
+type PieceHashImpl interface {
+	// Returns a SHA-1 hash for v1 pieces.
+	NewV1() hash.Hash
+	// Returns a SHA-256 hash, used for each 16 KiB block of v2 pieces. The blocks are combined into
+	// the piece's merkle root by the Client.
+	NewV2Block() hash.Hash
+}
+
+type defaultPieceHashImpl struct{}
+
+func (defaultPieceHashImpl) NewV1() hash.Hash {
+	return pieceHash.New()
+}
+
+func (defaultPieceHashImpl) NewV2Block() hash.Hash {
+	return sha256.New()
+}
+
+// The Client may be nil, for Torrents that were created without one.
+func (cl *Client) pieceHashImpl() PieceHashImpl {
+	if cl != nil && cl.config.PieceHashImpl != nil {
+		return cl.config.PieceHashImpl
+	}
+	return defaultPieceHashImpl{}
+}
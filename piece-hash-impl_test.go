@@ -0,0 +1,42 @@
+package torrent
+
+import (
+	"crypto/sha1"
+	"hash"
+	"os"
+	"sync/atomic"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+type countingPieceHashImpl struct {
+	defaultPieceHashImpl
+	v1 atomic.Int64
+}
+
+func (me *countingPieceHashImpl) NewV1() hash.Hash {
+	me.v1.Add(1)
+	return sha1.New()
+}
+
+func TestPieceHashImpl(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	var impl countingPieceHashImpl
+	cfg := TestingConfig(t)
+	cfg.DataDir = dir
+	cfg.PieceHashImpl = &impl
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	tt.VerifyData()
+	c.Check(tt.BytesMissing(), qt.Equals, int64(0))
+	// Pieces might also have been checked when the torrent was added.
+	c.Check(impl.v1.Load() >= int64(tt.NumPieces()), qt.IsTrue)
+}
@@ -0,0 +1,40 @@
+package torrent
+
+import (
+	"testing"
+
+	"github.com/anacrolix/missinggo/v2/bitmap"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestPieceHashQueuePrefersReaderPieces(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt := cl.newTorrentForTesting()
+	c.Assert(tt.setInfo(&metainfo.Info{Pieces: make([]byte, metainfo.HashSize*6)}), qt.IsNil)
+	pick := func() pieceIndex {
+		i, ok := tt.getPieceToHash()
+		c.Assert(ok, qt.IsTrue)
+		return i
+	}
+	for _, i := range []bitmap.BitIndex{1, 3, 5} {
+		tt.piecesQueuedForHash.Add(i)
+	}
+	c.Check(pick(), qt.Equals, 1)
+	tt._readerReadaheadPieces.Add(3)
+	c.Check(pick(), qt.Equals, 3)
+	// Pieces a reader is waiting on come before readahead.
+	tt._readerNowPieces.Add(5)
+	c.Check(pick(), qt.Equals, 5)
+	// Unless they're already being hashed.
+	tt.piece(5).hashing = true
+	c.Check(pick(), qt.Equals, 3)
+	// Reader pieces that aren't queued are skipped.
+	tt._readerNowPieces.Add(2)
+	c.Check(pick(), qt.Equals, 3)
+	tt.piecesQueuedForHash.Clear()
+	_, ok := tt.getPieceToHash()
+	c.Check(ok, qt.IsFalse)
+}
@@ -0,0 +1,44 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/anacrolix/log"
+)
+
+// Returned, wrapped, by reads needing a piece that has failed ClientConfig.MaxPieceFailures times
+// in a row, rather than waiting indefinitely for it.
+var ErrPieceUnavailable = errors.New("piece unavailable")
+
+type PieceUnavailableEvent struct {
+	Torrent  *Torrent
+	Piece    int
+	Failures int
+}
+
+// Counts a failed hash check of a piece. The Client lock must be held.
+func (t *Torrent) onPieceFailure(piece pieceIndex) {
+	p := t.piece(piece)
+	p.consecutiveFailures++
+	max := t.cl.config.MaxPieceFailures
+	if max == 0 || p.consecutiveFailures != max {
+		return
+	}
+	t.logger.Levelf(log.Warning, "piece %d unavailable after %d consecutive failures", piece, max)
+	// Wake readers waiting on the piece so they can give up.
+	p.readerCond.Broadcast()
+	for _, f := range t.callbacks().PieceUnavailable {
+		f(PieceUnavailableEvent{t, piece, p.consecutiveFailures})
+	}
+}
+
+// Returns an error wrapping ErrPieceUnavailable if reads needing the piece should give up.
+func (t *Torrent) pieceUnavailableErr(piece pieceIndex) error {
+	max := t.cl.config.MaxPieceFailures
+	n := t.piece(piece).consecutiveFailures
+	if max == 0 || n < max {
+		return nil
+	}
+	return fmt.Errorf("piece %d failed %d times in a row: %w", piece, n, ErrPieceUnavailable)
+}
@@ -0,0 +1,47 @@
+package torrent
+
+import (
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/storage"
+)
+
+func TestReadGivesUpOnPieceFailingHash(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.MaxPieceFailures = 2
+	var events []PieceUnavailableEvent
+	cfg.Callbacks.PieceUnavailable = append(cfg.Callbacks.PieceUnavailable, func(ev PieceUnavailableEvent) {
+		events = append(events, ev)
+	})
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	mi := testutil.GreetingMetaInfo()
+	tt, _ := cl.AddTorrentOpt(AddTorrentOpts{
+		InfoHash:  mi.HashInfoBytes(),
+		InfoBytes: mi.InfoBytes,
+		Storage:   storage.NewFile(t.TempDir()),
+	})
+	r := tt.NewReader()
+	defer r.Close()
+	readErr := make(chan error)
+	go func() {
+		_, err := r.Read(make([]byte, 1))
+		readErr <- err
+	}()
+	cl.lock()
+	tt.piece(0).storageCompletionOk = true
+	for range cfg.MaxPieceFailures {
+		tt.pieceHashed(0, false, nil)
+	}
+	cl.unlock()
+	err = <-readErr
+	c.Check(errors.Is(err, ErrPieceUnavailable), qt.IsTrue)
+	c.Check(events, qt.HasLen, 1)
+	c.Check(events[0].Piece, qt.Equals, 0)
+}
@@ -29,9 +29,15 @@ type Piece struct {
 	hashing             bool
 	marking             bool
 	storageCompletionOk bool
+	// See PieceState.LastError.
+	lastErr string
+	// Failed hash checks since the piece last passed. See ClientConfig.MaxPieceFailures.
+	consecutiveFailures int
 
 	publicPieceState PieceState
 	priority         piecePriority
+	// Set by Torrent.SetPiecePriority, and takes precedence over priority and file priorities.
+	pinnedPriority g.Option[piecePriority]
 	// Availability adjustment for this piece relative to len(Torrent.connsWithAllPieces). This is
 	// incremented for any piece a peer has when a peer has a piece, Torrent.haveInfo is true, and
 	// the Peer isn't recorded in Torrent.connsWithAllPieces.
@@ -42,9 +48,9 @@ type Piece struct {
 	pendingWrites      int
 	noPendingWrites    sync.Cond
 
-	// Connections that have written data to this piece since its last check.
-	// This can include connections that have closed.
-	dirtiers map[*Peer]struct{}
+	// Connections that have written data to this piece since its last check, and how many bytes
+	// each wrote. This can include connections that have closed.
+	dirtiers map[*Peer]int64
 }
 
 func (p *Piece) String() string {
@@ -213,8 +219,21 @@ func (p *Piece) SetPriority(prio piecePriority) {
 }
 
 func (p *Piece) purePriority() (ret piecePriority) {
-	for _, f := range p.files {
-		ret.Raise(f.prio)
+	if lw := p.t.liveWindow; lw.Ok {
+		ret = lw.Value.piecePriority(p.index)
+		if p.pinnedPriority.Ok {
+			ret.Raise(p.pinnedPriority.Value)
+		}
+		return
+	}
+	if p.pinnedPriority.Ok {
+		// Readers can still raise it below, or they could block on a piece that isn't wanted.
+		ret = p.pinnedPriority.Value
+	} else {
+		for _, f := range p.files {
+			ret.Raise(f.prio)
+		}
+		ret.Raise(p.priority)
 	}
 	if p.t.readerNowPieces().Contains(bitmap.BitIndex(p.index)) {
 		ret.Raise(PiecePriorityNow)
@@ -225,7 +244,6 @@ func (p *Piece) purePriority() (ret piecePriority) {
 	if p.t.readerReadaheadPieces().Contains(bitmap.BitIndex(p.index)) {
 		ret.Raise(PiecePriorityReadahead)
 	}
-	ret.Raise(p.priority)
 	return
 }
 
@@ -21,6 +21,10 @@ type PieceState struct {
 
 	// The v2 hash for the piece layer is missing.
 	MissingPieceLayerHash bool
+
+	// The most recent error writing, hashing or marking the piece, if it hasn't since passed a
+	// hash check. Empty if there was none.
+	LastError string
 }
 
 // Represents a series of consecutive pieces with the same state.
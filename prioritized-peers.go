@@ -7,11 +7,23 @@ import (
 	"github.com/google/btree"
 )
 
-// Peers are stored with their priority at insertion. Their priority may
+// Peers are stored with their priority and score at insertion. Their priority may
 // change if our apparent IP changes, we don't currently handle that.
 type prioritizedPeersItem struct {
-	prio peerPriority
-	p    PeerInfo
+	score peerScore
+	prio  peerPriority
+	p     PeerInfo
+}
+
+// Peers are identified by address and trust, so a peer learned from another source replaces the
+// existing one even if its score differs.
+type prioritizedPeersKey struct {
+	addr    string
+	trusted bool
+}
+
+func (me prioritizedPeersItem) key() prioritizedPeersKey {
+	return prioritizedPeersKey{me.p.Addr.String(), me.p.Trusted}
 }
 
 var hashSeed = maphash.MakeSeed()
@@ -26,7 +38,8 @@ func (me prioritizedPeersItem) addrHash() int64 {
 func (me prioritizedPeersItem) Less(than btree.Item) bool {
 	other := than.(prioritizedPeersItem)
 	return multiless.New().Bool(
-		me.p.Trusted, other.p.Trusted).Uint32(
+		me.p.Trusted, other.p.Trusted).Int64(
+		int64(me.score), int64(other.score)).Uint32(
 		me.prio, other.prio).Int64(
 		me.addrHash(), other.addrHash(),
 	).Less()
@@ -35,6 +48,37 @@ func (me prioritizedPeersItem) Less(than btree.Item) bool {
 type prioritizedPeers struct {
 	om      *btree.BTree
 	getPrio func(PeerInfo) peerPriority
+	// Optional. Peers have a zero score if it's not set.
+	getScore func(PeerInfo) peerScore
+	byKey    map[prioritizedPeersKey]prioritizedPeersItem
+}
+
+func (me *prioritizedPeers) newItem(p PeerInfo) (ret prioritizedPeersItem) {
+	ret.prio = me.getPrio(p)
+	if me.getScore != nil {
+		ret.score = me.getScore(p)
+	}
+	ret.p = p
+	return
+}
+
+// Inserts the item, replacing any with the same key.
+func (me *prioritizedPeers) replaceOrInsert(item prioritizedPeersItem) (replaced prioritizedPeersItem, ok bool) {
+	replaced, ok = me.byKey[item.key()]
+	if ok {
+		me.om.Delete(replaced)
+	}
+	if me.byKey == nil {
+		me.byKey = make(map[prioritizedPeersKey]prioritizedPeersItem)
+	}
+	me.byKey[item.key()] = item
+	me.om.ReplaceOrInsert(item)
+	return
+}
+
+func (me *prioritizedPeers) Delete(item prioritizedPeersItem) {
+	me.om.Delete(item)
+	delete(me.byKey, item.key())
 }
 
 func (me *prioritizedPeers) Each(f func(PeerInfo)) {
@@ -53,17 +97,14 @@ func (me *prioritizedPeers) Len() int {
 
 // Returns true if a peer is replaced.
 func (me *prioritizedPeers) Add(p PeerInfo) bool {
-	return me.om.ReplaceOrInsert(prioritizedPeersItem{me.getPrio(p), p}) != nil
+	_, ok := me.replaceOrInsert(me.newItem(p))
+	return ok
 }
 
 // Returns true if a peer is replaced.
 func (me *prioritizedPeers) AddReturningReplacedPeer(p PeerInfo) (ret PeerInfo, ok bool) {
-	item := me.om.ReplaceOrInsert(prioritizedPeersItem{me.getPrio(p), p})
-	if item == nil {
-		return
-	}
-	ret = item.(prioritizedPeersItem).p
-	ok = true
+	item, ok := me.replaceOrInsert(me.newItem(p))
+	ret = item.p
 	return
 }
 
@@ -73,10 +114,13 @@ func (me *prioritizedPeers) DeleteMin() (ret prioritizedPeersItem, ok bool) {
 		return
 	}
 	ret = i.(prioritizedPeersItem)
+	delete(me.byKey, ret.key())
 	ok = true
 	return
 }
 
 func (me *prioritizedPeers) PopMax() PeerInfo {
-	return me.om.DeleteMax().(prioritizedPeersItem).p
+	item := me.om.DeleteMax().(prioritizedPeersItem)
+	delete(me.byKey, item.key())
+	return item.p
 }
@@ -191,11 +191,17 @@ func (r *reader) waitAvailable(ctx context.Context, pos, wanted int64, wait bool
 	for {
 		r.t.cl.rLock()
 		avail = r.available(pos, wanted)
-		readerCond := t.piece(int((r.offset + pos) / t.info.PieceLength)).readerCond.Signaled()
+		piece := pieceIndex((r.offset + pos) / t.info.PieceLength)
+		readerCond := t.piece(piece).readerCond.Signaled()
+		unavailableErr := t.pieceUnavailableErr(piece)
 		r.t.cl.rUnlock()
 		if avail != 0 {
 			return
 		}
+		if wait && unavailableErr != nil {
+			err = unavailableErr
+			return
+		}
 		var dontWait <-chan struct{}
 		if !wait || wanted == 0 {
 			dontWait = closedChan
@@ -21,7 +21,7 @@ type (
 
 func pieceOrderLess(i, j *pieceRequestOrderItem) multiless.Computation {
 	return multiless.New().Int(
-		int(j.state.Priority), int(i.state.Priority),
+		j.state.Priority.Rank(), i.state.Priority.Rank(),
 		// TODO: Should we match on complete here to prevent churn when availability changes?
 	).Bool(
 		j.state.Partial, i.state.Partial,
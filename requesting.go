@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/gob"
 	"fmt"
+	"math"
 	"reflect"
 	"runtime/pprof"
 	"time"
@@ -25,6 +26,12 @@ type (
 )
 
 func (t *Torrent) requestStrategyPieceOrderState(i int) requestStrategy.PieceRequestOrderState {
+	if t.liveWindow.Ok {
+		// Leave only the index to order pieces within the window.
+		return requestStrategy.PieceRequestOrderState{
+			Priority: t.piece(i).purePriority(),
+		}
+	}
 	return requestStrategy.PieceRequestOrderState{
 		Priority:     t.piece(i).purePriority(),
 		Partial:      t.piecePartiallyDownloaded(i),
@@ -106,8 +113,8 @@ func (p *desiredPeerRequests) lessByValue(leftRequest, rightRequest RequestIndex
 		leftPriority := leftPiece.Priority
 		rightPriority := rightPiece.Priority
 		ml = ml.Int(
-			-int(leftPriority),
-			-int(rightPriority),
+			-leftPriority.Rank(),
+			-rightPriority.Rank(),
 		)
 		if !ml.Ok() {
 			if leftPriority != rightPriority {
@@ -161,6 +168,41 @@ func (p *desiredPeerRequests) lessByValue(leftRequest, rightRequest RequestIndex
 	return ml.Less()
 }
 
+// Whether any of the requests aren't outstanding with a peer.
+func (p *desiredPeerRequests) anyUnrequested() bool {
+	for _, r := range p.requestIndexes {
+		if p.peer.t.requestingPeer(r) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *desiredPeerRequests) requestPriority(r RequestIndex) piecePriority {
+	return p.pieceStates[p.peer.t.pieceIndexOfRequestIndex(r)].Priority
+}
+
+// Returns the number of the peer's request slots to reserve for pieces at normal priority or below,
+// per ClientConfig.BackgroundRequestFraction. It's zero if there are no such requests to make, so
+// the higher priority requests can use the entire pipeline.
+func (p *Peer) backgroundRequestSlots(desired desiredPeerRequests) maxRequests {
+	fraction := p.t.cl.config.BackgroundRequestFraction
+	if fraction <= 0 {
+		return 0
+	}
+	haveBackground := false
+	for _, r := range desired.requestIndexes {
+		if desired.requestPriority(r).Rank() <= PiecePriorityNormal.Rank() {
+			haveBackground = true
+			break
+		}
+	}
+	if !haveBackground {
+		return 0
+	}
+	return maxRequests(math.Ceil(fraction * float64(p.nominalMaxRequests())))
+}
+
 type desiredRequestState struct {
 	Requests   desiredPeerRequests
 	Interested bool
@@ -183,6 +225,9 @@ func (p *Peer) getDesiredRequestState() (desired desiredRequestState) {
 		pieceStates:    t.requestPieceStates,
 		requestIndexes: t.requestIndexes,
 	}
+	// Chunks that were cancelled with other peers that may still send them. Requesting them again
+	// risks receiving them twice, so they're left until we run out of alternatives.
+	var awaitingCancelElsewhere []RequestIndex
 	// Caller-provided allocation for roaring bitmap iteration.
 	var it typedRoaring.Iterator[RequestIndex]
 	requestStrategy.GetRequestablePieces(
@@ -217,10 +262,18 @@ func (p *Peer) getDesiredRequestState() (desired desiredRequestState) {
 					// Can't re-request while awaiting acknowledgement.
 					return
 				}
+				if t.cancelledRequests[r] != 0 && !p.requestState.Requests.Contains(r) {
+					awaitingCancelElsewhere = append(awaitingCancelElsewhere, r)
+					return
+				}
 				requestHeap.requestIndexes = append(requestHeap.requestIndexes, r)
 			})
 		},
 	)
+	if !requestHeap.anyUnrequested() {
+		// Endgame, as far as this peer is concerned.
+		requestHeap.requestIndexes = append(requestHeap.requestIndexes, awaitingCancelElsewhere...)
+	}
 	t.assertPendingRequests()
 	desired.Requests = requestHeap
 	return
@@ -234,7 +287,7 @@ func (p *Peer) maybeUpdateActualRequestState() {
 		return
 	}
 	if p.needRequestUpdate == peerUpdateRequestsTimerReason {
-		since := time.Since(p.lastRequestUpdate)
+		since := p.now().Sub(p.lastRequestUpdate)
 		if since < updateRequestsTimerDuration {
 			panic(since)
 		}
@@ -296,18 +349,11 @@ func (p *Peer) applyRequestState(next desiredRequestState) {
 
 	t := p.t
 	originalRequestCount := current.Requests.GetCardinality()
-	for {
-		if requestHeap.Len() == 0 {
-			break
-		}
-		numPending := maxRequests(current.Requests.GetCardinality() + current.Cancelled.GetCardinality())
-		if numPending >= p.nominalMaxRequests() {
-			break
-		}
-		req := heap.Pop(requestHeap)
-		if cap(next.Requests.requestIndexes) != cap(orig) {
-			panic("changed")
-		}
+	numPending := func() maxRequests {
+		return maxRequests(current.Requests.GetCardinality() + current.Cancelled.GetCardinality())
+	}
+	// Returns false if the pipeline is full.
+	apply := func(req RequestIndex) bool {
 		existing := t.requestingPeer(req)
 		if existing != nil && existing != p {
 			// Don't steal from the poor.
@@ -315,14 +361,43 @@ func (p *Peer) applyRequestState(next desiredRequestState) {
 			// Steal a request that leaves us with one more request than the existing peer
 			// connection if the stealer more recently received a chunk.
 			if diff > 1 || (diff == 1 && p.lastUsefulChunkReceived.Before(existing.lastUsefulChunkReceived)) {
-				continue
+				return true
 			}
 			t.cancelRequest(req)
 		}
 		more = p.mustRequest(req)
-		if !more {
+		return more
+	}
+	backgroundSlots := p.backgroundRequestSlots(next.Requests)
+	// Urgent requests that didn't fit outside the slots reserved for background requests. They get
+	// any room left over after the background requests.
+	var deferred []RequestIndex
+	for {
+		if requestHeap.Len() == 0 {
+			break
+		}
+		if numPending() >= p.nominalMaxRequests() {
+			break
+		}
+		req := heap.Pop(requestHeap)
+		if cap(next.Requests.requestIndexes) != cap(orig) {
+			panic("changed")
+		}
+		if backgroundSlots != 0 &&
+			next.Requests.requestPriority(req).Rank() > PiecePriorityNormal.Rank() &&
+			numPending() >= p.nominalMaxRequests()-backgroundSlots {
+			deferred = append(deferred, req)
+			continue
+		}
+		if !apply(req) {
+			break
+		}
+	}
+	for _, req := range deferred {
+		if !more || numPending() >= p.nominalMaxRequests() {
 			break
 		}
+		apply(req)
 	}
 	if !more {
 		// This might fail if we incorrectly determine that we can fit up to the maximum allowed
@@ -338,7 +413,7 @@ func (p *Peer) applyRequestState(next desiredRequestState) {
 	// 	originalRequestCount, current.Requests.GetCardinality(), p.peakRequests, newPeakRequests, p.needRequestUpdate, p)
 	p.peakRequests = newPeakRequests
 	p.needRequestUpdate = ""
-	p.lastRequestUpdate = time.Now()
+	p.lastRequestUpdate = p.now()
 	if enableUpdateRequestsTimer {
 		p.updateRequestsTimer.Reset(updateRequestsTimerDuration)
 	}
@@ -3,10 +3,13 @@ package torrent
 import (
 	"testing"
 
+	g "github.com/anacrolix/generics"
 	"github.com/bradfitz/iter"
 	qt "github.com/frankban/quicktest"
 
+	"github.com/anacrolix/torrent/metainfo"
 	pp "github.com/anacrolix/torrent/peer_protocol"
+	infohash_v2 "github.com/anacrolix/torrent/types/infohash-v2"
 )
 
 func keysAsSlice(m map[Request]struct{}) (sl []Request) {
@@ -76,3 +79,88 @@ func TestForLoopRepeatItem(t *testing.T) {
 		qt.Assert(t, seen, qt.DeepEquals, []int{0, 1, 2, 3})
 	})
 }
+
+// Requests for pieces at normal priority get a share of the pipeline when higher priority pieces,
+// such as those read by a Reader, are also wanted.
+func TestBackgroundRequestSlots(t *testing.T) {
+	const (
+		pieceLength     = 4 * defaultChunkSize
+		numPieces       = 8
+		foregroundLimit = 4
+	)
+	newPeer := func(c *qt.C, fraction float64) *PeerConn {
+		cl := newTestingClient(t)
+		cl.config.BackgroundRequestFraction = fraction
+		tor, _ := cl.AddTorrentOpt(AddTorrentOpts{
+			InfoHashV2: g.Some(infohash_v2.FromHexString("deadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeefdeadbeef")),
+			Storage:    &storageClient{},
+		})
+		tor.disableTriggers = true
+		c.Assert(tor.setInfo(&metainfo.Info{
+			Pieces:      make([]byte, numPieces*metainfo.HashSize),
+			PieceLength: pieceLength,
+			Length:      pieceLength * numPieces,
+		}), qt.IsNil)
+		tor.onSetInfo()
+		pc := cl.newConnection(nil, newConnectionOpts{network: "test"})
+		pc.setTorrent(tor)
+		tor.conns[pc] = struct{}{}
+		pc.initMessageWriter()
+		pc.onPeerHasAllPiecesNoTriggers()
+		pc.peerChoking = false
+		pc.PeerMaxRequests = 8
+		pc.peakRequests = 4
+		for i := range numPieces {
+			prio := PiecePriorityNormal
+			if i < foregroundLimit {
+				prio = PiecePriorityNow
+			}
+			tor.pieces[i].priority.Raise(prio)
+			tor.updatePiecePriorityNoTriggers(i)
+			tor.updatePieceCompletion(i)
+		}
+		return pc
+	}
+	countRequests := func(pc *PeerConn) (foreground, background int) {
+		pc.requestState.Requests.Iterate(func(r RequestIndex) bool {
+			if pc.t.pieceIndexOfRequestIndex(r) < foregroundLimit {
+				foreground++
+			} else {
+				background++
+			}
+			return true
+		})
+		return
+	}
+	t.Run("Disabled", func(t *testing.T) {
+		c := qt.New(t)
+		pc := newPeer(c, 0)
+		pc.applyRequestState(pc.getDesiredRequestState())
+		foreground, background := countRequests(pc)
+		c.Check(foreground, qt.Equals, 8)
+		c.Check(background, qt.Equals, 0)
+	})
+	t.Run("Reserved", func(t *testing.T) {
+		c := qt.New(t)
+		pc := newPeer(c, 0.25)
+		c.Check(pc.backgroundRequestSlots(pc.getDesiredRequestState().Requests), qt.Equals, maxRequests(2))
+		pc.applyRequestState(pc.getDesiredRequestState())
+		foreground, background := countRequests(pc)
+		c.Check(foreground, qt.Equals, 6)
+		c.Check(background, qt.Equals, 2)
+	})
+	t.Run("NoBackground", func(t *testing.T) {
+		c := qt.New(t)
+		pc := newPeer(c, 0.25)
+		// Only the foreground pieces are wanted, so they get the whole pipeline.
+		for i := foregroundLimit; i < numPieces; i++ {
+			pc.t.pieces[i].priority = 0
+			pc.t.updatePiecePriorityNoTriggers(i)
+		}
+		c.Check(pc.backgroundRequestSlots(pc.getDesiredRequestState().Requests), qt.Equals, maxRequests(0))
+		pc.applyRequestState(pc.getDesiredRequestState())
+		foreground, background := countRequests(pc)
+		c.Check(foreground, qt.Equals, 8)
+		c.Check(background, qt.Equals, 0)
+	})
+}
@@ -0,0 +1,39 @@
+package torrent
+
+import (
+	"errors"
+)
+
+var ErrTooManyTorrents = errors.New("too many torrents")
+
+func (cl *Client) torrentLimitErr() error {
+	if max := cl.config.MaxTorrents; max > 0 && len(cl.torrents) >= max {
+		return ErrTooManyTorrents
+	}
+	return nil
+}
+
+// Whether t can allocate size bytes for metadata within ClientConfig.MaxMetadataBytesInFlight.
+// Metadata of torrents that have their info is no longer in flight.
+func (t *Torrent) metadataAllocAllowed(size int) bool {
+	max := t.cl.config.MaxMetadataBytesInFlight
+	if max <= 0 {
+		return true
+	}
+	return t.cl.metadataBytesInFlight-t.metadataInFlight+size <= max
+}
+
+// Updates the Torrent's contribution to Client.metadataBytesInFlight.
+func (t *Torrent) setMetadataInFlight(n int) {
+	t.cl.metadataBytesInFlight += n - t.metadataInFlight
+	t.metadataInFlight = n
+}
+
+// Retries metadata allocations deferred by MaxMetadataBytesInFlight, after a torrent has stopped
+// using its allocation by getting its info or being dropped. Otherwise deferred torrents would wait
+// for new peers.
+func (cl *Client) retryDeferredMetadataAllocs() {
+	for t := range cl.deferredMetadataTorrents {
+		t.setMetadataSize(t.deferredMetadataSize)
+	}
+}
@@ -0,0 +1,60 @@
+package torrent
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestMaxTorrents(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.MaxTorrents = 1
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	t1, new, err := cl.AddTorrentSpec(&TorrentSpec{InfoHash: [20]byte{1}})
+	c.Assert(err, qt.IsNil)
+	c.Check(new, qt.IsTrue)
+	_, _, err = cl.AddTorrentSpec(&TorrentSpec{InfoHash: [20]byte{2}})
+	c.Check(err, qt.ErrorIs, ErrTooManyTorrents)
+	// Merging into an existing torrent isn't limited.
+	tt, new, err := cl.AddTorrentSpec(&TorrentSpec{InfoHash: [20]byte{1}})
+	c.Assert(err, qt.IsNil)
+	c.Check(new, qt.IsFalse)
+	c.Check(tt, qt.Equals, t1)
+	t1.Drop()
+	_, _, err = cl.AddTorrentSpec(&TorrentSpec{InfoHash: [20]byte{2}})
+	c.Check(err, qt.IsNil)
+}
+
+func TestMaxMetadataBytesInFlight(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.MaxMetadataBytesInFlight = 100
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	t1, _ := cl.AddTorrentInfoHash([20]byte{1})
+	t2, _ := cl.AddTorrentInfoHash([20]byte{2})
+	cl.lock()
+	c.Assert(t1.setMetadataSize(60), qt.IsNil)
+	c.Check(t1.metadataSize(), qt.Equals, 60)
+	c.Assert(t2.setMetadataSize(60), qt.IsNil)
+	c.Check(t2.metadataSize(), qt.Equals, 0)
+	c.Check(cl.metadataBytesInFlight, qt.Equals, 60)
+	c.Check(cl.deferredMetadataTorrents, qt.HasLen, 1)
+	cl.unlock()
+	// Dropping t1 frees the budget, and t2 allocates without waiting for peers.
+	t1.Drop()
+	cl.lock()
+	c.Check(t2.metadataSize(), qt.Equals, 60)
+	c.Check(t2.deferredMetadataSize, qt.Equals, 0)
+	c.Check(cl.metadataBytesInFlight, qt.Equals, 60)
+	c.Check(cl.deferredMetadataTorrents, qt.HasLen, 0)
+	cl.unlock()
+	t2.Drop()
+	cl.lock()
+	c.Check(cl.metadataBytesInFlight, qt.Equals, 0)
+	cl.unlock()
+}
@@ -0,0 +1,195 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	g "github.com/anacrolix/generics"
+)
+
+// The outcome of one of the checks done by Client.SelfTest.
+type SelfTestResult struct {
+	Name string
+	Ok   bool
+	// The check didn't apply, such as for a disabled feature. Ok is also set.
+	Skipped bool   `json:",omitempty"`
+	Detail  string `json:",omitempty"`
+}
+
+// Results from Client.SelfTest, for diagnostics.
+type SelfTestReport struct {
+	Checks []SelfTestResult
+}
+
+// Whether all the checks passed.
+func (me SelfTestReport) Ok() bool {
+	for _, c := range me.Checks {
+		if !c.Ok {
+			return false
+		}
+	}
+	return true
+}
+
+// Times before this mean the system clock hasn't been set.
+var selfTestMinPlausibleTime = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Checks the Client's environment: that TCP listeners accept connections over loopback, that DHT
+// servers have found good nodes, that DataDir is writable, and that the clock is plausible. This
+// doesn't show whether the listen port is reachable from outside, such as through NAT.
+func (cl *Client) SelfTest(ctx context.Context) (ret SelfTestReport) {
+	cl.rLock()
+	listeners := append([]Listener(nil), cl.listeners...)
+	dhtServers := append([]DhtServer(nil), cl.dhtServers...)
+	dataDir := cl.config.DataDir
+	clientNow := cl.clock().Now()
+	cl.rUnlock()
+	add := func(r SelfTestResult) {
+		ret.Checks = append(ret.Checks, r)
+	}
+	if len(listeners) == 0 {
+		add(SelfTestResult{Name: "listen", Ok: true, Skipped: true, Detail: "no listeners"})
+	}
+	for _, l := range listeners {
+		add(cl.selfTestListener(ctx, l))
+	}
+	if len(dhtServers) == 0 {
+		add(SelfTestResult{Name: "dht", Ok: true, Skipped: true, Detail: "no DHT servers"})
+	}
+	for _, s := range dhtServers {
+		add(selfTestDhtServer(s))
+	}
+	add(selfTestDataDir(dataDir))
+	add(selfTestClock(clientNow, time.Now()))
+	return
+}
+
+// Returns the address to dial to reach a listener over loopback.
+func loopbackListenAddr(network string, addr net.Addr) (string, error) {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return "", err
+	}
+	if ip := net.ParseIP(host); ip == nil || ip.IsUnspecified() {
+		host = "127.0.0.1"
+		if strings.HasSuffix(network, "6") {
+			host = "::1"
+		}
+	}
+	return net.JoinHostPort(host, port), nil
+}
+
+func (cl *Client) selfTestListener(ctx context.Context, l Listener) (ret SelfTestResult) {
+	network := l.Addr().Network()
+	ret.Name = fmt.Sprintf("listen %v %v", network, l.Addr())
+	if !parseNetworkString(network).Tcp {
+		// Dialing a uTP socket from itself isn't a meaningful test.
+		ret.Ok = true
+		ret.Skipped = true
+		ret.Detail = "only TCP listeners are checked"
+		return
+	}
+	addr, err := loopbackListenAddr(network, l.Addr())
+	if err != nil {
+		ret.Detail = err.Error()
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, addr)
+	if err != nil {
+		ret.Detail = fmt.Sprintf("dialing %v: %v", addr, err)
+		return
+	}
+	// This is recorded before closing, so it's seen when the accepted side fails to handshake.
+	cl.lock()
+	g.MakeMapIfNil(&cl.selfTestAddrs)
+	cl.selfTestAddrs[conn.LocalAddr().String()] = struct{}{}
+	cl.unlock()
+	conn.Close()
+	ret.Ok = true
+	return
+}
+
+// Returns whether an accepted connection was dialed by SelfTest, and forgets it. The Client lock
+// must be held.
+func (cl *Client) takeSelfTestAddr(remote PeerRemoteAddr) bool {
+	if remote == nil {
+		return false
+	}
+	key := remote.String()
+	if _, ok := cl.selfTestAddrs[key]; !ok {
+		return false
+	}
+	delete(cl.selfTestAddrs, key)
+	return true
+}
+
+func selfTestDhtServer(s DhtServer) (ret SelfTestResult) {
+	ret.Name = fmt.Sprintf("dht %v", s.Addr())
+	stats, ok := s.Stats().(dht.ServerStats)
+	if !ok {
+		ret.Ok = true
+		ret.Skipped = true
+		ret.Detail = fmt.Sprintf("unknown stats type %T", s.Stats())
+		return
+	}
+	ret.Ok = stats.GoodNodes > 0
+	ret.Detail = fmt.Sprintf("%v good nodes of %v", stats.GoodNodes, stats.Nodes)
+	if !ret.Ok {
+		ret.Detail += ", bootstrap may not have completed"
+	}
+	return
+}
+
+func selfTestDataDir(dir string) (ret SelfTestResult) {
+	ret.Name = "data dir"
+	if dir == "" {
+		ret.Ok = true
+		ret.Skipped = true
+		ret.Detail = "DataDir not set"
+		return
+	}
+	f, err := os.CreateTemp(dir, ".torrent-self-test-*")
+	if err != nil {
+		ret.Detail = err.Error()
+		return
+	}
+	defer os.Remove(f.Name())
+	_, err = f.Write([]byte{0})
+	if err == nil {
+		err = f.Sync()
+	}
+	closeErr := f.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		ret.Detail = fmt.Sprintf("writing %q: %v", f.Name(), err)
+		return
+	}
+	ret.Ok = true
+	ret.Detail = dir
+	return
+}
+
+// clientNow is from ClientConfig.Clock, and systemNow is from the real clock.
+func selfTestClock(clientNow, systemNow time.Time) (ret SelfTestResult) {
+	ret.Name = "clock"
+	if systemNow.Before(selfTestMinPlausibleTime) {
+		ret.Detail = fmt.Sprintf("system time %v is implausibly early", systemNow.UTC())
+		return
+	}
+	if d := clientNow.Sub(systemNow).Abs(); d > time.Minute {
+		ret.Detail = fmt.Sprintf("client clock differs from system clock by %v", d)
+		return
+	}
+	ret.Ok = true
+	return
+}
@@ -0,0 +1,68 @@
+package torrent
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestSelfTest(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	report := cl.SelfTest(context.Background())
+	c.Check(report.Ok(), qt.IsTrue, qt.Commentf("%+v", report))
+	var listenChecked bool
+	for _, check := range report.Checks {
+		if check.Name == "dht" {
+			c.Check(check.Skipped, qt.IsTrue)
+		}
+		if !check.Skipped && check.Name != "data dir" && check.Name != "clock" {
+			listenChecked = true
+		}
+	}
+	c.Check(listenChecked, qt.IsTrue)
+	cfg.DataDir = filepath.Join(t.TempDir(), "missing")
+	report = cl.SelfTest(context.Background())
+	c.Check(report.Ok(), qt.IsFalse)
+}
+
+func TestSelfTestClock(t *testing.T) {
+	c := qt.New(t)
+	now := time.Date(2025, 6, 1, 0, 0, 0, 0, time.UTC)
+	c.Check(selfTestClock(now, now).Ok, qt.IsTrue)
+	c.Check(selfTestClock(now.Add(time.Hour), now).Ok, qt.IsFalse)
+	unset := time.Unix(0, 0)
+	c.Check(selfTestClock(unset, unset).Ok, qt.IsFalse)
+}
+
+func TestSelfTestConnsArentHeldAgainstLoopback(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.DisableAcceptRateLimiting = false
+	cfg.AlwaysWantConns = true
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	report := cl.SelfTest(context.Background())
+	c.Assert(report.Ok(), qt.IsTrue, qt.Commentf("%+v", report))
+	// Wait for the accepted side to see each self-test connection close.
+	for {
+		cl.lock()
+		pending := len(cl.selfTestAddrs) != 0 || cl.numHalfAccepted != 0
+		cl.unlock()
+		if !pending {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cl.lock()
+	defer cl.unlock()
+	c.Check(cl.acceptLimiter, qt.HasLen, 0)
+	c.Check(cl.handshakeStats().Other, qt.Equals, int64(0))
+}
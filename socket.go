@@ -29,41 +29,74 @@ type socket interface {
 	Close() error
 }
 
-func listen(n network, addr string, f firewallCallback, logger log.Logger) (socket, error) {
+// Options for the sockets created for peer connections.
+type socketOpts struct {
+	// See ClientConfig.TcpSimultaneousOpen.
+	tcpSimultaneousOpen bool
+	// See ClientConfig.PeerSocketTos.
+	tos int
+	// See ClientConfig.PeerSocketMark.
+	mark int
+}
+
+// Sets the traffic marking options on a socket. network is from a Control func, such as "tcp4".
+func (me socketOpts) setMarking(network string, fd uintptr) error {
+	if me.tos != 0 {
+		if err := setSockTos(fd, network, me.tos); err != nil {
+			return fmt.Errorf("setting tos: %w", err)
+		}
+	}
+	if me.mark != 0 {
+		if err := setSockMark(fd, me.mark); err != nil {
+			return fmt.Errorf("setting SO_MARK: %w", err)
+		}
+	}
+	return nil
+}
+
+func (me socketOpts) hasMarking() bool {
+	return me.tos != 0 || me.mark != 0
+}
+
+func listen(n network, addr string, f firewallCallback, logger log.Logger, opts socketOpts) (socket, error) {
 	switch {
 	case n.Tcp:
-		return listenTcp(n.String(), addr)
+		return listenTcp(n.String(), addr, opts)
 	case n.Udp:
-		return listenUtp(n.String(), addr, f, logger)
+		return listenUtp(n.String(), addr, f, logger, opts)
 	default:
 		panic(n)
 	}
 }
 
-// Dialing TCP from a local port limits us to a single outgoing TCP connection to each remote
-// client. Instead, this should be a last resort if we need to use holepunching, and only then to
-// connect to other clients that actually try to holepunch TCP.
-const dialTcpFromListenPort = false
+// BitTorrent connections manage their own keep-alives.
+const tcpKeepAlive = -1
 
-var tcpListenConfig = net.ListenConfig{
-	Control: func(network, address string, c syscall.RawConn) (err error) {
-		controlErr := c.Control(func(fd uintptr) {
-			if dialTcpFromListenPort {
-				err = setReusePortSockOpts(fd)
+// Dialing TCP from the listen port limits us to a single outgoing TCP connection to each remote
+// client, so it's only done when responding to a holepunch connect message, where the remote is
+// dialing us at the same time. Both ends need SO_REUSEPORT: the listener so the dialer can share
+// its port, and the dialer to bind it.
+// Accepted connections inherit the listener's marking.
+func listenTcp(network, address string, opts socketOpts) (s socket, err error) {
+	lc := net.ListenConfig{
+		Control: func(network, address string, c syscall.RawConn) (err error) {
+			controlErr := c.Control(func(fd uintptr) {
+				if opts.tcpSimultaneousOpen {
+					err = setReusePortSockOpts(fd)
+				}
+				if err == nil {
+					err = opts.setMarking(network, fd)
+				}
+			})
+			if err != nil {
+				return
 			}
-		})
-		if err != nil {
+			err = controlErr
 			return
-		}
-		err = controlErr
-		return
-	},
-	// BitTorrent connections manage their own keep-alives.
-	KeepAlive: -1,
-}
-
-func listenTcp(network, address string) (s socket, err error) {
-	l, err := tcpListenConfig.Listen(context.Background(), network, address)
+		},
+		KeepAlive: tcpKeepAlive,
+	}
+	l, err := lc.Listen(context.Background(), network, address)
 	if err != nil {
 		return
 	}
@@ -72,46 +105,69 @@ func listenTcp(network, address string) (s socket, err error) {
 		// although it's probably not triggered as I think the network is already constrained to
 		// tcp4 or tcp6 at this point.
 		FallbackDelay: -1,
-		// BitTorrent connections manage their own keepalives.
-		KeepAlive: tcpListenConfig.KeepAlive,
-		Control: func(network, address string, c syscall.RawConn) (err error) {
-			controlErr := c.Control(func(fd uintptr) {
-				err = setSockNoLinger(fd)
-				if err != nil {
-					// Failing to disable linger is undesirable, but not fatal.
-					log.Levelf(log.Debug, "error setting linger socket option on tcp socket: %v", err)
-					err = nil
-				}
-				// This is no longer required I think, see
-				// https://github.com/anacrolix/torrent/discussions/856. I added this originally to
-				// allow dialling out from the client's listen port, but that doesn't really work. I
-				// think Linux older than ~2013 doesn't support SO_REUSEPORT.
-				if dialTcpFromListenPort {
-					err = setReusePortSockOpts(fd)
-				}
-			})
-			if err == nil {
-				err = controlErr
-			}
-			return
-		},
+		KeepAlive:     tcpKeepAlive,
+		Control:       tcpDialControl(false, opts),
 	}
-	if dialTcpFromListenPort {
-		netDialer.LocalAddr = l.Addr()
-	}
-	s = tcpSocket{
+	ts := tcpSocket{
 		Listener: l,
 		NetworkDialer: NetworkDialer{
 			Network: network,
 			Dialer:  &netDialer,
 		},
 	}
+	if opts.tcpSimultaneousOpen {
+		listenPortDialer := netDialer
+		listenPortDialer.LocalAddr = l.Addr()
+		listenPortDialer.Control = tcpDialControl(true, opts)
+		ts.listenPortDialer = &listenPortDialer
+	}
+	s = ts
 	return
 }
 
+func tcpDialControl(reusePort bool, opts socketOpts) func(network, address string, c syscall.RawConn) error {
+	return func(network, address string, c syscall.RawConn) (err error) {
+		controlErr := c.Control(func(fd uintptr) {
+			err = setSockNoLinger(fd)
+			if err != nil {
+				// Failing to disable linger is undesirable, but not fatal.
+				log.Levelf(log.Debug, "error setting linger socket option on tcp socket: %v", err)
+				err = nil
+			}
+			// I think Linux older than ~2013 doesn't support SO_REUSEPORT. See
+			// https://github.com/anacrolix/torrent/discussions/856.
+			if reusePort {
+				err = setReusePortSockOpts(fd)
+			}
+			if err == nil {
+				err = opts.setMarking(network, fd)
+			}
+		})
+		if err == nil {
+			err = controlErr
+		}
+		return
+	}
+}
+
 type tcpSocket struct {
 	net.Listener
 	NetworkDialer
+	// Dials from the listen port. Only set if ClientConfig.TcpSimultaneousOpen is.
+	listenPortDialer *net.Dialer
+}
+
+// Returns the Dialer to use for responding to a holepunch connect message. TCP sockets with
+// simultaneous open enabled dial from their listen port, so the remote's dial to that port can
+// pass through our NAT, and ours through theirs.
+func holepunchDialer(d Dialer) Dialer {
+	if ts, ok := d.(tcpSocket); ok && ts.listenPortDialer != nil {
+		return NetworkDialer{
+			Network: ts.Network,
+			Dialer:  ts.listenPortDialer,
+		}
+	}
+	return d
 }
 
 func listenAll(
@@ -120,6 +176,7 @@ func listenAll(
 	port int,
 	f firewallCallback,
 	logger log.Logger,
+	opts socketOpts,
 ) ([]socket, error) {
 	if len(networks) == 0 {
 		return nil, nil
@@ -129,7 +186,7 @@ func listenAll(
 		nahs = append(nahs, networkAndHost{n, getHost(n.String())})
 	}
 	for {
-		ss, retry, err := listenAllRetry(nahs, port, f, logger)
+		ss, retry, err := listenAllRetry(nahs, port, f, logger, opts)
 		if !retry {
 			return ss, err
 		}
@@ -160,6 +217,7 @@ func listenAllRetry(
 	port int,
 	f firewallCallback,
 	logger log.Logger,
+	opts socketOpts,
 ) (ss []socket, retry bool, err error) {
 	// Close all sockets on error or retry.
 	defer func() {
@@ -174,7 +232,7 @@ func listenAllRetry(
 	portStr := strconv.FormatInt(int64(port), 10)
 	for _, nah := range nahs {
 		var s socket
-		s, err = listen(nah.Network, net.JoinHostPort(nah.Host, portStr), f, logger)
+		s, err = listen(nah.Network, net.JoinHostPort(nah.Host, portStr), f, logger, opts)
 		if err != nil {
 			if isUnsupportedNetworkError(err) {
 				err = nil
@@ -198,11 +256,43 @@ func listenAllRetry(
 // This isn't aliased from go-libutp since that assumes CGO.
 type firewallCallback func(net.Addr) bool
 
-func listenUtp(network, addr string, fc firewallCallback, logger log.Logger) (socket, error) {
+func listenUtp(network, addr string, fc firewallCallback, logger log.Logger, opts socketOpts) (socket, error) {
+	if opts.hasMarking() {
+		// The uTP implementations create their own sockets without a way to set options, so we
+		// create it. This uses the pure Go uTP implementation.
+		lc := net.ListenConfig{
+			Control: func(network, address string, c syscall.RawConn) (err error) {
+				controlErr := c.Control(func(fd uintptr) {
+					err = opts.setMarking(network, fd)
+				})
+				if err == nil {
+					err = controlErr
+				}
+				return
+			},
+		}
+		pc, err := lc.ListenPacket(context.Background(), network, addr)
+		if err != nil {
+			return nil, err
+		}
+		us, err := NewUtpSocketFromPacketConn(pc, fc, logger)
+		if err != nil {
+			pc.Close()
+			return nil, err
+		}
+		return utpSocketSocket{us, network}, nil
+	}
 	us, err := NewUtpSocket(network, addr, fc, logger)
 	return utpSocketSocket{us, network}, err
 }
 
+// Wraps a PacketConn from ClientConfig.PacketConns. Packets that aren't uTP are still delivered by
+// the socket's ReadFrom, so it can be shared with the DHT.
+func utpSocketFromPacketConn(pc net.PacketConn, fc firewallCallback, logger log.Logger) (socket, error) {
+	us, err := NewUtpSocketFromPacketConn(pc, fc, logger)
+	return utpSocketSocket{us, pc.LocalAddr().Network()}, err
+}
+
 // utpSocket wrapper, additionally wrapped for the torrent package's socket interface.
 type utpSocketSocket struct {
 	utpSocket
@@ -0,0 +1,8 @@
+package torrent
+
+import "golang.org/x/sys/unix"
+
+// Requires CAP_NET_ADMIN.
+func setSockMark(fd uintptr, mark int) error {
+	return unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_MARK, mark)
+}
@@ -0,0 +1,49 @@
+package torrent
+
+import (
+	"context"
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/anacrolix/log"
+	qt "github.com/frankban/quicktest"
+	"golang.org/x/sys/unix"
+)
+
+func getSockTos(c *qt.C, sc syscall.Conn) (tos int) {
+	rc, err := sc.SyscallConn()
+	c.Assert(err, qt.IsNil)
+	c.Assert(rc.Control(func(fd uintptr) {
+		tos, err = unix.GetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS)
+	}), qt.IsNil)
+	c.Assert(err, qt.IsNil)
+	return
+}
+
+func TestPeerSocketTos(t *testing.T) {
+	c := qt.New(t)
+	opts := socketOpts{tos: TosDscpCs1}
+	remote, err := net.Listen("tcp4", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	defer remote.Close()
+	s, err := listenTcp("tcp4", "127.0.0.1:0", opts)
+	c.Assert(err, qt.IsNil)
+	defer s.Close()
+	nc, err := s.Dial(context.Background(), remote.Addr().String())
+	c.Assert(err, qt.IsNil)
+	defer nc.Close()
+	c.Check(getSockTos(c, nc.(syscall.Conn)), qt.Equals, TosDscpCs1)
+	// Accepted connections inherit the listener's TOS.
+	ac, err := net.Dial("tcp4", s.Addr().String())
+	c.Assert(err, qt.IsNil)
+	defer ac.Close()
+	lc, err := s.Accept()
+	c.Assert(err, qt.IsNil)
+	defer lc.Close()
+	c.Check(getSockTos(c, lc.(syscall.Conn)), qt.Equals, TosDscpCs1)
+
+	us, err := listenUtp("udp4", "127.0.0.1:0", nil, log.Default, opts)
+	c.Assert(err, qt.IsNil)
+	us.Close()
+}
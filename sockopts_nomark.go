@@ -0,0 +1,9 @@
+//go:build !linux && !wasm
+
+package torrent
+
+import "errors"
+
+func setSockMark(fd uintptr, mark int) error {
+	return errors.New("SO_MARK is only supported on linux")
+}
@@ -3,6 +3,7 @@
 package torrent
 
 import (
+	"strings"
 	"syscall"
 
 	"golang.org/x/sys/unix"
@@ -27,3 +28,11 @@ func setReusePortSockOpts(fd uintptr) (err error) {
 func setSockNoLinger(fd uintptr) (err error) {
 	return syscall.SetsockoptLinger(int(fd), syscall.SOL_SOCKET, syscall.SO_LINGER, &lingerOffVal)
 }
+
+// network is as passed to a Control func. The DSCP is the upper 6 bits of tos.
+func setSockTos(fd uintptr, network string, tos int) error {
+	if strings.HasSuffix(network, "6") {
+		return unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_TCLASS, tos)
+	}
+	return unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_TOS, tos)
+}
@@ -10,3 +10,11 @@ func setReusePortSockOpts(fd uintptr) error {
 func setSockNoLinger(fd uintptr) error {
 	return nil
 }
+
+func setSockTos(fd uintptr, network string, tos int) error {
+	return nil
+}
+
+func setSockMark(fd uintptr, mark int) error {
+	return nil
+}
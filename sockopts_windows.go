@@ -1,6 +1,7 @@
 package torrent
 
 import (
+	"errors"
 	"syscall"
 
 	"golang.org/x/sys/windows"
@@ -13,3 +14,8 @@ func setReusePortSockOpts(fd uintptr) (err error) {
 func setSockNoLinger(fd uintptr) (err error) {
 	return syscall.SetsockoptLinger(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_LINGER, &lingerOffVal)
 }
+
+// Windows ignores IP_TOS unless a registry setting is changed, and expects qWAVE to be used instead.
+func setSockTos(fd uintptr, network string, tos int) error {
+	return errors.New("not supported on windows")
+}
@@ -0,0 +1,37 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/socks5"
+)
+
+const socks5UdpAssociateTimeout = 30 * time.Second
+
+// Associates with ClientConfig.Socks5UdpProxy, for uTP and the DHT.
+func (cl *Client) socks5UdpAssociate() (*socks5.PacketConn, error) {
+	u := cl.config.Socks5UdpProxy
+	if u.Scheme != "socks5" && u.Scheme != "socks5h" {
+		return nil, fmt.Errorf("unsupported udp proxy scheme %q", u.Scheme)
+	}
+	var auth *socks5.Auth
+	if u.User != nil {
+		password, _ := u.User.Password()
+		auth = &socks5.Auth{
+			Username: u.User.Username(),
+			Password: password,
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), socks5UdpAssociateTimeout)
+	defer cancel()
+	pc, err := socks5.UdpAssociate(ctx, u.Host, auth)
+	if err != nil {
+		return nil, fmt.Errorf("udp associate with socks5 proxy %v: %w", u.Redacted(), err)
+	}
+	cl.logger.Levelf(log.Info, "relaying uTP and DHT through socks5 proxy at %v", pc.RelayAddr())
+	return pc, nil
+}
@@ -0,0 +1,26 @@
+package torrent
+
+import (
+	"net"
+	"net/url"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestSocks5UdpProxyUnavailableDisablesUdp(t *testing.T) {
+	c := qt.New(t)
+	// Nothing is listening on this address once the listener is closed.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	l.Close()
+	cfg := TestingConfig(t)
+	cfg.Socks5UdpProxy = &url.URL{Scheme: "socks5", Host: l.Addr().String()}
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	for _, l := range cl.Listeners() {
+		c.Check(parseNetworkString(l.Addr().Network()).Udp, qt.IsFalse)
+	}
+	c.Check(cl.Listeners(), qt.Not(qt.HasLen), 0)
+}
@@ -0,0 +1,342 @@
+// Package socks5 implements the client side of SOCKS5 UDP ASSOCIATE (RFC 1928), so that UDP
+// protocols like uTP and the DHT can be relayed through a proxy.
+package socks5
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	version = 5
+
+	methodNoAuth       = 0
+	methodUserPass     = 2
+	methodNoAcceptable = 0xff
+
+	cmdUdpAssociate = 3
+
+	atypIpv4   = 1
+	atypDomain = 3
+	atypIpv6   = 4
+
+	repSuccess             = 0
+	repCommandNotSupported = 7
+)
+
+// Returned, wrapped, when the proxy refuses UDP ASSOCIATE.
+var ErrUdpNotSupported = errors.New("proxy doesn't support udp associate")
+
+// Username and password authentication (RFC 1929).
+type Auth struct {
+	Username string
+	Password string
+}
+
+// Requests a UDP association from the SOCKS5 proxy at proxyAddr ("host:port"). auth may be nil.
+// The association lasts until the returned PacketConn is closed, or the proxy closes the control
+// connection.
+func UdpAssociate(ctx context.Context, proxyAddr string, auth *Auth) (_ *PacketConn, err error) {
+	var d net.Dialer
+	control, err := d.DialContext(ctx, "tcp", proxyAddr)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			control.Close()
+		}
+	}()
+	if dl, ok := ctx.Deadline(); ok {
+		control.SetDeadline(dl)
+	}
+	err = negotiateAuth(control, auth)
+	if err != nil {
+		return nil, err
+	}
+	// We don't know the address we'll send from, so it's left unspecified.
+	_, err = control.Write([]byte{version, cmdUdpAssociate, 0, atypIpv4, 0, 0, 0, 0, 0, 0})
+	if err != nil {
+		return nil, err
+	}
+	var reply [3]byte
+	_, err = io.ReadFull(control, reply[:])
+	if err != nil {
+		return nil, fmt.Errorf("reading reply: %w", err)
+	}
+	switch reply[1] {
+	case repSuccess:
+	case repCommandNotSupported:
+		return nil, ErrUdpNotSupported
+	default:
+		return nil, fmt.Errorf("udp associate failed with reply code %v", reply[1])
+	}
+	relay, err := readAddr(control)
+	if err != nil {
+		return nil, fmt.Errorf("reading relay address: %w", err)
+	}
+	if !relay.Addr().IsValid() || relay.Addr().IsUnspecified() {
+		// The relay is on the proxy's address.
+		proxyAddrPort, err := netip.ParseAddrPort(control.RemoteAddr().String())
+		if err != nil {
+			return nil, err
+		}
+		relay = netip.AddrPortFrom(proxyAddrPort.Addr(), relay.Port())
+	}
+	relay = netip.AddrPortFrom(relay.Addr().Unmap(), relay.Port())
+	control.SetDeadline(time.Time{})
+	udp, err := net.ListenUDP("udp", nil)
+	if err != nil {
+		return nil, err
+	}
+	pc := &PacketConn{
+		control: control,
+		udp:     udp,
+		relay:   relay,
+	}
+	go pc.watchControl()
+	return pc, nil
+}
+
+func negotiateAuth(rw io.ReadWriter, auth *Auth) error {
+	greeting := []byte{version, 1, methodNoAuth}
+	if auth != nil {
+		greeting = []byte{version, 2, methodNoAuth, methodUserPass}
+	}
+	_, err := rw.Write(greeting)
+	if err != nil {
+		return err
+	}
+	var choice [2]byte
+	_, err = io.ReadFull(rw, choice[:])
+	if err != nil {
+		return fmt.Errorf("reading method selection: %w", err)
+	}
+	if choice[0] != version {
+		return fmt.Errorf("unexpected socks version %v", choice[0])
+	}
+	switch choice[1] {
+	case methodNoAuth:
+		return nil
+	case methodUserPass:
+		if auth == nil {
+			break
+		}
+		return authenticate(rw, *auth)
+	case methodNoAcceptable:
+		return errors.New("no acceptable authentication methods")
+	}
+	return fmt.Errorf("unexpected authentication method %v", choice[1])
+}
+
+func authenticate(rw io.ReadWriter, auth Auth) error {
+	if len(auth.Username) > 255 || len(auth.Password) > 255 {
+		return errors.New("username or password too long")
+	}
+	b := []byte{1, byte(len(auth.Username))}
+	b = append(b, auth.Username...)
+	b = append(b, byte(len(auth.Password)))
+	b = append(b, auth.Password...)
+	_, err := rw.Write(b)
+	if err != nil {
+		return err
+	}
+	var status [2]byte
+	_, err = io.ReadFull(rw, status[:])
+	if err != nil {
+		return fmt.Errorf("reading authentication status: %w", err)
+	}
+	if status[1] != 0 {
+		return errors.New("authentication failed")
+	}
+	return nil
+}
+
+// Reads ATYP, DST.ADDR and DST.PORT. Domain names aren't resolved, and give an invalid address.
+func readAddr(r io.Reader) (ret netip.AddrPort, err error) {
+	var atyp [1]byte
+	_, err = io.ReadFull(r, atyp[:])
+	if err != nil {
+		return
+	}
+	var addr netip.Addr
+	switch atyp[0] {
+	case atypIpv4:
+		var b [4]byte
+		_, err = io.ReadFull(r, b[:])
+		addr = netip.AddrFrom4(b)
+	case atypIpv6:
+		var b [16]byte
+		_, err = io.ReadFull(r, b[:])
+		addr = netip.AddrFrom16(b)
+	case atypDomain:
+		var l [1]byte
+		_, err = io.ReadFull(r, l[:])
+		if err == nil {
+			_, err = io.ReadFull(r, make([]byte, l[0]))
+		}
+	default:
+		err = fmt.Errorf("unknown address type %v", atyp[0])
+	}
+	if err != nil {
+		return
+	}
+	var port [2]byte
+	_, err = io.ReadFull(r, port[:])
+	ret = netip.AddrPortFrom(addr, binary.BigEndian.Uint16(port[:]))
+	return
+}
+
+func appendAddr(b []byte, addr netip.AddrPort) []byte {
+	ip := addr.Addr().Unmap()
+	if ip.Is4() {
+		b = append(b, atypIpv4)
+	} else {
+		b = append(b, atypIpv6)
+	}
+	b = append(b, ip.AsSlice()...)
+	return binary.BigEndian.AppendUint16(b, addr.Port())
+}
+
+// Converts the net.Addrs given to WriteTo, which are usually *net.UDPAddr.
+func addrPortFromNetAddr(addr net.Addr) (netip.AddrPort, error) {
+	if ua, ok := addr.(*net.UDPAddr); ok {
+		return ua.AddrPort(), nil
+	}
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.AddrPort{}, err
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	return netip.AddrPortFrom(ip, uint16(p)), err
+}
+
+// A net.PacketConn with packets relayed by a SOCKS5 proxy. Remote addresses are those of the
+// peers, not the relay.
+type PacketConn struct {
+	control net.Conn
+	udp     *net.UDPConn
+	relay   netip.AddrPort
+
+	closeOnce sync.Once
+}
+
+var _ net.PacketConn = (*PacketConn)(nil)
+
+// The proxy ends the association when the control connection closes.
+func (me *PacketConn) watchControl() {
+	io.Copy(io.Discard, me.control)
+	me.Close()
+}
+
+// The largest header the proxy prepends, for a domain name address.
+const maxHeaderLen = 3 + 2 + 255 + 2
+
+var bufPool = sync.Pool{
+	New: func() any { return make([]byte, 0x10000+maxHeaderLen) },
+}
+
+func (me *PacketConn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	buf := bufPool.Get().([]byte)
+	defer bufPool.Put(buf)
+	for {
+		var from netip.AddrPort
+		n, from, err = me.udp.ReadFromUDPAddrPort(buf)
+		if err != nil {
+			return
+		}
+		if netip.AddrPortFrom(from.Addr().Unmap(), from.Port()) != me.relay {
+			continue
+		}
+		payload, src, ok := parseDatagram(buf[:n])
+		if !ok {
+			continue
+		}
+		return copy(b, payload), net.UDPAddrFromAddrPort(src), nil
+	}
+}
+
+// Fragmented datagrams and those from domain name addresses are dropped.
+func parseDatagram(b []byte) (payload []byte, src netip.AddrPort, ok bool) {
+	if len(b) < 4 || b[2] != 0 {
+		return
+	}
+	r := &sliceReader{b: b[3:]}
+	src, err := readAddr(r)
+	if err != nil || !src.Addr().IsValid() {
+		return
+	}
+	return r.b, src, true
+}
+
+type sliceReader struct {
+	b []byte
+}
+
+func (me *sliceReader) Read(p []byte) (int, error) {
+	if len(me.b) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(p, me.b)
+	me.b = me.b[n:]
+	return n, nil
+}
+
+func (me *PacketConn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	dst, err := addrPortFromNetAddr(addr)
+	if err != nil {
+		return 0, err
+	}
+	buf := bufPool.Get().([]byte)
+	defer bufPool.Put(buf)
+	packet := appendAddr(append(buf[:0], 0, 0, 0), dst)
+	packet = append(packet, b...)
+	_, err = me.udp.WriteToUDPAddrPort(packet, me.relay)
+	if err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Ends the association and closes the local socket.
+func (me *PacketConn) Close() (err error) {
+	me.closeOnce.Do(func() {
+		me.control.Close()
+		err = me.udp.Close()
+	})
+	return
+}
+
+// The local socket's address. Peers see the proxy's relay address instead.
+func (me *PacketConn) LocalAddr() net.Addr {
+	return me.udp.LocalAddr()
+}
+
+// The address the proxy relays packets from.
+func (me *PacketConn) RelayAddr() netip.AddrPort {
+	return me.relay
+}
+
+func (me *PacketConn) SetDeadline(t time.Time) error {
+	return me.udp.SetDeadline(t)
+}
+
+func (me *PacketConn) SetReadDeadline(t time.Time) error {
+	return me.udp.SetReadDeadline(t)
+}
+
+func (me *PacketConn) SetWriteDeadline(t time.Time) error {
+	return me.udp.SetWriteDeadline(t)
+}
@@ -0,0 +1,150 @@
+package socks5
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+// A minimal SOCKS5 proxy that handles UDP ASSOCIATE, or refuses it with rep.
+type testProxy struct {
+	l    net.Listener
+	auth *Auth
+	rep  byte
+}
+
+func startTestProxy(c *qt.C, auth *Auth, rep byte) *testProxy {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	p := &testProxy{l: l, auth: auth, rep: rep}
+	c.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go p.serve(conn)
+		}
+	}()
+	return p
+}
+
+func (p *testProxy) serve(conn net.Conn) {
+	defer conn.Close()
+	b := make([]byte, 512)
+	_, err := io.ReadFull(conn, b[:2])
+	if err != nil {
+		return
+	}
+	io.ReadFull(conn, b[:b[1]])
+	if p.auth == nil {
+		conn.Write([]byte{version, methodNoAuth})
+	} else {
+		conn.Write([]byte{version, methodUserPass})
+		io.ReadFull(conn, b[:2])
+		user := make([]byte, b[1])
+		io.ReadFull(conn, user)
+		io.ReadFull(conn, b[:1])
+		pass := make([]byte, b[0])
+		io.ReadFull(conn, pass)
+		if string(user) != p.auth.Username || string(pass) != p.auth.Password {
+			conn.Write([]byte{1, 1})
+			return
+		}
+		conn.Write([]byte{1, 0})
+	}
+	_, err = io.ReadFull(conn, b[:3])
+	if err != nil || b[1] != cmdUdpAssociate {
+		return
+	}
+	readAddr(conn)
+	if p.rep != repSuccess {
+		conn.Write([]byte{version, p.rep, 0, atypIpv4, 0, 0, 0, 0, 0, 0})
+		return
+	}
+	relay, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return
+	}
+	defer relay.Close()
+	reply := appendAddr([]byte{version, repSuccess, 0}, relay.LocalAddr().(*net.UDPAddr).AddrPort())
+	conn.Write(reply)
+	go func() {
+		var client netip.AddrPort
+		buf := make([]byte, 0x10000)
+		for {
+			n, from, err := relay.ReadFromUDPAddrPort(buf)
+			if err != nil {
+				return
+			}
+			if !client.IsValid() || from == client {
+				client = from
+				payload, dst, ok := parseDatagram(buf[:n])
+				if ok {
+					relay.WriteToUDPAddrPort(payload, dst)
+				}
+				continue
+			}
+			packet := appendAddr([]byte{0, 0, 0}, from)
+			relay.WriteToUDPAddrPort(append(packet, buf[:n]...), client)
+		}
+	}()
+	// The association lasts as long as the control connection.
+	io.Copy(io.Discard, conn)
+}
+
+func TestUdpAssociateRelaysPackets(t *testing.T) {
+	c := qt.New(t)
+	auth := &Auth{Username: "user", Password: "secret"}
+	proxy := startTestProxy(c, auth, repSuccess)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	pc, err := UdpAssociate(ctx, proxy.l.Addr().String(), auth)
+	c.Assert(err, qt.IsNil)
+	defer pc.Close()
+	c.Check(pc.RelayAddr().Addr(), qt.Equals, netip.MustParseAddr("127.0.0.1"))
+
+	peer, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	c.Assert(err, qt.IsNil)
+	defer peer.Close()
+	_, err = pc.WriteTo([]byte("ping"), peer.LocalAddr())
+	c.Assert(err, qt.IsNil)
+
+	b := make([]byte, 100)
+	peer.SetReadDeadline(time.Now().Add(10 * time.Second))
+	n, from, err := peer.ReadFromUDPAddrPort(b)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b[:n]), qt.Equals, "ping")
+	// The peer sees the relay, not our socket.
+	c.Check(from, qt.Equals, pc.RelayAddr())
+
+	_, err = peer.WriteToUDPAddrPort([]byte("pong"), from)
+	c.Assert(err, qt.IsNil)
+	pc.SetReadDeadline(time.Now().Add(10 * time.Second))
+	n, addr, err := pc.ReadFrom(b)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b[:n]), qt.Equals, "pong")
+	c.Check(addr.String(), qt.Equals, peer.LocalAddr().String())
+}
+
+func TestUdpAssociateNotSupported(t *testing.T) {
+	c := qt.New(t)
+	proxy := startTestProxy(c, nil, repCommandNotSupported)
+	_, err := UdpAssociate(context.Background(), proxy.l.Addr().String(), nil)
+	c.Check(errors.Is(err, ErrUdpNotSupported), qt.IsTrue)
+}
+
+func TestUdpAssociateBadAuth(t *testing.T) {
+	c := qt.New(t)
+	proxy := startTestProxy(c, &Auth{Username: "user", Password: "secret"}, repSuccess)
+	_, err := UdpAssociate(
+		context.Background(), proxy.l.Addr().String(), &Auth{Username: "user", Password: "wrong"})
+	c.Check(err, qt.ErrorMatches, "authentication failed")
+}
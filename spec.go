@@ -32,18 +32,34 @@ type TorrentSpec struct {
 	Sources []string
 	// BEP 52 "piece layers" from metainfo
 	PieceLayers map[string]string
+	// BEP 53 file indices to download, from the "so" magnet link parameter. They're given normal
+	// priority once the info is available.
+	SelectOnly []int
 
 	// The chunk size to use for outbound requests. Defaults to 16KiB if not set. Can only be set
 	// for new Torrents. TODO: Move into a "new" Torrent opt type.
 	ChunkSize pp.Integer
-	// TODO: Move into a "new" Torrent opt type.
+	// Storage for this torrent's data in place of ClientConfig.DefaultStorage, so torrents in the
+	// same Client can use different backends. Can only be set for new Torrents, and isn't closed by
+	// the Client. TODO: Move into a "new" Torrent opt type.
 	Storage storage.ClientImpl
 
 	DisableInitialPieceCheck bool
+	// Marks all pieces complete without hashing them, for data that's known to be correct, such as
+	// when it was just used to create the torrent. A piece is hashed if reading it for a peer fails.
+	// Only applies if the info isn't already known.
+	SeedMode bool
 
 	// Whether to allow data download or upload
 	DisallowDataUpload   bool
 	DisallowDataDownload bool
+
+	// Replaces the Torrent's announce overrides if any are set. See Torrent.SetAnnounceOverrides.
+	AnnounceOverrides AnnounceOverrides
+	// The metainfo "encoding" field. Names in the info that aren't UTF-8 are decoded with it for
+	// File paths and storage. See metainfo.Info.DecodeNames. Only applies if the info isn't already
+	// known.
+	Encoding string
 }
 
 func TorrentSpecFromMagnetUri(uri string) (spec *TorrentSpec, err error) {
@@ -51,6 +67,11 @@ func TorrentSpecFromMagnetUri(uri string) (spec *TorrentSpec, err error) {
 	if err != nil {
 		return
 	}
+	selectOnly, err := m.SelectOnly()
+	if err != nil {
+		err = fmt.Errorf("parsing select only: %w", err)
+		return
+	}
 	spec = &TorrentSpec{
 		Trackers:    [][]string{m.Trackers},
 		DisplayName: m.DisplayName,
@@ -59,6 +80,7 @@ func TorrentSpecFromMagnetUri(uri string) (spec *TorrentSpec, err error) {
 		Webseeds:    m.Params["ws"],
 		Sources:     append(m.Params["xs"], m.Params["as"]...),
 		PeerAddrs:   m.Params["x.pe"], // BEP 9
+		SelectOnly:  selectOnly,
 		// TODO: What's the parameter for DHT nodes?
 	}
 	return
@@ -87,6 +109,7 @@ func TorrentSpecFromMetaInfoErr(mi *metainfo.MetaInfo) (*TorrentSpec, error) {
 		PieceLayers: mi.PieceLayers,
 		InfoBytes:   mi.InfoBytes,
 		DisplayName: info.BestName(),
+		Encoding:    mi.Encoding,
 		Webseeds:    mi.UrlList,
 		DhtNodes: func() (ret []string) {
 			ret = make([]string, 0, len(mi.Nodes))
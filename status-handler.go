@@ -0,0 +1,114 @@
+package torrent
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"html"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/anacrolix/torrent/types/infohash"
+)
+
+// The default interval in seconds for the status page to refresh itself. It can be overridden with
+// the "refresh" query parameter, where 0 disables refreshing.
+const defaultStatusRefreshSeconds = 10
+
+// Returns a http.Handler serving the standard Client status page. The root renders
+// Client.WriteStatus with links to each torrent, "torrent/<infohash>" renders the status of a
+// single torrent, "json" serves Client.StateJSON, and "debug/vars" serves expvar. Append
+// "?format=json" to the torrent page to get the TorrentState instead. To mount it somewhere other
+// than the root, use http.StripPrefix with a prefix ending in "/".
+func StatusHandler(cl *Client) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		var buf bytes.Buffer
+		cl.WriteStatus(&buf)
+		writeStatusPage(w, r, "Client status", statusTorrentLinks(cl), buf.String())
+	})
+	mux.HandleFunc("/json", func(w http.ResponseWriter, r *http.Request) {
+		b, err := cl.StateJSON()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(b)
+	})
+	mux.HandleFunc("/torrent/", func(w http.ResponseWriter, r *http.Request) {
+		var ih infohash.T
+		err := ih.FromHexString(strings.TrimPrefix(r.URL.Path, "/torrent/"))
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parsing infohash: %v", err), http.StatusBadRequest)
+			return
+		}
+		t, ok := cl.Torrent(ih)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if r.URL.Query().Get("format") == "json" {
+			cl.rLock()
+			state := t.stateLocked()
+			cl.rUnlock()
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(&state)
+			return
+		}
+		var buf bytes.Buffer
+		func() {
+			bw := bufio.NewWriter(&buf)
+			defer bw.Flush()
+			cl.rLock()
+			defer cl.rUnlock()
+			t.writeStatus(bw)
+		}()
+		writeStatusPage(w, r, t.Name(), `<a href="../">All torrents</a>`, buf.String())
+	})
+	mux.Handle("/debug/vars", expvar.Handler())
+	return mux
+}
+
+func statusTorrentLinks(cl *Client) string {
+	var b strings.Builder
+	b.WriteString(`<a href="json">JSON</a> <a href="debug/vars">expvar</a>`)
+	cl.rLock()
+	defer cl.rUnlock()
+	torrentsSlice := cl.torrentsAsSlice()
+	sort.Slice(torrentsSlice, func(l, r int) bool {
+		return torrentsSlice[l].name() < torrentsSlice[r].name()
+	})
+	for _, t := range torrentsSlice {
+		fmt.Fprintf(
+			&b, "<br><a href=\"torrent/%s\">%s</a>",
+			t.canonicalShortInfohash().HexString(), html.EscapeString(t.name()))
+	}
+	return b.String()
+}
+
+func writeStatusPage(w http.ResponseWriter, r *http.Request, title, header, status string) {
+	refresh := defaultStatusRefreshSeconds
+	if s := r.URL.Query().Get("refresh"); s != "" {
+		var err error
+		refresh, err = strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("parsing refresh: %v", err), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	fmt.Fprintf(w, "<!DOCTYPE html>\n<html><head><title>%s</title>", html.EscapeString(title))
+	if refresh > 0 {
+		fmt.Fprintf(w, `<meta http-equiv="refresh" content="%d">`, refresh)
+	}
+	fmt.Fprintf(w, "</head><body>%s<pre>%s</pre></body></html>\n", header, html.EscapeString(status))
+}
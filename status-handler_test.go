@@ -0,0 +1,41 @@
+package torrent
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func TestStatusHandler(t *testing.T) {
+	c := qt.New(t)
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	h := StatusHandler(cl)
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+		return w
+	}
+	w := get("/")
+	c.Check(w.Code, qt.Equals, http.StatusOK)
+	c.Check(w.Body.String(), qt.Contains, "torrent/"+tt.InfoHash().HexString())
+	c.Check(w.Body.String(), qt.Contains, `http-equiv="refresh"`)
+	c.Check(get("/?refresh=0").Body.String(), qt.Not(qt.Contains), `http-equiv="refresh"`)
+	w = get("/torrent/" + tt.InfoHash().HexString())
+	c.Check(w.Code, qt.Equals, http.StatusOK)
+	c.Check(w.Body.String(), qt.Contains, "Infohash: "+tt.InfoHash().HexString())
+	c.Check(get("/torrent/"+tt.InfoHash().HexString()+"?format=json").Header().Get("Content-Type"), qt.Equals, "application/json")
+	c.Check(get("/torrent/nope").Code, qt.Equals, http.StatusBadRequest)
+	c.Check(get("/json").Code, qt.Equals, http.StatusOK)
+	c.Check(get("/debug/vars").Code, qt.Equals, http.StatusOK)
+}
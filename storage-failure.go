@@ -0,0 +1,46 @@
+package torrent
+
+import (
+	"github.com/anacrolix/log"
+)
+
+// Describes a failed write to storage, such as a full disk or a permissions problem.
+type StorageFailureEvent struct {
+	Torrent *Torrent
+	Piece   int
+	Err     error
+}
+
+// Pauses data download so that every subsequent chunk isn't received only to fail the same way.
+// Only the first error is reported until the torrent is resumed with AllowDataDownload.
+func (t *Torrent) onStorageErr(piece pieceIndex, err error) {
+	if t.storageErr != nil {
+		return
+	}
+	t.storageErr = err
+	t.logger.WithDefaultLevel(log.Critical).Printf("pausing data download after storage error: %v", err)
+	t.disallowDataDownloadLocked()
+	t.publishStorageFailure(piece, err)
+}
+
+// The callbacks are run once the Client lock is released, so they may call methods on the Torrent.
+func (t *Torrent) publishStorageFailure(piece pieceIndex, err error) {
+	callbacks := t.cl.config.Callbacks.StorageFailed
+	if len(callbacks) == 0 {
+		return
+	}
+	e := StorageFailureEvent{t, piece, err}
+	t.cl._mu.DeferAfterUnlock(func() {
+		for _, f := range callbacks {
+			f(e)
+		}
+	})
+}
+
+// Returns the storage error that paused data download, or nil. Resume with AllowDataDownload once
+// the cause has been dealt with.
+func (t *Torrent) StorageError() error {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.storageErr
+}
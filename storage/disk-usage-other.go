@@ -0,0 +1,16 @@
+//go:build !unix
+
+package storage
+
+import (
+	"os"
+)
+
+// Sparse allocation isn't detected here, so this is the file's size.
+func fileDiskUsage(path string) (int64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
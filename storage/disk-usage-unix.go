@@ -0,0 +1,22 @@
+//go:build unix
+
+package storage
+
+import (
+	"os"
+	"syscall"
+)
+
+// Returns the space allocated to a file, which is less than its size if it's sparse.
+func fileDiskUsage(path string) (int64, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fi.Size(), nil
+	}
+	// st_blocks is in 512 byte units regardless of the filesystem block size.
+	return int64(st.Blocks) * 512, nil
+}
@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -88,8 +89,9 @@ func (fs fileClientImpl) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash
 		fs.opts.PieceCompletion,
 	}
 	return TorrentImpl{
-		Piece: t.Piece,
-		Close: t.Close,
+		Piece:     t.Piece,
+		Close:     t.Close,
+		DiskUsage: t.DiskUsage,
 	}, nil
 }
 
@@ -122,6 +124,24 @@ func (fs *fileTorrentImpl) Close() error {
 	return nil
 }
 
+// Sums the space allocated to the torrent's files. Files that haven't been created yet use none.
+func (fs *fileTorrentImpl) DiskUsage() (ret int64, err error) {
+	for _, f := range fs.files {
+		var n int64
+		n, err = fileDiskUsage(f.path)
+		if errors.Is(err, os.ErrNotExist) {
+			err = nil
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("file %q: %w", f.path, err)
+			return
+		}
+		ret += n
+	}
+	return
+}
+
 // A helper to create zero-length files which won't appear for file-orientated storage since no
 // writes will ever occur to them (no torrent data is associated with a zero-length file). The
 // caller should make sure the file name provided is safe/sanitized.
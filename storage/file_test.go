@@ -40,3 +40,28 @@ func TestShortFile(t *testing.T) {
 		t.Errorf("expected nil or EOF error from truncated piece, got %v", err)
 	}
 }
+
+func TestFileDiskUsage(t *testing.T) {
+	td := t.TempDir()
+	s := NewFile(td)
+	defer s.Close()
+	info := &metainfo.Info{
+		Name:        "a",
+		Length:      64 * missinggo.MiB,
+		PieceLength: missinggo.MiB,
+	}
+	ts, err := s.OpenTorrent(info, metainfo.Hash{})
+	require.NoError(t, err)
+	n, err := ts.DiskUsage()
+	require.NoError(t, err)
+	assert.EqualValues(t, 0, n)
+	p := info.Piece(63)
+	_, err = ts.Piece(p).WriteAt(make([]byte, p.Length()), 0)
+	require.NoError(t, err)
+	n, err = ts.DiskUsage()
+	require.NoError(t, err)
+	assert.NotZero(t, n)
+	// Only the last piece was written, so a filesystem with sparse files uses much less than the
+	// file's length.
+	assert.LessOrEqual(t, n, info.Length)
+}
@@ -33,6 +33,9 @@ type TorrentImpl struct {
 	// to determine the storage for torrents sharing the same function pointer, and mutated in
 	// place.
 	Capacity TorrentCapacity
+	// Optional. Returns the space the torrent's data occupies in storage. This can be less than the
+	// data's length, such as for sparse files that are only partly written.
+	DiskUsage func() (int64, error)
 }
 
 // Interacts with torrent piece data. Optional interfaces to implement include:
@@ -0,0 +1,131 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/anacrolix/log"
+)
+
+// Approximate size of the swarm as reported by trackers, or by a BEP 33 DHT scrape when no tracker
+// has given counts.
+type SwarmStats struct {
+	Seeders  int
+	Leechers int
+	// "tracker", "dht", or empty if no counts are known.
+	Source string
+}
+
+const (
+	dhtScrapeTimeout = time.Minute
+	// DHT scrapes after announces are limited to this often per torrent, as each is a traversal of
+	// its own.
+	dhtScrapeInterval = 30 * time.Minute
+)
+
+// Scrapes the DHT for approximate swarm counts, using each DHT server that supports it and keeping
+// the largest counts. The result is used in TorrentStats.Swarm when no tracker has given counts.
+func (t *Torrent) ScrapeDht(ctx context.Context) (ret DhtScrapeResult, err error) {
+	t.cl.rLock()
+	var scrapers []DhtScraper
+	t.cl.eachDhtServer(func(s DhtServer) {
+		if scraper, ok := s.(DhtScraper); ok {
+			scrapers = append(scrapers, scraper)
+		}
+	})
+	t.cl.rUnlock()
+	return t.scrapeDht(ctx, scrapers)
+}
+
+func (t *Torrent) scrapeDht(ctx context.Context, scrapers []DhtScraper) (ret DhtScrapeResult, err error) {
+	if len(scrapers) == 0 {
+		err = errors.New("no DHT servers support scraping")
+		return
+	}
+	ih := *t.canonicalShortInfohash()
+	var errs []error
+	for _, s := range scrapers {
+		res, scrapeErr := s.Scrape(ctx, ih)
+		if scrapeErr != nil {
+			errs = append(errs, scrapeErr)
+			continue
+		}
+		ret.Seeders = maxInt(ret.Seeders, res.Seeders)
+		ret.Leechers = maxInt(ret.Leechers, res.Leechers)
+	}
+	if len(errs) == len(scrapers) {
+		err = errors.Join(errs...)
+		return
+	}
+	t.cl.lock()
+	t.lastDhtScrape.Set(ret)
+	t.cl.unlock()
+	return
+}
+
+// Returns the largest counts given in successful tracker announces.
+func (t *Torrent) trackerSwarmStats() (ret SwarmStats, ok bool) {
+	for _, ta := range t.trackerAnnouncers {
+		ts, isScraper := ta.(*trackerScraper)
+		if !isScraper {
+			continue
+		}
+		ar := ts.lastAnnounce
+		if ar.Err != nil || ar.Completed.IsZero() {
+			continue
+		}
+		ok = true
+		ret.Seeders = maxInt(ret.Seeders, ar.Seeders)
+		ret.Leechers = maxInt(ret.Leechers, ar.Leechers)
+	}
+	if ok {
+		ret.Source = "tracker"
+	}
+	return
+}
+
+func (t *Torrent) swarmStats() SwarmStats {
+	if ret, ok := t.trackerSwarmStats(); ok {
+		return ret
+	}
+	if t.lastDhtScrape.Ok {
+		return SwarmStats{
+			Seeders:  t.lastDhtScrape.Value.Seeders,
+			Leechers: t.lastDhtScrape.Value.Leechers,
+			Source:   "dht",
+		}
+	}
+	return SwarmStats{}
+}
+
+// Scrapes the DHT server after announces if trackers haven't provided swarm counts, and it's been
+// dhtScrapeInterval since the last scrape. Called without the Client lock.
+func (t *Torrent) maybeScrapeDht(s DhtServer) {
+	scraper, ok := s.(DhtScraper)
+	if !ok {
+		return
+	}
+	t.cl.lock()
+	_, haveTrackerCounts := t.trackerSwarmStats()
+	now := t.cl.clock().Now()
+	if haveTrackerCounts || now.Before(t.dhtScrapeNotBefore) {
+		t.cl.unlock()
+		return
+	}
+	t.dhtScrapeNotBefore = now.Add(dhtScrapeInterval)
+	t.cl.unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), dhtScrapeTimeout)
+	defer cancel()
+	go func() {
+		select {
+		case <-t.closed.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	_, err := t.scrapeDht(ctx, []DhtScraper{scraper})
+	if err != nil {
+		t.logger.Levelf(log.Debug, "scraping DHT: %v", err)
+	}
+}
@@ -0,0 +1,137 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/anacrolix/dht/v2"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+type testDhtScraper struct {
+	res DhtScrapeResult
+	err error
+}
+
+func (me testDhtScraper) Scrape(context.Context, [20]byte) (DhtScrapeResult, error) {
+	return me.res, me.err
+}
+
+func TestSwarmStatsFromDhtScrape(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	c.Check(tt.Stats().Swarm, qt.Equals, SwarmStats{})
+	res, err := tt.scrapeDht(context.Background(), []DhtScraper{
+		testDhtScraper{res: DhtScrapeResult{Seeders: 3, Leechers: 10}},
+		testDhtScraper{res: DhtScrapeResult{Seeders: 5, Leechers: 2}},
+		testDhtScraper{err: errors.New("timed out")},
+	})
+	c.Assert(err, qt.IsNil)
+	c.Check(res, qt.Equals, DhtScrapeResult{Seeders: 5, Leechers: 10})
+	c.Check(tt.Stats().Swarm, qt.Equals, SwarmStats{Seeders: 5, Leechers: 10, Source: "dht"})
+}
+
+type testDhtScraperServer struct {
+	DhtServer
+	testDhtScraper
+	scrapes *int
+}
+
+func (me testDhtScraperServer) Scrape(ctx context.Context, ih [20]byte) (DhtScrapeResult, error) {
+	*me.scrapes++
+	return me.testDhtScraper.Scrape(ctx, ih)
+}
+
+func TestDhtScrapeAfterAnnounceRateLimited(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	var scrapes int
+	s := testDhtScraperServer{scrapes: &scrapes}
+	tt.maybeScrapeDht(s)
+	tt.maybeScrapeDht(s)
+	c.Check(scrapes, qt.Equals, 1)
+	cl.lock()
+	tt.dhtScrapeNotBefore = time.Time{}
+	cl.unlock()
+	tt.maybeScrapeDht(s)
+	c.Check(scrapes, qt.Equals, 2)
+}
+
+type closedDhtAnnounce struct{}
+
+func (closedDhtAnnounce) Close() {}
+
+func (closedDhtAnnounce) Peers() <-chan dht.PeersValues {
+	ch := make(chan dht.PeersValues)
+	close(ch)
+	return ch
+}
+
+// Reports announces, and blocks scrapes until released.
+type blockingDhtScrapeServer struct {
+	DhtServer
+	announces     chan struct{}
+	scrapeStarted chan struct{}
+	release       chan struct{}
+}
+
+func (me *blockingDhtScrapeServer) Announce([20]byte, int, bool) (DhtAnnounce, error) {
+	select {
+	case me.announces <- struct{}{}:
+	case <-me.release:
+	}
+	return closedDhtAnnounce{}, nil
+}
+
+func (me *blockingDhtScrapeServer) Scrape(ctx context.Context, _ [20]byte) (DhtScrapeResult, error) {
+	select {
+	case me.scrapeStarted <- struct{}{}:
+	default:
+	}
+	select {
+	case <-me.release:
+	case <-ctx.Done():
+	}
+	return DhtScrapeResult{}, errors.New("released")
+}
+
+func TestDhtScrapeDoesntBlockAnnounces(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	// Skips the wait between announces.
+	cfg.Clock = &skippingClock{now: time.Unix(1000, 0)}
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	// Announces are only made while the torrent wants peers.
+	tt.DownloadAll()
+	s := &blockingDhtScrapeServer{
+		announces:     make(chan struct{}),
+		scrapeStarted: make(chan struct{}, 1),
+		release:       make(chan struct{}),
+	}
+	defer close(s.release)
+	tt.goBackground(func() { tt.dhtAnnouncer(s) })
+	receive := func(ch chan struct{}, what string) {
+		select {
+		case <-ch:
+		case <-time.After(10 * time.Second):
+			c.Fatalf("timed out waiting for %v", what)
+		}
+	}
+	receive(s.announces, "first announce")
+	receive(s.scrapeStarted, "scrape")
+	// The scrape is still blocked, but announces continue.
+	receive(s.announces, "second announce")
+	receive(s.announces, "third announce")
+}
@@ -1,14 +1,18 @@
 package torrent
 
 import (
+	"context"
+	"errors"
 	"strconv"
 	"strings"
 
 	"github.com/anacrolix/chansync/events"
+	g "github.com/anacrolix/generics"
 	"github.com/anacrolix/missinggo/v2/pubsub"
 	"github.com/anacrolix/sync"
 
 	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
 )
 
 // The Torrent's infohash. This is fixed and cannot change. It uniquely identifies a torrent.
@@ -94,7 +98,10 @@ func (t *Torrent) PieceBytesMissing(piece int) int64 {
 
 // Drop the torrent from the client, and close it. It's always safe to do
 // this. No data corruption can, or should occur to either the torrent's data,
-// or connected peers.
+// or connected peers. Blocks until the torrent's background work, such as
+// announces, piece hashing and peer connections, has stopped. Callbacks and
+// hooks may be run by that work, so calling Drop from them deadlocks: call it
+// from a new goroutine instead.
 func (t *Torrent) Drop() {
 	var wg sync.WaitGroup
 	defer wg.Wait()
@@ -116,6 +123,102 @@ func (t *Torrent) BytesCompleted() int64 {
 	return t.bytesCompleted()
 }
 
+// Number of bytes in wanted pieces that aren't complete. With selective downloads, this is what
+// remains of the download, while BytesMissing includes pieces that aren't wanted.
+func (t *Torrent) BytesWantedMissing() (n int64) {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	t._pendingPieces.Iterate(func(x uint32) bool {
+		p := t.piece(pieceIndex(x))
+		if !t.pieceComplete(pieceIndex(x)) {
+			n += int64(p.length() - p.numDirtyBytes())
+		}
+		return true
+	})
+	return
+}
+
+var ErrTorrentClosed = errors.New("torrent closed")
+
+// Blocks until all the torrent's pieces are complete, which is when Complete turns on. Returns
+// ErrTorrentClosed if the torrent is closed first, or the cause if ctx is done first. To wait in a
+// select, use Complete.On and Closed directly.
+func (t *Torrent) Wait(ctx context.Context) error {
+	select {
+	case <-t.Complete.On():
+		return nil
+	default:
+	}
+	select {
+	case <-t.Complete.On():
+		return nil
+	case <-t.Closed():
+		return ErrTorrentClosed
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+// Returned when a Torrent option can only be changed before the info is available.
+var ErrInfoAlreadyKnown = errors.New("torrent info already known")
+
+// Replaces the storage for the torrent's data, such as to choose the download directory for a
+// magnet link before its info arrives. As with TorrentSpec.Storage, the Client doesn't close it.
+// Returns ErrInfoAlreadyKnown once the info is available, as storage is opened with it.
+func (t *Torrent) SetStorage(impl storage.ClientImpl) error {
+	t.cl.lock()
+	defer t.cl.unlock()
+	if t.haveInfo() {
+		return ErrInfoAlreadyKnown
+	}
+	t.storageOpener = storage.NewClient(impl)
+	return nil
+}
+
+// Sets the priorities of files by their index in the info, as for File.SetPriority. Before the
+// info is available, the priorities are kept and applied along with it, so they're in effect
+// before any data is requested. Later calls replace the priorities given for the same files.
+func (t *Torrent) SetFilePriorities(prios map[int]piecePriority) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	if !t.haveInfo() {
+		g.MakeMapIfNil(&t.pendingFilePriorities)
+		for i, prio := range prios {
+			t.pendingFilePriorities[i] = prio
+		}
+		return
+	}
+	for i, prio := range prios {
+		if i < 0 || i >= len(*t.files) {
+			continue
+		}
+		f := (*t.files)[i]
+		if f.prio != prio {
+			f.prio = prio
+			t.updatePiecePriorities(f.BeginPieceIndex(), f.EndPieceIndex(), "Torrent.SetFilePriorities")
+		}
+	}
+}
+
+var ErrStorageDiskUsageUnsupported = errors.New("storage doesn't report disk usage")
+
+// Returns the space the torrent's data occupies in storage. With sparse files, only data that has
+// been written takes up space, so this can be much less than the torrent's length. It's usually more
+// than BytesCompleted, due to filesystem block sizes and data written for pieces that failed their
+// hash checks. Returns ErrStorageDiskUsageUnsupported if the storage doesn't report it.
+func (t *Torrent) BytesOnDisk() (int64, error) {
+	t.cl.rLock()
+	ts := t.storage
+	t.cl.rUnlock()
+	if ts == nil {
+		return 0, nil
+	}
+	if ts.DiskUsage == nil {
+		return 0, ErrStorageDiskUsageUnsupported
+	}
+	return ts.DiskUsage()
+}
+
 // The subscription emits as (int) the index of pieces as their state changes.
 // A state change is when the PieceState for a piece alters in value.
 func (t *Torrent) SubscribePieceStateChanges() *pubsub.Subscription[PieceStateChange] {
@@ -132,7 +235,8 @@ func (t *Torrent) Seeding() (ret bool) {
 }
 
 // Clobbers the torrent display name if metainfo is unavailable.
-// The display name is used as the torrent name while the metainfo is unavailable.
+// The display name is used as the torrent name while the metainfo is unavailable. See also
+// SetStorage and SetFilePriorities for other choices that can be made before the metainfo arrives.
 func (t *Torrent) SetDisplayName(dn string) {
 	t.nameMu.Lock()
 	if !t.haveInfo() {
@@ -193,6 +297,33 @@ func (t *Torrent) downloadPiecesLocked(begin, end pieceIndex) {
 	}
 }
 
+// Sets the priority of a piece, overriding file priorities, Piece.SetPriority, DownloadPieces and
+// CancelPieces until ClearPiecePriority is called. Readers can still raise the priority of pieces
+// they're waiting on. Returns an error if the info hasn't been obtained, or the piece is out of
+// range.
+func (t *Torrent) SetPiecePriority(piece pieceIndex, prio piecePriority) error {
+	t.cl.lock()
+	defer t.cl.unlock()
+	if err := t.checkPieceIndex(piece); err != nil {
+		return err
+	}
+	t.pieces[piece].pinnedPriority.Set(prio)
+	t.updatePiecePriority(piece, "Torrent.SetPiecePriority")
+	return nil
+}
+
+// Removes a priority set by SetPiecePriority.
+func (t *Torrent) ClearPiecePriority(piece pieceIndex) error {
+	t.cl.lock()
+	defer t.cl.unlock()
+	if err := t.checkPieceIndex(piece); err != nil {
+		return err
+	}
+	t.pieces[piece].pinnedPriority.SetNone()
+	t.updatePiecePriority(piece, "Torrent.ClearPiecePriority")
+	return nil
+}
+
 func (t *Torrent) CancelPieces(begin, end pieceIndex) {
 	t.cl.lock()
 	t.cancelPiecesLocked(begin, end, "Torrent.CancelPieces")
@@ -224,6 +355,7 @@ func (t *Torrent) initFiles() {
 			fi.DisplayPath(info),
 			PiecePriorityNone,
 			fi.PiecesRoot,
+			fileChecksumState{},
 		})
 		offset += fi.Length
 		if info.FilesArePieceAligned() {
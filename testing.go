@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/anacrolix/log"
+	"golang.org/x/time/rate"
 
 	pp "github.com/anacrolix/torrent/peer_protocol"
 )
@@ -17,6 +18,8 @@ func TestingConfig(t testing.TB) *ClientConfig {
 	cfg.DisableTrackers = true
 	cfg.NoDefaultPortForwarding = true
 	cfg.DisableAcceptRateLimiting = true
+	// Tests dial the same loopback peers repeatedly, faster than the default limit allows.
+	cfg.DialRateLimiter = rate.NewLimiter(rate.Inf, 0)
 	cfg.ListenPort = 0
 	cfg.KeepAliveTimeout = time.Millisecond
 	cfg.MinPeerExtensions.SetBit(pp.ExtensionBitFast, true)
@@ -0,0 +1,40 @@
+package torrent
+
+import "context"
+
+// Registers a unit of background work for the Torrent, so that closing it waits for the work to
+// finish. Returns false if the Torrent is already closed, in which case the work shouldn't start.
+// The Client lock must be held. Call backgroundWork.Done when the work ends.
+func (t *Torrent) addBackgroundWork() bool {
+	if t.closed.IsSet() {
+		return false
+	}
+	t.backgroundWork.Add(1)
+	return true
+}
+
+// Runs f in a goroutine tracked by the Torrent's backgroundWork. f isn't run if the Torrent is
+// closed. The Client lock must be held.
+func (t *Torrent) goBackground(f func()) {
+	if !t.addBackgroundWork() {
+		return
+	}
+	go func() {
+		defer t.backgroundWork.Done()
+		f()
+	}()
+}
+
+// Returns a Context derived from parent that's also cancelled when the Torrent is closed, so that
+// background work such as dials and handshakes doesn't hold up closing.
+func (t *Torrent) closedContext(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	go func() {
+		select {
+		case <-t.closed.Done():
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,69 @@
+package torrent
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestDropWaitsForBackgroundWork(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt, _ := cl.AddTorrentInfoHash(metainfo.Hash{1})
+	started := make(chan struct{})
+	finished := false
+	cl.lock()
+	tt.goBackground(func() {
+		close(started)
+		<-tt.Closed()
+		// Needs the Client lock, so it can't finish until Drop releases it.
+		cl.lock()
+		defer cl.unlock()
+		finished = true
+	})
+	cl.unlock()
+	<-started
+	tt.Drop()
+	c.Check(finished, qt.IsTrue)
+	cl.lock()
+	defer cl.unlock()
+	c.Check(tt.addBackgroundWork(), qt.IsFalse)
+	tt.goBackground(func() {
+		panic("started after close")
+	})
+}
+
+func TestDropCancelsHandshakes(t *testing.T) {
+	c := qt.New(t)
+	l, err := net.Listen("tcp4", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		// Accepts and never responds, so the handshake waits.
+		nc, err := l.Accept()
+		if err == nil {
+			accepted <- nc
+		}
+	}()
+	cfg := TestingConfig(t)
+	cfg.DisableUTP = true
+	cfg.HandshakesTimeout = time.Hour
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, _ := cl.AddTorrentInfoHash(metainfo.Hash{1})
+	tt.AddPeers([]PeerInfo{{
+		Addr:   ipPortAddr{IP: net.IPv4(127, 0, 0, 1), Port: l.Addr().(*net.TCPAddr).Port},
+		Source: PeerSourceDirect,
+	}})
+	nc := <-accepted
+	defer nc.Close()
+	started := time.Now()
+	tt.Drop()
+	c.Check(time.Since(started) < 10*time.Second, qt.IsTrue)
+}
@@ -0,0 +1,45 @@
+package torrent
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+type recordingStorage struct {
+	storage.ClientImpl
+	opened int
+}
+
+func (me *recordingStorage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	me.opened++
+	return me.ClientImpl.OpenTorrent(info, infoHash)
+}
+
+func TestOptionsSetBeforeInfo(t *testing.T) {
+	c := qt.New(t)
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	mi := testutil.GreetingMetaInfo()
+	tt, _ := cl.AddTorrentInfoHash(mi.HashInfoBytes())
+	tt.SetDisplayName("chosen name")
+	st := &recordingStorage{ClientImpl: storage.NewFile(t.TempDir())}
+	c.Assert(tt.SetStorage(st), qt.IsNil)
+	tt.SetFilePriorities(map[int]piecePriority{0: PiecePriorityNone, 5: PiecePriorityHigh})
+	c.Check(tt.Name(), qt.Equals, "chosen name")
+
+	c.Assert(tt.SetInfoBytes(mi.InfoBytes), qt.IsNil)
+	c.Check(st.opened, qt.Equals, 1)
+	c.Check(tt.Files()[0].Priority(), qt.Equals, PiecePriorityNone)
+	c.Check(tt.PieceState(0).Priority, qt.Equals, PiecePriorityNone)
+	c.Check(tt.SetStorage(st), qt.Equals, ErrInfoAlreadyKnown)
+
+	// Once the info is known, priorities apply immediately.
+	tt.SetFilePriorities(map[int]piecePriority{0: PiecePriorityNormal})
+	c.Check(tt.Files()[0].Priority(), qt.Equals, PiecePriorityNormal)
+}
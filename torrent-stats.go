@@ -14,4 +14,24 @@ type TorrentStats struct {
 	ConnectedSeeders int
 	HalfOpenPeers    int
 	PiecesComplete   int
+
+	// Pieces waiting for a hasher, and pieces being hashed now.
+	PiecesQueuedForHash int
+	PiecesHashing       int
+
+	// Estimated swarm size from trackers or the DHT.
+	Swarm SwarmStats
+
+	// Piece availability from connected peers. Zero until the info is known.
+	Availability PieceAvailabilityStats
+
+	// Rolling transfer rates over all connections.
+	Rates TransferRates
+
+	// Totals including previous sessions, if ClientConfig.TorrentStatsStore is set. Previous
+	// sessions aren't included until they've been loaded, shortly after the torrent is added.
+	AllTime PersistedTorrentStats
+
+	// Error and backoff state per webseed URL, sorted by URL.
+	Webseeds []WebseedStats
 }
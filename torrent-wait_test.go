@@ -0,0 +1,42 @@
+package torrent
+
+import (
+	"context"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestTorrentWait(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt, _ := cl.AddTorrentInfoHash(metainfo.Hash{1})
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	c.Check(tt.Wait(ctx), qt.ErrorIs, context.Canceled)
+	tt.Complete.Set()
+	c.Check(tt.Wait(ctx), qt.IsNil)
+	tt.Complete.Clear()
+	tt.Drop()
+	c.Check(tt.Wait(context.Background()), qt.ErrorIs, ErrTorrentClosed)
+}
+
+func TestWaitAllIgnoresDroppedTorrents(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt, _ := cl.AddTorrentInfoHash(metainfo.Hash{1})
+	done := make(chan bool)
+	go func() {
+		done <- cl.WaitAll()
+	}()
+	tt.Drop()
+	c.Check(<-done, qt.IsTrue)
+	cl.AddTorrentInfoHash(metainfo.Hash{2})
+	go func() {
+		done <- cl.WaitAll()
+	}()
+	cl.Close()
+	c.Check(<-done, qt.IsFalse)
+}
@@ -9,11 +9,11 @@ import (
 	"fmt"
 	"hash"
 	"io"
-	"math/rand"
 	"net/netip"
 	"net/url"
 	"sort"
 	"strings"
+	"sync/atomic"
 	"text/tabwriter"
 	"time"
 	"unsafe"
@@ -58,16 +58,52 @@ type Torrent struct {
 	// Torrent-level aggregate statistics. First in struct to ensure 64-bit
 	// alignment. See #262.
 	stats  ConnStats
+	rates  transferRateMeters
 	cl     *Client
 	logger log.Logger
 
+	// Transfer totals from previous sessions, from ClientConfig.TorrentStatsStore.
+	persistedStats PersistedTorrentStats
+	// Chunks journaled since the journal was last compacted.
+	chunkJournalAppends   atomic.Int64
+	chunkJournalCompactMu sync.Mutex
+	// Closed when persistedStats has been loaded.
+	persistedStatsLoaded <-chan struct{}
+	// Set if loading failed, so saves don't overwrite the stored totals with this session's.
+	persistedStatsLoadFailed bool
+	persistedStatsSaveMu     sync.Mutex
+	// Set by SetLiveWindow to request pieces in order for live content.
+	liveWindow g.Option[liveWindow]
+	// Progress of pieces queued by VerifyData.
+	verifyProgress verifyProgress
+	// The most recent successful BEP 33 scrape. See ScrapeDht.
+	lastDhtScrape g.Option[DhtScrapeResult]
+	// Scrapes after DHT announces aren't done again until then.
+	dhtScrapeNotBefore time.Time
+
 	networkingEnabled      chansync.Flag
 	dataDownloadDisallowed chansync.Flag
 	dataUploadDisallowed   bool
 	userOnWriteChunkErr    func(error)
+	// The storage error that paused data download. Cleared by AllowDataDownload.
+	storageErr error
+	// See Torrent.DisallowEncryptedIncoming.
+	encryptedIncomingDisallowed bool
+	// See Torrent.SetAnnounceOverrides.
+	announceOverrides AnnounceOverrides
+	// Outcomes of dialing peer addresses, by address. See Torrent.reservePeerScore.
+	peerDialHistory map[string]peerDialHistory
+	// Set when the wanted pieces finish downloading. Trackers are sent a completed event when
+	// this occurs.
+	downloadCompleted chansync.SetOnce
+	// Whether any piece received from peers has passed its hash check.
+	piecesDownloaded bool
 
 	closed  chansync.SetOnce
 	onClose []func()
+	// Goroutines doing work for the Torrent, such as announcing, hashing and running connections.
+	// Closing waits for them. See goBackground.
+	backgroundWork sync.WaitGroup
 
 	infoHash   g.Option[metainfo.Hash]
 	infoHashV2 g.Option[infohash_v2.T]
@@ -132,10 +168,18 @@ type Torrent struct {
 	// the info bytes aren't initially available, and we try to fetch them
 	// from peers.
 	metadataBytes []byte
+	// The metainfo encoding field, used to decode names in the info that aren't UTF-8.
+	infoEncoding string
 	// Each element corresponds to the 16KiB metadata pieces. If true, we have
 	// received that piece.
 	metadataCompletedChunks []bool
-	metadataChanged         sync.Cond
+	// The metadata size from peers, while allocating it is deferred by MaxMetadataBytesInFlight.
+	deferredMetadataSize int
+	// The metadataBytes counted in Client.metadataBytesInFlight.
+	metadataInFlight int
+	metadataChanged  sync.Cond
+	// Metadata isn't requested from peers while ClientConfig.LookupInfoBytes is running.
+	infoLookupPending bool
 
 	// Closed when .Info is obtained.
 	gotMetainfoC chan struct{}
@@ -153,10 +197,19 @@ type Torrent struct {
 	piecesQueuedForHash       bitmap.Bitmap
 	activePieceHashes         int
 	initialPieceCheckDisabled bool
+	// See TorrentSpec.SeedMode.
+	seedMode bool
+	// BEP 53 file indices to download once the info is available.
+	selectOnlyFiles []int
+	// File priorities given with SetFilePriorities before the info was available, by file index.
+	pendingFilePriorities map[int]piecePriority
 
 	connsWithAllPieces map[*Peer]struct{}
 
 	requestState map[RequestIndex]requestState
+	// The number of peers that each request was cancelled with that haven't acknowledged it yet.
+	// The chunk may still arrive from them.
+	cancelledRequests map[RequestIndex]int
 	// Chunks we've written to since the corresponding piece was last checked.
 	dirtyChunks typedRoaring.Bitmap[RequestIndex]
 
@@ -270,6 +323,7 @@ func (t *Torrent) KnownSwarm() (ks []PeerInfo) {
 			// > connection. It's probably easiest to do the latter for now.
 			// https://github.com/anacrolix/torrent/pull/188
 			SupportsEncryption: conn.headerEncrypted,
+			PexPeerFlags:       conn.DiscoveryFlags,
 		})
 	}
 
@@ -519,6 +573,7 @@ func (t *Torrent) setInfo(info *metainfo.Info) error {
 	t.updateComplete()
 	t.displayName = "" // Save a few bytes lol.
 	t.initFiles()
+	t.applyPendingFilePriorities()
 	t.cacheLength()
 	t.makePieces()
 	return nil
@@ -533,9 +588,10 @@ func (t *Torrent) pieceRequestOrderKey(i int) request_strategy.PieceRequestOrder
 
 // This seems to be all the follow-up tasks after info is set, that can't fail.
 func (t *Torrent) onSetInfo() {
-	t.pieceRequestOrder = rand.Perm(t.numPieces())
+	t.pieceRequestOrder = t.cl.rand.Perm(t.numPieces())
 	t.initPieceRequestOrder()
 	MakeSliceWithLength(&t.requestPieceStates, t.numPieces())
+	journaled := t.readChunkJournal()
 	for i := range t.pieces {
 		p := &t.pieces[i]
 		// Need to add relativeAvailability before updating piece completion, as that may result in conns
@@ -545,18 +601,59 @@ func (t *Torrent) onSetInfo() {
 		}
 		p.relativeAvailability = t.selectivePieceAvailabilityFromPeers(i)
 		t.addRequestOrderPiece(i)
+		if t.seedMode {
+			t.seedModeMarkComplete(i)
+		}
 		t.updatePieceCompletion(i)
-		t.queueInitialPieceCheck(i)
+		if !t.restoreJournaledChunks(i, journaled[i]) {
+			t.queueInitialPieceCheck(i)
+		}
 	}
 	t.cl.event.Broadcast()
 	close(t.gotMetainfoC)
 	t.updateWantPeersEvent()
 	t.requestState = make(map[RequestIndex]requestState)
+	t.cancelledRequests = make(map[RequestIndex]int)
 	t.tryCreateMorePieceHashers()
 	t.iterPeers(func(p *Peer) {
 		p.onGotInfo(t.info)
 		p.updateRequests("onSetInfo")
 	})
+	t.applySelectOnlyFiles()
+	// Our metadata is no longer in flight.
+	delete(t.cl.deferredMetadataTorrents, t)
+	if t.metadataInFlight != 0 {
+		t.setMetadataInFlight(0)
+		t.cl.retryDeferredMetadataAllocs()
+	}
+}
+
+// Sets the file priorities given before the info was available. This is done before anything uses
+// the piece priorities, so they're in effect from the start.
+func (t *Torrent) applyPendingFilePriorities() {
+	for i, prio := range t.pendingFilePriorities {
+		if i < 0 || i >= len(*t.files) {
+			t.logger.Levelf(log.Warning, "file priority index %v out of range", i)
+			continue
+		}
+		(*t.files)[i].prio = prio
+	}
+	t.pendingFilePriorities = nil
+}
+
+// Gives the BEP 53 selected files normal priority. Files are indexed in the order they appear in
+// the info.
+func (t *Torrent) applySelectOnlyFiles() {
+	for _, i := range t.selectOnlyFiles {
+		if i < 0 || i >= len(*t.files) {
+			t.logger.Levelf(log.Warning, "select only file index %v out of range", i)
+			continue
+		}
+		f := (*t.files)[i]
+		if f.prio.Raise(PiecePriorityNormal) {
+			t.updatePiecePriorities(f.BeginPieceIndex(), f.EndPieceIndex(), "select only")
+		}
+	}
 }
 
 // Checks the info bytes hash to expected values. Fills in any missing infohashes.
@@ -568,7 +665,7 @@ func (t *Torrent) hashInfoBytes(b []byte, info *metainfo.Info) error {
 		if v1Hash == t.infoHash.Value {
 			if info.HasV2() {
 				t.infoHashV2.Set(v2Hash)
-				cl.torrentsByShortHash[*v2Hash.ToShort()] = t
+				cl.setTorrentShortHash(*v2Hash.ToShort(), t)
 			}
 		} else if *v2Hash.ToShort() == t.infoHash.Value {
 			if !info.HasV2() {
@@ -577,7 +674,7 @@ func (t *Torrent) hashInfoBytes(b []byte, info *metainfo.Info) error {
 			t.infoHashV2.Set(v2Hash)
 			t.infoHash.SetNone()
 			if info.HasV1() {
-				cl.torrentsByShortHash[v1Hash] = t
+				cl.setTorrentShortHash(v1Hash, t)
 				t.infoHash.Set(v1Hash)
 			}
 		}
@@ -594,7 +691,7 @@ func (t *Torrent) hashInfoBytes(b []byte, info *metainfo.Info) error {
 		}
 		if info.HasV1() {
 			t.infoHash.Set(v1Hash)
-			cl.torrentsByShortHash[v1Hash] = t
+			cl.setTorrentShortHash(v1Hash, t)
 		}
 	} else {
 		panic("no expected infohashes")
@@ -614,11 +711,15 @@ func (t *Torrent) setInfoBytesLocked(b []byte) (err error) {
 	if err != nil {
 		return
 	}
+	if err := info.DecodeNames(t.infoEncoding); err != nil {
+		t.logger.WithDefaultLevel(log.Warning).Printf("using undecoded names: %v", err)
+	}
 	t.metadataBytes = b
 	t.metadataCompletedChunks = nil
 	if t.info != nil {
 		return nil
 	}
+	t.setMetadataInFlight(len(b))
 	if err := t.setInfo(&info); err != nil {
 		return err
 	}
@@ -653,7 +754,18 @@ func (t *Torrent) setMetadataSize(size int) (err error) {
 	if len(t.metadataBytes) == size {
 		return
 	}
+	if !t.metadataAllocAllowed(size) {
+		torrent.Add("metadata allocations deferred", 1)
+		t.logger.Levelf(log.Debug, "deferring allocating %v bytes for metadata", size)
+		t.deferredMetadataSize = size
+		g.MakeMapIfNil(&t.cl.deferredMetadataTorrents)
+		t.cl.deferredMetadataTorrents[t] = struct{}{}
+		return
+	}
+	t.deferredMetadataSize = 0
+	delete(t.cl.deferredMetadataTorrents, t)
 	t.metadataBytes = make([]byte, size)
+	t.setMetadataInFlight(size)
 	t.metadataCompletedChunks = make([]bool, (size+(1<<14)-1)/(1<<14))
 	t.metadataChanged.Broadcast()
 	for c := range t.conns {
@@ -684,6 +796,7 @@ func (t *Torrent) pieceState(index pieceIndex) (ret PieceState) {
 	ret.Hashing = p.hashing
 	ret.Checking = ret.QueuedForHash || ret.Hashing
 	ret.Marking = p.marking
+	ret.LastError = p.lastErr
 	if !ret.Complete && t.piecePartiallyDownloaded(index) {
 		ret.Partial = true
 	}
@@ -760,6 +873,8 @@ func (psr PieceStateRun) String() (ret string) {
 			return "N"
 		case PiecePriorityNormal:
 			return "."
+		case PiecePriorityLow:
+			return "L"
 		case PiecePriorityReadahead:
 			return "R"
 		case PiecePriorityNow:
@@ -802,6 +917,9 @@ func (t *Torrent) writeStatus(w io.Writer) {
 		fmt.Fprintf(w, "Infohash v2: %s\n", t.infoHashV2.Value.HexString())
 	}
 	fmt.Fprintf(w, "Metadata length: %d\n", t.metadataSize())
+	if t.storageErr != nil {
+		fmt.Fprintf(w, "Paused by storage error: %v\n", t.storageErr)
+	}
 	if !t.haveInfo() {
 		fmt.Fprintf(w, "Metadata have: ")
 		for _, h := range t.metadataCompletedChunks {
@@ -828,6 +946,7 @@ func (t *Torrent) writeStatus(w io.Writer) {
 	)
 	if t.info != nil {
 		fmt.Fprintf(w, "Num Pieces: %d (%d completed)\n", t.numPieces(), t.numPiecesCompleted())
+		fmt.Fprintf(w, "Piece hashing: %d active, %d queued\n", t.activePieceHashes, t.piecesQueuedForHash.Len())
 		fmt.Fprintf(w, "Piece States: %s\n", t.pieceStateRuns())
 		// Generates a huge, unhelpful listing when piece availability is very scattered. Prefer
 		// availability frequencies instead.
@@ -873,7 +992,7 @@ func (t *Torrent) writeStatus(w io.Writer) {
 			ml.StrictNext(lu.String() == ru.String(), lu.String() < ru.String())
 			return ml.Less()
 		}).([]torrentTrackerAnnouncer) {
-			fmt.Fprintf(tw, "    %q\t%v\n", ta.URL(), ta.statusLine())
+			fmt.Fprintf(tw, "    %q\t%v\n", t.cl.redactTracker(ta.URL().String()), t.cl.redactTracker(ta.statusLine()))
 		}
 		tw.Flush()
 	}()
@@ -917,6 +1036,17 @@ func (t *Torrent) writePeerStatuses(w io.Writer, peers []*Peer) {
 	}
 }
 
+// Checks that a piece index from outside the package refers to a piece of the info.
+func (t *Torrent) checkPieceIndex(piece pieceIndex) error {
+	if !t.haveInfo() {
+		return errors.New("torrent info not available")
+	}
+	if piece < 0 || piece >= t.numPieces() {
+		return fmt.Errorf("piece index %v out of range [0, %v)", piece, t.numPieces())
+	}
+	return nil
+}
+
 func (t *Torrent) haveInfo() bool {
 	return t.info != nil
 }
@@ -1013,6 +1143,21 @@ func (t *Torrent) close(wg *sync.WaitGroup) (err error) {
 	for _, f := range t.onClose {
 		f()
 	}
+	t.cl.uploadReadCache.removeTorrent(t)
+	if saved := t.savePersistedStats(); saved != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-saved
+		}()
+	}
+	if compacted := t.compactChunkJournal(); compacted != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-compacted
+		}()
+	}
 	if t.storage != nil {
 		wg.Add(1)
 		go func() {
@@ -1038,6 +1183,12 @@ func (t *Torrent) close(wg *sync.WaitGroup) (err error) {
 	t.cl.event.Broadcast()
 	t.pieceStateChanges.Close()
 	t.updateWantPeersEvent()
+	// Background work may need the Client lock to finish, so the caller waits after releasing it.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t.backgroundWork.Wait()
+	}()
 	return
 }
 
@@ -1139,9 +1290,10 @@ func (t *Torrent) hashPiece(piece pieceIndex) (
 	p.waitNoPendingWrites()
 	storagePiece := p.Storage()
 
+	hasher := t.cl.pieceHashImpl()
 	var h hash.Hash
 	if p.hash != nil {
-		h = pieceHash.New()
+		h = hasher.NewV1()
 
 		// Does the backend want to do its own hashing?
 		if i, ok := storagePiece.PieceImpl.(storage.SelfHashing); ok {
@@ -1155,7 +1307,7 @@ func (t *Torrent) hashPiece(piece pieceIndex) (
 		}
 
 	} else if p.hashV2.Ok {
-		h = merkle.NewHash()
+		h = merkle.NewHashFromBlockHash(hasher.NewV2Block())
 	} else {
 		panic("no hash")
 	}
@@ -1181,7 +1333,9 @@ func (t *Torrent) hashPiece(piece pieceIndex) (
 		var sum [20]byte
 		n := len(h.Sum(sum[:0]))
 		if n != 20 {
-			panic(n)
+			// Hashers can be provided by the user, so don't trust them.
+			err = fmt.Errorf("piece hasher returned %v byte sum", n)
+			return
 		}
 		correct = sum == *p.hash
 	} else if p.hashV2.Ok {
@@ -1208,6 +1362,12 @@ func (t *Torrent) haveAllPieces() bool {
 	return t._completedPieces.GetCardinality() == bitmap.BitRange(t.numPieces())
 }
 
+// Whether we have every piece we want, but not all of them, such as when only some files are
+// selected. This makes us a partial seed per BEP 21. There's nothing to seed if we have no pieces.
+func (t *Torrent) partialSeed() bool {
+	return t.haveInfo() && t.haveAnyPieces() && !t.haveAllPieces() && t._pendingPieces.IsEmpty()
+}
+
 func (t *Torrent) havePiece(index pieceIndex) bool {
 	return t.haveInfo() && t.pieceComplete(index)
 }
@@ -1295,7 +1455,7 @@ func (t *Torrent) worstBadConnFromSlice(opts worseConnLensOpts, sl []*PeerConn)
 		// connection quota and is older than a minute.
 		if wcs.Len() >= (t.maxEstablishedConns+1)/2 {
 			// Give connections 1 minute to prove themselves.
-			if time.Since(c.completedHandshake) > time.Minute {
+			if c.now().Sub(c.completedHandshake) > time.Minute {
 				return c
 			}
 		}
@@ -1527,6 +1687,7 @@ func (t *Torrent) maxHalfOpen() int {
 
 func (t *Torrent) openNewConns() (initiated int) {
 	defer t.updateWantPeersEvent()
+	bySource := t.connsBySource()
 	for t.peers.Len() != 0 {
 		if !t.wantOutgoingConns() {
 			return
@@ -1540,14 +1701,31 @@ func (t *Torrent) openNewConns() (initiated int) {
 		if t.cl.numHalfOpen >= t.cl.config.TotalHalfOpenConns {
 			return
 		}
-		p := t.peers.PopMax()
+		p, ok := t.popPeerToDial(bySource)
+		if !ok {
+			return
+		}
+		obfuscationPolicy, ok := t.cl.dialHeaderObfuscationPolicy(p)
+		if !ok {
+			torrent.Add("peers skipped requiring encryption", 1)
+			continue
+		}
+		// Don't spend a dial token on a peer initiateConn would discard.
+		if !t.canInitiateConn(p, false) {
+			continue
+		}
+		if !t.cl.allowDial() {
+			t.peers.Add(p)
+			return
+		}
+		bySource[p.Source]++
 		opts := outgoingConnOpts{
 			peerInfo:                 p,
 			t:                        t,
 			requireRendezvous:        false,
 			skipHolepunchRendezvous:  false,
 			receivedHolepunchConnect: false,
-			HeaderObfuscationPolicy:  t.cl.config.HeaderObfuscationPolicy,
+			HeaderObfuscationPolicy:  obfuscationPolicy,
 		}
 		initiateConn(opts, false)
 		initiated++
@@ -1789,7 +1967,7 @@ func (t *Torrent) seeding() bool {
 	if cl.config.NoUpload {
 		return false
 	}
-	if !cl.config.Seed {
+	if !cl.config.Seed && !cl.config.ServeOnly {
 		return false
 	}
 	if cl.config.DisableAggressiveUpload && t.needData() {
@@ -1861,15 +2039,15 @@ func (t *Torrent) startWebsocketAnnouncer(u url.URL, shortInfohash [20]byte) tor
 	// webtorrent.TrackerClient for the same info hash before the old one is cleaned up.
 	t.onClose = append(t.onClose, release)
 	wst := websocketTrackerStatus{u, wtc}
-	go func() {
+	t.goBackground(func() {
 		err := wtc.Announce(tracker.Started, shortInfohash)
 		if err != nil {
 			t.logger.WithDefaultLevel(log.Warning).Printf(
 				"error in initial announce to %q: %v",
-				u.String(), err,
+				t.cl.redactTracker(u.String()), t.cl.redactTracker(err.Error()),
 			)
 		}
-	}()
+	})
 	return wst
 }
 
@@ -1881,7 +2059,7 @@ func (t *Torrent) startScrapingTracker(_url string) {
 	if err != nil {
 		// URLs with a leading '*' appear to be a uTorrent convention to disable trackers.
 		if _url[0] != '*' {
-			t.logger.Levelf(log.Warning, "error parsing tracker url: %v", err)
+			t.logger.Levelf(log.Warning, "error parsing tracker url: %v", t.cl.redactTracker(err.Error()))
 		}
 		return
 	}
@@ -1930,7 +2108,7 @@ func (t *Torrent) startScrapingTrackerWithInfohash(u *url.URL, urlStr string, sh
 			t:               t,
 			lookupTrackerIp: t.cl.config.LookupTrackerIp,
 		}
-		go newAnnouncer.Run()
+		t.goBackground(newAnnouncer.Run)
 		return newAnnouncer
 	}()
 	if sl == nil {
@@ -1962,23 +2140,18 @@ func (t *Torrent) announceRequest(
 	event tracker.AnnounceEvent,
 	shortInfohash [20]byte,
 ) tracker.AnnounceRequest {
+	if event == tracker.None && t.partialSeed() {
+		event = tracker.Paused
+	}
 	// Note that IPAddress is not set. It's set for UDP inside the tracker code, since it's
 	// dependent on the network in use.
 	return tracker.AnnounceRequest{
-		Event: event,
-		NumWant: func() int32 {
-			if t.wantPeers() && len(t.cl.dialers) > 0 {
-				// Windozer has UDP packet limit. See:
-				// https://github.com/anacrolix/torrent/issues/764
-				return 200
-			} else {
-				return 0
-			}
-		}(),
-		Port:     uint16(t.cl.incomingPeerPort()),
+		Event:    event,
+		NumWant:  t.announceNumWant(),
+		Port:     t.announcePort(),
 		PeerId:   t.cl.peerID,
 		InfoHash: shortInfohash,
-		Key:      t.cl.announceKey(),
+		Key:      t.announceKey(),
 
 		// The following are vaguely described in BEP 3.
 
@@ -2072,15 +2245,16 @@ func (t *Torrent) dhtAnnounceConsumer(
 }
 
 func (t *Torrent) timeboxedAnnounceToDht(s DhtServer) error {
-	_, stop, err := t.AnnounceToDht(s)
+	done, stop, err := t.AnnounceToDht(s)
 	if err != nil {
 		return err
 	}
 	select {
 	case <-t.closed.Done():
-	case <-time.After(5 * time.Minute):
+	case <-t.cl.clock().After(5 * time.Minute):
 	}
 	stop()
+	<-done
 	return nil
 }
 
@@ -2116,6 +2290,8 @@ func (t *Torrent) dhtAnnouncer(s DhtServer) {
 				t.logger.WithDefaultLevel(log.Warning).Printf("error announcing %q to DHT: %s", t, err)
 			}
 		}()
+		// Scrapes can take as long as an announce, so they're kept out of the announce loop.
+		t.goBackground(func() { t.maybeScrapeDht(s) })
 	}
 }
 
@@ -2148,7 +2324,19 @@ func (t *Torrent) statsLocked() (ret TorrentStats) {
 		}
 	}
 	ret.ConnStats = t.stats.Copy()
+	ret.Rates = t.rates.rates(t.cl.clock().Now())
+	for _, ws := range t.webSeeds {
+		ret.Webseeds = append(ret.Webseeds, ws.peerImpl.(*webseedPeer).stats())
+	}
+	sort.Slice(ret.Webseeds, func(i, j int) bool {
+		return ret.Webseeds[i].Url < ret.Webseeds[j].Url
+	})
 	ret.PiecesComplete = t.numPiecesCompleted()
+	ret.PiecesQueuedForHash = int(t.piecesQueuedForHash.Len())
+	ret.PiecesHashing = t.activePieceHashes
+	ret.AllTime = t.allTimeStats()
+	ret.Swarm = t.swarmStats()
+	ret.Availability = t.pieceAvailabilityStats()
 	return
 }
 
@@ -2213,6 +2401,9 @@ func (t *Torrent) addPeerConn(c *PeerConn) (err error) {
 			return errors.New("existing connection preferred")
 		}
 	}
+	if err := t.connAddrLimitErr(c); err != nil {
+		return err
+	}
 	if len(t.conns) >= t.maxEstablishedConns {
 		numOutgoing := t.numOutgoingConns()
 		numIncoming := len(t.conns) - numOutgoing
@@ -2319,6 +2510,7 @@ func (t *Torrent) pieceHashed(piece pieceIndex, passed bool, hashIoErr error) {
 	})
 	p := t.piece(piece)
 	p.numVerifies++
+	t.updateVerifyProgress(piece)
 	t.cl.event.Broadcast()
 	if t.closed.IsSet() {
 		return
@@ -2333,8 +2525,18 @@ func (t *Torrent) pieceHashed(piece pieceIndex, passed bool, hashIoErr error) {
 				"piece %d failed hash: %d connections contributed", piece, len(p.dirtiers),
 			).AddValues(t, p).LogLevel(log.Info, t.logger)
 			pieceHashedNotCorrect.Add(1)
+			t.onPieceFailure(piece)
+			if hashIoErr != nil {
+				p.lastErr = fmt.Sprintf("reading piece data: %v", hashIoErr)
+			} else {
+				p.lastErr = "hash check failed"
+			}
 		}
 	}
+	if passed {
+		p.lastErr = ""
+		p.consecutiveFailures = 0
+	}
 
 	p.marking = true
 	t.publishPieceStateChange(piece)
@@ -2347,6 +2549,8 @@ func (t *Torrent) pieceHashed(piece pieceIndex, passed bool, hashIoErr error) {
 		if len(p.dirtiers) != 0 {
 			// Don't increment stats above connection-level for every involved connection.
 			t.allStats((*ConnStats).incrementPiecesDirtiedGood)
+			t.piecesDownloaded = true
+			t.wantFileChecksums(piece)
 		}
 		for c := range p.dirtiers {
 			c._stats.incrementPiecesDirtiedGood()
@@ -2362,6 +2566,10 @@ func (t *Torrent) pieceHashed(piece pieceIndex, passed bool, hashIoErr error) {
 			t.logger.Levelf(log.Warning, "%T: error marking piece complete %d: %s", t.storage, piece, err)
 		}
 		t.cl.lock()
+		if err != nil {
+			p.lastErr = fmt.Sprintf("marking complete: %v", err)
+			t.onStorageErr(piece, fmt.Errorf("marking piece complete: %w", err))
+		}
 
 		if t.closed.IsSet() {
 			return
@@ -2374,9 +2582,11 @@ func (t *Torrent) pieceHashed(piece pieceIndex, passed bool, hashIoErr error) {
 
 			// Increment Torrent and above stats, and then specific connections.
 			t.allStats((*ConnStats).incrementPiecesDirtiedBad)
-			for c := range p.dirtiers {
+			for c, n := range p.dirtiers {
 				// Y u do dis peer?!
 				c.stats().incrementPiecesDirtiedBad()
+				c.stats().BytesReadWastedFailedHash.Add(n)
+				t.allStats(add(n, func(cs *ConnStats) *Count { return &cs.BytesReadWastedFailedHash }))
 			}
 
 			bannableTouchers := make([]*Peer, 0, len(p.dirtiers))
@@ -2419,6 +2629,7 @@ func (t *Torrent) pieceHashed(piece pieceIndex, passed bool, hashIoErr error) {
 		p.Storage().MarkNotComplete()
 	}
 	t.updatePieceCompletion(piece)
+	t.updateDownloadCompleted()
 }
 
 func (t *Torrent) cancelRequestsForPiece(piece pieceIndex) {
@@ -2437,10 +2648,13 @@ func (t *Torrent) onPieceCompleted(piece pieceIndex) {
 		conn.have(piece)
 		t.maybeDropMutuallyCompletePeer(conn)
 	}
+	t.maybeVerifyFileChecksums(piece)
+	t.maybeCompactChunkJournal()
 }
 
 // Called when a piece is found to be not complete.
 func (t *Torrent) onIncompletePiece(piece pieceIndex) {
+	t.cl.uploadReadCache.removePiece(uploadReadCacheKey{t, piece})
 	if t.pieceAllDirty(piece) {
 		t.pendAllChunkSpecs(piece)
 	}
@@ -2467,7 +2681,7 @@ func (t *Torrent) onIncompletePiece(piece pieceIndex) {
 }
 
 func (t *Torrent) tryCreateMorePieceHashers() {
-	for !t.closed.IsSet() && t.activePieceHashes < t.cl.config.PieceHashersPerTorrent && t.tryCreatePieceHasher() {
+	for !t.closed.IsSet() && t.activePieceHashes < t.maxPieceHashers() && t.tryCreatePieceHasher() {
 	}
 }
 
@@ -2486,19 +2700,30 @@ func (t *Torrent) tryCreatePieceHasher() bool {
 	t.updatePiecePriority(pi, "Torrent.tryCreatePieceHasher")
 	t.storageLock.RLock()
 	t.activePieceHashes++
-	go t.pieceHasher(pi)
+	t.goBackground(func() { t.pieceHasher(pi) })
 	return true
 }
 
+// Picks the next queued piece to hash. Pieces that readers are blocked on come first, then those
+// in reader readahead, then the rest in index order.
 func (t *Torrent) getPieceToHash() (ret pieceIndex, ok bool) {
-	t.piecesQueuedForHash.IterTyped(func(i pieceIndex) bool {
-		if t.piece(i).hashing {
+	pick := func(i pieceIndex) bool {
+		if !t.piecesQueuedForHash.Get(bitmap.BitIndex(i)) || t.piece(i).hashing {
 			return true
 		}
 		ret = i
 		ok = true
 		return false
-	})
+	}
+	t.readerNowPieces().IterTyped(pick)
+	if ok {
+		return
+	}
+	t.readerReadaheadPieces().IterTyped(pick)
+	if ok {
+		return
+	}
+	t.piecesQueuedForHash.IterTyped(pick)
 	return
 }
 
@@ -2573,12 +2798,26 @@ func (t *Torrent) peersAsSlice() (ret []*Peer) {
 	return
 }
 
+// Marks a piece complete in storage without hashing it.
+func (t *Torrent) seedModeMarkComplete(i pieceIndex) {
+	ps := t.piece(i).Storage()
+	if c := ps.Completion(); c.Ok && c.Complete {
+		return
+	}
+	if err := ps.MarkComplete(); err != nil {
+		t.logger.Levelf(log.Warning, "marking piece %v complete for seed mode: %v", i, err)
+	}
+}
+
 func (t *Torrent) queueInitialPieceCheck(i pieceIndex) {
 	if !t.initialPieceCheckDisabled && !t.piece(i).storageCompletionOk {
 		t.queuePieceCheck(i)
 	}
 }
 
+// Adds a piece to the hash queue. Hashing starts immediately if the torrent is below its hasher
+// limit, otherwise the piece waits for a running hash to finish. See getPieceToHash for the order
+// pieces leave the queue.
 func (t *Torrent) queuePieceCheck(pieceIndex pieceIndex) {
 	piece := t.piece(pieceIndex)
 	if piece.hash == nil && !piece.hashV2.Ok {
@@ -2596,8 +2835,38 @@ func (t *Torrent) queuePieceCheck(pieceIndex pieceIndex) {
 // Forces all the pieces to be re-hashed. See also Piece.VerifyData. This should not be called
 // before the Info is available.
 func (t *Torrent) VerifyData() {
-	for i := pieceIndex(0); i < t.NumPieces(); i++ {
-		t.Piece(i).VerifyData()
+	t.VerifyPieces(0, t.NumPieces())
+}
+
+// Forces the pieces in [begin, end) to be re-hashed, and waits for them all to finish. They're
+// queued together so they can be hashed concurrently. Progress is reported as for VerifyData. The
+// range is clipped to the torrent's pieces, so nothing is verified before the Info is available.
+func (t *Torrent) VerifyPieces(begin, end pieceIndex) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	if !t.haveInfo() {
+		return
+	}
+	begin = maxInt(begin, 0)
+	end = minInt(end, t.numPieces())
+	if begin >= end {
+		return
+	}
+	t.addVerifyPieces(begin, end)
+	targets := make([]int64, 0, end-begin)
+	for i := begin; i < end; i++ {
+		p := t.piece(i)
+		target := p.numVerifies + 1
+		if p.hashing {
+			target++
+		}
+		targets = append(targets, target)
+		t.queuePieceCheck(i)
+	}
+	for i := begin; i < end; i++ {
+		for t.piece(i).numVerifies < targets[i-begin] {
+			t.cl.event.Wait()
+		}
 	}
 }
 
@@ -2640,28 +2909,34 @@ func initiateConn(
 ) {
 	t := opts.t
 	peer := opts.peerInfo
-	if peer.Id == t.cl.peerID {
+	if !t.canInitiateConn(peer, ignoreLimits) {
 		return
 	}
-	if t.cl.badPeerAddr(peer.Addr) && !peer.Trusted {
-		return
+	attemptKey := &peer
+	t.addHalfOpen(peer.Addr.String(), attemptKey)
+	t.goBackground(func() {
+		t.cl.outgoingConnection(
+			opts,
+			attemptKey,
+		)
+	})
+}
+
+// Whether initiateConn would start a connection to the peer.
+func (t *Torrent) canInitiateConn(peer PeerInfo, ignoreLimits bool) bool {
+	if t.closed.IsSet() {
+		return false
 	}
-	addr := peer.Addr
-	addrStr := addr.String()
-	if !ignoreLimits {
-		if t.connectingToPeerAddr(addrStr) {
-			return
-		}
+	if peer.Id == t.cl.peerID {
+		return false
 	}
-	if t.hasPeerConnForAddr(addr) {
-		return
+	if t.cl.badPeerAddr(peer.Addr) && !peer.Trusted {
+		return false
 	}
-	attemptKey := &peer
-	t.addHalfOpen(addrStr, attemptKey)
-	go t.cl.outgoingConnection(
-		opts,
-		attemptKey,
-	)
+	if !ignoreLimits && t.connectingToPeerAddr(peer.Addr.String()) {
+		return false
+	}
+	return !t.hasPeerConnForAddr(peer.Addr)
 }
 
 // Adds a trusted, pending peer for each of the given Client's addresses. Typically used in tests to
@@ -2701,13 +2976,13 @@ func (t *Torrent) piece(i int) *Piece {
 	return &t.pieces[i]
 }
 
-func (t *Torrent) onWriteChunkErr(err error) {
+func (t *Torrent) onWriteChunkErr(piece pieceIndex, err error) {
 	if t.userOnWriteChunkErr != nil {
 		go t.userOnWriteChunkErr(err)
+		t.publishStorageFailure(piece, fmt.Errorf("writing chunk: %w", err))
 		return
 	}
-	t.logger.WithDefaultLevel(log.Critical).Printf("default chunk write error handler: disabling data download")
-	t.disallowDataDownloadLocked()
+	t.onStorageErr(piece, fmt.Errorf("writing chunk: %w", err))
 }
 
 func (t *Torrent) DisallowDataDownload() {
@@ -2725,9 +3000,15 @@ func (t *Torrent) disallowDataDownloadLocked() {
 	})
 }
 
+// Enables downloading data, if it was disabled. This resumes a torrent paused by a storage error,
+// once the cause has been dealt with. It has no effect if ClientConfig.ServeOnly is set.
 func (t *Torrent) AllowDataDownload() {
 	t.cl.lock()
 	defer t.cl.unlock()
+	if t.cl.config.ServeOnly {
+		return
+	}
+	t.storageErr = nil
 	t.dataDownloadDisallowed.Clear()
 	t.iterPeers(func(p *Peer) {
 		p.updateRequests("allow data download")
@@ -2756,7 +3037,7 @@ func (t *Torrent) DisallowDataUpload() {
 }
 
 // Sets a handler that is called if there's an error writing a chunk to local storage. By default,
-// or if nil, a critical message is logged, and data download is disabled.
+// or if nil, the torrent is paused as for other storage errors. See Torrent.StorageError.
 func (t *Torrent) SetOnWriteChunkError(f func(error)) {
 	t.cl.lock()
 	defer t.cl.unlock()
@@ -2794,7 +3075,7 @@ func (t *Torrent) AddWebSeeds(urls []string, opts ...AddWebSeedsOpt) {
 }
 
 func (t *Torrent) addWebSeed(url string, opts ...AddWebSeedsOpt) {
-	if t.cl.config.DisableWebseeds {
+	if t.cl.config.DisableWebseeds || t.cl.config.ServeOnly {
 		return
 	}
 	if _, ok := t.webSeeds[url]; ok {
@@ -2802,16 +3083,20 @@ func (t *Torrent) addWebSeed(url string, opts ...AddWebSeedsOpt) {
 	}
 	// I don't think Go http supports pipelining requests. However, we can have more ready to go
 	// right away. This value should be some multiple of the number of connections to a host. I
-	// would expect that double maxRequests plus a bit would be appropriate. This value is based on
+	// would expect that double maxRequests plus a bit would be appropriate. The default is based on
 	// downloading Sintel (08ada5a7a6183aae1e09d831df6748d566095a10) from
 	// "https://webtorrent.io/torrents/".
-	const maxRequests = 16
+	maxRequests := t.cl.config.WebseedMaxRequests
+	if maxRequests <= 0 {
+		maxRequests = defaultWebseedMaxRequests
+	}
 	ws := webseedPeer{
 		peer: Peer{
 			t:                        t,
 			outgoing:                 true,
 			Network:                  "http",
 			reconciledHandshakeStats: true,
+			clock:                    t.cl.clock(),
 			// This should affect how often we have to recompute requests for this peer. Note that
 			// because we can request more than 1 thing at a time over HTTP, we will hit the low
 			// requests mark more often, so recomputation is probably sooner than with regular peer
@@ -2822,8 +3107,11 @@ func (t *Torrent) addWebSeed(url string, opts ...AddWebSeedsOpt) {
 			callbacks:  t.callbacks(),
 		},
 		client: webseed.Client{
-			HttpClient: t.cl.httpClient,
-			Url:        url,
+			HttpClient:      t.cl.httpClient,
+			Url:             url,
+			UserAgent:       t.cl.httpUserAgent(),
+			Header:          t.cl.config.HTTPHeader,
+			RequestDirector: t.cl.httpRequestDirector(),
 			ResponseBodyWrapper: func(r io.Reader) io.Reader {
 				return &rateLimitedReader{
 					l: t.cl.config.DownloadRateLimiter,
@@ -2831,7 +3119,8 @@ func (t *Torrent) addWebSeed(url string, opts ...AddWebSeedsOpt) {
 				}
 			},
 		},
-		activeRequests: make(map[Request]webseed.Request, maxRequests),
+		activeRequests:    make(map[Request]webseed.Request, maxRequests),
+		maxCoalescedBytes: t.cl.config.WebseedMaxCoalescedBytes,
 	}
 	ws.peer.initRequestState()
 	for _, opt := range opts {
@@ -2840,7 +3129,7 @@ func (t *Torrent) addWebSeed(url string, opts ...AddWebSeedsOpt) {
 	ws.peer.initUpdateRequestsTimer()
 	ws.requesterCond.L = t.cl.locker()
 	for i := 0; i < maxRequests; i += 1 {
-		go ws.requester(i)
+		t.goBackground(func() { ws.requester(i) })
 	}
 	for _, f := range t.callbacks().NewPeer {
 		f(&ws.peer)
@@ -2879,7 +3168,12 @@ func (t *Torrent) pieceRequestIndexOffset(piece pieceIndex) RequestIndex {
 }
 
 func (t *Torrent) updateComplete() {
-	t.Complete.SetBool(t.haveAllPieces())
+	complete := t.haveAllPieces()
+	if complete && t.persistedStats.Completed.IsZero() {
+		t.persistedStats.Completed = t.cl.clock().Now()
+		t.savePersistedStats()
+	}
+	t.Complete.SetBool(complete)
 }
 
 func (t *Torrent) cancelRequest(r RequestIndex) *Peer {
@@ -2895,6 +3189,14 @@ func (t *Torrent) cancelRequest(r RequestIndex) *Peer {
 	return p
 }
 
+func (t *Torrent) decCancelledRequest(r RequestIndex) {
+	if t.cancelledRequests[r] <= 1 {
+		delete(t.cancelledRequests, r)
+	} else {
+		t.cancelledRequests[r]--
+	}
+}
+
 func (t *Torrent) requestingPeer(r RequestIndex) *Peer {
 	return t.requestState[r].peer
 }
@@ -3166,9 +3468,10 @@ func (t *Torrent) eachShortInfohash(each func(short [20]byte)) {
 	}
 }
 
+// Files without a pieces root, such as in v1 torrents, never match.
 func (t *Torrent) getFileByPiecesRoot(hash [32]byte) *File {
 	for _, f := range *t.files {
-		if f.piecesRoot.Unwrap() == hash {
+		if f.piecesRoot.Ok && f.piecesRoot.Value == hash {
 			return f
 		}
 	}
@@ -1,6 +1,7 @@
 package torrent
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -22,6 +23,7 @@ import (
 	"github.com/anacrolix/torrent/metainfo"
 	pp "github.com/anacrolix/torrent/peer_protocol"
 	"github.com/anacrolix/torrent/storage"
+	"github.com/anacrolix/torrent/tracker"
 )
 
 func r(i, b, l pp.Integer) Request {
@@ -164,6 +166,23 @@ func TestPieceHashFailed(t *testing.T) {
 	tt.cl.unlock()
 }
 
+func TestPieceStateLastError(t *testing.T) {
+	c := qt.New(t)
+	mi := testutil.GreetingMetaInfo()
+	cl := newTestingClient(t)
+	tt := cl.newTorrent(mi.HashInfoBytes(), badStorage{})
+	c.Assert(tt.setInfoBytesLocked(mi.InfoBytes), qt.IsNil)
+	cl.lock()
+	p := tt.piece(1)
+	p.storageCompletionOk = true
+	tt.pieceHashed(1, false, errors.New("disk on fire"))
+	c.Check(tt.pieceState(1).LastError, qt.Equals, "reading piece data: disk on fire")
+	tt.pieceHashed(1, true, nil)
+	// The bad storage fails to mark pieces complete.
+	c.Check(tt.pieceState(1).LastError, qt.Equals, "marking complete: psyyyyyyyche")
+	cl.unlock()
+}
+
 // Check the behaviour of Torrent.Metainfo when metadata is not completed.
 func TestTorrentMetainfoIncompleteMetadata(t *testing.T) {
 	cfg := TestingConfig(t)
@@ -253,3 +272,294 @@ func TestRelativeAvailabilityHaveNone(t *testing.T) {
 	tt.close(&wg)
 	tt.assertAllPiecesRelativeAvailabilityZero()
 }
+
+func TestLiveWindowPiecePriorities(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt := cl.newTorrent(testutil.GreetingMetaInfo().HashInfoBytes(), badStorage{})
+	c.Assert(tt.setInfoBytesLocked(testutil.GreetingMetaInfo().InfoBytes), qt.IsNil)
+	tt.DownloadAll()
+	tt.SetLiveWindow(1, 1)
+	cl.lock()
+	c.Check(tt.piece(0).purePriority(), qt.Equals, PiecePriorityNone)
+	c.Check(tt.piece(1).purePriority(), qt.Equals, PiecePriorityNow)
+	c.Check(tt.piece(2).purePriority(), qt.Equals, PiecePriorityNone)
+	cl.unlock()
+	tt.ClearLiveWindow()
+	cl.lock()
+	c.Check(tt.piece(0).purePriority(), qt.Equals, PiecePriorityNormal)
+	cl.unlock()
+}
+
+func TestSetPiecePriorityPins(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt := cl.newTorrent(testutil.GreetingMetaInfo().HashInfoBytes(), badStorage{})
+	c.Check(tt.SetPiecePriority(0, PiecePriorityLow), qt.IsNotNil)
+	c.Assert(tt.setInfoBytesLocked(testutil.GreetingMetaInfo().InfoBytes), qt.IsNil)
+	tt.DownloadAll()
+	c.Assert(tt.SetPiecePriority(0, PiecePriorityLow), qt.IsNil)
+	c.Assert(tt.SetPiecePriority(1, PiecePriorityNone), qt.IsNil)
+	c.Check(tt.SetPiecePriority(3, PiecePriorityLow), qt.IsNotNil)
+	c.Check(tt.ClearPiecePriority(-1), qt.IsNotNil)
+	tt.DownloadPieces(0, 2)
+	cl.lock()
+	c.Check(tt.piece(0).purePriority(), qt.Equals, PiecePriorityLow)
+	c.Check(tt.piece(1).purePriority(), qt.Equals, PiecePriorityNone)
+	c.Check(tt.piece(2).purePriority(), qt.Equals, PiecePriorityNormal)
+	cl.unlock()
+	c.Assert(tt.ClearPiecePriority(0), qt.IsNil)
+	cl.lock()
+	c.Check(tt.piece(0).purePriority(), qt.Equals, PiecePriorityNormal)
+	cl.unlock()
+}
+
+func TestSelectOnlyFilesOutOfRange(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt := cl.newTorrent(testutil.GreetingMetaInfo().HashInfoBytes(), badStorage{})
+	tt.selectOnlyFiles = []int{-1, 1, 0}
+	c.Assert(tt.setInfoBytesLocked(testutil.GreetingMetaInfo().InfoBytes), qt.IsNil)
+	cl.lock()
+	c.Check(tt.piece(0).purePriority(), qt.Equals, PiecePriorityNormal)
+	cl.unlock()
+}
+
+func TestPiecePriorityLowRank(t *testing.T) {
+	c := qt.New(t)
+	// The existing values are unchanged.
+	c.Check(PiecePriorityNormal, qt.Equals, piecePriority(1))
+	c.Check(PiecePriorityNow, qt.Equals, piecePriority(5))
+	c.Check(PiecePriorityLow.Rank() > PiecePriorityNone.Rank(), qt.IsTrue)
+	c.Check(PiecePriorityLow.Rank() < PiecePriorityNormal.Rank(), qt.IsTrue)
+	prio := PiecePriorityLow
+	c.Check(prio.Raise(PiecePriorityNormal), qt.IsTrue)
+	c.Check(prio.Raise(PiecePriorityLow), qt.IsFalse)
+	c.Check(prio, qt.Equals, PiecePriorityNormal)
+}
+
+func TestVerifyPiecesProgress(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	cfg := TestingConfig(t)
+	cfg.DataDir = dir
+	var events []VerifyDataProgressEvent
+	cfg.Callbacks.VerifyDataProgress = append(cfg.Callbacks.VerifyDataProgress, func(e VerifyDataProgressEvent) {
+		events = append(events, e)
+	})
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	tt.VerifyPieces(1, 3)
+	progress := tt.VerifyDataProgress()
+	c.Check(progress.NumPieces, qt.Equals, 2)
+	c.Check(progress.PiecesHashed, qt.Equals, 2)
+	c.Check(progress.BytesHashed, qt.Equals, int64(8))
+	c.Check(events, qt.HasLen, 2)
+	// Out of range pieces are ignored.
+	tt.VerifyPieces(2, 10)
+	tt.VerifyPieces(-5, 0)
+	tt.VerifyPieces(3, 1)
+	c.Check(tt.VerifyDataProgress().NumPieces, qt.Equals, 1)
+}
+
+func TestPartialSeedAnnouncesPaused(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	// Corrupt the last piece, so only the first two complete.
+	f, err := os.OpenFile(filepath.Join(dir, testutil.GreetingFileName), os.O_WRONLY, 0)
+	c.Assert(err, qt.IsNil)
+	_, err = f.WriteAt([]byte("x"), int64(len(testutil.GreetingFileContents)-1))
+	f.Close()
+	c.Assert(err, qt.IsNil)
+	cfg := TestingConfig(t)
+	cfg.DataDir = dir
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	// Make sure no pieces are left queued for hashing, as they're not pending until checked.
+	tt.VerifyData()
+	cl.lock()
+	// Nothing more is wanted, and some pieces are complete.
+	c.Check(tt.numPiecesCompleted(), qt.Equals, 2)
+	c.Check(tt.partialSeed(), qt.IsTrue)
+	c.Check(tt.announceRequest(tracker.None, *tt.canonicalShortInfohash()).Event, qt.Equals, tracker.Paused)
+	c.Check(tt.announceRequest(tracker.Started, *tt.canonicalShortInfohash()).Event, qt.Equals, tracker.Started)
+	cl.unlock()
+	tt.DownloadAll()
+	cl.lock()
+	c.Check(tt.partialSeed(), qt.IsFalse)
+	c.Check(tt.announceRequest(tracker.None, *tt.canonicalShortInfohash()).Event, qt.Equals, tracker.None)
+	cl.unlock()
+}
+
+func TestNothingSelectedOrCompleteIsNotPartialSeed(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	cl.lock()
+	defer cl.unlock()
+	c.Check(tt.partialSeed(), qt.IsFalse)
+	c.Check(tt.announceRequest(tracker.None, *tt.canonicalShortInfohash()).Event, qt.Equals, tracker.None)
+}
+
+func TestSeedModeMarksPiecesCompleteWithoutHashing(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	cfg := TestingConfig(t)
+	cfg.DataDir = dir
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	spec, err := TorrentSpecFromMetaInfoErr(mi)
+	c.Assert(err, qt.IsNil)
+	spec.SeedMode = true
+	tt, _, err := cl.AddTorrentSpec(spec)
+	c.Assert(err, qt.IsNil)
+	// The data is trusted to be complete without being hashed.
+	c.Check(tt.BytesMissing(), qt.Equals, int64(0))
+	cl.lock()
+	defer cl.unlock()
+	for i := 0; i < tt.numPieces(); i++ {
+		c.Check(tt.piece(i).numVerifies, qt.Equals, int64(0))
+		c.Check(tt.pieceQueuedForHash(i), qt.IsFalse)
+	}
+}
+
+func TestStorageErrorPausesDownload(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	var (
+		events        []StorageFailureEvent
+		storageErrors []error
+	)
+	cfg.Callbacks.StorageFailed = append(cfg.Callbacks.StorageFailed, func(e StorageFailureEvent) {
+		events = append(events, e)
+		// The Client lock isn't held, so this doesn't deadlock.
+		storageErrors = append(storageErrors, e.Torrent.StorageError())
+	})
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, _, err := cl.AddTorrentSpec(TorrentSpecFromMetaInfo(testutil.GreetingMetaInfo()))
+	c.Assert(err, qt.IsNil)
+	diskFull := errors.New("disk full")
+	cl.lock()
+	tt.onWriteChunkErr(1, diskFull)
+	// Chunks already being written when the torrent is paused don't report again.
+	tt.onWriteChunkErr(2, diskFull)
+	c.Check(events, qt.HasLen, 0)
+	cl.unlock()
+	c.Assert(events, qt.HasLen, 1)
+	c.Check(storageErrors[0], qt.ErrorIs, diskFull)
+	c.Check(events[0].Torrent, qt.Equals, tt)
+	c.Check(events[0].Piece, qt.Equals, 1)
+	c.Check(events[0].Err, qt.ErrorIs, diskFull)
+	c.Check(tt.StorageError(), qt.ErrorIs, diskFull)
+	c.Check(tt.dataDownloadDisallowed.Bool(), qt.IsTrue)
+	tt.AllowDataDownload()
+	c.Check(tt.StorageError(), qt.IsNil)
+	c.Check(tt.dataDownloadDisallowed.Bool(), qt.IsFalse)
+}
+
+func TestTorrentDecodesNamesWithEncoding(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	info := metainfo.Info{
+		PieceLength: 1 << 14,
+		// "中文" and "文件" in GBK.
+		Name:  "\xd6\xd0\xce\xc4",
+		Files: []metainfo.FileInfo{{Path: []string{"\xce\xc4\xbc\xfe"}}},
+	}
+	mi := metainfo.MetaInfo{
+		InfoBytes: bencode.MustMarshal(info),
+		Encoding:  "GBK",
+	}
+	spec, err := TorrentSpecFromMetaInfoErr(&mi)
+	c.Assert(err, qt.IsNil)
+	tt, _, err := cl.AddTorrentSpec(spec)
+	c.Assert(err, qt.IsNil)
+	c.Check(tt.Name(), qt.Equals, "中文")
+	c.Check(tt.Files()[0].Path(), qt.Equals, "中文/文件")
+	c.Check(tt.Files()[0].DisplayPath(), qt.Equals, "文件")
+}
+
+// Two files of two pieces each.
+var twoFileTestTorrent = testutil.Torrent{
+	Name: "dir",
+	Files: []testutil.File{
+		{Name: "a", Data: "0123456789"},
+		{Name: "b", Data: "abcdefghij"},
+	},
+}
+
+// Writes the data for one of the files of twoFileTestTorrent to dataDir.
+func writeTwoFileTestTorrentFile(c *qt.C, dataDir string, i int) {
+	f := twoFileTestTorrent.Files[i]
+	dir := filepath.Join(dataDir, twoFileTestTorrent.Name)
+	c.Assert(os.MkdirAll(dir, 0o755), qt.IsNil)
+	c.Assert(os.WriteFile(filepath.Join(dir, f.Name), []byte(f.Data), 0o644), qt.IsNil)
+}
+
+func TestBytesWantedMissing(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(twoFileTestTorrent.Metainfo(5))
+	c.Assert(err, qt.IsNil)
+	tt.VerifyData()
+	c.Check(tt.BytesWantedMissing(), qt.Equals, int64(0))
+	c.Check(tt.BytesMissing(), qt.Equals, int64(20))
+	tt.Files()[1].Download()
+	c.Check(tt.BytesWantedMissing(), qt.Equals, int64(10))
+	tt.DownloadAll()
+	c.Check(tt.BytesWantedMissing(), qt.Equals, int64(20))
+	// Complete the first file.
+	writeTwoFileTestTorrentFile(c, cfg.DataDir, 0)
+	tt.VerifyData()
+	c.Check(tt.BytesWantedMissing(), qt.Equals, int64(10))
+	c.Check(tt.BytesMissing(), qt.Equals, int64(10))
+}
+
+func TestBytesOnDisk(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(twoFileTestTorrent.Metainfo(5))
+	c.Assert(err, qt.IsNil)
+	n, err := tt.BytesOnDisk()
+	c.Assert(err, qt.IsNil)
+	c.Check(n, qt.Equals, int64(0))
+	writeTwoFileTestTorrentFile(c, cfg.DataDir, 0)
+	tt.VerifyData()
+	c.Assert(tt.BytesCompleted(), qt.Equals, int64(10))
+	n, err = tt.BytesOnDisk()
+	c.Assert(err, qt.IsNil)
+	c.Check(n >= tt.BytesCompleted(), qt.IsTrue, qt.Commentf("%v", n))
+}
+
+func TestBytesOnDiskUnsupported(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	s := storage.NewMMap(t.TempDir())
+	defer s.Close()
+	spec, err := TorrentSpecFromMetaInfoErr(twoFileTestTorrent.Metainfo(5))
+	c.Assert(err, qt.IsNil)
+	spec.Storage = s
+	tt, _, err := cl.AddTorrentSpec(spec)
+	c.Assert(err, qt.IsNil)
+	_, err = tt.BytesOnDisk()
+	c.Check(err, qt.ErrorIs, ErrStorageDiskUsageUnsupported)
+}
@@ -0,0 +1,3 @@
+// Package torrenttest provides a swarm of in-process Clients for integration tests. The Clients
+// connect to each other over loopback, and keep torrent data in memory.
+package torrenttest
@@ -0,0 +1,106 @@
+package torrenttest
+
+import (
+	"io"
+	"sync"
+
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+// Keeps torrent data in memory, so swarms don't touch the disk. If seed is set, torrents start
+// with it as their data, and all pieces complete.
+type memoryStorage struct {
+	seed []byte
+}
+
+func (me memoryStorage) OpenTorrent(info *metainfo.Info, infoHash metainfo.Hash) (storage.TorrentImpl, error) {
+	t := &memoryTorrent{
+		data:     make([]byte, info.TotalLength()),
+		complete: make([]bool, info.NumPieces()),
+	}
+	if me.seed != nil {
+		copy(t.data, me.seed)
+		for i := range t.complete {
+			t.complete[i] = true
+		}
+	}
+	return storage.TorrentImpl{
+		Piece: t.piece,
+		Close: func() error { return nil },
+	}, nil
+}
+
+func (memoryStorage) Close() error {
+	return nil
+}
+
+type memoryTorrent struct {
+	mu       sync.RWMutex
+	data     []byte
+	complete []bool
+}
+
+func (t *memoryTorrent) piece(p metainfo.Piece) storage.PieceImpl {
+	return memoryPiece{t, p}
+}
+
+type memoryPiece struct {
+	t *memoryTorrent
+	p metainfo.Piece
+}
+
+func (p memoryPiece) bytes() []byte {
+	return p.t.data[p.p.Offset() : p.p.Offset()+p.p.Length()]
+}
+
+func (p memoryPiece) ReadAt(b []byte, off int64) (n int, err error) {
+	p.t.mu.RLock()
+	defer p.t.mu.RUnlock()
+	data := p.bytes()
+	if off >= int64(len(data)) {
+		return 0, io.EOF
+	}
+	n = copy(b, data[off:])
+	if n < len(b) {
+		err = io.EOF
+	}
+	return
+}
+
+func (p memoryPiece) WriteAt(b []byte, off int64) (n int, err error) {
+	p.t.mu.Lock()
+	defer p.t.mu.Unlock()
+	data := p.bytes()
+	if off >= int64(len(data)) {
+		return 0, io.ErrShortWrite
+	}
+	n = copy(data[off:], b)
+	if n < len(b) {
+		err = io.ErrShortWrite
+	}
+	return
+}
+
+func (p memoryPiece) MarkComplete() error {
+	p.t.mu.Lock()
+	defer p.t.mu.Unlock()
+	p.t.complete[p.p.Index()] = true
+	return nil
+}
+
+func (p memoryPiece) MarkNotComplete() error {
+	p.t.mu.Lock()
+	defer p.t.mu.Unlock()
+	p.t.complete[p.p.Index()] = false
+	return nil
+}
+
+func (p memoryPiece) Completion() storage.Completion {
+	p.t.mu.RLock()
+	defer p.t.mu.RUnlock()
+	return storage.Completion{
+		Complete: p.t.complete[p.p.Index()],
+		Ok:       true,
+	}
+}
@@ -0,0 +1,144 @@
+package torrenttest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"testing"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/bencode"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+type SwarmOpts struct {
+	// The number of Clients in the swarm. Defaults to 2.
+	Clients int
+	// The number of Clients that start with all the data. The rest start with none. Defaults to 1.
+	Seeders int
+	// The length of the generated torrent data. Defaults to 1 MiB.
+	Length int64
+	// Defaults to 64 KiB.
+	PieceLength int64
+	// Seeds the generation of the torrent data, so failures can be reproduced.
+	RandSeed int64
+	// Called to adjust each Client's config before it's created. Seeders are the first Clients.
+	ConfigureClient func(i int, cfg *torrent.ClientConfig)
+}
+
+// A set of Clients sharing a generated torrent.
+type Swarm struct {
+	Clients  []*torrent.Client
+	Torrents []*torrent.Torrent
+	MetaInfo *metainfo.MetaInfo
+	// The torrent's data.
+	Data []byte
+}
+
+// Creates a swarm of Clients with the torrent added, and all Clients told about each other.
+// Leechers are set to download everything. The Clients are closed when the test completes.
+func NewSwarm(t testing.TB, opts SwarmOpts) *Swarm {
+	t.Helper()
+	if opts.Clients == 0 {
+		opts.Clients = 2
+	}
+	if opts.Seeders == 0 {
+		opts.Seeders = 1
+	}
+	if opts.Length == 0 {
+		opts.Length = 1 << 20
+	}
+	if opts.PieceLength == 0 {
+		opts.PieceLength = 64 << 10
+	}
+	s := &Swarm{
+		Data: make([]byte, opts.Length),
+	}
+	rand.New(rand.NewSource(opts.RandSeed)).Read(s.Data)
+	mi, err := generateMetaInfo(s.Data, opts.PieceLength)
+	if err != nil {
+		t.Fatalf("generating metainfo: %v", err)
+	}
+	s.MetaInfo = mi
+	for i := range opts.Clients {
+		cfg := torrent.TestingConfig(t)
+		cfg.Seed = true
+		// TestingConfig's limit is too small for regular chunks.
+		cfg.MaxAllocPeerRequestDataPerConn = torrent.NewDefaultClientConfig().MaxAllocPeerRequestDataPerConn
+		ms := memoryStorage{}
+		if i < opts.Seeders {
+			ms.seed = s.Data
+		}
+		cfg.DefaultStorage = ms
+		if opts.ConfigureClient != nil {
+			opts.ConfigureClient(i, cfg)
+		}
+		cl, err := torrent.NewClient(cfg)
+		if err != nil {
+			t.Fatalf("creating client %v: %v", i, err)
+		}
+		t.Cleanup(func() { cl.Close() })
+		s.Clients = append(s.Clients, cl)
+		tt, err := cl.AddTorrent(mi)
+		if err != nil {
+			t.Fatalf("adding torrent to client %v: %v", i, err)
+		}
+		s.Torrents = append(s.Torrents, tt)
+	}
+	for i, tt := range s.Torrents {
+		if i >= opts.Seeders {
+			tt.DownloadAll()
+		}
+		for j, cl := range s.Clients {
+			if j != i {
+				tt.AddClientPeer(cl)
+			}
+		}
+	}
+	return s
+}
+
+func generateMetaInfo(data []byte, pieceLength int64) (*metainfo.MetaInfo, error) {
+	info := metainfo.Info{
+		Name:        "torrenttest",
+		Length:      int64(len(data)),
+		PieceLength: pieceLength,
+	}
+	err := info.GeneratePieces(func(metainfo.FileInfo) (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	infoBytes, err := bencode.Marshal(info)
+	if err != nil {
+		return nil, err
+	}
+	return &metainfo.MetaInfo{InfoBytes: infoBytes}, nil
+}
+
+// Waits until every Client has completed the torrent, and then checks that each has the original
+// data.
+func (s *Swarm) WaitConverged(ctx context.Context) error {
+	for i, tt := range s.Torrents {
+		select {
+		case <-tt.Complete.On():
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for client %v to complete: %w", i, ctx.Err())
+		}
+	}
+	for i, tt := range s.Torrents {
+		r := tt.NewReader()
+		b, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			return fmt.Errorf("reading client %v data: %w", i, err)
+		}
+		if !bytes.Equal(b, s.Data) {
+			return fmt.Errorf("client %v data differs", i)
+		}
+	}
+	return nil
+}
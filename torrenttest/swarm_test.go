@@ -0,0 +1,27 @@
+package torrenttest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent"
+)
+
+func TestSwarmConverges(t *testing.T) {
+	c := qt.New(t)
+	s := NewSwarm(t, SwarmOpts{
+		Clients: 3,
+		Length:  300 << 10,
+		ConfigureClient: func(i int, cfg *torrent.ClientConfig) {
+			cfg.DisableUTP = true
+		},
+	})
+	c.Check(s.Torrents[0].BytesMissing(), qt.Equals, int64(0))
+	c.Check(s.Torrents[1].BytesMissing(), qt.Equals, int64(len(s.Data)))
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	c.Assert(s.WaitConverged(ctx), qt.IsNil)
+}
@@ -0,0 +1,134 @@
+package torrent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent/tracker"
+)
+
+// Tracker clients that haven't been used for this long are closed.
+const trackerClientIdleTimeout = 5 * time.Minute
+
+type trackerClientKey struct {
+	url string
+	// HTTP clients verify TLS against this, and the URL host may have been replaced by an IP.
+	serverName string
+	udpNetwork string
+}
+
+type sharedTrackerClient struct {
+	tracker.Client
+	inUse    int
+	lastUsed time.Time
+}
+
+// Tracker clients shared by announces to the same tracker URL across torrents, so they reuse HTTP
+// connections and UDP connection IDs instead of setting up new ones for each announce.
+type trackerClients struct {
+	// For the shared clients, as they aren't specific to a torrent.
+	logger log.Logger
+	// Redacts tracker URLs in the context of client loggers.
+	redact func(string) string
+
+	mu      sync.Mutex
+	closed  bool
+	clients map[trackerClientKey]*sharedTrackerClient
+	// Pending while there are clients that might become idle.
+	reapTimer *time.Timer
+}
+
+// Returns a client for the announce, and a func to call with the announce error when done with it.
+func (me *trackerClients) get(a tracker.Announce) (_ tracker.Client, release func(error), err error) {
+	opts := a.NewClientOpts()
+	opts.Http.AllowKeepAlive = true
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if me.closed {
+		opts.Logger = a.Logger.WithContextValue(fmt.Sprintf("tracker client for %q", me.redactUrl(a.TrackerUrl)))
+		cl, err := tracker.NewClient(a.TrackerUrl, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		return cl, func(error) { cl.Close() }, nil
+	}
+	key := trackerClientKey{a.TrackerUrl, a.ServerName, a.UdpNetwork}
+	sc, ok := me.clients[key]
+	if !ok {
+		opts.Logger = me.logger
+		cl, err := tracker.NewClient(a.TrackerUrl, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		sc = &sharedTrackerClient{Client: cl}
+		if me.clients == nil {
+			me.clients = make(map[trackerClientKey]*sharedTrackerClient)
+		}
+		me.clients[key] = sc
+	}
+	sc.inUse++
+	return sc.Client, func(err error) {
+		me.mu.Lock()
+		defer me.mu.Unlock()
+		sc.inUse--
+		sc.lastUsed = time.Now()
+		// UDP clients close themselves if their socket fails. Using them again would fail every
+		// later announce, so don't share them further.
+		if errors.Is(err, net.ErrClosed) && me.clients[key] == sc {
+			sc.Close()
+			delete(me.clients, key)
+		}
+		me.scheduleReap()
+	}, nil
+}
+
+func (me *trackerClients) redactUrl(s string) string {
+	if me.redact == nil {
+		return s
+	}
+	return me.redact(s)
+}
+
+func (me *trackerClients) scheduleReap() {
+	if me.closed || me.reapTimer != nil {
+		return
+	}
+	me.reapTimer = time.AfterFunc(trackerClientIdleTimeout, func() {
+		me.mu.Lock()
+		defer me.mu.Unlock()
+		me.reapTimer = nil
+		me.closeIdle()
+		if len(me.clients) != 0 {
+			me.scheduleReap()
+		}
+	})
+}
+
+func (me *trackerClients) closeIdle() {
+	for key, sc := range me.clients {
+		if sc.inUse == 0 && time.Since(sc.lastUsed) >= trackerClientIdleTimeout {
+			sc.Close()
+			delete(me.clients, key)
+		}
+	}
+}
+
+// Closes the shared clients. Later announces, such as stopped events, use their own client.
+func (me *trackerClients) close() {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.closed = true
+	if me.reapTimer != nil {
+		me.reapTimer.Stop()
+		me.reapTimer = nil
+	}
+	for key, sc := range me.clients {
+		sc.Close()
+		delete(me.clients, key)
+	}
+}
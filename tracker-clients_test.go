@@ -0,0 +1,98 @@
+package torrent
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/tracker"
+)
+
+func TestTrackerClientsShared(t *testing.T) {
+	c := qt.New(t)
+	var newConns atomic.Int32
+	s := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("d8:intervali1800e5:peers0:e"))
+	}))
+	s.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			newConns.Add(1)
+		}
+	}
+	s.Start()
+	defer s.Close()
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = true
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	u, err := url.Parse(s.URL + "/announce")
+	c.Assert(err, qt.IsNil)
+	for _, ih := range [][20]byte{{1}, {2}} {
+		tt, _ := cl.AddTorrentInfoHash(ih)
+		ts := &trackerScraper{
+			shortInfohash: *tt.canonicalShortInfohash(),
+			u:             *u,
+			t:             tt,
+		}
+		ar := ts.announce(context.Background(), tracker.Started)
+		c.Assert(ar.Err, qt.IsNil)
+	}
+	c.Check(newConns.Load(), qt.Equals, int32(1))
+	c.Check(cl.trackerClients.clients, qt.HasLen, 1)
+	cl.Close()
+	c.Check(cl.trackerClients.clients, qt.HasLen, 0)
+}
+
+func TestTrackerClientsKeyedByServerName(t *testing.T) {
+	c := qt.New(t)
+	var tcs trackerClients
+	defer tcs.close()
+	u, err := url.Parse("https://127.0.0.1/announce")
+	c.Assert(err, qt.IsNil)
+	var releases []func(error)
+	for _, serverName := range []string{"a.example", "b.example", "a.example"} {
+		_, release, err := tcs.get(tracker.Announce{TrackerUrl: u.String(), ServerName: serverName})
+		c.Assert(err, qt.IsNil)
+		releases = append(releases, release)
+	}
+	c.Check(tcs.clients, qt.HasLen, 2)
+	for _, release := range releases {
+		release(nil)
+	}
+	tcs.mu.Lock()
+	defer tcs.mu.Unlock()
+	c.Check(tcs.reapTimer, qt.IsNotNil)
+	// Idle clients are closed without further announces.
+	for _, sc := range tcs.clients {
+		sc.lastUsed = time.Now().Add(-trackerClientIdleTimeout)
+	}
+	tcs.closeIdle()
+	c.Check(tcs.clients, qt.HasLen, 0)
+}
+
+func TestTrackerClientsEvictClosed(t *testing.T) {
+	c := qt.New(t)
+	var tcs trackerClients
+	defer tcs.close()
+	a := tracker.Announce{TrackerUrl: "udp://127.0.0.1:1/announce", Context: context.Background()}
+	cl, release, err := tcs.get(a)
+	c.Assert(err, qt.IsNil)
+	// UDP clients close themselves when their socket fails.
+	cl.Close()
+	a.Client = cl
+	_, err = a.Do()
+	c.Assert(err, qt.ErrorIs, net.ErrClosed)
+	release(err)
+	c.Check(tcs.clients, qt.HasLen, 0)
+	cl2, release, err := tcs.get(a)
+	c.Assert(err, qt.IsNil)
+	defer release(nil)
+	c.Check(cl2, qt.Not(qt.Equals), cl)
+}
@@ -0,0 +1,84 @@
+package torrent
+
+import (
+	"sort"
+	"time"
+
+	"github.com/anacrolix/log"
+)
+
+const defaultDeadTrackerProbeInterval = time.Hour
+
+func (me *trackerScraper) probeInterval() time.Duration {
+	if d := me.t.cl.config.DeadTrackerProbeInterval; d > 0 {
+		return d
+	}
+	return defaultDeadTrackerProbeInterval
+}
+
+// Counts consecutive announce failures, disabling the tracker once there are too many, and
+// re-enabling it when an announce succeeds. A disabled tracker's next announce is a probe after the
+// probe interval. Called with the Client lock held.
+func (me *trackerScraper) updateHealth(ar *trackerAnnounceResult) {
+	if ar.Err == nil {
+		if me.disabled {
+			me.t.logger.WithDefaultLevel(log.Info).Printf(
+				"tracker %q responded after %d failed announces, re-enabling",
+				me.redactedUrl(), me.consecutiveFailures)
+			me.disabled = false
+		}
+		me.consecutiveFailures = 0
+		return
+	}
+	me.consecutiveFailures++
+	threshold := me.t.cl.config.DeadTrackerFailures
+	if !me.disabled && threshold > 0 && me.consecutiveFailures >= threshold {
+		me.disabled = true
+		me.t.logger.WithDefaultLevel(log.Warning).Printf(
+			"disabling tracker %q after %d consecutive failed announces: %v",
+			me.redactedUrl(), me.consecutiveFailures, me.t.cl.redactTracker(ar.Err.Error()))
+	}
+	if me.disabled {
+		ar.Interval = me.probeInterval()
+	}
+}
+
+// Returns the URLs of trackers that were disabled after repeatedly failing to respond. See
+// ClientConfig.DeadTrackerFailures. UDP trackers are listed separately for each address family,
+// with the udp4 and udp6 schemes.
+func (t *Torrent) DisabledTrackers() (ret []string) {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	seen := make(map[string]bool)
+	for _, ta := range t.trackerAnnouncers {
+		ts, ok := ta.(*trackerScraper)
+		if !ok || !ts.disabled {
+			continue
+		}
+		u := ts.u.String()
+		if !seen[u] {
+			seen[u] = true
+			ret = append(ret, u)
+		}
+	}
+	sort.Strings(ret)
+	return
+}
+
+// Re-enables a tracker disabled after repeated failures, announcing to it immediately. The URL
+// should be one returned by DisabledTrackers. Returns false if no such tracker was disabled.
+func (t *Torrent) EnableTracker(url string) (ok bool) {
+	t.cl.lock()
+	defer t.cl.unlock()
+	for _, ta := range t.trackerAnnouncers {
+		ts, isScraper := ta.(*trackerScraper)
+		if !isScraper || !ts.disabled || ts.u.String() != url {
+			continue
+		}
+		ts.disabled = false
+		ts.consecutiveFailures = 0
+		ts.reenabled.Broadcast()
+		ok = true
+	}
+	return
+}
@@ -0,0 +1,81 @@
+package torrent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/tracker"
+)
+
+func TestDeadTrackerDisabled(t *testing.T) {
+	c := qt.New(t)
+	var fail atomic.Bool
+	fail.Store(true)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("d8:intervali1800e5:peers0:e"))
+	}))
+	defer s.Close()
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = true
+	cfg.DeadTrackerFailures = 2
+	cfg.DeadTrackerProbeInterval = 3 * time.Hour
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	u, err := url.Parse(s.URL + "/announce")
+	c.Assert(err, qt.IsNil)
+	ts := &trackerScraper{
+		shortInfohash: *tt.canonicalShortInfohash(),
+		u:             *u,
+		t:             tt,
+	}
+	cl.lock()
+	tt.trackerAnnouncers = map[torrentTrackerAnnouncerKey]torrentTrackerAnnouncer{
+		{ts.shortInfohash, u.String()}: ts,
+	}
+	cl.unlock()
+	announce := func() trackerAnnounceResult {
+		ar := ts.announce(context.Background(), tracker.None)
+		cl.lock()
+		defer cl.unlock()
+		ts.updateHealth(&ar)
+		return ar
+	}
+	c.Check(announce().Err, qt.IsNotNil)
+	c.Check(tt.DisabledTrackers(), qt.HasLen, 0)
+	ar := announce()
+	c.Check(ar.Err, qt.IsNotNil)
+	c.Check(ar.Interval, qt.Equals, 3*time.Hour)
+	c.Check(tt.DisabledTrackers(), qt.DeepEquals, []string{u.String()})
+	cl.lock()
+	reenabled := ts.reenabled.Signaled()
+	cl.unlock()
+	c.Check(tt.EnableTracker("http://example.com/announce"), qt.IsFalse)
+	c.Check(tt.EnableTracker(u.String()), qt.IsTrue)
+	<-reenabled
+	c.Check(tt.DisabledTrackers(), qt.HasLen, 0)
+	// Failures count from zero again once re-enabled.
+	c.Check(announce().Err, qt.IsNotNil)
+	c.Check(tt.DisabledTrackers(), qt.HasLen, 0)
+	c.Check(announce().Err, qt.IsNotNil)
+	c.Check(tt.DisabledTrackers(), qt.HasLen, 1)
+	// A successful probe re-enables the tracker.
+	fail.Store(false)
+	c.Check(announce().Err, qt.IsNil)
+	c.Check(tt.DisabledTrackers(), qt.HasLen, 0)
+	c.Check(ts.consecutiveFailures, qt.Equals, 0)
+}
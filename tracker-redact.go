@@ -0,0 +1,41 @@
+package torrent
+
+import (
+	"regexp"
+	"strings"
+)
+
+const redactedTrackerSecret = "REDACTED"
+
+var (
+	trackerUrlUserinfoRegexp = regexp.MustCompile(`(://)[^/@\s"]+@`)
+	// Query parameters private trackers commonly use for credentials.
+	trackerUrlSecretParamRegexp = regexp.MustCompile(
+		`(?i)([?&;](?:passkey|authkey|torrent_pass|pk|key|token|secret|auth|apikey|api_key|password|pass)=)[^&;\s"]*`)
+	// Path segments that look like passkeys, such as "/0123456789abcdef0123456789abcdef/announce".
+	// The preceding character excludes the host, which follows "//".
+	trackerUrlSecretPathRegexp = regexp.MustCompile(`([^/:])/[0-9A-Za-z]{16,}\b`)
+)
+
+// Replaces secrets in text that may contain tracker URLs, such as announce errors, with
+// "REDACTED". It handles userinfo, common passkey query parameters, and path segments of 16 or more
+// alphanumerics that include a digit. This is the default for ClientConfig.TrackerRedactor.
+func RedactTrackerUrls(s string) string {
+	s = trackerUrlUserinfoRegexp.ReplaceAllString(s, "${1}"+redactedTrackerSecret+"@")
+	s = trackerUrlSecretParamRegexp.ReplaceAllString(s, "${1}"+redactedTrackerSecret)
+	s = trackerUrlSecretPathRegexp.ReplaceAllStringFunc(s, func(m string) string {
+		if !strings.ContainsAny(m[2:], "0123456789") {
+			return m
+		}
+		return m[:2] + redactedTrackerSecret
+	})
+	return s
+}
+
+// Applies the configured TrackerRedactor to text destined for status output, logs or ClientState.
+func (cl *Client) redactTracker(s string) string {
+	if f := cl.config.TrackerRedactor; f != nil {
+		return f(s)
+	}
+	return RedactTrackerUrls(s)
+}
@@ -22,10 +22,13 @@ type AnnounceOpt = trHttp.AnnounceOpt
 
 type NewClientOpts struct {
 	Http trHttp.NewClientOpts
-	// Overrides the network in the scheme. Probably a legacy thing.
+	// Overrides the network in the scheme. The Client uses it to pick "udp4" or "udp6" by the
+	// address family of the tracker IP it resolved.
 	UdpNetwork   string
 	Logger       log.Logger
 	ListenPacket func(network, addr string) (net.PacketConn, error)
+	// Retransmit schedule for UDP tracker requests.
+	UdpRetransmit udp.RetransmitPolicy
 }
 
 func NewClient(urlStr string, opts NewClientOpts) (Client, error) {
@@ -46,6 +49,7 @@ func NewClient(urlStr string, opts NewClientOpts) (Client, error) {
 			Host:         _url.Host,
 			Logger:       opts.Logger,
 			ListenPacket: opts.ListenPacket,
+			Retransmit:   opts.UdpRetransmit,
 		})
 		if err != nil {
 			return nil, err
@@ -53,6 +57,7 @@ func NewClient(urlStr string, opts NewClientOpts) (Client, error) {
 		return &udpClient{
 			cl:         cc,
 			requestUri: _url.RequestURI(),
+			ipv6:       network == "udp6",
 		}, nil
 	default:
 		return nil, ErrBadScheme
@@ -11,6 +11,8 @@ import (
 type Client struct {
 	hc   *http.Client
 	url_ *url.URL
+	// Whether hc was created for this Client, and so its idle connections can be closed with it.
+	ownHttpClient bool
 }
 
 type (
@@ -23,11 +25,21 @@ type NewClientOpts struct {
 	DialContext    DialContextFunc
 	ServerName     string
 	AllowKeepAlive bool
+	// If set, this is used for requests, and the options above that configure the transport are
+	// ignored.
+	HttpClient *http.Client
 }
 
 func NewClient(url_ *url.URL, opts NewClientOpts) Client {
+	if opts.HttpClient != nil {
+		return Client{
+			url_: url_,
+			hc:   opts.HttpClient,
+		}
+	}
 	return Client{
-		url_: url_,
+		url_:          url_,
+		ownHttpClient: true,
 		hc: &http.Client{
 			Transport: &http.Transport{
 				DialContext: opts.DialContext,
@@ -44,6 +56,8 @@ func NewClient(url_ *url.URL, opts NewClientOpts) Client {
 }
 
 func (cl Client) Close() error {
-	cl.hc.CloseIdleConnections()
+	if cl.ownHttpClient {
+		cl.hc.CloseIdleConnections()
+	}
 	return nil
 }
@@ -43,6 +43,10 @@ func setAnnounceParams(_url *url.URL, ar *AnnounceRequest, opts AnnounceOpt) {
 	}
 	q.Set("left", strconv.FormatInt(left, 10))
 
+	// Zero is omitted so that the tracker applies its default.
+	if ar.NumWant > 0 {
+		q.Set("numwant", strconv.FormatInt(int64(ar.NumWant), 10))
+	}
 	if ar.Event != shared.None {
 		q.Set("event", ar.Event.String())
 	}
@@ -51,18 +55,23 @@ func setAnnounceParams(_url *url.URL, ar *AnnounceRequest, opts AnnounceOpt) {
 	// According to https://wiki.vuze.com/w/Message_Stream_Encryption. TODO:
 	// Take EncryptionPolicy or something like it as a parameter.
 	q.Set("supportcrypto", "1")
-	doIp := func(versionKey string, ip net.IP) {
-		if ip == nil {
+	doIp := func(versionKey string, ip net.IP, port int, ipv6 bool) {
+		if ip == nil || (ip.To4() == nil) != ipv6 {
 			return
 		}
 		ipString := ip.String()
-		q.Set(versionKey, ipString)
+		// BEP 7 allows an endpoint for peers reaching us on a different port in each family.
+		if port != 0 && port != int(ar.Port) {
+			q.Set(versionKey, net.JoinHostPort(ipString, strconv.Itoa(port)))
+		} else {
+			q.Set(versionKey, ipString)
+		}
 		// Let's try listing them. BEP 3 mentions having an "ip" param, and BEP 7 says we can list
 		// addresses for other address-families, although it's not encouraged.
 		q.Add("ip", ipString)
 	}
-	doIp("ipv4", opts.ClientIp4)
-	doIp("ipv6", opts.ClientIp6)
+	doIp("ipv4", opts.ClientIp4, opts.ClientPort4, false)
+	doIp("ipv6", opts.ClientIp6, opts.ClientPort6, true)
 	// We're operating purely on query-escaped strings, where + would have already been encoded to
 	// %2B, and + has no other special meaning. See https://github.com/anacrolix/torrent/issues/534.
 	qstr := strings.ReplaceAll(q.Encode(), "+", "%20")
@@ -81,6 +90,12 @@ type AnnounceOpt struct {
 	ClientIp4           net.IP
 	ClientIp6           net.IP
 	HttpRequestDirector func(*http.Request) error
+	// Extra headers to add to the request, such as for authentication.
+	Header http.Header
+	// Ports for ClientIp4 and ClientIp6, sent if they're not zero and differ from the announce
+	// port.
+	ClientPort4 int
+	ClientPort6 int
 }
 
 type AnnounceRequest = udp.AnnounceRequest
@@ -96,6 +111,9 @@ func (cl Client) Announce(ctx context.Context, ar AnnounceRequest, opt AnnounceO
 	if userAgent != "" {
 		req.Header.Set("User-Agent", userAgent)
 	}
+	for k, vs := range opt.Header {
+		req.Header[k] = append(req.Header[k], vs...)
+	}
 
 	if opt.HttpRequestDirector != nil {
 		err = opt.HttpRequestDirector(req)
@@ -133,10 +151,19 @@ func (cl Client) Announce(ctx context.Context, ar AnnounceRequest, opt AnnounceO
 	ret.Interval = trackerResponse.Interval
 	ret.Leechers = trackerResponse.Incomplete
 	ret.Seeders = trackerResponse.Complete
+	ret.WarningMessage = trackerResponse.WarningMessage
+	if l := len(trackerResponse.ExternalIp); l == net.IPv4len || l == net.IPv6len {
+		ret.ExternalIp = net.IP(trackerResponse.ExternalIp)
+	}
 	if len(trackerResponse.Peers.List) != 0 {
 		vars.Add("http responses with nonempty peers key", 1)
 	}
 	ret.Peers = trackerResponse.Peers.List
+	if trackerResponse.Peers.Compact && len(trackerResponse.CryptoFlags) == len(ret.Peers) {
+		for i, f := range []byte(trackerResponse.CryptoFlags) {
+			ret.Peers[i].RequiresEncryption = f == 1
+		}
+	}
 	if len(trackerResponse.Peers6) != 0 {
 		vars.Add("http responses with nonempty peers6 key", 1)
 	}
@@ -154,4 +181,8 @@ type AnnounceResponse struct {
 	Leechers int32
 	Seeders  int32
 	Peers    []Peer
+	// Given by some HTTP trackers. The announce still succeeded.
+	WarningMessage string
+	// Our IP as seen by an HTTP tracker, per BEP 24. Nil if it wasn't given.
+	ExternalIp net.IP
 }
@@ -1,6 +1,10 @@
 package httpTracker
 
 import (
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"testing"
 
@@ -74,3 +78,68 @@ func TestSetAnnounceInfohashParamWithSpaces(t *testing.T) {
 		qt.Contains,
 		"info_hash=%2Bv%0A%A1x%93%200%C8G%DC%DF%8E%AE%BFV%0A%1B%D1l")
 }
+
+func TestSetAnnounceClientIps(t *testing.T) {
+	c := qt.New(t)
+	u := &url.URL{}
+	setAnnounceParams(u, &udp.AnnounceRequest{Port: 42069}, AnnounceOpt{
+		ClientIp4:   net.ParseIP("1.2.3.4"),
+		ClientIp6:   net.ParseIP("2001:db8::1"),
+		ClientPort6: 6881,
+	})
+	q := u.Query()
+	c.Check(q.Get("ipv4"), qt.Equals, "1.2.3.4")
+	c.Check(q.Get("ipv6"), qt.Equals, "[2001:db8::1]:6881")
+	c.Check(q["ip"], qt.DeepEquals, []string{"1.2.3.4", "2001:db8::1"})
+	// Addresses of the wrong family aren't sent, and the port is omitted if it's the announce port.
+	u = &url.URL{}
+	setAnnounceParams(u, &udp.AnnounceRequest{Port: 42069}, AnnounceOpt{
+		ClientIp4:   net.ParseIP("2001:db8::1"),
+		ClientIp6:   net.ParseIP("2001:db8::2"),
+		ClientPort6: 42069,
+	})
+	q = u.Query()
+	c.Check(q.Has("ipv4"), qt.IsFalse)
+	c.Check(q.Get("ipv6"), qt.Equals, "2001:db8::2")
+	c.Check(q["ip"], qt.DeepEquals, []string{"2001:db8::2"})
+}
+
+func TestUnmarshalHttpResponseWarningAndExternalIp(t *testing.T) {
+	c := qt.New(t)
+	var hr HttpResponse
+	c.Assert(bencode.Unmarshal(
+		[]byte("d11:external ip4:\x01\x02\x03\x0415:warning message7:go awaye"),
+		&hr,
+	), qt.IsNil)
+	c.Check(hr.WarningMessage, qt.Equals, "go away")
+	c.Check(hr.ExternalIp, qt.DeepEquals, []byte{1, 2, 3, 4})
+}
+
+func TestAnnounceCryptoFlags(t *testing.T) {
+	c := qt.New(t)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("d12:crypto_flags2:\x00\x018:intervali1800e5:peers12:\x01\x02\x03\x04\x00\x01\x05\x06\x07\x08\x00\x02e"))
+	}))
+	defer s.Close()
+	u, err := url.Parse(s.URL)
+	c.Assert(err, qt.IsNil)
+	cl := NewClient(u, NewClientOpts{})
+	defer cl.Close()
+	ar, err := cl.Announce(context.Background(), AnnounceRequest{}, AnnounceOpt{})
+	c.Assert(err, qt.IsNil)
+	c.Assert(ar.Peers, qt.HasLen, 2)
+	c.Check(ar.Peers[0].RequiresEncryption, qt.IsFalse)
+	c.Check(ar.Peers[1].RequiresEncryption, qt.IsTrue)
+}
+
+func TestUnmarshalHttpResponseMalformedPeerDicts(t *testing.T) {
+	for _, peers := range []string{
+		"li1ee",
+		"ld2:ipi1eee",
+		"ld2:ip7:1.2.3.44:port3:abcee",
+		"ld2:ip7:1.2.3.44:porti70000eee",
+	} {
+		var hr HttpResponse
+		qt.Check(t, bencode.Unmarshal([]byte("d5:peers"+peers+"e"), &hr), qt.IsNotNil, qt.Commentf("%q", peers))
+	}
+}
@@ -2,6 +2,7 @@ package httpTracker
 
 import (
 	"fmt"
+	"math"
 	"net"
 	"net/netip"
 
@@ -13,6 +14,8 @@ type Peer struct {
 	IP   net.IP `bencode:"ip"`
 	Port int    `bencode:"port"`
 	ID   []byte `bencode:"peer id"`
+	// Set from the tracker's crypto_flags.
+	RequiresEncryption bool `bencode:"-"`
 }
 
 func (p Peer) ToNetipAddrPort() (addrPort netip.AddrPort, ok bool) {
@@ -30,7 +33,28 @@ func (p Peer) String() string {
 	}
 }
 
-// Set from the non-compact form in BEP 3.
+// The non-compact form of a peer in BEP 3.
+type peerDict struct {
+	// This may also be a DNS name, which we don't handle.
+	IP     string `bencode:"ip"`
+	Port   int64  `bencode:"port"`
+	PeerId string `bencode:"peer id"`
+}
+
+func (d peerDict) toPeer() (p Peer, err error) {
+	if d.Port < 0 || d.Port > math.MaxUint16 {
+		err = fmt.Errorf("peer has invalid port %v", d.Port)
+		return
+	}
+	p.IP = net.ParseIP(d.IP)
+	p.Port = int(d.Port)
+	if d.PeerId != "" {
+		p.ID = []byte(d.PeerId)
+	}
+	return
+}
+
+// Set from the non-compact form in BEP 3. It panics if the values have the wrong types.
 func (p *Peer) FromDictInterface(d map[string]interface{}) {
 	p.IP = net.ParseIP(d["ip"].(string))
 	if _, ok := d["peer id"]; ok {
@@ -17,6 +17,13 @@ type HttpResponse struct {
 	Peers         Peers  `bencode:"peers"`
 	// BEP 7
 	Peers6 krpc.CompactIPv6NodeAddrs `bencode:"peers6"`
+	// Not fatal, unlike FailureReason. See BEP 3's "Tracker Protocol Extensions" wiki page.
+	WarningMessage string `bencode:"warning message,omitempty"`
+	// BEP 24. The IP the tracker saw the announce come from, as 4 or 16 bytes.
+	ExternalIp []byte `bencode:"external ip,omitempty"`
+	// One byte per peer in a compact Peers, where 1 means the peer requires encryption. It's
+	// requested with supportcrypto, as implemented by uTorrent and others.
+	CryptoFlags string `bencode:"crypto_flags,omitempty"`
 }
 
 type Peers struct {
@@ -69,9 +76,18 @@ func (me *Peers) UnmarshalBencode(b []byte) (err error) {
 	case []interface{}:
 		vars.Add("http responses with list peers", 1)
 		me.Compact = false
-		for _, i := range v {
+		// Decode again into typed values, so that malformed peers from the tracker are errors.
+		var dicts []peerDict
+		err = bencode.Unmarshal(b, &dicts)
+		if err != nil {
+			return
+		}
+		for _, d := range dicts {
 			var p Peer
-			p.FromDictInterface(i.(map[string]interface{}))
+			p, err = d.toPeer()
+			if err != nil {
+				return
+			}
 			me.List = append(me.List, p)
 		}
 		return
@@ -22,6 +22,7 @@ const (
 	Started   = shared.Started
 	Stopped   = shared.Stopped
 	Completed = shared.Completed
+	Paused    = shared.Paused
 )
 
 type AnnounceRequest = udp.AnnounceRequest
@@ -51,26 +52,47 @@ type Announce struct {
 	ClientIp6 krpc.NodeAddr
 	Context   context.Context
 	Logger    log.Logger
+	// Used for HTTP trackers if set, instead of a client configured from HttpProxy and DialContext.
+	HttpClient *http.Client
+	// Extra headers for HTTP tracker requests.
+	HttpHeader http.Header
+	// Retransmit schedule for UDP trackers. Failed announces return a udp.TimeoutError if the
+	// tracker doesn't respond.
+	UdpRetransmit udp.RetransmitPolicy
+	// If set, the announce is made with this Client instead of one created from the fields above
+	// and closed after. This lets announces to the same tracker share HTTP connections and UDP
+	// connection IDs.
+	Client Client
 }
 
 // The code *is* the documentation.
 const DefaultTrackerAnnounceTimeout = 15 * time.Second
 
-func (me Announce) Do() (res AnnounceResponse, err error) {
-	cl, err := NewClient(me.TrackerUrl, NewClientOpts{
+// The options Do uses to create a Client for the announce. See Announce.Client.
+func (me Announce) NewClientOpts() NewClientOpts {
+	return NewClientOpts{
 		Http: trHttp.NewClientOpts{
 			Proxy:       me.HttpProxy,
 			DialContext: me.DialContext,
 			ServerName:  me.ServerName,
+			HttpClient:  me.HttpClient,
 		},
-		UdpNetwork:   me.UdpNetwork,
-		Logger:       me.Logger.WithContextValue(fmt.Sprintf("tracker client for %q", me.TrackerUrl)),
-		ListenPacket: me.ListenPacket,
-	})
-	if err != nil {
-		return
+		UdpNetwork:    me.UdpNetwork,
+		Logger:        me.Logger.WithContextValue(fmt.Sprintf("tracker client for %q", me.TrackerUrl)),
+		ListenPacket:  me.ListenPacket,
+		UdpRetransmit: me.UdpRetransmit,
+	}
+}
+
+func (me Announce) Do() (res AnnounceResponse, err error) {
+	cl := me.Client
+	if cl == nil {
+		cl, err = NewClient(me.TrackerUrl, me.NewClientOpts())
+		if err != nil {
+			return
+		}
+		defer cl.Close()
 	}
-	defer cl.Close()
 	if me.Context == nil {
 		// This is just to maintain the old behaviour that should be a timeout of 15s. Users can
 		// override it by providing their own Context. See comments elsewhere about longer timeouts
@@ -84,6 +106,9 @@ func (me Announce) Do() (res AnnounceResponse, err error) {
 		HostHeader:          me.HostHeader,
 		ClientIp4:           me.ClientIp4.IP,
 		ClientIp6:           me.ClientIp6.IP,
+		ClientPort4:         me.ClientIp4.Port,
+		ClientPort6:         me.ClientIp6.Port,
 		HttpRequestDirector: me.HttpRequestDirector,
+		Header:              me.HttpHeader,
 	})
 }
@@ -14,6 +14,8 @@ import (
 type udpClient struct {
 	cl         *udp.ConnClient
 	requestUri string
+	// The tracker is known to be reached over IPv6, where the announce has no IPv4 address.
+	ipv6 bool
 }
 
 func (c *udpClient) Scrape(ctx context.Context, ihs []infohash.T) (out udp.ScrapeResponse, err error) {
@@ -30,11 +32,10 @@ func (c *udpClient) Close() error {
 }
 
 func (c *udpClient) Announce(ctx context.Context, req AnnounceRequest, opts trHttp.AnnounceOpt) (res AnnounceResponse, err error) {
-	if req.IPAddress == 0 && opts.ClientIp4 != nil {
+	if req.IPAddress == 0 && opts.ClientIp4 != nil && !c.ipv6 {
 		// I think we're taking bytes in big-endian order (all IPs), and writing it to a natively
 		// ordered uint32. This will be correctly ordered when written back out by the UDP client
-		// later. I'm ignoring the fact that IPv6 announces shouldn't have an IP address, we have a
-		// perfectly good IPv4 address.
+		// later.
 		req.IPAddress = binary.BigEndian.Uint32(opts.ClientIp4.To4())
 	}
 	h, nas, err := c.cl.Announce(ctx, req, udp.Options{RequestUri: c.requestUri})
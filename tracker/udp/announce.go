@@ -35,7 +35,7 @@ func (me *AnnounceEvent) UnmarshalText(text []byte) error {
 	return fmt.Errorf("unknown event")
 }
 
-var announceEventStrings = []string{"", "completed", "started", "stopped"}
+var announceEventStrings = []string{"", "completed", "started", "stopped", "paused"}
 
 func (e AnnounceEvent) String() string {
 	// See BEP 3, "event", and
@@ -4,10 +4,12 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/anacrolix/dht/v2/krpc"
@@ -24,6 +26,7 @@ type Client struct {
 
 	Dispatcher *Dispatcher
 	Writer     io.Writer
+	Retransmit RetransmitPolicy
 }
 
 func (cl *Client) Announce(
@@ -167,17 +170,25 @@ func (cl *Client) writeRequest(
 	return
 }
 
-func (cl *Client) requestWriter(ctx context.Context, action Action, body []byte, tId TransactionId) (err error) {
+// Writes the request until the context is done or the retransmits run out. attempts counts the
+// writes.
+func (cl *Client) requestWriter(
+	ctx context.Context, action Action, body []byte, tId TransactionId, attempts *atomic.Int32,
+) (err error) {
 	var buf bytes.Buffer
 	for n := 0; ; n++ {
 		err = cl.writeRequest(ctx, action, body, tId, &buf)
 		if err != nil {
 			return
 		}
+		attempts.Add(1)
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case <-time.After(timeout(n)):
+		case <-time.After(cl.Retransmit.timeout(n)):
+		}
+		if max := cl.Retransmit.MaxRetries; max != 0 && n >= max {
+			return TimeoutError{Attempts: n + 1}
 		}
 	}
 }
@@ -201,8 +212,9 @@ func (cl *Client) request(ctx context.Context, action Action, body []byte) (resp
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 	writeErr := make(chan error, 1)
+	var attempts atomic.Int32
 	go func() {
-		writeErr <- cl.requestWriter(ctx, action, body, t.Id())
+		writeErr <- cl.requestWriter(ctx, action, body, t.Id(), &attempts)
 	}()
 	select {
 	case dr := <-respChan:
@@ -217,9 +229,18 @@ func (cl *Client) request(ctx context.Context, action Action, body []byte) (resp
 			err = fmt.Errorf("unexpected response action %v", dr.Header.Action)
 		}
 	case err = <-writeErr:
-		err = fmt.Errorf("write error: %w", err)
+		switch {
+		case errors.As(err, new(TimeoutError)):
+		case errors.Is(err, context.DeadlineExceeded):
+			err = TimeoutError{Attempts: int(attempts.Load()), Err: err}
+		default:
+			err = fmt.Errorf("write error: %w", err)
+		}
 	case <-ctx.Done():
 		err = ctx.Err()
+		if errors.Is(err, context.DeadlineExceeded) {
+			err = TimeoutError{Attempts: int(attempts.Load()), Err: err}
+		}
 	}
 	return
 }
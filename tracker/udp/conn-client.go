@@ -21,6 +21,8 @@ type NewConnClientOpts struct {
 	Logger log.Logger
 	// Custom function to use as a substitute for net.ListenPacket
 	ListenPacket listenPacketFunc
+	// Retransmit schedule for requests.
+	Retransmit RetransmitPolicy
 }
 
 // Manages a Client with a specific connection.
@@ -104,6 +106,7 @@ func NewConnClient(opts NewConnClientOpts) (cc *ConnClient, err error) {
 				network: opts.Network,
 				address: opts.Host,
 			},
+			Retransmit: opts.Retransmit,
 		},
 		conn:    conn,
 		newOpts: opts,
@@ -1,18 +1,77 @@
 package udp
 
 import (
+	"fmt"
 	"time"
 )
 
-const maxTimeout = 3840 * time.Second
+const (
+	defaultInitialTimeout = 15 * time.Second
+	// BEP 15 stops doubling the timeout after this many retransmits.
+	maxTimeoutDoublings = 8
+	maxTimeout          = defaultInitialTimeout << maxTimeoutDoublings
+)
+
+// Controls retransmits of requests that go unanswered. The zero value follows BEP 15, waiting 15s *
+// 2^n after the nth transmit, until the request's context is done.
+type RetransmitPolicy struct {
+	// The wait after the first transmit, doubled after each retransmit. Defaults to 15s.
+	InitialTimeout time.Duration
+	// Requests fail with a TimeoutError after this many retransmits go unanswered. Zero means
+	// retransmit until the context is done.
+	MaxRetries int
+}
 
-func timeout(contiguousTimeouts int) (d time.Duration) {
-	if contiguousTimeouts > 8 {
-		contiguousTimeouts = 8
+func (me RetransmitPolicy) timeout(contiguousTimeouts int) (d time.Duration) {
+	if contiguousTimeouts > maxTimeoutDoublings {
+		contiguousTimeouts = maxTimeoutDoublings
+	}
+	d = me.InitialTimeout
+	if d == 0 {
+		d = defaultInitialTimeout
 	}
-	d = 15 * time.Second
 	for ; contiguousTimeouts > 0; contiguousTimeouts-- {
 		d *= 2
 	}
 	return
 }
+
+// Returns the time a request takes to give up if MaxRetries is set, or zero.
+func (me RetransmitPolicy) Total() (ret time.Duration) {
+	if me.MaxRetries == 0 {
+		return
+	}
+	for n := 0; n <= me.MaxRetries; n++ {
+		ret += me.timeout(n)
+	}
+	return
+}
+
+func timeout(contiguousTimeouts int) time.Duration {
+	return RetransmitPolicy{}.timeout(contiguousTimeouts)
+}
+
+// Returned when a request goes unanswered, either through all the retransmits allowed by the
+// RetransmitPolicy, or until the context deadline. It's distinct from errors writing requests, such
+// as when the tracker refuses the connection.
+type TimeoutError struct {
+	// The number of times the request was sent.
+	Attempts int
+	// The context error if it ended the request.
+	Err error
+}
+
+func (me TimeoutError) Error() string {
+	if me.Err != nil {
+		return fmt.Sprintf("request timed out after %v attempts: %v", me.Attempts, me.Err)
+	}
+	return fmt.Sprintf("request timed out after %v attempts", me.Attempts)
+}
+
+func (me TimeoutError) Unwrap() error {
+	return me.Err
+}
+
+func (me TimeoutError) Timeout() bool {
+	return true
+}
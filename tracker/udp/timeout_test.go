@@ -1,8 +1,13 @@
 package udp
 
 import (
+	"context"
+	"errors"
 	"math"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 
 	qt "github.com/frankban/quicktest"
 )
@@ -13,3 +18,54 @@ func TestTimeoutMax(t *testing.T) {
 	c.Check(timeout(9), qt.Equals, maxTimeout)
 	c.Check(timeout(math.MaxInt32), qt.Equals, maxTimeout)
 }
+
+func TestRetransmitPolicy(t *testing.T) {
+	c := qt.New(t)
+	c.Check(RetransmitPolicy{}.Total(), qt.Equals, time.Duration(0))
+	p := RetransmitPolicy{InitialTimeout: time.Second, MaxRetries: 2}
+	c.Check(p.timeout(0), qt.Equals, time.Second)
+	c.Check(p.timeout(2), qt.Equals, 4*time.Second)
+	c.Check(p.Total(), qt.Equals, 7*time.Second)
+}
+
+func TestRequestTimeoutError(t *testing.T) {
+	c := qt.New(t)
+	var writes atomic.Int32
+	newClient := func(w writerFunc, p RetransmitPolicy) *Client {
+		return &Client{
+			Dispatcher: &Dispatcher{},
+			Writer:     w,
+			Retransmit: p,
+		}
+	}
+	discard := func(b []byte) (int, error) {
+		writes.Add(1)
+		return len(b), nil
+	}
+	cl := newClient(discard, RetransmitPolicy{InitialTimeout: time.Millisecond, MaxRetries: 2})
+	_, err := cl.Scrape(context.Background(), []InfoHash{{1}})
+	var te TimeoutError
+	c.Assert(errors.As(err, &te), qt.IsTrue)
+	c.Check(te.Attempts, qt.Equals, 3)
+	c.Check(writes.Load(), qt.Equals, int32(3))
+	// Context deadlines are reported as timeouts too, and still match the context error.
+	cl = newClient(discard, RetransmitPolicy{})
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err = cl.Scrape(ctx, []InfoHash{{1}})
+	c.Check(errors.As(err, &te), qt.IsTrue)
+	c.Check(err, qt.ErrorIs, context.DeadlineExceeded)
+	// Write errors, such as connection refused, aren't timeouts.
+	cl = newClient(func(b []byte) (int, error) {
+		return 0, syscall.ECONNREFUSED
+	}, RetransmitPolicy{})
+	_, err = cl.Scrape(context.Background(), []InfoHash{{1}})
+	c.Check(errors.As(err, &te), qt.IsFalse)
+	c.Check(err, qt.ErrorIs, syscall.ECONNREFUSED)
+}
+
+type writerFunc func([]byte) (int, error)
+
+func (me writerFunc) Write(b []byte) (int, error) {
+	return me(b)
+}
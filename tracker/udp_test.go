@@ -66,6 +66,48 @@ func TestAnnounceLocalhost(t *testing.T) {
 	assert.EqualValues(t, 2, len(ar.Peers))
 }
 
+func TestAnnounceLocalhostIpv6(t *testing.T) {
+	t.Parallel()
+	ih := [20]byte{1}
+	srv := server{
+		t: map[[20]byte]torrent{
+			ih: {
+				Seeders: 1,
+				Peers: krpc.CompactIPv6NodeAddrs{
+					{net.ParseIP("2001:db8::1"), 5},
+					{net.ParseIP("2001:db8::2"), 10},
+				},
+			},
+		},
+	}
+	var err error
+	srv.pc, err = net.ListenPacket("udp6", "[::1]:0")
+	if err != nil {
+		t.Skipf("ipv6 loopback unavailable: %v", err)
+	}
+	defer srv.pc.Close()
+	go func() {
+		require.NoError(t, srv.serveOne())
+		require.NoError(t, srv.serveOne())
+	}()
+	req := AnnounceRequest{
+		NumWant:  -1,
+		Event:    Started,
+		InfoHash: ih,
+	}
+	ar, err := Announce{
+		TrackerUrl: fmt.Sprintf("udp://%s/announce", srv.pc.LocalAddr().String()),
+		UdpNetwork: "udp6",
+		Request:    req,
+		ClientIp4:  krpc.NodeAddr{IP: net.IPv4(1, 2, 3, 4)},
+	}.Do()
+	require.NoError(t, err)
+	assert.EqualValues(t, 1, ar.Seeders)
+	require.Len(t, ar.Peers, 2)
+	assert.True(t, ar.Peers[1].IP.Equal(net.ParseIP("2001:db8::2")))
+	assert.EqualValues(t, 10, ar.Peers[1].Port)
+}
+
 func TestUDPTracker(t *testing.T) {
 	t.Parallel()
 	if testing.Short() {
@@ -6,9 +6,12 @@ import (
 	"errors"
 	"fmt"
 	"net"
+	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
+	"github.com/anacrolix/chansync"
 	"github.com/anacrolix/dht/v2/krpc"
 	"github.com/anacrolix/log"
 
@@ -23,6 +26,14 @@ type trackerScraper struct {
 	t               *Torrent
 	lastAnnounce    trackerAnnounceResult
 	lookupTrackerIp func(*url.URL) ([]net.IP, error)
+	// Whether the tracker has been sent the completed event.
+	completedSent bool
+	// Announce failures since the last success. Guarded by the Client lock.
+	consecutiveFailures int
+	// Set after ClientConfig.DeadTrackerFailures consecutive failures. Guarded by the Client lock.
+	disabled bool
+	// Broadcast when a disabled tracker is re-enabled with Torrent.EnableTracker.
+	reenabled chansync.BroadcastCond
 }
 
 type torrentTrackerAnnouncer interface {
@@ -30,15 +41,20 @@ type torrentTrackerAnnouncer interface {
 	URL() *url.URL
 }
 
-func (me trackerScraper) URL() *url.URL {
+func (me *trackerScraper) URL() *url.URL {
 	return &me.u
 }
 
+// The tracker URL as it should appear in logs.
+func (me *trackerScraper) redactedUrl() string {
+	return me.t.cl.redactTracker(me.u.String())
+}
+
 func (ts *trackerScraper) statusLine() string {
 	var w bytes.Buffer
 	fmt.Fprintf(&w, "next ann: %v, last ann: %v",
 		func() string {
-			na := time.Until(ts.lastAnnounce.Completed.Add(ts.lastAnnounce.Interval))
+			na := ts.lastAnnounce.Completed.Add(ts.lastAnnounce.Interval).Sub(ts.t.cl.clock().Now())
 			if na > 0 {
 				na /= time.Second
 				na *= time.Second
@@ -57,6 +73,12 @@ func (ts *trackerScraper) statusLine() string {
 			return fmt.Sprintf("%d peers", ts.lastAnnounce.NumPeers)
 		}(),
 	)
+	if ts.lastAnnounce.Warning != "" {
+		fmt.Fprintf(&w, ", warning: %q", ts.lastAnnounce.Warning)
+	}
+	if ts.disabled {
+		fmt.Fprintf(&w, ", disabled after %d failures", ts.consecutiveFailures)
+	}
 	return w.String()
 }
 
@@ -65,9 +87,47 @@ type trackerAnnounceResult struct {
 	NumPeers  int
 	Interval  time.Duration
 	Completed time.Time
+	// Swarm counts given by the tracker.
+	Seeders  int
+	Leechers int
+	// A non-fatal warning given by the tracker.
+	Warning string
+}
+
+// Hosts on anonymous overlay networks that can only be reached through a proxy that resolves them,
+// such as Tor or I2P over SOCKS5 (socks5h semantics).
+func isOverlayNetworkHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	return strings.HasSuffix(host, ".onion") || strings.HasSuffix(host, ".i2p")
+}
+
+// Whether the announce goes through a proxy that resolves the tracker host itself. In that case
+// the host must not be resolved locally, which would leak it, and fail for overlay network hosts.
+func (me *trackerScraper) proxyResolvesHost() (bool, error) {
+	switch me.u.Scheme {
+	case "http", "https":
+	default:
+		return false, nil
+	}
+	cfg := me.t.cl.config
+	if cfg.HTTPProxy != nil {
+		proxyUrl, err := cfg.HTTPProxy(&http.Request{URL: &me.u})
+		if err != nil {
+			return false, fmt.Errorf("getting proxy: %w", err)
+		}
+		if proxyUrl != nil {
+			return true, nil
+		}
+	}
+	// We can't tell what a custom client does, but it's the only way such hosts could be reached.
+	return cfg.HTTPClient != nil && isOverlayNetworkHost(me.u.Hostname()), nil
 }
 
 func (me *trackerScraper) getIp() (ip net.IP, err error) {
+	if isOverlayNetworkHost(me.u.Hostname()) {
+		err = errors.New("overlay network host requires a proxy")
+		return
+	}
 	var ips []net.IP
 	if me.lookupTrackerIp != nil {
 		ips, err = me.lookupTrackerIp(&me.u)
@@ -92,6 +152,13 @@ func (me *trackerScraper) getIp() (ip net.IP, err error) {
 		if me.t.cl.ipIsBlocked(ip) {
 			continue
 		}
+		if ip.To4() != nil {
+			if me.t.cl.config.DisableIPv4 {
+				continue
+			}
+		} else if me.t.cl.config.DisableIPv6 {
+			continue
+		}
 		switch me.u.Scheme {
 		case "udp4":
 			if ip.To4() == nil {
@@ -108,8 +175,39 @@ func (me *trackerScraper) getIp() (ip net.IP, err error) {
 	return
 }
 
-func (me *trackerScraper) trackerUrl(ip net.IP) string {
-	u := me.u
+// Passed to ClientConfig.TrackerAnnounceHook before each announce. The Request and TrackerUrl can be
+// modified in place, and only affect the announce they're passed for.
+type TrackerAnnounceHookRequest struct {
+	Torrent *Torrent
+	// The tracker URL as added to the Torrent. Changes to the host aren't used for resolving the
+	// tracker's IP, so it's intended for adjusting the path and query.
+	TrackerUrl *url.URL
+	Request    *tracker.AnnounceRequest
+}
+
+func (me *trackerScraper) announceTimeout() time.Duration {
+	if strings.HasPrefix(me.u.Scheme, "udp") {
+		if total := me.t.cl.config.UdpTrackerRetransmit.Total(); total != 0 {
+			return total
+		}
+	}
+	return tracker.DefaultTrackerAnnounceTimeout
+}
+
+// Binds UDP tracker sockets to the family of the resolved tracker IP, so an IPv6 tracker isn't
+// announced to from a dual-stack socket that might not be usable, and the announce doesn't carry
+// an IPv4 address.
+func trackerUdpNetwork(scheme string, ip net.IP) string {
+	if scheme != "udp" {
+		return scheme
+	}
+	if ip.To4() != nil {
+		return "udp4"
+	}
+	return "udp6"
+}
+
+func trackerUrlWithIp(u url.URL, ip net.IP) string {
 	if u.Port() != "" {
 		u.Host = net.JoinHostPort(ip.String(), u.Port())
 	}
@@ -123,7 +221,7 @@ func (me *trackerScraper) announce(
 	event tracker.AnnounceEvent,
 ) (ret trackerAnnounceResult) {
 	defer func() {
-		ret.Completed = time.Now()
+		ret.Completed = me.t.cl.clock().Now()
 	}()
 	ret.Interval = time.Minute
 
@@ -144,38 +242,74 @@ func (me *trackerScraper) announce(
 		}
 	}()
 
-	ip, err := me.getIp()
-	if err != nil {
-		ret.Err = fmt.Errorf("error getting ip: %s", err)
-		return
-	}
 	me.t.cl.rLock()
 	req := me.t.announceRequest(event, me.shortInfohash)
 	me.t.cl.rUnlock()
+	u := me.u
+	if hook := me.t.cl.config.TrackerAnnounceHook; hook != nil {
+		hook(TrackerAnnounceHookRequest{
+			Torrent:    me.t,
+			TrackerUrl: &u,
+			Request:    &req,
+		})
+	}
+	proxied, err := me.proxyResolvesHost()
+	if err != nil {
+		ret.Err = err
+		return
+	}
+	trackerUrl := u.String()
+	udpNetwork := u.Scheme
+	if !proxied {
+		ip, err := me.getIp()
+		if err != nil {
+			ret.Err = fmt.Errorf("error getting ip: %s", err)
+			return
+		}
+		trackerUrl = trackerUrlWithIp(u, ip)
+		udpNetwork = trackerUdpNetwork(u.Scheme, ip)
+	}
 	// The default timeout works well as backpressure on concurrent access to the tracker. Since
 	// we're passing our own Context now, we will include that timeout ourselves to maintain similar
 	// behavior to previously, albeit with this context now being cancelled when the Torrent is
 	// closed.
-	ctx, cancel := context.WithTimeout(ctx, tracker.DefaultTrackerAnnounceTimeout)
+	ctx, cancel := context.WithTimeout(ctx, me.announceTimeout())
 	defer cancel()
-	me.t.logger.WithDefaultLevel(log.Debug).Printf("announcing to %q: %#v", me.u.String(), req)
-	res, err := tracker.Announce{
+	var clientIp4, clientIp6 krpc.NodeAddr
+	if !me.t.cl.config.AnonymousMode {
+		clientIp4.IP, clientIp6.IP = me.t.cl.announceIps()
+	}
+	me.t.logger.WithDefaultLevel(log.Debug).Printf("announcing to %q: %#v", me.redactedUrl(), req)
+	a := tracker.Announce{
 		Context:             ctx,
 		HttpProxy:           me.t.cl.config.HTTPProxy,
-		HttpRequestDirector: me.t.cl.config.HttpRequestDirector,
+		HttpRequestDirector: me.t.cl.httpRequestDirector(),
+		HttpClient:          me.t.cl.config.HTTPClient,
+		HttpHeader:          me.t.cl.config.HTTPHeader,
 		DialContext:         me.t.cl.config.TrackerDialContext,
 		ListenPacket:        me.t.cl.config.TrackerListenPacket,
-		UserAgent:           me.t.cl.config.HTTPUserAgent,
-		TrackerUrl:          me.trackerUrl(ip),
+		UserAgent:           me.t.cl.httpUserAgent(),
+		TrackerUrl:          trackerUrl,
 		Request:             req,
 		HostHeader:          me.u.Host,
 		ServerName:          me.u.Hostname(),
-		UdpNetwork:          me.u.Scheme,
-		ClientIp4:           krpc.NodeAddr{IP: me.t.cl.config.PublicIp4},
-		ClientIp6:           krpc.NodeAddr{IP: me.t.cl.config.PublicIp6},
+		UdpNetwork:          udpNetwork,
+		ClientIp4:           clientIp4,
+		ClientIp6:           clientIp6,
 		Logger:              me.t.logger,
-	}.Do()
-	me.t.logger.WithDefaultLevel(log.Debug).Printf("announce to %q returned %#v: %v", me.u.String(), res, err)
+		UdpRetransmit:       me.t.cl.config.UdpTrackerRetransmit,
+	}
+	client, release, err := me.t.cl.trackerClients.get(a)
+	if err != nil {
+		ret.Err = fmt.Errorf("getting tracker client: %w", err)
+		return
+	}
+	a.Client = client
+	res, err := a.Do()
+	release(err)
+	me.t.logger.WithDefaultLevel(log.Debug).Printf(
+		"announce to %q returned %#v: %v",
+		me.redactedUrl(), res, me.t.cl.redactTracker(fmt.Sprint(err)))
 	if err != nil {
 		ret.Err = fmt.Errorf("announcing: %w", err)
 		return
@@ -183,6 +317,17 @@ func (me *trackerScraper) announce(
 	me.t.AddPeers(peerInfos(nil).AppendFromTracker(res.Peers))
 	ret.NumPeers = len(res.Peers)
 	ret.Interval = time.Duration(res.Interval) * time.Second
+	ret.Seeders = int(res.Seeders)
+	ret.Leechers = int(res.Leechers)
+	ret.Warning = res.WarningMessage
+	if ret.Warning != "" {
+		me.t.logger.WithDefaultLevel(log.Warning).Printf("tracker %q warning: %s", me.redactedUrl(), ret.Warning)
+	}
+	if res.ExternalIp != nil {
+		me.t.cl.lock()
+		me.t.cl.voteExternalIp("tracker "+me.u.Host, res.ExternalIp)
+		me.t.cl.unlock()
+	}
 	return
 }
 
@@ -203,7 +348,9 @@ func (me *trackerScraper) canIgnoreInterval(notify *<-chan struct{}) bool {
 }
 
 func (me *trackerScraper) Run() {
-	defer me.announceStopped()
+	// The stopped announce happens after the Torrent is closed, so it isn't waited for, like the
+	// Torrent's other background work.
+	defer func() { go me.announceStopped() }()
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -217,15 +364,30 @@ func (me *trackerScraper) Run() {
 
 	// make sure first announce is a "started"
 	e := tracker.Started
+	// Announces as soon as the download completes, once.
+	downloadCompleted := me.t.downloadCompleted.Done()
 
 	for {
+		if e == tracker.None && !me.completedSent && me.t.downloadCompleted.IsSet() {
+			e = tracker.Completed
+		}
 		ar := me.announce(ctx, e)
+		if e == tracker.Completed && ar.Err == nil {
+			me.completedSent = true
+		}
 		// after first announce, get back to regular "none"
 		e = tracker.None
 		me.t.cl.lock()
+		me.updateHealth(&ar)
 		me.lastAnnounce = ar
+		disabled := me.disabled
+		reenabled := me.reenabled.Signaled()
 		me.t.cl.unlock()
 
+		// Delays announces by up to a tenth of the interval, so that torrents that started together
+		// drift apart rather than announcing to the tracker in bursts.
+		jitter := me.t.cl.rand.Float64() / 10
+
 	recalculate:
 		// Make sure we don't announce for at least a minute since the last one.
 		interval := ar.Interval
@@ -244,7 +406,8 @@ func (me *trackerScraper) Run() {
 		var reconsider <-chan struct{}
 		select {
 		case <-wantPeers:
-			if interval > time.Minute && me.canIgnoreInterval(&reconsider) {
+			// Dead trackers are only probed, however much we want peers.
+			if interval > time.Minute && !disabled && me.canIgnoreInterval(&reconsider) {
 				interval = time.Minute
 			}
 		default:
@@ -257,12 +420,23 @@ func (me *trackerScraper) Run() {
 		case <-reconsider:
 			// Recalculate the interval.
 			goto recalculate
-		case <-time.After(time.Until(ar.Completed.Add(interval))):
+		case <-downloadCompleted:
+			// Failed completed events are retried at the regular interval instead.
+			downloadCompleted = nil
+		case <-reenabled:
+		case <-me.t.cl.clock().After(ar.Completed.Add(interval + time.Duration(jitter*float64(interval))).Sub(me.t.cl.clock().Now())):
 		}
 	}
 }
 
 func (me *trackerScraper) announceStopped() {
+	me.t.cl.rLock()
+	disabled := me.disabled
+	me.t.cl.rUnlock()
+	if disabled {
+		// Don't hold up closing the torrent for a tracker that isn't responding.
+		return
+	}
 	ctx, cancel := context.WithTimeout(context.Background(), tracker.DefaultTrackerAnnounceTimeout)
 	defer cancel()
 	me.announce(ctx, tracker.Stopped)
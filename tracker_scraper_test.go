@@ -0,0 +1,123 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/tracker"
+)
+
+func TestTrackerAnnounceHook(t *testing.T) {
+	c := qt.New(t)
+	var query url.Values
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte("d8:intervali1800e5:peers0:e"))
+	}))
+	defer s.Close()
+	cfg := TestingConfig(t)
+	cfg.DisableTrackers = true
+	cfg.TrackerAnnounceHook = func(r TrackerAnnounceHookRequest) {
+		q := r.TrackerUrl.Query()
+		q.Set("passkey", "hunter2")
+		r.TrackerUrl.RawQuery = q.Encode()
+		r.Request.NumWant = 7
+	}
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	u, err := url.Parse(s.URL + "/announce")
+	c.Assert(err, qt.IsNil)
+	ts := &trackerScraper{
+		shortInfohash: *tt.canonicalShortInfohash(),
+		u:             *u,
+		t:             tt,
+	}
+	ar := ts.announce(context.Background(), tracker.Started)
+	c.Assert(ar.Err, qt.IsNil)
+	c.Check(query.Get("passkey"), qt.Equals, "hunter2")
+	c.Check(query.Get("numwant"), qt.Equals, "7")
+	// The hook's changes don't persist to later announces.
+	c.Check(ts.u.RawQuery, qt.Equals, "")
+}
+
+func TestTrackerUdpNetwork(t *testing.T) {
+	c := qt.New(t)
+	c.Check(trackerUdpNetwork("udp", net.ParseIP("1.2.3.4")), qt.Equals, "udp4")
+	c.Check(trackerUdpNetwork("udp", net.ParseIP("::ffff:1.2.3.4")), qt.Equals, "udp4")
+	c.Check(trackerUdpNetwork("udp", net.ParseIP("2001:db8::1")), qt.Equals, "udp6")
+	c.Check(trackerUdpNetwork("https", net.ParseIP("2001:db8::1")), qt.Equals, "https")
+}
+
+func TestIsOverlayNetworkHost(t *testing.T) {
+	c := qt.New(t)
+	for _, tc := range []struct {
+		host string
+		want bool
+	}{
+		{"example.onion", true},
+		{"EXAMPLE.ONION", true},
+		{"example.onion.", true},
+		{"tracker.example.i2p", true},
+		{"example.com", false},
+		{"onion", false},
+		{"example.onion.com", false},
+		{"1.2.3.4", false},
+		{"", false},
+	} {
+		c.Check(isOverlayNetworkHost(tc.host), qt.Equals, tc.want, qt.Commentf("%q", tc.host))
+	}
+}
+
+func TestTrackerProxyResolvesHost(t *testing.T) {
+	c := qt.New(t)
+	proxy := http.ProxyURL(&url.URL{Scheme: "socks5h", Host: "localhost:9050"})
+	noProxy := func(*http.Request) (*url.URL, error) { return nil, nil }
+	failingProxy := func(*http.Request) (*url.URL, error) { return nil, errors.New("bad proxy") }
+	for _, tc := range []struct {
+		name       string
+		url        string
+		proxy      func(*http.Request) (*url.URL, error)
+		httpClient bool
+		want       bool
+		wantErr    bool
+	}{
+		{name: "NoProxy", url: "http://example.com/announce"},
+		{name: "Proxy", url: "http://example.com/announce", proxy: proxy, want: true},
+		{name: "ProxyHttps", url: "https://example.onion/announce", proxy: proxy, want: true},
+		{name: "ProxyNotUsed", url: "http://example.com/announce", proxy: noProxy},
+		{name: "ProxyError", url: "http://example.com/announce", proxy: failingProxy, wantErr: true},
+		{name: "UdpIgnoresProxy", url: "udp://example.com:1337", proxy: proxy},
+		{name: "HttpClientOverlay", url: "http://example.onion/announce", httpClient: true, want: true},
+		{name: "HttpClientNotOverlay", url: "http://example.com/announce", httpClient: true},
+		{name: "OverlayWithoutProxy", url: "http://example.i2p/announce"},
+	} {
+		c.Run(tc.name, func(c *qt.C) {
+			cl := newTestingClient(c.TB)
+			cl.config.HTTPProxy = tc.proxy
+			if tc.httpClient {
+				cl.config.HTTPClient = &http.Client{}
+			}
+			u, err := url.Parse(tc.url)
+			c.Assert(err, qt.IsNil)
+			ts := &trackerScraper{u: *u, t: cl.newTorrentForTesting()}
+			got, err := ts.proxyResolvesHost()
+			if tc.wantErr {
+				c.Check(err, qt.IsNotNil)
+				return
+			}
+			c.Assert(err, qt.IsNil)
+			c.Check(got, qt.Equals, tc.want)
+		})
+	}
+}
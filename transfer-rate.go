@@ -0,0 +1,78 @@
+package torrent
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Time constants for the exponential moving averages maintained for transfer rates.
+var transferRateWindows = [...]time.Duration{time.Second, 10 * time.Second, time.Minute}
+
+// Rolling transfer rates in bytes per second. Each is an exponential moving average with the given
+// time constant, so recent transfers are weighted more heavily than older ones.
+type TransferRate struct {
+	Over1s  float64
+	Over10s float64
+	Over60s float64
+}
+
+// Download and upload rates on the wire, including protocol overhead.
+type TransferRates struct {
+	Download TransferRate
+	Upload   TransferRate
+}
+
+// Maintains exponentially decaying byte counts so that rates can be read at any time without
+// sampling counters on a timer. It's safe for concurrent use, since transfers are recorded from
+// outside the Client lock.
+type rateMeter struct {
+	mu     sync.Mutex
+	last   time.Time
+	values [len(transferRateWindows)]float64
+}
+
+func (me *rateMeter) decayTo(now time.Time) {
+	if !now.After(me.last) {
+		return
+	}
+	if !me.last.IsZero() {
+		dt := now.Sub(me.last)
+		for i, w := range transferRateWindows {
+			me.values[i] *= math.Exp(-float64(dt) / float64(w))
+		}
+	}
+	me.last = now
+}
+
+func (me *rateMeter) add(n int64, now time.Time) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.decayTo(now)
+	for i, w := range transferRateWindows {
+		me.values[i] += float64(n) / w.Seconds()
+	}
+}
+
+func (me *rateMeter) rate(now time.Time) TransferRate {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.decayTo(now)
+	return TransferRate{
+		Over1s:  me.values[0],
+		Over10s: me.values[1],
+		Over60s: me.values[2],
+	}
+}
+
+type transferRateMeters struct {
+	download rateMeter
+	upload   rateMeter
+}
+
+func (me *transferRateMeters) rates(now time.Time) TransferRates {
+	return TransferRates{
+		Download: me.download.rate(now),
+		Upload:   me.upload.rate(now),
+	}
+}
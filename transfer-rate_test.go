@@ -0,0 +1,38 @@
+package torrent
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestRateMeterDecays(t *testing.T) {
+	c := qt.New(t)
+	var rm rateMeter
+	start := time.Now()
+	rm.add(1000, start)
+	r := rm.rate(start)
+	c.Check(r.Over1s, qt.Equals, 1000.)
+	c.Check(r.Over10s, qt.Equals, 100.)
+	c.Check(r.Over60s, qt.Equals, 1000./60)
+	r = rm.rate(start.Add(10 * time.Second))
+	c.Check(r.Over1s < 1, qt.IsTrue)
+	c.Check(r.Over10s > 36 && r.Over10s < 37, qt.IsTrue, qt.Commentf("%v", r.Over10s))
+	// Reading with a time in the past doesn't undo decay.
+	c.Check(rm.rate(start), qt.Equals, r)
+}
+
+func TestRateMeterSteadyState(t *testing.T) {
+	c := qt.New(t)
+	var rm rateMeter
+	now := time.Now()
+	for i := 0; i < 600; i++ {
+		now = now.Add(100 * time.Millisecond)
+		rm.add(100, now)
+	}
+	r := rm.rate(now)
+	// 1000 bytes per second, sampled just after an addition.
+	c.Check(r.Over10s > 990 && r.Over10s < 1010, qt.IsTrue, qt.Commentf("%v", r.Over10s))
+	c.Check(r.Over60s > 600 && r.Over60s < 700, qt.IsTrue, qt.Commentf("%v", r.Over60s))
+}
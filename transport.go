@@ -0,0 +1,157 @@
+package torrent
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// A means of connecting to peers, such as TCP, uTP or a future QUIC implementation. NewClient
+// registers the builtin TCP and uTP transports, and others can be added with Client.AddTransport
+// without changes to dialing or accepting.
+//
+// Transports are named by network: "tcp" and "utp" for the builtin networks, and otherwise the
+// Dialer's DialerNetwork or the Listener's Addr().Network().
+type Transport interface {
+	// Makes outgoing peer connections. Nil if the transport doesn't dial.
+	Dialer() Dialer
+	// Accepts incoming peer connections. Nil if the transport doesn't listen. The Client doesn't
+	// close it.
+	Listener() Listener
+}
+
+// Registers a Transport's Dialer and Listener with the Client.
+func (cl *Client) AddTransport(t Transport) {
+	if d := t.Dialer(); d != nil {
+		cl.AddDialer(d)
+	}
+	if l := t.Listener(); l != nil {
+		cl.lock()
+		cl.AddListener(l)
+		cl.unlock()
+	}
+}
+
+// Returns the transport name for a network, such as from DialerNetwork, or a net.Addr.
+func networkTransport(network string) string {
+	n := parseNetworkString(network)
+	switch {
+	case n.Udp:
+		return "utp"
+	case n.Tcp:
+		return "tcp"
+	default:
+		return network
+	}
+}
+
+type TransportStats struct {
+	Enabled bool
+	// Outgoing connection attempts.
+	DialsStarted int64
+	// Outgoing connection attempts that connected, whether or not the connection was then used.
+	DialsSucceeded int64
+	// Incoming connections accepted, including those that are subsequently rejected.
+	Accepted int64
+	// Established peer connections.
+	ActiveConns int
+}
+
+// Enable flags and stats for each transport. Has its own lock.
+type transports struct {
+	mu sync.Mutex
+	m  map[string]*transportState
+}
+
+type transportState struct {
+	disabled       atomic.Bool
+	dialsStarted   Count
+	dialsSucceeded Count
+	accepted       Count
+}
+
+func (me *transports) get(name string) *transportState {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if ret, ok := me.m[name]; ok {
+		return ret
+	}
+	if me.m == nil {
+		me.m = make(map[string]*transportState)
+	}
+	ret := new(transportState)
+	me.m[name] = ret
+	return ret
+}
+
+// Enables or disables dialing and accepting on a transport, such as "tcp" or "utp". Existing
+// connections aren't affected.
+func (cl *Client) SetTransportEnabled(name string, enabled bool) {
+	cl.transports.get(name).disabled.Store(!enabled)
+	if enabled {
+		cl.lock()
+		defer cl.unlock()
+		for t := range cl.torrents {
+			t.openNewConns()
+		}
+	}
+}
+
+func (cl *Client) dialerEnabled(d Dialer) bool {
+	return !cl.transports.get(networkTransport(d.DialerNetwork())).disabled.Load()
+}
+
+func (cl *Client) countTransportDialResult(res DialResult) {
+	if res.Conn != nil {
+		cl.transports.get(networkTransport(res.Dialer.DialerNetwork())).dialsSucceeded.Add(1)
+	}
+}
+
+// Stats for each transport that has been registered or used, by name.
+func (cl *Client) TransportStats() map[string]TransportStats {
+	cl.rLock()
+	defer cl.rUnlock()
+	return cl.transportStatsLocked()
+}
+
+func (cl *Client) transportStatsLocked() map[string]TransportStats {
+	activeConns := make(map[string]int)
+	for _, d := range cl.dialers {
+		cl.transports.get(networkTransport(d.DialerNetwork()))
+	}
+	for _, l := range cl.listeners {
+		cl.transports.get(networkTransport(l.Addr().Network()))
+	}
+	for t := range cl.torrents {
+		for c := range t.conns {
+			activeConns[c.transport()]++
+		}
+	}
+	cl.transports.mu.Lock()
+	defer cl.transports.mu.Unlock()
+	ret := make(map[string]TransportStats, len(cl.transports.m))
+	for name, s := range cl.transports.m {
+		ret[name] = TransportStats{
+			Enabled:        !s.disabled.Load(),
+			DialsStarted:   s.dialsStarted.Int64(),
+			DialsSucceeded: s.dialsSucceeded.Int64(),
+			Accepted:       s.accepted.Int64(),
+			ActiveConns:    activeConns[name],
+		}
+	}
+	for name, n := range activeConns {
+		if _, ok := ret[name]; !ok {
+			ret[name] = TransportStats{Enabled: true, ActiveConns: n}
+		}
+	}
+	return ret
+}
+
+func sortedTransportNames(m map[string]TransportStats) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
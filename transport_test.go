@@ -0,0 +1,80 @@
+package torrent
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+type testTransport struct {
+	accept chan net.Conn
+}
+
+func (me testTransport) Dialer() Dialer { return me }
+
+func (me testTransport) Listener() Listener { return me }
+
+func (testTransport) DialerNetwork() string { return "quic" }
+
+func (testTransport) Dial(context.Context, string) (net.Conn, error) {
+	return nil, errors.New("unreachable")
+}
+
+func (me testTransport) Accept() (net.Conn, error) {
+	c, ok := <-me.accept
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return c, nil
+}
+
+func (testTransport) Addr() net.Addr {
+	return testNetAddr{network: "quic", addr: "1.2.3.4:5"}
+}
+
+type testNetAddr struct {
+	network, addr string
+}
+
+func (me testNetAddr) Network() string { return me.network }
+
+func (me testNetAddr) String() string { return me.addr }
+
+func TestNetworkTransport(t *testing.T) {
+	c := qt.New(t)
+	c.Check(networkTransport("tcp4"), qt.Equals, "tcp")
+	c.Check(networkTransport("udp6"), qt.Equals, "utp")
+	c.Check(networkTransport("webrtc"), qt.Equals, "webrtc")
+}
+
+func TestAddTransport(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.DisableUTP = true
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	tr := testTransport{accept: make(chan net.Conn)}
+	defer close(tr.accept)
+	defer cl.Close()
+	cl.AddTransport(tr)
+	c.Check(cl.ListenAddrs(), qt.Contains, net.Addr(tr.Addr()))
+
+	stats := cl.TransportStats()
+	c.Check(stats["quic"].Enabled, qt.IsTrue)
+	c.Check(stats["tcp"].Enabled, qt.IsTrue)
+	_, ok := stats["utp"]
+	c.Check(ok, qt.IsFalse)
+
+	cl.SetTransportEnabled("quic", false)
+	c.Check(cl.dialerEnabled(tr), qt.IsFalse)
+	c.Check(cl.TransportStats()["quic"].Enabled, qt.IsFalse)
+	// Connections accepted on a disabled transport are closed straight away.
+	local, remote := net.Pipe()
+	tr.accept <- remote
+	_, err = local.Read(make([]byte, 1))
+	c.Check(err, qt.IsNotNil)
+	c.Check(cl.TransportStats()["quic"].Accepted, qt.Equals, int64(1))
+}
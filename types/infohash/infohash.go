@@ -4,8 +4,11 @@ import (
 	"crypto/sha1"
 	"crypto/sha256"
 	"encoding"
+	"encoding/base32"
 	"encoding/hex"
 	"fmt"
+
+	"github.com/anacrolix/torrent/bencode"
 )
 
 const Size = 20
@@ -52,6 +55,26 @@ func (t *T) FromHexString(s string) (err error) {
 	return
 }
 
+// Sets the hash from its base32 encoding, which magnet links sometimes use instead of hex.
+func (t *T) FromBase32String(s string) (err error) {
+	if len(s) != base32.StdEncoding.EncodedLen(Size) {
+		err = fmt.Errorf("hash base32 string has bad length: %d", len(s))
+		return
+	}
+	var b [Size]byte
+	n, err := base32.StdEncoding.Decode(b[:], []byte(s))
+	if err != nil {
+		return
+	}
+	// Padding shortens the decoded hash.
+	if n != Size {
+		err = fmt.Errorf("hash base32 string decoded to %d bytes", n)
+		return
+	}
+	*t = b
+	return
+}
+
 func (t *T) IsZero() bool {
 	return *t == T{}
 }
@@ -69,6 +92,28 @@ func (t T) MarshalText() (text []byte, err error) {
 	return []byte(t.HexString()), nil
 }
 
+var (
+	_ bencode.Unmarshaler = (*T)(nil)
+	_ bencode.Marshaler   = T{}
+)
+
+// Unlike decoding into a plain [20]byte, strings of the wrong length are an error.
+func (t *T) UnmarshalBencode(b []byte) error {
+	s, err := bencode.UnmarshalTo[string](b)
+	if err != nil {
+		return err
+	}
+	if len(s) != Size {
+		return fmt.Errorf("hash string has bad length: %d", len(s))
+	}
+	copy(t[:], s)
+	return nil
+}
+
+func (t T) MarshalBencode() ([]byte, error) {
+	return bencode.Marshal(t[:])
+}
+
 func FromHexString(s string) (h T) {
 	err := h.FromHexString(s)
 	if err != nil {
@@ -77,6 +122,19 @@ func FromHexString(s string) (h T) {
 	return
 }
 
+// Parses a hash from either its hex or base32 encoding, as found in magnet links and user input.
+func Parse(s string) (h T, err error) {
+	switch len(s) {
+	case hex.EncodedLen(Size):
+		err = h.FromHexString(s)
+	case base32.StdEncoding.EncodedLen(Size):
+		err = h.FromBase32String(s)
+	default:
+		err = fmt.Errorf("hash string has bad length for hex or base32: %d", len(s))
+	}
+	return
+}
+
 func HashBytes(b []byte) (ret T) {
 	hasher := sha1.New()
 	hasher.Write(b)
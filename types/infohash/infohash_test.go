@@ -0,0 +1,48 @@
+package infohash
+
+import (
+	"encoding/json"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/bencode"
+)
+
+const testHex = "08ada5a7a6183aae1e09d831df6748d566095a10"
+
+func TestParse(t *testing.T) {
+	c := qt.New(t)
+	want := FromHexString(testHex)
+	h, err := Parse(testHex)
+	c.Assert(err, qt.IsNil)
+	c.Check(h, qt.Equals, want)
+	h, err = Parse("BCW2LJ5GDA5K4HQJ3AY56Z2I2VTASWQQ")
+	c.Assert(err, qt.IsNil)
+	c.Check(h, qt.Equals, want)
+	_, err = Parse("08ada5")
+	c.Check(err, qt.IsNotNil)
+	_, err = Parse("!CW2LJ5GDA5K4HQJ3AY56Z2I2VTASWQQ")
+	c.Check(err, qt.IsNotNil)
+	// Padding gives the right length, but too few bytes.
+	_, err = Parse("AAAAAAAAAAAAAAAAAAAAAAAAAA======")
+	c.Check(err, qt.IsNotNil)
+}
+
+func TestMarshalling(t *testing.T) {
+	c := qt.New(t)
+	h := FromHexString(testHex)
+	b, err := bencode.Marshal(h)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Equals, "20:"+h.AsString())
+	var h2 T
+	c.Assert(bencode.Unmarshal(b, &h2), qt.IsNil)
+	c.Check(h2, qt.Equals, h)
+	c.Check(bencode.Unmarshal([]byte("3:abc"), &h2), qt.IsNotNil)
+	b, err = json.Marshal(h)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Equals, `"`+testHex+`"`)
+	var h3 T
+	c.Assert(json.Unmarshal(b, &h3), qt.IsNil)
+	c.Check(h3, qt.Equals, h)
+}
@@ -28,7 +28,7 @@ func (r Request) ToMsg(mt pp.MessageType) pp.Message {
 type PiecePriority byte
 
 func (pp *PiecePriority) Raise(maybe PiecePriority) bool {
-	if maybe > *pp {
+	if maybe.Rank() > pp.Rank() {
 		*pp = maybe
 		return true
 	}
@@ -37,7 +37,19 @@ func (pp *PiecePriority) Raise(maybe PiecePriority) bool {
 
 // Priority for use in PriorityBitmap
 func (me PiecePriority) BitmapPriority() int {
-	return -int(me)
+	return -me.Rank()
+}
+
+// Orders priorities by importance. The values aren't in order, as Low was added after the others.
+func (me PiecePriority) Rank() int {
+	switch me {
+	case PiecePriorityNone:
+		return 0
+	case PiecePriorityLow:
+		return 1
+	default:
+		return int(me) + 1
+	}
 }
 
 const (
@@ -49,4 +61,6 @@ const (
 	// with caching.
 	PiecePriorityNext
 	PiecePriorityNow // A Reader is reading in this piece. Highest urgency.
+	// Wanted, once Normal pieces are taken care of. Compare priorities by Rank.
+	PiecePriorityLow
 )
@@ -0,0 +1,135 @@
+package udpmux
+
+import (
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+type packet struct {
+	b    []byte
+	addr net.Addr
+}
+
+// One route of a Mux. Closing it doesn't close the underlying PacketConn.
+type Conn struct {
+	mux     *Mux
+	match   func([]byte) bool
+	packets chan packet
+
+	closeOnce    sync.Once
+	closed       chan struct{}
+	readDeadline deadline
+}
+
+var _ net.PacketConn = (*Conn)(nil)
+
+func (c *Conn) ReadFrom(b []byte) (n int, addr net.Addr, err error) {
+	select {
+	case p := <-c.packets:
+		return copy(b, p.b), p.addr, nil
+	default:
+	}
+	select {
+	case p := <-c.packets:
+		return copy(b, p.b), p.addr, nil
+	case <-c.closed:
+		return 0, nil, net.ErrClosed
+	case <-c.mux.done:
+		return 0, nil, c.mux.err
+	case <-c.readDeadline.wait():
+		return 0, nil, os.ErrDeadlineExceeded
+	}
+}
+
+func (c *Conn) WriteTo(b []byte, addr net.Addr) (int, error) {
+	select {
+	case <-c.closed:
+		return 0, net.ErrClosed
+	default:
+	}
+	return c.mux.conn.WriteTo(b, addr)
+}
+
+func (c *Conn) Close() error {
+	c.closeOnce.Do(func() {
+		close(c.closed)
+		c.mux.removeRoute(c)
+	})
+	return nil
+}
+
+func (c *Conn) LocalAddr() net.Addr {
+	return c.mux.conn.LocalAddr()
+}
+
+// Only the read deadline is set, since the write side is shared with the other routes.
+func (c *Conn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *Conn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.set(t)
+	return nil
+}
+
+// Write deadlines aren't supported, since the underlying PacketConn is shared with the other
+// routes. UDP writes don't usually block.
+func (c *Conn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+// A read deadline whose expiry can be selected on, as done for net.Pipe.
+type deadline struct {
+	mu      sync.Mutex
+	timer   *time.Timer
+	expired chan struct{}
+}
+
+func (d *deadline) init() {
+	d.expired = make(chan struct{})
+}
+
+func (d *deadline) set(t time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer != nil && !d.timer.Stop() {
+		// Wait for the timer func to close expired.
+		<-d.expired
+	}
+	d.timer = nil
+	closed := isClosedChan(d.expired)
+	if t.IsZero() {
+		if closed {
+			d.expired = make(chan struct{})
+		}
+		return
+	}
+	if dur := time.Until(t); dur > 0 {
+		if closed {
+			d.expired = make(chan struct{})
+		}
+		expired := d.expired
+		d.timer = time.AfterFunc(dur, func() { close(expired) })
+		return
+	}
+	if !closed {
+		close(d.expired)
+	}
+}
+
+func (d *deadline) wait() <-chan struct{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.expired
+}
+
+func isClosedChan(c <-chan struct{}) bool {
+	select {
+	case <-c:
+		return true
+	default:
+	}
+	return false
+}
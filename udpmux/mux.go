@@ -0,0 +1,120 @@
+// Package udpmux shares a single UDP socket between protocols, such as uTP and the DHT, by routing
+// each received packet according to its shape. This lets a client operate through one forwarded UDP
+// port without relying on any of the protocol implementations to pass through packets they don't
+// recognise.
+package udpmux
+
+import (
+	"net"
+	"sync"
+)
+
+// Large enough for any UDP payload.
+const maxPacketSize = 0x10000
+
+// Packets are dropped once this many are waiting to be read from a Conn, as the network would.
+const connQueueLen = 256
+
+// Demultiplexes packets received on a PacketConn to the Conns returned by Route. Writes from all
+// Conns go directly to the underlying PacketConn.
+type Mux struct {
+	conn net.PacketConn
+
+	mu      sync.Mutex
+	routes  []*Conn
+	started bool
+	// Closed when reading from conn fails, after which err is set.
+	done chan struct{}
+	err  error
+}
+
+// Creates a Mux that reads from conn once the first route is added. Mux.Close closes conn.
+func New(conn net.PacketConn) *Mux {
+	return &Mux{
+		conn: conn,
+		done: make(chan struct{}),
+	}
+}
+
+// Returns a PacketConn that receives the packets for which match returns true. Routes are tried in
+// the order they're added, and packets that match no route are dropped. match must not retain the
+// packet.
+func (m *Mux) Route(match func(packet []byte) bool) *Conn {
+	c := &Conn{
+		mux:     m,
+		match:   match,
+		packets: make(chan packet, connQueueLen),
+		closed:  make(chan struct{}),
+	}
+	c.readDeadline.init()
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.routes = append(m.routes, c)
+	if !m.started {
+		m.started = true
+		go m.run()
+	}
+	return c
+}
+
+// Closes the underlying PacketConn. Reads on the routes then return the resulting error.
+func (m *Mux) Close() error {
+	return m.conn.Close()
+}
+
+// The address of the underlying PacketConn.
+func (m *Mux) LocalAddr() net.Addr {
+	return m.conn.LocalAddr()
+}
+
+func (m *Mux) run() {
+	b := make([]byte, maxPacketSize)
+	for {
+		n, addr, err := m.conn.ReadFrom(b)
+		if err != nil {
+			m.err = err
+			close(m.done)
+			return
+		}
+		m.dispatch(b[:n], addr)
+	}
+}
+
+func (m *Mux) dispatch(b []byte, addr net.Addr) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, c := range m.routes {
+		if !c.match(b) {
+			continue
+		}
+		select {
+		case c.packets <- packet{append([]byte(nil), b...), addr}:
+		default:
+		}
+		return
+	}
+}
+
+func (m *Mux) removeRoute(c *Conn) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, r := range m.routes {
+		if r == c {
+			m.routes = append(m.routes[:i:i], m.routes[i+1:]...)
+			return
+		}
+	}
+}
+
+// Reports whether a packet looks like a KRPC message, as used by the DHT (BEP 5): a bencoded
+// dictionary.
+func IsKrpc(b []byte) bool {
+	return len(b) >= 2 && b[0] == 'd' && b[len(b)-1] == 'e'
+}
+
+// Reports whether a packet looks like uTP (BEP 29): a complete header with version 1 and a known
+// packet type.
+func IsUtp(b []byte) bool {
+	const headerLen = 20
+	return len(b) >= headerLen && b[0]&0xf == 1 && b[0]>>4 <= 4
+}
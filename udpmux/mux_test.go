@@ -0,0 +1,87 @@
+package udpmux
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestPacketShapes(t *testing.T) {
+	c := qt.New(t)
+	krpc := []byte("d1:ad2:id20:aaaaaaaaaaaaaaaaaaaae1:q4:ping1:t2:aa1:y1:qe")
+	c.Check(IsKrpc(krpc), qt.IsTrue)
+	c.Check(IsUtp(krpc), qt.IsFalse)
+	utpSyn := make([]byte, 20)
+	utpSyn[0] = 4<<4 | 1
+	c.Check(IsUtp(utpSyn), qt.IsTrue)
+	c.Check(IsKrpc(utpSyn), qt.IsFalse)
+	c.Check(IsUtp(utpSyn[:19]), qt.IsFalse)
+	utpSyn[0] = 5<<4 | 1
+	c.Check(IsUtp(utpSyn), qt.IsFalse)
+}
+
+func TestMuxRoutesByShape(t *testing.T) {
+	c := qt.New(t)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	m := New(pc)
+	defer m.Close()
+	dht := m.Route(IsKrpc)
+	utp := m.Route(IsUtp)
+	sender, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	defer sender.Close()
+
+	utpPacket := make([]byte, 20)
+	utpPacket[0] = 0x01
+	for _, b := range [][]byte{[]byte("garbage"), utpPacket, []byte("d1:y1:qe")} {
+		_, err = sender.WriteTo(b, pc.LocalAddr())
+		c.Assert(err, qt.IsNil)
+	}
+	read := func(conn *Conn) []byte {
+		c.Assert(conn.SetReadDeadline(time.Now().Add(5*time.Second)), qt.IsNil)
+		b := make([]byte, 100)
+		n, addr, err := conn.ReadFrom(b)
+		c.Assert(err, qt.IsNil)
+		c.Check(addr.String(), qt.Equals, sender.LocalAddr().String())
+		return b[:n]
+	}
+	c.Check(read(dht), qt.DeepEquals, []byte("d1:y1:qe"))
+	c.Check(bytes.Equal(read(utp), utpPacket), qt.IsTrue)
+
+	// Replies go out through the shared socket.
+	_, err = dht.WriteTo([]byte("d1:y1:re"), sender.LocalAddr())
+	c.Assert(err, qt.IsNil)
+	c.Assert(sender.SetReadDeadline(time.Now().Add(5*time.Second)), qt.IsNil)
+	b := make([]byte, 100)
+	n, addr, err := sender.ReadFrom(b)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b[:n]), qt.Equals, "d1:y1:re")
+	c.Check(addr.String(), qt.Equals, pc.LocalAddr().String())
+}
+
+func TestConnReadDeadlineAndClose(t *testing.T) {
+	c := qt.New(t)
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	m := New(pc)
+	conn := m.Route(IsKrpc)
+	c.Assert(conn.SetReadDeadline(time.Now().Add(10*time.Millisecond)), qt.IsNil)
+	_, _, err = conn.ReadFrom(make([]byte, 1))
+	c.Check(errors.Is(err, os.ErrDeadlineExceeded), qt.IsTrue)
+	c.Assert(conn.SetReadDeadline(time.Time{}), qt.IsNil)
+	c.Assert(conn.Close(), qt.IsNil)
+	_, _, err = conn.ReadFrom(make([]byte, 1))
+	c.Check(errors.Is(err, net.ErrClosed), qt.IsTrue)
+
+	// Closing the Mux ends reads on the remaining routes.
+	other := m.Route(IsUtp)
+	c.Assert(m.Close(), qt.IsNil)
+	_, _, err = other.ReadFrom(make([]byte, 1))
+	c.Check(err, qt.IsNotNil)
+}
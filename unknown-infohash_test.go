@@ -0,0 +1,64 @@
+package torrent
+
+import (
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+func TestOnUnknownInfoHashServesOnDemand(t *testing.T) {
+	c := qt.New(t)
+	dir, mi := testutil.GreetingTestTorrent()
+	defer os.RemoveAll(dir)
+	var (
+		mu        sync.Mutex
+		requested []metainfo.Hash
+	)
+	cfg := TestingConfig(t)
+	cfg.Seed = true
+	cfg.DataDir = dir
+	// Encrypted handshakes for unknown infohashes can't be answered.
+	cfg.HeaderObfuscationPolicy = HeaderObfuscationPolicy{}
+	cfg.OnUnknownInfoHash = func(cl *Client, ih metainfo.Hash) *Torrent {
+		mu.Lock()
+		requested = append(requested, ih)
+		mu.Unlock()
+		if ih != mi.HashInfoBytes() {
+			return nil
+		}
+		t, err := cl.AddTorrent(mi)
+		if err != nil {
+			return nil
+		}
+		t.VerifyData()
+		return t
+	}
+	server, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer server.Close()
+	c.Check(server.Torrents(), qt.HasLen, 0)
+
+	cfg = TestingConfig(t)
+	cfg.HeaderObfuscationPolicy = HeaderObfuscationPolicy{}
+	leecher, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer leecher.Close()
+	lt, err := leecher.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	lt.AddClientPeer(server)
+	r := lt.NewReader()
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	c.Assert(err, qt.IsNil)
+	c.Check(string(b), qt.Equals, testutil.GreetingFileContents)
+	c.Check(server.Torrents(), qt.HasLen, 1)
+	mu.Lock()
+	c.Check(requested[0], qt.Equals, mi.HashInfoBytes())
+	mu.Unlock()
+}
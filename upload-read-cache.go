@@ -0,0 +1,131 @@
+package torrent
+
+import (
+	"container/list"
+	"sync"
+)
+
+// The upload read cache capacity used with ClientConfig.ServeOnly, where repeated reads of popular
+// pieces make up most of the storage access.
+const defaultServeOnlyUploadReadCacheCapacity = 64 << 20
+
+type uploadReadCacheKey struct {
+	t     *Torrent
+	piece pieceIndex
+}
+
+type uploadReadCacheEntry struct {
+	key  uploadReadCacheKey
+	data []byte
+}
+
+// Caches whole pieces read from storage to serve peer requests, evicting the least recently used
+// pieces once the capacity in bytes is exceeded. Peers typically request every chunk of a piece, and
+// on a seed many peers request the same popular pieces, so this avoids going to storage for each of
+// them. It's accessed outside the Client lock, as peer request data is read asynchronously.
+type uploadReadCache struct {
+	mu       sync.Mutex
+	capacity int64
+	size     int64
+	// Most recently used at the front.
+	lru     list.List
+	entries map[uploadReadCacheKey]*list.Element
+
+	hits   int64
+	misses int64
+}
+
+func (me *uploadReadCache) init(capacity int64) {
+	me.capacity = capacity
+	me.entries = make(map[uploadReadCacheKey]*list.Element)
+}
+
+func (me *uploadReadCache) enabled() bool {
+	return me.capacity > 0
+}
+
+// Whether data of the given length can be cached. It's false if the cache isn't enabled.
+func (me *uploadReadCache) fits(length int64) bool {
+	return length <= me.capacity
+}
+
+func (me *uploadReadCache) get(key uploadReadCacheKey) (data []byte, ok bool) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	e, ok := me.entries[key]
+	if !ok {
+		me.misses++
+		return
+	}
+	me.hits++
+	me.lru.MoveToFront(e)
+	return e.Value.(*uploadReadCacheEntry).data, true
+}
+
+func (me *uploadReadCache) put(key uploadReadCacheKey, data []byte) {
+	if !me.fits(int64(len(data))) {
+		return
+	}
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if _, ok := me.entries[key]; ok {
+		// Another reader filled it concurrently.
+		return
+	}
+	me.entries[key] = me.lru.PushFront(&uploadReadCacheEntry{key, data})
+	me.size += int64(len(data))
+	for me.size > me.capacity {
+		me.removeElement(me.lru.Back())
+	}
+}
+
+func (me *uploadReadCache) removeElement(e *list.Element) {
+	entry := me.lru.Remove(e).(*uploadReadCacheEntry)
+	delete(me.entries, entry.key)
+	me.size -= int64(len(entry.data))
+}
+
+func (me *uploadReadCache) removePiece(key uploadReadCacheKey) {
+	if !me.enabled() {
+		return
+	}
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	if e, ok := me.entries[key]; ok {
+		me.removeElement(e)
+	}
+}
+
+func (me *uploadReadCache) removeTorrent(t *Torrent) {
+	if !me.enabled() {
+		return
+	}
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	for e := me.lru.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*uploadReadCacheEntry).key.t == t {
+			me.removeElement(e)
+		}
+		e = next
+	}
+}
+
+func (me *uploadReadCache) stats() (ret UploadReadCacheStats) {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	ret.Hits = me.hits
+	ret.Misses = me.misses
+	ret.Bytes = me.size
+	ret.Pieces = len(me.entries)
+	return
+}
+
+type UploadReadCacheStats struct {
+	// Peer requests served from the cache, and those that required reading storage.
+	Hits   int64
+	Misses int64
+	// The current amount of piece data held.
+	Bytes  int64
+	Pieces int
+}
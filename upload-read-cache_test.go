@@ -0,0 +1,73 @@
+package torrent
+
+import (
+	"os"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+)
+
+func TestUploadReadCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := qt.New(t)
+	var cache uploadReadCache
+	cache.init(10)
+	var tor Torrent
+	key := func(i int) uploadReadCacheKey { return uploadReadCacheKey{&tor, i} }
+	cache.put(key(0), make([]byte, 4))
+	cache.put(key(1), make([]byte, 4))
+	_, ok := cache.get(key(0))
+	c.Assert(ok, qt.IsTrue)
+	// Exceeds capacity, so piece 1 should go as it was used least recently.
+	cache.put(key(2), make([]byte, 4))
+	_, ok = cache.get(key(1))
+	c.Check(ok, qt.IsFalse)
+	_, ok = cache.get(key(0))
+	c.Check(ok, qt.IsTrue)
+	// Larger than the entire cache.
+	cache.put(key(3), make([]byte, 11))
+	_, ok = cache.get(key(3))
+	c.Check(ok, qt.IsFalse)
+	cache.removePiece(key(0))
+	c.Check(cache.stats(), qt.Equals, UploadReadCacheStats{
+		Hits:   2,
+		Misses: 2,
+		Bytes:  4,
+		Pieces: 1,
+	})
+	cache.removeTorrent(&tor)
+	c.Check(cache.stats().Pieces, qt.Equals, 0)
+}
+
+func TestUploadReadCachePieceLargerThanCapacity(t *testing.T) {
+	// The greeting torrent's pieces are 5 bytes.
+	for _, capacity := range []int64{5, 4} {
+		c := qt.New(t)
+		greetingDir, mi := testutil.GreetingTestTorrent()
+		defer os.RemoveAll(greetingDir)
+		cfg := TestingConfig(t)
+		cfg.DataDir = greetingDir
+		cfg.UploadReadCacheCapacity = capacity
+		cl, err := NewClient(cfg)
+		c.Assert(err, qt.IsNil)
+		defer cl.Close()
+		tt, err := cl.AddTorrent(mi)
+		c.Assert(err, qt.IsNil)
+		tt.VerifyData()
+		pc := cl.newConnection(nil, newConnectionOpts{network: "test"})
+		pc.setTorrent(tt)
+		for range 2 {
+			b, err := pc.readPeerRequestData(Request{1, ChunkSpec{1, 3}})
+			c.Assert(err, qt.IsNil)
+			c.Check(string(b), qt.Equals, testutil.GreetingFileContents[6:9])
+		}
+		stats := cl.uploadReadCache.stats()
+		if capacity == 5 {
+			c.Check(stats, qt.Equals, UploadReadCacheStats{Hits: 1, Misses: 1, Bytes: 5, Pieces: 1})
+		} else {
+			// The cache isn't consulted for pieces that can't fit.
+			c.Check(stats, qt.Equals, UploadReadCacheStats{})
+		}
+	}
+}
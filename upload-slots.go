@@ -0,0 +1,238 @@
+package torrent
+
+import (
+	"slices"
+	"time"
+
+	"github.com/anacrolix/log"
+	"golang.org/x/time/rate"
+)
+
+const (
+	// Used when ClientConfig.AutoUploadSlots is set without UploadSlots.
+	defaultAutoUploadSlots  = 4
+	autoUploadSlotsInterval = 10 * time.Second
+	autoUploadSlotsMin      = 2
+	autoUploadSlotsMax      = 100
+	// A slot is added if the existing ones average at least this, in bytes per second.
+	autoUploadSlotsGrowRate = 8 << 10
+	// A slot is removed if they average less than this while the uplink is saturated.
+	autoUploadSlotsStarveRate = 2 << 10
+	// The fraction of the UploadRateLimiter limit at which the uplink is considered saturated.
+	autoUploadSlotsSaturation = 0.9
+	// How often slots are taken from idle or slow peers so that waiting peers get a turn.
+	uploadSlotsRotateInterval = 10 * time.Second
+	// The optimistic slot moves to another waiting peer every this many rotations.
+	uploadSlotsOptimisticRotations = 3
+)
+
+// Limits the peers unchoked for uploading across the Client. Guarded by the Client lock.
+type uploadSlots struct {
+	// Zero means no limit.
+	slots int
+	// PeerConns we're not choking.
+	unchoked int
+	timer    ClockTimer
+	// An interested peer given a slot beyond the limit, regardless of what it has sent us, so new
+	// peers get a chance to show what they can do.
+	optimistic  *PeerConn
+	rotateTimer ClockTimer
+	rotations   int
+}
+
+// Per-PeerConn upload slot state. Guarded by the Client lock.
+type peerUploadSlot struct {
+	// When we last unchoked the peer.
+	unchokedAt time.Time
+	// The peer's BytesWrittenData at the last rotation.
+	writtenAtRotation int64
+	// The peer must give up its slot until the next rotation.
+	revoked bool
+}
+
+// The PeerConns unchoked in the regular slots.
+func (us *uploadSlots) regularUnchoked() int {
+	n := us.unchoked
+	if us.optimistic != nil && !us.optimistic.choking {
+		n--
+	}
+	return n
+}
+
+func (cl *Client) initUploadSlots() {
+	cl.uploadSlots.slots = cl.config.UploadSlots
+	if cl.config.AutoUploadSlots {
+		if cl.uploadSlots.slots == 0 {
+			cl.uploadSlots.slots = defaultAutoUploadSlots
+		}
+		cl.uploadSlots.timer = cl.clock().AfterFunc(autoUploadSlotsInterval, cl.autoAdjustUploadSlots)
+		cl.onClose = append(cl.onClose, func() { cl.uploadSlots.timer.Stop() })
+	}
+	if cl.uploadSlots.slots != 0 {
+		cl.uploadSlots.rotateTimer = cl.clock().AfterFunc(uploadSlotsRotateInterval, cl.rotateUploadSlots)
+		cl.onClose = append(cl.onClose, func() { cl.uploadSlots.rotateTimer.Stop() })
+	}
+}
+
+// Whether the peer can be unchoked, or stay unchoked, within the Client's upload slots.
+func (c *PeerConn) haveUploadSlot() bool {
+	us := &c.t.cl.uploadSlots
+	if us.slots == 0 {
+		return true
+	}
+	// Slots are scarce, so they aren't held for peers that don't want anything.
+	if !c.peerInterested {
+		return false
+	}
+	if c == us.optimistic {
+		return true
+	}
+	if c.uploadSlot.revoked {
+		return false
+	}
+	if c.choking {
+		return us.regularUnchoked() < us.slots
+	}
+	return us.regularUnchoked() <= us.slots
+}
+
+// Called when a PeerConn is choked or closed while unchoked. Waiting peers are only woken if a
+// regular slot is now free.
+func (cl *Client) onUploadSlotFreed() {
+	us := &cl.uploadSlots
+	us.unchoked--
+	if us.slots != 0 && us.regularUnchoked() < us.slots {
+		cl.tickleUploadSlotConns(true)
+	}
+}
+
+// Called when a PeerConn closes.
+func (cl *Client) onUploadSlotConnClosed(c *PeerConn) {
+	if cl.uploadSlots.optimistic == c {
+		cl.uploadSlots.optimistic = nil
+	}
+}
+
+// Tickles the writers of interested peers that are choked, so they can take free slots, or of
+// unchoked peers, so they give up slots beyond the limit.
+func (cl *Client) tickleUploadSlotConns(choked bool) {
+	for t := range cl.torrents {
+		for c := range t.conns {
+			if c.choking == choked && (!choked || c.peerInterested) {
+				c.tickleWriter()
+			}
+		}
+	}
+}
+
+func (cl *Client) rotateUploadSlots() {
+	cl.lock()
+	defer cl.unlock()
+	if cl.closed.IsSet() {
+		return
+	}
+	cl.rotateUploadSlotsLocked()
+	cl.uploadSlots.rotateTimer.Reset(uploadSlotsRotateInterval)
+}
+
+// Takes slots from peers that held them for a whole interval without being sent anything, and if
+// peers are still waiting, from the peer that was sent the least. Periodically moves the
+// optimistic slot to a random waiting peer.
+func (cl *Client) rotateUploadSlotsLocked() {
+	us := &cl.uploadSlots
+	now := cl.clock().Now()
+	uploaded := make(map[*PeerConn]int64)
+	// Regular slot holders that have had a whole interval to use their slot.
+	var held, waiting []*PeerConn
+	for t := range cl.torrents {
+		for c := range t.conns {
+			written := c._stats.BytesWrittenData.Int64()
+			uploaded[c] = written - c.uploadSlot.writtenAtRotation
+			c.uploadSlot.writtenAtRotation = written
+			if c.uploadSlot.revoked {
+				c.uploadSlot.revoked = false
+				c.tickleWriter()
+			}
+			switch {
+			case c.choking:
+				if c.peerInterested {
+					waiting = append(waiting, c)
+				}
+			case c != us.optimistic && now.Sub(c.uploadSlot.unchokedAt) >= uploadSlotsRotateInterval:
+				held = append(held, c)
+			}
+		}
+	}
+	revoke := func(c *PeerConn) {
+		c.uploadSlot.revoked = true
+		c.tickleWriter()
+	}
+	var active []*PeerConn
+	for _, c := range held {
+		if uploaded[c] == 0 && len(c.peerRequests) == 0 {
+			revoke(c)
+		} else {
+			active = append(active, c)
+		}
+	}
+	if len(waiting) > len(held)-len(active) && len(active) != 0 && us.regularUnchoked() >= us.slots {
+		revoke(slices.MinFunc(active, func(a, b *PeerConn) int {
+			return cmpInt64(uploaded[a], uploaded[b])
+		}))
+	}
+	us.rotations++
+	if len(waiting) != 0 && (us.optimistic == nil || us.rotations%uploadSlotsOptimisticRotations == 0) {
+		if prev := us.optimistic; prev != nil {
+			// It competes for a regular slot now.
+			prev.tickleWriter()
+		}
+		us.optimistic = waiting[cl.rand.Int63n(int64(len(waiting)))]
+		us.optimistic.tickleWriter()
+	}
+}
+
+func cmpInt64(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func (cl *Client) autoAdjustUploadSlots() {
+	cl.lock()
+	defer cl.unlock()
+	if cl.closed.IsSet() {
+		return
+	}
+	us := &cl.uploadSlots
+	uploadRate := cl.rates.rates(cl.clock().Now()).Upload.Over10s
+	slots := nextUploadSlots(us.slots, us.unchoked, uploadRate, cl.config.UploadRateLimiter.Limit())
+	if slots != us.slots {
+		cl.logger.Levelf(log.Debug, "adjusting upload slots from %v to %v at %.0f B/s", us.slots, slots, uploadRate)
+		// When slots grow, choked peers can take them, and when they shrink, unchoked peers beyond
+		// the limit are choked.
+		cl.tickleUploadSlotConns(slots > us.slots)
+		us.slots = slots
+	}
+	us.timer.Reset(autoUploadSlotsInterval)
+}
+
+// Returns the number of upload slots for the next interval, from the current slots, the peers
+// unchoked, and the aggregate upload rate in bytes per second. Slots are added while they're all in
+// use and each gets good throughput without saturating the rate limit, and removed when the rate
+// limit is saturated and slots are starved. Without a rate limit, saturation can't be detected,
+// so slots only grow.
+func nextUploadSlots(slots, unchoked int, uploadRate float64, limit rate.Limit) int {
+	saturated := limit != rate.Inf && uploadRate >= autoUploadSlotsSaturation*float64(limit)
+	perSlot := uploadRate / float64(maxInt(unchoked, 1))
+	switch {
+	case unchoked >= slots && !saturated && perSlot >= autoUploadSlotsGrowRate:
+		slots++
+	case saturated && perSlot < autoUploadSlotsStarveRate:
+		slots--
+	}
+	return minInt(maxInt(slots, autoUploadSlotsMin), autoUploadSlotsMax)
+}
@@ -0,0 +1,110 @@
+package torrent
+
+import (
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+	"golang.org/x/time/rate"
+
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+func TestNextUploadSlots(t *testing.T) {
+	c := qt.New(t)
+	// Every slot is in use and fast, with the uplink to spare.
+	c.Check(nextUploadSlots(4, 4, 4*autoUploadSlotsGrowRate, rate.Inf), qt.Equals, 5)
+	c.Check(nextUploadSlots(4, 4, 4*autoUploadSlotsGrowRate, 1<<20), qt.Equals, 5)
+	// Free slots aren't being taken.
+	c.Check(nextUploadSlots(4, 2, 4*autoUploadSlotsGrowRate, rate.Inf), qt.Equals, 4)
+	// The uplink is saturated, but slots are still fast.
+	c.Check(nextUploadSlots(4, 4, 1<<20, 1<<20), qt.Equals, 4)
+	// The uplink is saturated and slots are starved.
+	limit := rate.Limit(4 * autoUploadSlotsStarveRate)
+	c.Check(nextUploadSlots(8, 8, float64(limit), limit), qt.Equals, 7)
+	// Without a limit, saturation isn't detected.
+	c.Check(nextUploadSlots(8, 8, 1, rate.Inf), qt.Equals, 8)
+	c.Check(nextUploadSlots(autoUploadSlotsMin, 8, float64(limit), limit), qt.Equals, autoUploadSlotsMin)
+	c.Check(nextUploadSlots(autoUploadSlotsMax, autoUploadSlotsMax, 1<<30, rate.Inf), qt.Equals, autoUploadSlotsMax)
+}
+
+func TestUploadSlotsLimitUnchoking(t *testing.T) {
+	c := qt.New(t)
+	cfg := TestingConfig(t)
+	cfg.Seed = true
+	cfg.UploadSlots = 1
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, _ := cl.AddTorrentInfoHash([20]byte{1})
+	cl.lock()
+	defer cl.unlock()
+	newConn := func() *PeerConn {
+		pc := cl.newConnection(nil, newConnectionOpts{network: "tcp"})
+		pc.t = tt
+		pc.peerInterested = true
+		return pc
+	}
+	a := newConn()
+	b := newConn()
+	write := func(pp.Message) bool { return true }
+	c.Check(a.haveUploadSlot(), qt.IsTrue)
+	a.unchoke(write)
+	c.Check(b.haveUploadSlot(), qt.IsFalse)
+	c.Check(a.haveUploadSlot(), qt.IsTrue)
+	a.choke(write)
+	c.Check(b.haveUploadSlot(), qt.IsTrue)
+	c.Check(cl.uploadSlots.unchoked, qt.Equals, 0)
+}
+
+func TestUploadSlotsRotate(t *testing.T) {
+	c := qt.New(t)
+	clock := &fakeClock{now: time.Unix(1000, 0)}
+	cfg := TestingConfig(t)
+	cfg.Clock = clock
+	cfg.Seed = true
+	cfg.UploadSlots = 1
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, _ := cl.AddTorrentInfoHash([20]byte{1})
+	cl.lock()
+	defer cl.unlock()
+	newConn := func() *PeerConn {
+		pc := cl.newConnection(nil, newConnectionOpts{network: "tcp"})
+		pc.t = tt
+		pc.peerInterested = true
+		tt.conns[pc] = struct{}{}
+		return pc
+	}
+	a := newConn()
+	b := newConn()
+	d := newConn()
+	write := func(pp.Message) bool { return true }
+	a.unchoke(write)
+	// A holder that isn't sent anything for a whole interval gives up its slot, and a waiting peer
+	// gets the optimistic slot.
+	clock.now = clock.now.Add(uploadSlotsRotateInterval)
+	cl.rotateUploadSlotsLocked()
+	c.Check(a.haveUploadSlot(), qt.IsFalse)
+	opt := cl.uploadSlots.optimistic
+	c.Assert(opt == b || opt == d, qt.IsTrue)
+	c.Check(opt.haveUploadSlot(), qt.IsTrue)
+	other := b
+	if opt == b {
+		other = d
+	}
+	c.Check(other.haveUploadSlot(), qt.IsFalse)
+	a.choke(write)
+	c.Check(other.haveUploadSlot(), qt.IsTrue)
+	other.unchoke(write)
+	opt.unchoke(write)
+	c.Check(cl.uploadSlots.regularUnchoked(), qt.Equals, 1)
+	// With peers waiting, the holder sent the least gives up its slot, even if it's busy.
+	other._stats.BytesWrittenData.Add(1)
+	clock.now = clock.now.Add(uploadSlotsRotateInterval)
+	cl.rotateUploadSlotsLocked()
+	c.Check(other.haveUploadSlot(), qt.IsFalse)
+	other.choke(write)
+	c.Check(a.haveUploadSlot(), qt.IsTrue)
+}
@@ -9,7 +9,6 @@ import (
 	"strings"
 
 	"github.com/anacrolix/log"
-	"github.com/anacrolix/missinggo/v2"
 	"github.com/fsnotify/fsnotify"
 
 	"github.com/anacrolix/torrent/metainfo"
@@ -108,7 +107,7 @@ func scanDir(dirName string) (ee map[metainfo.Hash]entity) {
 			e := entity{
 				TorrentFilePath: fullName,
 			}
-			missinggo.CopyExact(&e.Hash, ih)
+			e.Hash = ih
 			addEntity(e)
 		case ".magnet":
 			uris, err := magnetFileURIs(fullName)
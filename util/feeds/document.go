@@ -0,0 +1,98 @@
+package feeds
+
+import (
+	"strings"
+)
+
+// Decodes either an RSS 2.0 or Atom feed, as the root element isn't constrained.
+type document struct {
+	Channel struct {
+		Items []rssItem `xml:"item"`
+	} `xml:"channel"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type rssItem struct {
+	Title     string `xml:"title"`
+	Link      string `xml:"link"`
+	Guid      string `xml:"guid"`
+	MagnetUri string `xml:"magnetURI"`
+	Enclosure struct {
+		Url  string `xml:"url,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"enclosure"`
+}
+
+type atomEntry struct {
+	Title string `xml:"title"`
+	Id    string `xml:"id"`
+	Links []struct {
+		Href string `xml:"href,attr"`
+		Rel  string `xml:"rel,attr"`
+		Type string `xml:"type,attr"`
+	} `xml:"link"`
+}
+
+const torrentMimeType = "application/x-bittorrent"
+
+// A feed item reduced to what's needed to add it.
+type item struct {
+	title string
+	id    string
+	// A magnet link or torrent file URL. Empty if the item doesn't have one.
+	url string
+}
+
+// Identifies the item for adding it only once.
+func (me item) key() string {
+	if me.id != "" {
+		return me.id
+	}
+	return me.url
+}
+
+func looksLikeTorrent(url, mimeType string) bool {
+	return mimeType == torrentMimeType ||
+		strings.HasPrefix(url, "magnet:") ||
+		strings.HasSuffix(strings.ToLower(url), ".torrent")
+}
+
+func (me rssItem) url() string {
+	if me.MagnetUri != "" {
+		return me.MagnetUri
+	}
+	if looksLikeTorrent(me.Enclosure.Url, me.Enclosure.Type) {
+		return me.Enclosure.Url
+	}
+	if looksLikeTorrent(me.Link, "") {
+		return me.Link
+	}
+	return ""
+}
+
+func (me atomEntry) url() string {
+	for _, l := range me.Links {
+		if looksLikeTorrent(l.Href, l.Type) {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+func (me *document) items() (ret []item) {
+	for _, i := range me.Channel.Items {
+		ret = append(ret, item{
+			title: strings.TrimSpace(i.Title),
+			id:    strings.TrimSpace(i.Guid),
+			url:   strings.TrimSpace(i.url()),
+		})
+	}
+	for _, e := range me.Entries {
+		ret = append(ret, item{
+			title: strings.TrimSpace(e.Title),
+			id:    strings.TrimSpace(e.Id),
+			url:   strings.TrimSpace(e.url()),
+		})
+	}
+	return
+}
@@ -0,0 +1,264 @@
+// Package feeds polls RSS and Atom feeds of torrents and magnet links (BEP 36), and adds the items
+// that match each feed's filters to a Client.
+package feeds
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anacrolix/log"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/storage"
+)
+
+const DefaultInterval = 15 * time.Minute
+
+var errTooLarge = errors.New("response too large")
+
+const (
+	// Limits on the size of remote feeds and torrent files.
+	maxFeedBytes        = 10 << 20
+	maxTorrentFileBytes = 50 << 20
+	// Items that haven't appeared in a polled feed for this long are forgotten, so they'd be added
+	// again if they reappear.
+	seenExpiry = 7 * 24 * time.Hour
+)
+
+type Feed struct {
+	Url string
+	// If set, only items with titles that match are added.
+	Include *regexp.Regexp
+	// If set, items with titles that match aren't added.
+	Exclude *regexp.Regexp
+	// Where the data for torrents from this feed is stored. The Client's default storage is used
+	// if it's empty.
+	DownloadDir string
+}
+
+func (f *Feed) wants(title string) bool {
+	if f.Include != nil && !f.Include.MatchString(title) {
+		return false
+	}
+	if f.Exclude != nil && f.Exclude.MatchString(title) {
+		return false
+	}
+	return true
+}
+
+type Config struct {
+	Feeds []Feed
+	// Defaults to DefaultInterval.
+	Interval time.Duration
+	// Used to fetch feeds and torrent files. Defaults to http.DefaultClient.
+	HttpClient *http.Client
+	Logger     log.Logger
+	// Called for each torrent added from a feed.
+	OnAdded func(*Feed, *torrent.Torrent)
+}
+
+// Adds torrents from feeds to a Client. Items are only added once per Poller, unless they're missing
+// from its feeds for a week and then reappear. All the files of added torrents are downloaded.
+type Poller struct {
+	cl     *torrent.Client
+	config Config
+	mu     sync.Mutex
+	// When each added item last appeared in a polled feed.
+	seen     map[string]time.Time
+	storages map[string]storage.ClientImplCloser
+}
+
+func New(cl *torrent.Client, config Config) *Poller {
+	if config.Interval == 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.HttpClient == nil {
+		config.HttpClient = http.DefaultClient
+	}
+	if config.Logger.IsZero() {
+		config.Logger = log.Default
+	}
+	return &Poller{
+		cl:       cl,
+		config:   config,
+		seen:     make(map[string]time.Time),
+		storages: make(map[string]storage.ClientImplCloser),
+	}
+}
+
+// Polls the feeds every interval until the context is done.
+func (p *Poller) Run(ctx context.Context) error {
+	for {
+		p.Poll(ctx)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(p.config.Interval):
+		}
+	}
+}
+
+// Polls each feed once. Errors are logged, and items that failed to be added are retried on the
+// next poll.
+func (p *Poller) Poll(ctx context.Context) {
+	for i := range p.config.Feeds {
+		f := &p.config.Feeds[i]
+		err := p.pollFeed(ctx, f)
+		if err != nil {
+			p.config.Logger.Levelf(log.Warning, "polling feed %q: %v", f.Url, err)
+		}
+	}
+	p.expireSeen(time.Now())
+}
+
+// Forgets items that haven't appeared in a feed since seenExpiry before now.
+func (p *Poller) expireSeen(now time.Time) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key, last := range p.seen {
+		if now.Sub(last) >= seenExpiry {
+			delete(p.seen, key)
+		}
+	}
+}
+
+// Closes the storage opened for feed download directories. Torrents added from feeds should be
+// dropped first.
+func (p *Poller) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for dir, s := range p.storages {
+		s.Close()
+		delete(p.storages, dir)
+	}
+	return nil
+}
+
+func (p *Poller) pollFeed(ctx context.Context, f *Feed) error {
+	items, err := p.fetchItems(ctx, f.Url)
+	if err != nil {
+		return err
+	}
+	for _, it := range items {
+		if it.url == "" || !f.wants(it.title) {
+			continue
+		}
+		key := it.key()
+		p.mu.Lock()
+		_, seen := p.seen[key]
+		if seen {
+			p.seen[key] = time.Now()
+		}
+		p.mu.Unlock()
+		if seen {
+			continue
+		}
+		t, err := p.addItem(ctx, f, it)
+		if err != nil {
+			p.config.Logger.Levelf(log.Warning, "adding %q from feed %q: %v", it.title, f.Url, err)
+			continue
+		}
+		p.mu.Lock()
+		p.seen[key] = time.Now()
+		p.mu.Unlock()
+		go func() {
+			select {
+			case <-t.GotInfo():
+				t.DownloadAll()
+			case <-t.Closed():
+			}
+		}()
+		if p.config.OnAdded != nil {
+			p.config.OnAdded(f, t)
+		}
+	}
+	return nil
+}
+
+func (p *Poller) get(ctx context.Context, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.config.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response status %q", resp.Status)
+	}
+	return resp, nil
+}
+
+func (p *Poller) fetchItems(ctx context.Context, url string) ([]item, error) {
+	resp, err := p.get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body := &io.LimitedReader{R: resp.Body, N: maxFeedBytes}
+	var doc document
+	err = xml.NewDecoder(body).Decode(&doc)
+	if err != nil {
+		return nil, fmt.Errorf("decoding feed: %w", limitErr(body, err))
+	}
+	return doc.items(), nil
+}
+
+// Returns an error for the limit instead of err, if decoding failed because the limit was reached.
+func limitErr(r *io.LimitedReader, err error) error {
+	if r.N <= 0 {
+		return errTooLarge
+	}
+	return err
+}
+
+func (p *Poller) addItem(ctx context.Context, f *Feed, it item) (*torrent.Torrent, error) {
+	spec, err := p.itemSpec(ctx, it)
+	if err != nil {
+		return nil, err
+	}
+	if f.DownloadDir != "" {
+		spec.Storage = p.dirStorage(f.DownloadDir)
+	}
+	t, _, err := p.cl.AddTorrentSpec(spec)
+	return t, err
+}
+
+func (p *Poller) itemSpec(ctx context.Context, it item) (*torrent.TorrentSpec, error) {
+	if strings.HasPrefix(it.url, "magnet:") {
+		return torrent.TorrentSpecFromMagnetUri(it.url)
+	}
+	resp, err := p.get(ctx, it.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body := &io.LimitedReader{R: resp.Body, N: maxTorrentFileBytes}
+	mi, err := metainfo.Load(body)
+	if err != nil {
+		return nil, fmt.Errorf("loading metainfo: %w", limitErr(body, err))
+	}
+	return torrent.TorrentSpecFromMetaInfoErr(mi)
+}
+
+func (p *Poller) dirStorage(dir string) storage.ClientImpl {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	s, ok := p.storages[dir]
+	if !ok {
+		s = storage.NewFile(dir)
+		p.storages[dir] = s
+	}
+	return s
+}
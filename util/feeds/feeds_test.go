@@ -0,0 +1,120 @@
+package feeds
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent"
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/types/infohash"
+)
+
+const rssFeed = `<?xml version="1.0"?>
+<rss version="2.0" xmlns:torrent="http://xmlns.ezrss.it/0.1/">
+<channel>
+<item>
+	<title>Greeting</title>
+	<guid>greeting</guid>
+	<enclosure url="%[1]s/greeting.torrent" type="application/x-bittorrent"/>
+</item>
+<item>
+	<title>Greeting sample</title>
+	<torrent:magnetURI>magnet:?xt=urn:btih:0303030303030303030303030303030303030303</torrent:magnetURI>
+</item>
+<item>
+	<title>Not a torrent</title>
+	<link>%[1]s/page.html</link>
+</item>
+</channel>
+</rss>`
+
+const atomFeed = `<?xml version="1.0"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+<entry>
+	<title>Other</title>
+	<id>other</id>
+	<link rel="alternate" href="https://example.com/other"/>
+	<link rel="enclosure" href="magnet:?xt=urn:btih:0202020202020202020202020202020202020202"/>
+</entry>
+</feed>`
+
+func TestPoll(t *testing.T) {
+	c := qt.New(t)
+	mi := testutil.GreetingMetaInfo()
+	var torrentFetches atomic.Int32
+	mux := http.NewServeMux()
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+	mux.HandleFunc("/rss", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, rssFeed, srv.URL)
+	})
+	mux.HandleFunc("/atom", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(atomFeed))
+	})
+	mux.HandleFunc("/greeting.torrent", func(w http.ResponseWriter, r *http.Request) {
+		torrentFetches.Add(1)
+		mi.Write(w)
+	})
+	cl, err := torrent.NewClient(torrent.TestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	var added []*torrent.Torrent
+	p := New(cl, Config{
+		Feeds: []Feed{
+			{
+				Url:         srv.URL + "/rss",
+				Include:     regexp.MustCompile(`^Greeting`),
+				Exclude:     regexp.MustCompile(`sample`),
+				DownloadDir: t.TempDir(),
+			},
+			{Url: srv.URL + "/atom"},
+		},
+		OnAdded: func(_ *Feed, t *torrent.Torrent) {
+			added = append(added, t)
+		},
+	})
+	defer p.Close()
+	p.Poll(context.Background())
+	c.Assert(added, qt.HasLen, 2)
+	c.Check(added[0].InfoHash(), qt.Equals, mi.HashInfoBytes())
+	c.Check(added[1].InfoHash(), qt.Equals, infohash.FromHexString("0202020202020202020202020202020202020202"))
+	c.Check(torrentFetches.Load(), qt.Equals, int32(1))
+	// Items are only added once.
+	p.Poll(context.Background())
+	c.Check(added, qt.HasLen, 2)
+	c.Check(torrentFetches.Load(), qt.Equals, int32(1))
+	c.Check(cl.Torrents(), qt.HasLen, 2)
+	// Items that stop appearing in feeds are eventually forgotten.
+	c.Check(p.seen, qt.HasLen, 2)
+	p.expireSeen(time.Now().Add(seenExpiry - time.Minute))
+	c.Check(p.seen, qt.HasLen, 2)
+	p.expireSeen(time.Now().Add(seenExpiry))
+	c.Check(p.seen, qt.HasLen, 0)
+}
+
+func TestFeedTooLarge(t *testing.T) {
+	c := qt.New(t)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("<rss><channel>"))
+		padding := strings.Repeat(" ", 1<<20)
+		for range maxFeedBytes>>20 + 1 {
+			_, err := w.Write([]byte(padding))
+			if err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+	p := New(nil, Config{})
+	_, err := p.fetchItems(context.Background(), srv.URL)
+	c.Check(err, qt.ErrorIs, errTooLarge)
+}
@@ -4,6 +4,8 @@
 package torrent
 
 import (
+	"net"
+
 	"github.com/anacrolix/log"
 	"github.com/anacrolix/utp"
 )
@@ -16,3 +18,12 @@ func NewUtpSocket(network, addr string, _ firewallCallback, _ log.Logger) (utpSo
 		return s, err
 	}
 }
+
+// Creates a uTP socket on an existing PacketConn, which is closed with the socket.
+func NewUtpSocketFromPacketConn(pc net.PacketConn, _ firewallCallback, _ log.Logger) (utpSocket, error) {
+	s, err := utp.NewSocketFromPacketConn(pc)
+	if s == nil {
+		return nil, err
+	}
+	return s, err
+}
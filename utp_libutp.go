@@ -4,8 +4,11 @@
 package torrent
 
 import (
+	"net"
+
 	utp "github.com/anacrolix/go-libutp"
 	"github.com/anacrolix/log"
+	goutp "github.com/anacrolix/utp"
 )
 
 func NewUtpSocket(network, addr string, fc firewallCallback, logger log.Logger) (utpSocket, error) {
@@ -21,3 +24,13 @@ func NewUtpSocket(network, addr string, fc firewallCallback, logger log.Logger)
 	}
 	return s, err
 }
+
+// Creates a uTP socket on an existing PacketConn, which is closed with the socket. go-libutp only
+// creates its own sockets, so this uses the pure Go implementation, without firewall callbacks.
+func NewUtpSocketFromPacketConn(pc net.PacketConn, _ firewallCallback, _ log.Logger) (utpSocket, error) {
+	s, err := goutp.NewSocketFromPacketConn(pc)
+	if s == nil {
+		return nil, err
+	}
+	return s, err
+}
@@ -1,9 +1,13 @@
 package torrent
 
 import (
+	"net"
 	"testing"
+	"time"
 
+	"github.com/anacrolix/dht/v2"
 	"github.com/anacrolix/log"
+	qt "github.com/frankban/quicktest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -14,3 +18,25 @@ func TestNewUtpSocketErrorNilInterface(t *testing.T) {
 		t.Fatalf("expected nil, got %#v", s)
 	}
 }
+
+func TestClientPacketConns(t *testing.T) {
+	c := qt.New(t)
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	c.Assert(err, qt.IsNil)
+	port := pc.LocalAddr().(*net.UDPAddr).Port
+	cfg := TestingConfig(t)
+	cfg.DisableIPv6 = true
+	cfg.NoDHT = false
+	cfg.DhtStartingNodes = func(string) dht.StartingNodesGetter {
+		return func() ([]dht.Addr, error) { return nil, nil }
+	}
+	cfg.PacketConns = []net.PacketConn{pc}
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	c.Check(cl.listenPorts(), qt.Equals, ListenPorts{Tcp: port, Utp: port, Dht: port})
+	cl.Close()
+	// The Client closes the PacketConn, though sockets are closed asynchronously.
+	for pc.SetDeadline(time.Now()) == nil {
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,57 @@
+package torrent
+
+import (
+	"time"
+
+	"github.com/anacrolix/missinggo/v2/bitmap"
+
+	"github.com/anacrolix/torrent/metainfo"
+)
+
+// Tracks pieces explicitly queued for verification, so that long rechecks can report progress.
+type verifyProgress struct {
+	// Pieces in the current run that are yet to be hashed.
+	pending bitmap.Bitmap
+	meter   metainfo.HashingProgressMeter
+}
+
+type VerifyDataProgressEvent struct {
+	Torrent *Torrent
+	metainfo.HashingProgress
+}
+
+// Adds pieces in [begin, end) to the current verification run, starting a new run if the last
+// one finished.
+func (t *Torrent) addVerifyPieces(begin, end pieceIndex) {
+	vp := &t.verifyProgress
+	if vp.pending.IsEmpty() {
+		vp.meter = metainfo.HashingProgressMeter{Started: time.Now()}
+	}
+	for i := begin; i < end; i++ {
+		if vp.pending.Contains(bitmap.BitIndex(i)) {
+			continue
+		}
+		vp.pending.Add(bitmap.BitIndex(i))
+		vp.meter.NumPieces++
+		vp.meter.TotalBytes += int64(t.pieceLength(i))
+	}
+}
+
+func (t *Torrent) updateVerifyProgress(piece pieceIndex) {
+	vp := &t.verifyProgress
+	if !vp.pending.Contains(bitmap.BitIndex(piece)) {
+		return
+	}
+	vp.pending.Remove(bitmap.BitIndex(piece))
+	vp.meter.PieceHashed(int64(t.pieceLength(piece)))
+	for _, f := range t.callbacks().VerifyDataProgress {
+		f(VerifyDataProgressEvent{t, vp.meter.HashingProgress})
+	}
+}
+
+// Returns the progress of the current or most recent verification started by VerifyData.
+func (t *Torrent) VerifyDataProgress() metainfo.HashingProgress {
+	t.cl.rLock()
+	defer t.cl.rUnlock()
+	return t.verifyProgress.meter.HashingProgress
+}
@@ -0,0 +1,81 @@
+package torrent
+
+import (
+	"testing"
+
+	g "github.com/anacrolix/generics"
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	pp "github.com/anacrolix/torrent/peer_protocol"
+)
+
+func TestFailedHashWasteAttributedToDirtiers(t *testing.T) {
+	c := qt.New(t)
+	mi := testutil.GreetingMetaInfo()
+	cl := newTestingClient(t)
+	tt := cl.newTorrent(mi.HashInfoBytes(), badStorage{})
+	tt.setChunkSize(2)
+	c.Assert(tt.setInfoBytesLocked(mi.InfoBytes), qt.IsNil)
+	cl.lock()
+	defer cl.unlock()
+	var pcs [2]*PeerConn
+	for i := range pcs {
+		pcs[i] = cl.newConnection(nil, newConnectionOpts{network: "test"})
+		pcs[i].setTorrent(tt)
+		// Untrusted peers would be banned, which needs a remote address.
+		pcs[i].trusted = true
+	}
+	tt.dirtyChunks.AddRange(
+		uint64(tt.pieceRequestIndexOffset(1)),
+		uint64(tt.pieceRequestIndexOffset(1)+3))
+	pcs[0].onDirtiedPiece(1, 4)
+	pcs[1].onDirtiedPiece(1, 2)
+	tt.pieceHashed(1, false, nil)
+	stats0 := pcs[0].Stats()
+	stats1 := pcs[1].Stats()
+	c.Check(stats0.BytesReadWastedFailedHash.Int64(), qt.Equals, int64(4))
+	c.Check(stats1.BytesReadWasted(), qt.Equals, int64(2))
+	c.Check(tt.stats.BytesReadWastedFailedHash.Int64(), qt.Equals, int64(6))
+	c.Check(tt.piece(1).dirtiers, qt.HasLen, 0)
+}
+
+func TestUnwantedChunkCountedOnlyAsWasted(t *testing.T) {
+	c := qt.New(t)
+	cl, err := NewClient(TestingConfig(t))
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	cl.lock()
+	defer cl.unlock()
+	tt._pendingPieces.Add(1)
+	pc := cl.newConnection(nil, newConnectionOpts{network: "test"})
+	pc.setTorrent(tt)
+	receive := func(index int) {
+		r := tt.requestIndexToRequest(tt.pieceRequestIndexOffset(index))
+		data := testutil.GreetingFileContents[r.Begin+pp.Integer(index)*pp.Integer(tt.info.PieceLength):][:r.Length]
+		g.MakeMapIfNil(&pc.validReceiveChunks)
+		pc.validReceiveChunks[tt.requestIndexFromRequest(r)] = 1
+		c.Assert(pc.receiveChunk(&pp.Message{
+			Type:  pp.Piece,
+			Index: r.Index,
+			Begin: r.Begin,
+			Piece: []byte(data),
+		}), qt.IsNil)
+	}
+	// Piece 0 isn't wanted.
+	receive(0)
+	stats := pc.Stats()
+	c.Check(stats.BytesReadWastedUnwanted.Int64(), qt.Equals, int64(5))
+	c.Check(stats.ChunksReadWasted.Int64(), qt.Equals, int64(1))
+	c.Check(stats.BytesReadUsefulData.Int64(), qt.Equals, int64(0))
+	c.Check(stats.ChunksReadUseful.Int64(), qt.Equals, int64(0))
+	receive(1)
+	stats = pc.Stats()
+	c.Check(stats.BytesReadWastedUnwanted.Int64(), qt.Equals, int64(5))
+	c.Check(stats.BytesReadUsefulData.Int64(), qt.Equals, int64(5))
+	c.Check(stats.ChunksReadUseful.Int64(), qt.Equals, int64(1))
+	c.Check(tt.stats.BytesReadUsefulData.Int64(), qt.Equals, int64(5))
+	c.Check(tt.stats.BytesReadWasted(), qt.Equals, int64(5))
+}
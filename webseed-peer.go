@@ -4,7 +4,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"math/rand"
+	"net/http"
 	"sync"
 	"time"
 
@@ -17,26 +17,122 @@ import (
 )
 
 const (
-	webseedPeerUnhandledErrorSleep   = 5 * time.Second
-	webseedPeerCloseOnUnhandledError = false
+	// Backoff after the first failed request. It doubles for each consecutive failure.
+	webseedPeerMinErrorBackoff = 5 * time.Second
+	webseedPeerMaxErrorBackoff = 10 * time.Minute
+	// Consecutive 404 responses after which the webseed is disabled.
+	webseedPeerMaxNotFound = 3
+
+	defaultWebseedMaxRequests = 16
+	// I think this value was observed from some webseeds. It seems reasonable to extend it to other
+	// uses of HTTP from the client.
+	defaultWebseedMaxConnsPerHost = 10
 )
 
 type webseedPeer struct {
 	// First field for stats alignment.
-	peer             Peer
-	client           webseed.Client
-	activeRequests   map[Request]webseed.Request
-	requesterCond    sync.Cond
-	lastUnhandledErr time.Time
+	peer           Peer
+	client         webseed.Client
+	activeRequests map[Request]webseed.Request
+	requesterCond  sync.Cond
+	// Contiguous chunk requests are combined into HTTP requests of up to this many bytes.
+	maxCoalescedBytes int64
+
+	// Error tracking, guarded by the Client lock.
+	lastErr           error
+	lastErrTime       time.Time
+	consecutiveErrors int
+	totalErrors       int64
+	consecutive404s   int
+	// Requesters won't start requests before this time.
+	backoffUntil time.Time
+	disabled     bool
+}
+
+// Error and backoff state for a webseed URL.
+type WebseedStats struct {
+	Url string
+	// Failed requests since the last successful one. This determines the current backoff.
+	ConsecutiveErrors int
+	TotalErrors       int64
+	LastError         string
+	LastErrorTime     time.Time
+	// No requests will be made to the webseed before this time.
+	BackoffUntil time.Time
+	// The webseed has been given up on, due to repeated 404 responses.
+	Disabled bool
 }
 
 var _ peerImpl = (*webseedPeer)(nil)
 
 func (me *webseedPeer) peerImplStatusLines() []string {
-	return []string{
+	lines := []string{
 		me.client.Url,
-		fmt.Sprintf("last unhandled error: %v", eventAgeString(me.lastUnhandledErr)),
+		fmt.Sprintf("last error: %v (%v consecutive, %v total)",
+			eventAgeString(me.peer.now(), me.lastErrTime), me.consecutiveErrors, me.totalErrors),
+	}
+	if me.lastErr != nil {
+		lines = append(lines, fmt.Sprintf("last error: %v", me.lastErr))
+	}
+	if me.disabled {
+		lines = append(lines, "disabled")
+	} else if d := me.backoffUntil.Sub(me.peer.now()); d > 0 {
+		lines = append(lines, fmt.Sprintf("backing off for %v", d.Round(time.Second)))
+	}
+	return lines
+}
+
+func (me *webseedPeer) stats() WebseedStats {
+	ret := WebseedStats{
+		Url:               me.client.Url,
+		ConsecutiveErrors: me.consecutiveErrors,
+		TotalErrors:       me.totalErrors,
+		LastErrorTime:     me.lastErrTime,
+		BackoffUntil:      me.backoffUntil,
+		Disabled:          me.disabled,
 	}
+	if me.lastErr != nil {
+		ret.LastError = me.lastErr.Error()
+	}
+	return ret
+}
+
+// Records a failed request, and determines how long to wait before making further requests. The
+// caller should close the peer if it becomes disabled.
+func (me *webseedPeer) onRequestError(err error) {
+	now := me.peer.now()
+	me.lastErr = err
+	me.lastErrTime = now
+	me.consecutiveErrors++
+	me.totalErrors++
+	backoff := webseedPeerMinErrorBackoff << (me.consecutiveErrors - 1)
+	if backoff > webseedPeerMaxErrorBackoff || backoff <= 0 {
+		backoff = webseedPeerMaxErrorBackoff
+	}
+	var badResp webseed.ErrBadResponse
+	if errors.As(err, &badResp) {
+		if retryAfter, ok := badResp.RetryAfter(); ok && retryAfter > backoff {
+			backoff = retryAfter
+		}
+		if badResp.Response != nil && badResp.Response.StatusCode == http.StatusNotFound {
+			me.consecutive404s++
+		} else {
+			me.consecutive404s = 0
+		}
+	} else {
+		me.consecutive404s = 0
+	}
+	me.backoffUntil = now.Add(backoff)
+	if me.consecutive404s >= webseedPeerMaxNotFound {
+		me.peer.logger.Levelf(log.Warning, "disabling after %v consecutive not found responses", me.consecutive404s)
+		me.disabled = true
+	}
+}
+
+func (me *webseedPeer) onRequestSuccess() {
+	me.consecutiveErrors = 0
+	me.consecutive404s = 0
+	me.backoffUntil = time.Time{}
 }
 
 func (ws *webseedPeer) String() string {
@@ -76,15 +172,58 @@ func (ws *webseedPeer) _request(r Request) bool {
 	return true
 }
 
-func (ws *webseedPeer) doRequest(r Request) error {
-	webseedRequest := ws.client.NewRequest(ws.intoSpec(r))
-	ws.activeRequests[r] = webseedRequest
+// Returns a run of contiguous requests including x that are pending and not already active, up to
+// the coalescing limit. The run starts before x if possible, since requests aren't necessarily
+// made in order.
+func (ws *webseedPeer) coalesceRequests(x RequestIndex) (rs []Request) {
+	t := ws.peer.t
+	length := int64(t.requestIndexToRequest(x).Length)
+	// Adds the request to the run if it can be coalesced.
+	extend := func(x RequestIndex) bool {
+		if !ws.peer.requestState.Requests.Contains(x) {
+			return false
+		}
+		r := t.requestIndexToRequest(x)
+		if _, ok := ws.activeRequests[r]; ok {
+			return false
+		}
+		if length+int64(r.Length) > ws.maxCoalescedBytes {
+			return false
+		}
+		length += int64(r.Length)
+		return true
+	}
+	start, end := x, x+1
+	for start > 0 && extend(start-1) {
+		start--
+	}
+	for end < t.numChunks() && extend(end) {
+		end++
+	}
+	for x := start; x < end; x++ {
+		rs = append(rs, t.requestIndexToRequest(x))
+	}
+	return
+}
+
+// Makes a single HTTP request for a run of contiguous chunk requests.
+func (ws *webseedPeer) doRequests(rs []Request) error {
+	spec := ws.intoSpec(rs[0])
+	for _, r := range rs[1:] {
+		spec.Length += int64(r.Length)
+	}
+	webseedRequest := ws.client.NewRequest(spec)
+	for _, r := range rs {
+		ws.activeRequests[r] = webseedRequest
+	}
 	err := func() error {
 		ws.requesterCond.L.Unlock()
 		defer ws.requesterCond.L.Lock()
-		return ws.requestResultHandler(r, webseedRequest)
+		return ws.requestResultHandler(rs, webseedRequest)
 	}()
-	delete(ws.activeRequests, r)
+	for _, r := range rs {
+		delete(ws.activeRequests, r)
+	}
 	return err
 }
 
@@ -93,6 +232,18 @@ func (ws *webseedPeer) requester(i int) {
 	defer ws.requesterCond.L.Unlock()
 start:
 	for !ws.peer.closed.IsSet() {
+		// Every requester waits out a backoff, not just the one whose request failed.
+		if duration := ws.backoffUntil.Sub(ws.peer.now()); duration > 0 {
+			ws.requesterCond.L.Unlock()
+			// Spread out requesters resuming after a backoff.
+			duration += time.Duration(ws.peer.t.cl.rand.Int63n(int64(time.Second)))
+			select {
+			case <-ws.peer.t.cl.clock().After(duration):
+			case <-ws.peer.closed.Done():
+			}
+			ws.requesterCond.L.Lock()
+			continue
+		}
 		// Restart is set if we don't need to wait for the requestCond before trying again.
 		restart := false
 		ws.peer.requestState.Requests.Iterate(func(x RequestIndex) bool {
@@ -100,21 +251,12 @@ start:
 			if _, ok := ws.activeRequests[r]; ok {
 				return true
 			}
-			err := ws.doRequest(r)
-			ws.requesterCond.L.Unlock()
+			rs := ws.coalesceRequests(x)
+			err := ws.doRequests(rs)
 			if err != nil && !errors.Is(err, context.Canceled) {
-				ws.peer.logger.Printf("requester %v: error doing webseed request %v: %v", i, r, err)
+				ws.peer.logger.Printf("requester %v: error doing webseed request %v (%v chunks): %v", i, rs[0], len(rs), err)
 			}
 			restart = true
-			if errors.Is(err, webseed.ErrTooFast) {
-				time.Sleep(time.Duration(rand.Int63n(int64(10 * time.Second))))
-			}
-			// Demeter is throwing a tantrum on Mount Olympus for this
-			ws.peer.t.cl.locker().RLock()
-			duration := time.Until(ws.lastUnhandledErr.Add(webseedPeerUnhandledErrorSleep))
-			ws.peer.t.cl.locker().RUnlock()
-			time.Sleep(duration)
-			ws.requesterCond.L.Lock()
 			return false
 		})
 		if restart {
@@ -138,11 +280,11 @@ func (cn *webseedPeer) ban() {
 func (ws *webseedPeer) handleUpdateRequests() {
 	// Because this is synchronous, webseed peers seem to get first dibs on newly prioritized
 	// pieces.
-	go func() {
+	ws.peer.t.goBackground(func() {
 		ws.peer.t.cl.lock()
 		defer ws.peer.t.cl.unlock()
 		ws.peer.maybeUpdateActualRequestState()
-	}()
+	})
 }
 
 func (ws *webseedPeer) onClose() {
@@ -157,14 +299,27 @@ func (ws *webseedPeer) onClose() {
 	ws.requesterCond.Broadcast()
 }
 
-func (ws *webseedPeer) requestResultHandler(r Request, webseedRequest webseed.Request) error {
+// Handles the result of a webseed request covering the contiguous requests in rs. Cancelling any
+// one of them cancels the HTTP request, and all of them are rejected.
+func (ws *webseedPeer) requestResultHandler(rs []Request, webseedRequest webseed.Request) error {
 	result := <-webseedRequest.Result
 	close(webseedRequest.Result) // one-shot
+	var expectedLength int
+	for _, r := range rs {
+		expectedLength += int(r.Length)
+	}
+	if result.Err == nil && len(result.Bytes) != expectedLength {
+		result.Err = fmt.Errorf("got %v bytes, expected %v", len(result.Bytes), expectedLength)
+	}
 	// We do this here rather than inside receiveChunk, since we want to count errors too. I'm not
 	// sure if we can divine which errors indicate cancellation on our end without hitting the
 	// network though.
-	if len(result.Bytes) != 0 || result.Err == nil {
+	if result.Err == nil {
 		// Increment ChunksRead and friends
+		for _, r := range rs {
+			ws.peer.doChunkReadStats(int64(r.Length))
+		}
+	} else if len(result.Bytes) != 0 {
 		ws.peer.doChunkReadStats(int64(len(result.Bytes)))
 	}
 	ws.peer.readBytes(int64(len(result.Bytes)))
@@ -177,37 +332,39 @@ func (ws *webseedPeer) requestResultHandler(r Request, webseedRequest webseed.Re
 	if err != nil {
 		switch {
 		case errors.Is(err, context.Canceled):
-		case errors.Is(err, webseed.ErrTooFast):
 		case ws.peer.closed.IsSet():
 		default:
-			ws.peer.logger.Printf("Request %v rejected: %v", r, result.Err)
-			// // Here lies my attempt to extract something concrete from Go's error system. RIP.
-			// cfg := spew.NewDefaultConfig()
-			// cfg.DisableMethods = true
-			// cfg.Dump(result.Err)
-
-			if webseedPeerCloseOnUnhandledError {
-				log.Printf("closing %v", ws)
-				ws.peer.close()
-			} else {
-				ws.lastUnhandledErr = time.Now()
+			if !errors.Is(err, webseed.ErrTooFast) {
+				ws.peer.logger.Printf("Request %v rejected: %v", rs[0], result.Err)
 			}
+			ws.onRequestError(err)
 		}
-		if !ws.peer.remoteRejectedRequest(ws.peer.t.requestIndexFromRequest(r)) {
-			panic("invalid reject")
+		for _, r := range rs {
+			if !ws.peer.remoteRejectedRequest(ws.peer.t.requestIndexFromRequest(r)) {
+				panic("invalid reject")
+			}
+		}
+		if ws.disabled {
+			ws.peer.close()
 		}
 		return err
 	}
-	err = ws.peer.receiveChunk(&pp.Message{
-		Type:  pp.Piece,
-		Index: r.Index,
-		Begin: r.Begin,
-		Piece: result.Bytes,
-	})
-	if err != nil {
-		panic(err)
+	ws.onRequestSuccess()
+	for _, r := range rs {
+		err = ws.peer.receiveChunk(&pp.Message{
+			Type:  pp.Piece,
+			Index: r.Index,
+			Begin: r.Begin,
+			Piece: result.Bytes[:r.Length],
+		})
+		if err != nil {
+			// The request may have been cancelled while we were waiting for the result, such as if
+			// the piece was completed from another peer.
+			ws.peer.logger.Levelf(log.Debug, "error receiving webseed chunk %v: %v", r, err)
+		}
+		result.Bytes = result.Bytes[r.Length:]
 	}
-	return err
+	return nil
 }
 
 func (me *webseedPeer) peerPieces() *roaring.Bitmap {
@@ -0,0 +1,245 @@
+package torrent
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/anacrolix/torrent/internal/testutil"
+	"github.com/anacrolix/torrent/metainfo"
+	"github.com/anacrolix/torrent/webseed"
+)
+
+// Serves the greeting torrent's data for webseeds. Requests are passed to handle first, which
+// returns true if it responded.
+func newGreetingWebseedServer(t *testing.T, handle func(http.ResponseWriter, *http.Request) bool) *httptest.Server {
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handle != nil && handle(w, r) {
+			return
+		}
+		http.ServeContent(w, r, testutil.GreetingFileName, time.Time{}, strings.NewReader(testutil.GreetingFileContents))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Adds the greeting torrent with the webseed, and waits for it to download.
+func downloadGreetingFromWebseed(c *qt.C, cl *Client, url string) *Torrent {
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	tt.AddWebSeeds([]string{url})
+	tt.VerifyData()
+	tt.DownloadAll()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c.Assert(tt.Wait(ctx), qt.IsNil)
+	return tt
+}
+
+// A single file torrent of four chunks, in pieces of two chunks.
+func newFourChunkTestTorrent() (*metainfo.MetaInfo, string) {
+	data := strings.Repeat("abcdefgh", 4*defaultChunkSize/8)
+	tt := testutil.Torrent{
+		Name:  "data",
+		Files: []testutil.File{{Data: data}},
+	}
+	return tt.Metainfo(2 * defaultChunkSize), data
+}
+
+func TestWebseedCoalesceRequests(t *testing.T) {
+	c := qt.New(t)
+	cl := newTestingClient(t)
+	mi, _ := newFourChunkTestTorrent()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	ws := &webseedPeer{
+		peer:              Peer{t: tt},
+		activeRequests:    make(map[Request]webseed.Request),
+		maxCoalescedBytes: 3 * defaultChunkSize,
+	}
+	ws.peer.initRequestState()
+	indexes := func(rs []Request) (ret []RequestIndex) {
+		for _, r := range rs {
+			ret = append(ret, tt.requestIndexFromRequest(r))
+		}
+		return
+	}
+	// Requests aren't merged if the chunks between them aren't requested.
+	ws.peer.requestState.Requests.Add(0)
+	ws.peer.requestState.Requests.Add(2)
+	c.Check(indexes(ws.coalesceRequests(0)), qt.DeepEquals, []RequestIndex{0})
+	c.Check(indexes(ws.coalesceRequests(2)), qt.DeepEquals, []RequestIndex{2})
+	// Requests are merged across pieces, and in both directions, up to the byte limit.
+	ws.peer.requestState.Requests.Add(1)
+	ws.peer.requestState.Requests.Add(3)
+	c.Check(indexes(ws.coalesceRequests(0)), qt.DeepEquals, []RequestIndex{0, 1, 2})
+	c.Check(indexes(ws.coalesceRequests(2)), qt.DeepEquals, []RequestIndex{0, 1, 2})
+	c.Check(indexes(ws.coalesceRequests(3)), qt.DeepEquals, []RequestIndex{1, 2, 3})
+	// Requests already being made aren't merged.
+	ws.activeRequests[tt.requestIndexToRequest(2)] = webseed.Request{}
+	c.Check(indexes(ws.coalesceRequests(0)), qt.DeepEquals, []RequestIndex{0, 1})
+	c.Check(indexes(ws.coalesceRequests(3)), qt.DeepEquals, []RequestIndex{3})
+	// A limit less than the chunk size disables coalescing.
+	ws.maxCoalescedBytes = 1
+	c.Check(indexes(ws.coalesceRequests(0)), qt.DeepEquals, []RequestIndex{0})
+}
+
+// Coalesced requests are made as single ranged HTTP requests, and the responses are split back into
+// the chunks that were requested.
+func TestWebseedCoalescedDownload(t *testing.T) {
+	c := qt.New(t)
+	mi, data := newFourChunkTestTorrent()
+	var (
+		mu     sync.Mutex
+		ranges []string
+	)
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		mu.Unlock()
+		http.ServeContent(w, r, "data", time.Time{}, strings.NewReader(data))
+	}))
+	defer s.Close()
+	cfg := TestingConfig(t)
+	cfg.WebseedMaxCoalescedBytes = 2 * defaultChunkSize
+	// A single requester makes the HTTP requests deterministic.
+	cfg.WebseedMaxRequests = 1
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	defer cl.Close()
+	tt, err := cl.AddTorrent(mi)
+	c.Assert(err, qt.IsNil)
+	tt.AddWebSeeds([]string{s.URL})
+	cl.lock()
+	// Skip the slow start, so that all the chunks are requested at once.
+	tt.webSeeds[s.URL].peakRequests = 4
+	cl.unlock()
+	tt.VerifyData()
+	tt.DownloadAll()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	c.Assert(tt.Wait(ctx), qt.IsNil)
+	// The data passed hash checks, so the responses were split correctly.
+	c.Check(tt.BytesMissing(), qt.Equals, int64(0))
+	mu.Lock()
+	defer mu.Unlock()
+	c.Check(ranges, qt.ContentEquals, []string{
+		fmt.Sprintf("bytes=0-%d", 2*defaultChunkSize-1),
+		fmt.Sprintf("bytes=%d-%d", 2*defaultChunkSize, 4*defaultChunkSize-1),
+	})
+}
+
+// A Clock that skips ahead by the duration passed to After, so that backoffs end immediately. The
+// durations waited are recorded.
+type skippingClock struct {
+	mu    sync.Mutex
+	now   time.Time
+	waits []time.Duration
+}
+
+func (me *skippingClock) Now() time.Time {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return me.now
+}
+
+func (me *skippingClock) AfterFunc(d time.Duration, f func()) ClockTimer {
+	// Never fires, like fakeClock.
+	return time.AfterFunc(time.Duration(1<<63-1), f)
+}
+
+func (me *skippingClock) After(d time.Duration) <-chan time.Time {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	me.now = me.now.Add(d)
+	me.waits = append(me.waits, d)
+	ch := make(chan time.Time, 1)
+	ch <- me.now
+	return ch
+}
+
+func (me *skippingClock) Waits() []time.Duration {
+	me.mu.Lock()
+	defer me.mu.Unlock()
+	return append([]time.Duration(nil), me.waits...)
+}
+
+// Returns a Client using clock, with a single webseed requester so that requests are made one at a
+// time.
+func newWebseedBackoffTestClient(c *qt.C, clock Clock) *Client {
+	cfg := TestingConfig(c.TB)
+	cfg.Clock = clock
+	cfg.WebseedMaxRequests = 1
+	cl, err := NewClient(cfg)
+	c.Assert(err, qt.IsNil)
+	c.Cleanup(func() { cl.Close() })
+	return cl
+}
+
+func TestWebseedBackoff(t *testing.T) {
+	c := qt.New(t)
+	var requests atomic.Int32
+	s := newGreetingWebseedServer(t, func(w http.ResponseWriter, r *http.Request) bool {
+		switch requests.Add(1) {
+		case 1, 2:
+			http.Error(w, "oops", http.StatusInternalServerError)
+			return true
+		case 3:
+			w.Header().Set("Retry-After", "60")
+			http.Error(w, "slow down", http.StatusServiceUnavailable)
+			return true
+		}
+		return false
+	})
+	clock := &skippingClock{now: time.Unix(1000, 0)}
+	cl := newWebseedBackoffTestClient(c, clock)
+	tt := downloadGreetingFromWebseed(c, cl, s.URL)
+	// The backoff doubles after each consecutive error, and Retry-After extends it. Up to a second
+	// is added to spread out requesters.
+	waits := clock.Waits()
+	c.Assert(waits, qt.HasLen, 3)
+	for i, min := range []time.Duration{5 * time.Second, 10 * time.Second, time.Minute} {
+		c.Check(waits[i] >= min && waits[i] < min+time.Second, qt.IsTrue, qt.Commentf("wait %v: %v", i, waits[i]))
+	}
+	stats := tt.Stats().Webseeds
+	c.Assert(stats, qt.HasLen, 1)
+	c.Check(stats[0].ConsecutiveErrors, qt.Equals, 0)
+	c.Check(stats[0].TotalErrors, qt.Equals, int64(3))
+	c.Check(stats[0].LastError, qt.Contains, webseed.ErrTooFast.Error())
+	c.Check(stats[0].BackoffUntil.IsZero(), qt.IsTrue)
+	c.Check(stats[0].Disabled, qt.IsFalse)
+}
+
+func TestWebseedDisabledAfterNotFound(t *testing.T) {
+	c := qt.New(t)
+	var requests atomic.Int32
+	s := newGreetingWebseedServer(t, func(w http.ResponseWriter, r *http.Request) bool {
+		requests.Add(1)
+		http.NotFound(w, r)
+		return true
+	})
+	cl := newWebseedBackoffTestClient(c, &skippingClock{now: time.Unix(1000, 0)})
+	tt, err := cl.AddTorrent(testutil.GreetingMetaInfo())
+	c.Assert(err, qt.IsNil)
+	tt.AddWebSeeds([]string{s.URL})
+	tt.DownloadAll()
+	ws := tt.webSeeds[s.URL]
+	select {
+	case <-ws.closed.Done():
+	case <-time.After(10 * time.Second):
+		c.Fatal("webseed wasn't closed")
+	}
+	c.Check(requests.Load(), qt.Equals, int32(webseedPeerMaxNotFound))
+	stats := tt.Stats().Webseeds
+	c.Assert(stats, qt.HasLen, 1)
+	c.Check(stats[0].Disabled, qt.IsTrue)
+	c.Check(stats[0].ConsecutiveErrors, qt.Equals, webseedPeerMaxNotFound)
+}
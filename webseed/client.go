@@ -8,7 +8,9 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/RoaringBitmap/roaring"
 
@@ -54,6 +56,12 @@ type Client struct {
 	Pieces              roaring.Bitmap
 	ResponseBodyWrapper ResponseBodyWrapper
 	PathEscaper         PathEscaper
+	// Set on requests if not empty.
+	UserAgent string
+	// Extra headers to add to requests, such as for authentication.
+	Header http.Header
+	// Modifies requests before they're sent.
+	RequestDirector func(*http.Request) error
 }
 
 type ResponseBodyWrapper func(io.Reader) io.Reader
@@ -86,6 +94,7 @@ func (ws *Client) NewRequest(r RequestSpec) Request {
 		if err != nil {
 			panic(err)
 		}
+		directErr := ws.direct(req)
 		part := requestPart{
 			req:                 req,
 			result:              make(chan requestPartResult, 1),
@@ -93,6 +102,10 @@ func (ws *Client) NewRequest(r RequestSpec) Request {
 			responseBodyWrapper: ws.ResponseBodyWrapper,
 		}
 		part.start = func() {
+			if directErr != nil {
+				part.result <- requestPartResult{err: fmt.Errorf("modifying request: %w", directErr)}
+				return
+			}
 			go func() {
 				resp, err := ws.HttpClient.Do(req)
 				part.result <- requestPartResult{
@@ -120,15 +133,61 @@ func (ws *Client) NewRequest(r RequestSpec) Request {
 	return req
 }
 
+func (ws *Client) direct(req *http.Request) error {
+	if ws.UserAgent != "" {
+		req.Header.Set("User-Agent", ws.UserAgent)
+	}
+	for k, vs := range ws.Header {
+		req.Header[k] = append(req.Header[k], vs...)
+	}
+	if ws.RequestDirector != nil {
+		return ws.RequestDirector(req)
+	}
+	return nil
+}
+
 type ErrBadResponse struct {
 	Msg      string
 	Response *http.Response
+	// An underlying error, such as ErrTooFast.
+	Err error
 }
 
 func (me ErrBadResponse) Error() string {
 	return me.Msg
 }
 
+func (me ErrBadResponse) Unwrap() error {
+	return me.Err
+}
+
+// Returns the delay requested by the server in a Retry-After header, if any.
+func (me ErrBadResponse) RetryAfter() (d time.Duration, ok bool) {
+	if me.Response == nil {
+		return
+	}
+	return parseRetryAfter(me.Response.Header.Get("Retry-After"), time.Now())
+}
+
+// Parses a Retry-After header value, which is either delay-seconds or an HTTP-date.
+func parseRetryAfter(s string, now time.Time) (d time.Duration, ok bool) {
+	if s == "" {
+		return
+	}
+	if secs, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return time.Duration(secs) * time.Second, true
+	}
+	t, err := http.ParseTime(s)
+	if err != nil {
+		return
+	}
+	d = t.Sub(now)
+	if d < 0 {
+		d = 0
+	}
+	return d, true
+}
+
 func recvPartResult(ctx context.Context, buf io.Writer, part requestPart) error {
 	result := <-part.result
 	// Make sure there's no further results coming, it should be a one-shot channel.
@@ -178,14 +237,15 @@ func recvPartResult(ctx context.Context, buf io.Writer, part requestPart) error
 			_, err := io.CopyN(buf, body, part.e.Length)
 			return err
 		} else {
-			return ErrBadResponse{"resp status ok but requested range", result.resp}
+			return ErrBadResponse{Msg: "resp status ok but requested range", Response: result.resp}
 		}
 	case http.StatusServiceUnavailable:
-		return ErrTooFast
+		// Retain the response so that any Retry-After can be honoured.
+		return ErrBadResponse{ErrTooFast.Error(), result.resp, ErrTooFast}
 	default:
 		return ErrBadResponse{
-			fmt.Sprintf("unhandled response status code (%v)", result.resp.StatusCode),
-			result.resp,
+			Msg:      fmt.Sprintf("unhandled response status code (%v)", result.resp.StatusCode),
+			Response: result.resp,
 		}
 	}
 }
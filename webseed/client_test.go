@@ -0,0 +1,27 @@
+package webseed
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	c := qt.New(t)
+	now := time.Date(2015, 10, 21, 7, 28, 0, 0, time.UTC)
+	d, ok := parseRetryAfter("120", now)
+	c.Check(ok, qt.IsTrue)
+	c.Check(d, qt.Equals, 2*time.Minute)
+	d, ok = parseRetryAfter(now.Add(time.Hour).Format(http.TimeFormat), now)
+	c.Check(ok, qt.IsTrue)
+	c.Check(d, qt.Equals, time.Hour)
+	d, ok = parseRetryAfter(now.Add(-time.Hour).Format(http.TimeFormat), now)
+	c.Check(ok, qt.IsTrue)
+	c.Check(d, qt.Equals, time.Duration(0))
+	_, ok = parseRetryAfter("", now)
+	c.Check(ok, qt.IsFalse)
+	_, ok = parseRetryAfter("soon", now)
+	c.Check(ok, qt.IsFalse)
+}
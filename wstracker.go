@@ -46,6 +46,15 @@ type websocketTrackers struct {
 	DialContext                func(ctx context.Context, network, addr string) (net.Conn, error)
 	WebsocketTrackerHttpHeader func() netHttp.Header
 	ICEServers                 []string
+	// Hides secrets in tracker URLs before they're logged. See ClientConfig.TrackerRedactor.
+	Redact func(string) string
+}
+
+func (me *websocketTrackers) redact(s string) string {
+	if me.Redact == nil {
+		return s
+	}
+	return me.Redact(s)
 }
 
 func (me *websocketTrackers) Get(url string, infoHash [20]byte) (*webtorrent.TrackerClient, func()) {
@@ -62,7 +71,7 @@ func (me *websocketTrackers) Get(url string, infoHash [20]byte) (*webtorrent.Tra
 				PeerId:             me.PeerId,
 				OnConn:             me.OnConn,
 				Logger: me.Logger.WithText(func(m log.Msg) string {
-					return fmt.Sprintf("tracker client for %q: %v", url, m)
+					return me.redact(fmt.Sprintf("tracker client for %q: %v", url, m))
 				}),
 				WebsocketTrackerHttpHeader: me.WebsocketTrackerHttpHeader,
 				ICEServers:                 me.ICEServers,
@@ -70,7 +79,7 @@ func (me *websocketTrackers) Get(url string, infoHash [20]byte) (*webtorrent.Tra
 		}
 		value.TrackerClient.Start(func(err error) {
 			if err != nil {
-				me.Logger.Printf("error running tracker client for %q: %v", url, err)
+				me.Logger.Printf("%s", me.redact(fmt.Sprintf("error running tracker client for %q: %v", url, err)))
 			}
 		})
 		if me.clients == nil {